@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"goplow/internal/server"
+)
+
+// configFlags lists the config settings that can be overridden with a flag,
+// with their usage; the flag name is the key with hyphens (data_dir is -data-dir)
+var configFlags = map[string]string{
+	"port":     "Server port, overriding the config file",
+	"host":     "Server host to bind to, overriding the config file",
+	"data_dir": "Directory for persisted state, overriding the config file",
+}
+
+// addConfigFlags registers the config override flags on fs
+// The returned function lists the flags that were set, keyed by config key
+func addConfigFlags(fs *flag.FlagSet) func() map[string]string {
+	for key, usage := range configFlags {
+		fs.String(strings.ReplaceAll(key, "_", "-"), "", usage)
+	}
+
+	return func() map[string]string {
+		overrides := make(map[string]string)
+		fs.Visit(func(f *flag.Flag) {
+			key := strings.ReplaceAll(f.Name, "-", "_")
+			if _, ok := configFlags[key]; ok {
+				overrides[key] = f.Value.String()
+			}
+		})
+		return overrides
+	}
+}
+
+// runConfig handles the config subcommands
+// Usage: goplow config show [-e env]
+func runConfig(args []string) {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintf(os.Stderr, "Usage: goplow config show [flags]\n")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	environment := fs.String("env", "", "Environment configuration to resolve")
+	fs.StringVar(environment, "e", "", "Environment configuration to resolve (shorthand)")
+	overrides := addConfigFlags(fs)
+	container := addContainerFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: goplow config show [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Print the resolved configuration, after defaults, environment inheritance,\n")
+		fmt.Fprintf(fs.Output(), "GOPLOW_* environment variables and flags, with the source of each value.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+
+	config, sources, err := loadConfig(*environment, *container, overrides())
+	if err != nil {
+		log.Fatalf("Error loading config: %v\n", err)
+	}
+
+	if err := printSettings(config.Settings(sources)); err != nil {
+		log.Fatalf("Error printing config: %v\n", err)
+	}
+}
+
+// printSettings prints settings as TOML, commenting each with its source
+// Tables are printed last so the output stays valid TOML
+func printSettings(settings []server.ConfigSetting) error {
+	var tables []server.ConfigSetting
+	for _, setting := range settings {
+		source := server.ConfigSource{Kind: setting.Source, Origin: setting.Origin}
+		line, err := encodeSetting(setting)
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			line = "# " + setting.Key + " is not set"
+		} else if isTableList(setting.Value) {
+			tables = append(tables, setting)
+			continue
+		}
+		fmt.Printf("%-50s # %s\n", line, source)
+	}
+
+	for _, setting := range tables {
+		source := server.ConfigSource{Kind: setting.Source, Origin: setting.Origin}
+		fmt.Printf("\n# %s: %s\n", setting.Key, source)
+		table, err := encodeSetting(setting)
+		if err != nil {
+			return err
+		}
+		fmt.Println(table)
+	}
+	return nil
+}
+
+// encodeSetting encodes a single setting as TOML, or "" for an empty list
+func encodeSetting(setting server.ConfigSetting) (string, error) {
+	var builder strings.Builder
+	err := toml.NewEncoder(&builder).Encode(map[string]interface{}{setting.Key: setting.Value})
+	return strings.TrimSuffix(builder.String(), "\n"), err
+}
+
+// isTableList reports whether a setting is a list of tables (e.g. endpoints)
+func isTableList(value interface{}) bool {
+	switch value.(type) {
+	case []server.EndpointConfig, []server.SamplingRule, []server.TransformRule:
+		return true
+	}
+	return false
+}
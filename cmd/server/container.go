@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"goplow/internal/handlers"
+	"goplow/internal/server"
+)
+
+// containerDrainTimeout bounds graceful shutdown in container mode, well inside
+// the usual stop grace period
+const containerDrainTimeout = 2 * time.Second
+
+// addContainerFlag registers -container on fs, defaulting to $GOPLOW_CONTAINER
+func addContainerFlag(fs *flag.FlagSet) *bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("GOPLOW_CONTAINER"))
+	return fs.Bool("container", enabled, "Container mode: env-only config, host 0.0.0.0, JSON logs, no browser (or set GOPLOW_CONTAINER=true)")
+}
+
+// loadConfig loads the configuration for the server, from GOPLOW_* environment
+// variables and flags only in container mode
+func loadConfig(environment string, container bool, overrides map[string]string) (server.EnvironmentConfig, server.ConfigSources, error) {
+	if container {
+		return server.LoadContainerConfig(overrides)
+	}
+	return server.LoadConfig("goplow.toml", environment, overrides)
+}
+
+// useJSONLogs writes every log line as a JSON object, for container log collectors
+func useJSONLogs() {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+}
+
+// runHealthcheck checks the local server's health route, exiting non-zero if it
+// is not healthy, for images without curl
+// Usage: goplow healthcheck [-port 8081]
+func runHealthcheck(args []string) {
+	fs := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	port := fs.String("port", os.Getenv("GOPLOW_PORT"), "Server port (defaults to $GOPLOW_PORT, then 8081)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: goplow healthcheck [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Exit with status 0 if the local server is healthy, or 1 if not.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *port == "" {
+		*port = "8081"
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get("http://" + net.JoinHostPort("127.0.0.1", *port) + handlers.HealthPath)
+	if err != nil {
+		log.Fatalf("Health check failed: %v\n", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("Health check failed: status %d\n", resp.StatusCode)
+	}
+}
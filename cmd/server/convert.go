@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"goplow/internal/export"
+	"goplow/internal/server"
+	"goplow/internal/thrift"
+)
+
+// convertFromThrift is the input format for Snowplow collector payloads
+const convertFromThrift = "thrift"
+
+// convertInputs lists the formats goplow convert can read
+var convertInputs = []string{export.FormatEnrichedTSV, convertFromThrift, export.FormatNDJSON, export.FormatSDKJSON}
+
+// convertExtensions guesses a format from a file extension when -from or -to is omitted
+var convertExtensions = map[string]string{
+	".tsv":     export.FormatEnrichedTSV,
+	".thrift":  convertFromThrift,
+	".ndjson":  export.FormatNDJSON,
+	".jsonl":   export.FormatNDJSON,
+	".parquet": export.FormatParquet,
+	".csv":     export.FormatAtomicCSV,
+}
+
+// runConvert converts captured events between Snowplow data formats
+// Usage: goplow convert [-from format] [-to format] [in] [out]
+func runConvert(args []string) {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	from := fs.String("from", "", "Input format: "+strings.Join(convertInputs, ", ")+" (guessed from the file extension if omitted)")
+	to := fs.String("to", "", "Output format: "+strings.Join(export.Formats, ", ")+" (guessed from the file extension if omitted)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: goplow convert [flags] [in] [out]\n\n")
+		fmt.Fprintf(fs.Output(), "Convert events between Snowplow data formats, one tracker event per record.\n")
+		fmt.Fprintf(fs.Output(), "Reads stdin and writes stdout when in or out is omitted or \"-\".\n")
+		fmt.Fprintf(fs.Output(), "Thrift input holds collector payloads, binary or one base64 record per line.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	input, output := fs.Arg(0), fs.Arg(1)
+
+	inputFormat := convertFormat(*from, input, export.FormatNDJSON)
+	if !isConvertInput(inputFormat) {
+		log.Fatalf("Unknown input format %q, expected one of %s\n", inputFormat, strings.Join(convertInputs, ", "))
+	}
+	outputFormat, err := export.ParseFormat(convertFormat(*to, output, export.FormatNDJSON))
+	if err != nil {
+		log.Fatalf("Unknown output format: %v\n", err)
+	}
+
+	in := io.Reader(os.Stdin)
+	if input != "" && input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			log.Fatalf("Error opening %s: %v\n", input, err)
+		}
+		defer file.Close()
+		in = file
+	}
+
+	events, err := readConvertInput(bufio.NewReader(in), inputFormat)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v\n", inputFormat, err)
+	}
+
+	out := io.Writer(os.Stdout)
+	if output != "" && output != "-" {
+		file, err := os.Create(output)
+		if err != nil {
+			log.Fatalf("Error creating %s: %v\n", output, err)
+		}
+		defer file.Close()
+		out = file
+	}
+	writer := bufio.NewWriter(out)
+	if err := export.Write(writer, outputFormat, events, export.Options{}); err != nil {
+		log.Fatalf("Error writing %s: %v\n", outputFormat, err)
+	}
+	if err := writer.Flush(); err != nil {
+		log.Fatalf("Error writing %s: %v\n", outputFormat, err)
+	}
+	if output != "" && output != "-" {
+		fmt.Fprintf(os.Stderr, "Converted %d events from %s to %s\n", len(events), inputFormat, outputFormat)
+	}
+}
+
+// convertFormat returns the named format, or guesses one from the path
+func convertFormat(name string, path string, fallback string) string {
+	if name != "" {
+		return name
+	}
+	if format, ok := convertExtensions[strings.ToLower(filepath.Ext(path))]; ok {
+		return format
+	}
+	return fallback
+}
+
+// isConvertInput reports whether goplow convert can read a format
+func isConvertInput(format string) bool {
+	for _, input := range convertInputs {
+		if input == format {
+			return true
+		}
+	}
+	return false
+}
+
+// readConvertInput reads events in the given format, numbering them in order
+// when the format carries no goplow IDs
+func readConvertInput(r io.Reader, format string) ([]server.Event, error) {
+	var events []server.Event
+	switch format {
+	case export.FormatNDJSON:
+		decoder := json.NewDecoder(r)
+		for {
+			var event server.Event
+			if err := decoder.Decode(&event); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("event %d: %w", len(events)+1, err)
+			}
+			events = append(events, event)
+		}
+	case convertFromThrift:
+		payloads, err := thrift.ReadCollectorPayloads(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, payload := range payloads {
+			payloadEvents, err := collectorPayloadEvents(payload)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, payloadEvents...)
+		}
+	default:
+		read := export.ReadEnrichedTSV
+		if format == export.FormatSDKJSON {
+			read = export.ReadSDKJSON
+		}
+		records, err := read(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			events = append(events, record.Event())
+		}
+	}
+
+	for i := range events {
+		if events[i].ID == 0 {
+			events[i].ID = i + 1
+		}
+	}
+	return events, nil
+}
+
+// collectorPayloadEvents splits a collector payload into one event per tracker
+// event, with the collector-side fields goplow records on ingest
+func collectorPayloadEvents(payload thrift.CollectorPayload) ([]server.Event, error) {
+	schema := "iglu:com.snowplowanalytics.snowplow/payload_data/jsonschema/1-0-4"
+	var items []map[string]interface{}
+
+	if payload.Querystring != "" {
+		query, err := url.ParseQuery(payload.Querystring)
+		if err != nil {
+			return nil, fmt.Errorf("invalid querystring: %w", err)
+		}
+		item := make(map[string]interface{})
+		for key, values := range query {
+			item[key] = values[0]
+		}
+		items = append(items, item)
+	}
+	if payload.Body != "" {
+		var body struct {
+			Schema string                   `json:"schema"`
+			Data   []map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(payload.Body), &body); err != nil {
+			return nil, fmt.Errorf("invalid body: %w", err)
+		}
+		if body.Schema != "" {
+			schema = body.Schema
+		}
+		items = append(items, body.Data...)
+	}
+
+	received := time.UnixMilli(payload.Timestamp)
+	events := make([]server.Event, 0, len(items))
+	for _, item := range items {
+		enriched := map[string]interface{}{"user_ipaddress": payload.IPAddress}
+		if ip, ok := item["ip"].(string); ok && ip != "" {
+			enriched["user_ipaddress"] = ip
+		}
+		userAgent := payload.UserAgent
+		if ua, ok := item["ua"].(string); ok && ua != "" {
+			userAgent = ua
+		}
+		if userAgent != "" {
+			enriched["useragent"] = userAgent
+		}
+		if payload.NetworkUserID != "" {
+			enriched["network_userid"] = payload.NetworkUserID
+		}
+		events = append(events, server.Event{
+			Schema:     schema,
+			Data:       []map[string]interface{}{item},
+			Timestamp:  received,
+			ReceivedAt: received,
+			Namespace:  payload.Path,
+			Enriched:   enriched,
+		})
+	}
+	return events, nil
+}
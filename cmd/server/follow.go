@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"goplow/internal/follow"
+	"goplow/internal/server"
+)
+
+// runFollow runs a local server that mirrors events from a remote goplow instance
+// Usage: goplow follow [-e env] http://staging-goplow:8081
+func runFollow(args []string) {
+	fs := flag.NewFlagSet("follow", flag.ExitOnError)
+	environment := fs.String("env", "", "Environment configuration to use for the local server")
+	fs.StringVar(environment, "e", "", "Environment configuration to use (shorthand)")
+	overrides := addConfigFlags(fs)
+	container := addContainerFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: goplow follow [flags] <remote-url>\n\n")
+		fmt.Fprintf(fs.Output(), "Mirror events from another goplow instance into a local UI.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	remoteURL := fs.Arg(0)
+
+	if *container {
+		useJSONLogs()
+	}
+
+	// Load configuration for the local server
+	config, sources, err := loadConfig(*environment, *container, overrides())
+	if err != nil {
+		log.Fatalf("Error loading config: %v\n", err)
+	}
+
+	appServer := server.New(config)
+	appServer.SetConfigSources(sources)
+
+	// Mirror remote events until shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	go follow.New(remoteURL, appServer, newOutboundClient(config)).Run(ctx)
+
+	serve(appServer, *container, cancel)
+}
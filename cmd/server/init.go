@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// initOptions are the values written into a scaffolded config file
+type initOptions struct {
+	Port           int
+	Host           string
+	MaxMessages    int
+	EventsEndpoint string
+	AllowedOrigins string
+}
+
+// configTemplate is the commented goplow.toml written by goplow init
+var configTemplate = template.Must(template.New("goplow.toml").Parse(`# goplow configuration
+# Run with an environment using: goplow -e <name>
+# Print the resolved configuration with: goplow config show -e <name>
+
+[default]
+# Server port and host to bind to
+port = {{.Port}}
+host = "{{.Host}}"
+
+# Maximum number of events to keep in memory
+max_messages = {{.MaxMessages}}
+
+# Ingest endpoint trackers send events to (registered as /{{.EventsEndpoint}})
+events_endpoint = "{{.EventsEndpoint}}"
+
+# CORS allowed origins for the events API (comma-separated list)
+allowed_origins = "{{.AllowedOrigins}}"
+
+# Reject schema-invalid events with a 422 instead of storing them
+# strict = true
+
+# Directory for persisted state (defaults to $XDG_DATA_HOME/goplow or ~/.local/share/goplow)
+# data_dir = "./goplow-data"
+
+# Clear the buffer after this long without any new events
+# clear_after_idle = "10m"
+
+# Keep one page ping in every 10
+# [[default.sampling]]
+# event_type = "pp"
+# keep_one_in = 10
+
+# Extra ingest endpoint, shown exactly as received
+# [[default.endpoints]]
+# path = "com.snowplowanalytics.iglu/v1"
+# transformers = ["raw"]
+
+# Webhook endpoint accepting any JSON payload, with GitHub style signature checks
+# [[default.endpoints]]
+# path = "webhooks/github"
+# adapter = "webhook"
+# schema = "iglu:com.github/push/jsonschema/1-0-0"
+# signature_secret = "change-me"
+
+# Example environment: only list the values that change
+[dev]
+port = {{.DevPort}}
+max_messages = 1000
+
+# Example environment inheriting from dev
+[ci]
+extends = "dev"
+strict = true
+`))
+
+// runInit writes a commented starter config file
+// Usage: goplow init [-port 8081] [-endpoint com.acme/events] [-y] [-force]
+func runInit(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	output := fs.String("o", "goplow.toml", "Path of the config file to write")
+	port := fs.Int("port", 8081, "Server port")
+	host := fs.String("host", "localhost", "Server host to bind to")
+	maxMessages := fs.Int("max-messages", 100, "Maximum number of events to keep in memory")
+	endpoint := fs.String("endpoint", "com.simplybusiness/events", "Ingest endpoint path")
+	origins := fs.String("origins", "http://localhost:3000", "CORS allowed origins (comma-separated)")
+	yes := fs.Bool("y", false, "Accept the flag values without prompting")
+	force := fs.Bool("force", false, "Overwrite an existing config file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: goplow init [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Write a commented goplow.toml with default and example environments.\n")
+		fmt.Fprintf(fs.Output(), "Prompts for the main settings when run in a terminal, unless -y is given.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if _, err := os.Stat(*output); err == nil && !*force {
+		log.Fatalf("%s already exists; use -force to overwrite it\n", *output)
+	}
+
+	options := initOptions{
+		Port:           *port,
+		Host:           *host,
+		MaxMessages:    *maxMessages,
+		EventsEndpoint: strings.Trim(*endpoint, "/"),
+		AllowedOrigins: *origins,
+	}
+
+	if !*yes && isTerminal(os.Stdin) {
+		reader := bufio.NewReader(os.Stdin)
+		options.Port = promptInt(reader, "Port", options.Port)
+		options.EventsEndpoint = strings.Trim(promptString(reader, "Ingest endpoint", options.EventsEndpoint), "/")
+		options.AllowedOrigins = promptString(reader, "Allowed origins", options.AllowedOrigins)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		log.Fatalf("Error creating %s: %v\n", *output, err)
+	}
+	defer file.Close()
+
+	err = configTemplate.Execute(file, struct {
+		initOptions
+		DevPort int
+	}{options, options.Port + 1})
+	if err != nil {
+		log.Fatalf("Error writing %s: %v\n", *output, err)
+	}
+	fmt.Printf("Wrote %s\n", *output)
+}
+
+// isTerminal reports whether the file is an interactive terminal
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// promptString asks for a value, returning the default on an empty answer
+func promptString(reader *bufio.Reader, label string, defaultValue string) string {
+	fmt.Printf("%s [%s]: ", label, defaultValue)
+	answer, _ := reader.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer
+	}
+	return defaultValue
+}
+
+// promptInt asks for a number, re-asking until the answer is valid
+func promptInt(reader *bufio.Reader, label string, defaultValue int) int {
+	for {
+		answer := promptString(reader, label, strconv.Itoa(defaultValue))
+		if value, err := strconv.Atoi(answer); err == nil {
+			return value
+		}
+		fmt.Printf("%q is not a number\n", answer)
+	}
+}
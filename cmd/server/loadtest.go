@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"time"
+
+	"goplow/internal/replay"
+	"goplow/internal/server"
+)
+
+// runLoadtest fires synthetic tracker payloads at a collector and reports how
+// many were accepted and how quickly
+// Usage: goplow loadtest [-target url] [-rate 5000] [-duration 60s]
+func runLoadtest(args []string) {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	environment := fs.String("env", "", "Environment configuration used to find the local server when -target is omitted")
+	fs.StringVar(environment, "e", "", "Environment configuration to use (shorthand)")
+	target := fs.String("target", "", "Collector URL to load (defaults to the local goplow events endpoint)")
+	rate := fs.Float64("rate", 100, "Requests started per second")
+	duration := fs.Duration("duration", 10*time.Second, "How long to keep starting requests")
+	concurrency := fs.Int("concurrency", 64, "Maximum requests in flight; requests due beyond this are skipped")
+	batch := fs.Int("batch", 1, "Tracker events in each request")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for each request")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: goplow loadtest [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Send synthetic page views, page pings and structured events at a fixed rate\n")
+		fmt.Fprintf(fs.Output(), "and report the accept rate and latency percentiles.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if *target == "" {
+		config, _, err := loadConfig(*environment, false, nil)
+		if err != nil {
+			log.Fatalf("Error loading config: %v\n", err)
+		}
+		endpoint := config.EventsEndpoint
+		if endpoint == "" {
+			endpoint = "com.simplybusiness/events"
+		}
+		basePath := server.NormalizeEndpointPath(config.BasePath)
+		if basePath == "/" {
+			basePath = ""
+		}
+		*target = "http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(config.Port)) + basePath + server.NormalizeEndpointPath(endpoint)
+	}
+	targetURL, err := replay.TargetURL(*target)
+	if err != nil {
+		log.Fatalf("Invalid target: %v\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "Sending %g requests/s of %d events to %s for %s\n", *rate, *batch, targetURL, *duration)
+
+	// Stop early on Ctrl+C, still reporting what was sent
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := replay.LoadTest(ctx, replay.LoadOptions{
+		Target:      *target,
+		Rate:        *rate,
+		Duration:    *duration,
+		Concurrency: *concurrency,
+		Batch:       *batch,
+		Timeout:     *timeout,
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Fatalf("Load test failed: %v\n", err)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Load test interrupted: %v\n", err)
+	}
+
+	seconds := report.Duration.Seconds()
+	fmt.Printf("Sent %d requests (%d events) in %s, %.1f requests/s\n",
+		report.Sent, report.Sent**batch, report.Duration.Round(time.Millisecond), float64(report.Sent)/seconds)
+	fmt.Printf("  accepted: %d (%.2f%%)\n", report.Accepted, report.AcceptRate()*100)
+	fmt.Printf("  rejected: %d\n", report.Rejected)
+	fmt.Printf("  errors:   %d\n", report.Errors)
+	fmt.Printf("  skipped:  %d (concurrency limit reached)\n", report.Skipped)
+
+	statuses := make([]int, 0, len(report.Statuses))
+	for status := range report.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	fmt.Printf("Statuses:\n")
+	for _, status := range statuses {
+		label := fmt.Sprint(status)
+		if status == 0 {
+			label = "no response"
+		}
+		fmt.Printf("  %s: %d\n", label, report.Statuses[status])
+	}
+
+	if len(report.Latency) > 0 {
+		fmt.Printf("Latency:\n")
+		for _, key := range []string{"p50", "p90", "p99", "max"} {
+			fmt.Printf("  %s: %s\n", key, report.Latency[key].Round(10*time.Microsecond))
+		}
+	}
+	if report.Accepted < report.Sent || report.Skipped > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,3 +1,24 @@
+// Command goplow runs a local Snowplow-compatible collector with a live event viewer.
+//
+// Usage:
+//
+//	goplow [-e env] [-port 8081] [-host localhost] [-data-dir dir] [-container]
+//	goplow init [flags]              write a commented goplow.toml
+//	goplow config show [-e env]      print the effective configuration
+//	goplow follow <remote-url>       mirror another instance's events
+//	goplow healthcheck [-port n]     exit 0 if the local server is healthy
+//	goplow convert [flags] in out    convert between Snowplow data formats
+//	goplow replay -target url file   re-send captured events to a collector
+//	goplow loadtest [-rate n]        benchmark a collector with synthetic events
+//	goplow quality [-min n]          print the data-quality score for CI
+//
+// In container mode (-container or GOPLOW_CONTAINER=true) goplow reads its
+// settings from GOPLOW_* environment variables only, listens on 0.0.0.0, logs
+// JSON, never opens a browser and drains quickly on SIGTERM, so it can be used
+// directly as a container entrypoint:
+//
+//	ENTRYPOINT ["/goplow", "-container"]
+//	HEALTHCHECK CMD ["/goplow", "healthcheck"]
 package main
 
 import (
@@ -9,46 +30,210 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	// Embed the time zone database, so display_timezone works without system zoneinfo
+	_ "time/tzdata"
 
+	"goplow/internal/cluster"
+	"goplow/internal/enrich"
 	"goplow/internal/handlers"
+	"goplow/internal/notify"
+	"goplow/internal/outbound"
+	"goplow/internal/scripting"
 	"goplow/internal/server"
 	"goplow/internal/static"
+	"goplow/internal/validation"
+	"goplow/pkg/backend"
 	"goplow/pkg/browser"
 )
 
 func main() {
+	// Dispatch subcommands before parsing the default flag set
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "follow":
+			runFollow(os.Args[2:])
+			return
+		case "config":
+			runConfig(os.Args[2:])
+			return
+		case "init":
+			runInit(os.Args[2:])
+			return
+		case "healthcheck":
+			runHealthcheck(os.Args[2:])
+			return
+		case "convert":
+			runConvert(os.Args[2:])
+			return
+		case "replay":
+			runReplay(os.Args[2:])
+			return
+		case "loadtest":
+			runLoadtest(os.Args[2:])
+			return
+		case "quality":
+			runQuality(os.Args[2:])
+			return
+		}
+	}
+
 	// Parse command-line flags
 	environment := flag.String("env", "", "Environment configuration to use (e.g., chopin, production)")
 	flag.StringVar(environment, "e", "", "Environment configuration to use (shorthand)")
+	overrides := addConfigFlags(flag.CommandLine)
+	container := addContainerFlag(flag.CommandLine)
 	flag.Parse()
 
+	if *container {
+		useJSONLogs()
+	}
+
 	// Load configuration
-	config, err := server.LoadConfig("goplow.toml", *environment)
+	config, sources, err := loadConfig(*environment, *container, overrides())
 	if err != nil {
 		log.Fatalf("Error loading config: %v\n", err)
 	}
 
 	// Create the application server
 	appServer := server.New(config)
+	appServer.SetConfigSources(sources)
 
-	// Create a new ServeMux for routing
-	mux := http.NewServeMux()
+	serve(appServer, *container, nil)
+}
+
+// newOutboundClient creates the client for requests to other services, with
+// the configured proxy, TLS and retry settings
+func newOutboundClient(config server.EnvironmentConfig) *outbound.Client {
+	client, err := outbound.NewClient(outbound.OptionsFromConfig(config))
+	if err != nil {
+		log.Fatalf("Error configuring outbound requests: %v\n", err)
+	}
+	return client
+}
+
+// serve registers routes, opens the browser and runs the HTTP server until a
+// shutdown signal is received. The optional onShutdown callback runs before
+// the HTTP server is stopped. In container mode the browser is never opened
+// and shutdown drains faster.
+func serve(appServer *server.AppServer, container bool, onShutdown func()) {
+	// Register the configured enrichments
+	if err := enrich.Configure(appServer); err != nil {
+		log.Fatalf("Error configuring enrichments: %v\n", err)
+	}
+
+	// Apply declarative transform rules, then the user's transform script, then
+	// the field dictionary, if configured
+	if rules := appServer.GetConfig().TransformRules; len(rules) > 0 {
+		processor, err := handlers.CompileTransformRules(rules)
+		if err != nil {
+			log.Fatalf("Error compiling transform rules: %v\n", err)
+		}
+		appServer.EventHandlers().AddPostProcessor("rules", processor)
+		log.Printf("Loaded %d transform rules\n", len(rules))
+	}
+	if scriptPath := appServer.GetConfig().TransformScript; scriptPath != "" {
+		script, err := scripting.LoadLuaTransform(scriptPath)
+		if err != nil {
+			log.Fatalf("Error loading transform script: %v\n", err)
+		}
+		script.OnError = func(error) {
+			appServer.CountMetric(server.MetricTransformErrors, "script")
+		}
+		appServer.EventHandlers().AddPostProcessor("script", func(_ map[string]interface{}, transformed map[string]interface{}) map[string]interface{} {
+			return script.Transform(transformed)
+		})
+		log.Printf("Loaded transform script %s\n", scriptPath)
+	}
+	if dictionary := appServer.GetConfig().FieldDictionary; len(dictionary) > 0 {
+		appServer.EventHandlers().AddPostProcessor("dictionary", handlers.CompileFieldDictionary(dictionary))
+		log.Printf("Loaded %d field dictionary entries\n", len(dictionary))
+	}
+
+	if appServer.GetConfig().OutboundInsecureSkipVerify {
+		log.Printf("Warning: TLS certificates are not verified for outbound requests (outbound_insecure_skip_verify); use this for development only\n")
+	}
+
+	// Load the dashboard's label translations, with the user's overrides
+	if err := appServer.LoadLabels(); err != nil {
+		log.Fatalf("Error loading labels: %v\n", err)
+	}
+
+	// Validate self-describing data against the bundled schemas, and record
+	// their versions in capture manifests
+	schemas := static.GetSchemasFS()
+	appServer.SetValidator(validation.New(schemas))
+	appServer.SetSchemaRegistry(schemas)
+
+	// Log an alert for each application error, if a template is configured
+	if alertTemplate := appServer.GetConfig().ErrorAlert; alertTemplate != "" {
+		alert, err := handlers.NewErrorAlert(alertTemplate)
+		if err != nil {
+			log.Fatalf("Error configuring error alert: %v\n", err)
+		}
+		appServer.AddEventListener(alert)
+	}
+
+	// Record admin actions in the data directory
+	if auditPath, err := appServer.GetConfig().DataPath("audit.jsonl"); err != nil {
+		log.Printf("Audit log disabled: %v\n", err)
+	} else {
+		appServer.EnableAuditLog(auditPath)
+	}
+
+	// Persist the event buffer to the configured store, restoring it from the last run
+	if _, err := appServer.OpenConfiguredStore(); err != nil {
+		log.Fatalf("Error opening event store: %v\n", err)
+	}
+
+	// Create a router for the API, ingest endpoints and mounted adapters
+	router := handlers.NewRouter()
 
 	// Register route handlers
-	handlers.RegisterRoutes(mux, appServer)
+	handlers.RegisterRoutes(router, appServer)
 
 	// Register static file routes
-	static.RegisterStaticRoutes(mux)
+	static.RegisterStaticRoutes(router.Group(server.RouteGroupUI))
+
+	// Background tasks run until shutdown
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+
+	// Clear the event buffer on a schedule or when idle, if configured
+	appServer.StartAutoClear(backgroundCtx)
+
+	// Flag sudden spikes and drops in event volume, if configured
+	appServer.StartAnomalyDetection(backgroundCtx)
+
+	// Process tracker events on a worker pool, if configured
+	appServer.StartIngestWorkers()
+
+	// Push events to an aggregator instance and post notifications for matching
+	// events to webhooks and chat services, as configured
+	// Sinks outlive the other background tasks, so queued events can be
+	// delivered while the server drains
+	backend.RegisterSinkFactory(cluster.SinkName, server.SinkFactory(cluster.Sinks).Backend())
+	backend.RegisterSinkFactory("notifications", server.SinkFactory(notify.Sinks).Backend())
+	if err := appServer.OpenSinks(); err != nil {
+		log.Fatalf("Error configuring sinks: %v\n", err)
+	}
+	forwardCtx, stopForwarding := context.WithCancel(context.Background())
+	appServer.RunSinks(forwardCtx)
 
 	// Get server address and URL
 	addr := appServer.GetAddr()
 	url := appServer.GetURL()
 
 	log.Printf("Starting server on %s\n", addr)
-	log.Printf("Opening browser to %s\n", url)
+	for _, lanURL := range appServer.GetLANURLs() {
+		log.Printf("Reachable from other devices at %s\n", lanURL)
+	}
+	if !container {
+		log.Printf("Opening browser to %s\n", url)
+	}
 
 	// Only open browser if not in dev mode (in dev mode, Vite dev server will open)
-	if os.Getenv("GOPLOW_DEV_MODE") != "true" {
+	if container {
+		log.Printf("Container mode: not opening a browser\n")
+	} else if os.Getenv("GOPLOW_DEV_MODE") != "true" {
 		// Open browser in a goroutine to avoid blocking
 		go func() {
 			time.Sleep(500 * time.Millisecond)
@@ -61,10 +246,18 @@ func main() {
 	}
 
 	// Create HTTP server
+	// Resolve forwarded headers first, so the base path and access lists see
+	// the real client request
+	var handler http.Handler = handlers.WithAccessControl(appServer, router)
+	handler = handlers.WithBasePath(appServer.GetBasePath(), handler)
+	handler = handlers.WithTrustedProxies(appServer, handler)
+
 	httpServer := &http.Server{
 		Addr:    addr,
-		Handler: mux,
+		Handler: handler,
 	}
+	// End SSE streams on shutdown instead of waiting for browsers to disconnect
+	httpServer.RegisterOnShutdown(appServer.CloseSSEClients)
 
 	// Channel to handle shutdown signals
 	sigChan := make(chan os.Signal, 1)
@@ -82,8 +275,17 @@ func main() {
 
 	log.Println("\nShutdown signal received, gracefully stopping server...")
 
+	if onShutdown != nil {
+		onShutdown()
+	}
+	stopBackground()
+
 	// Create a context with timeout for graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	drainTimeout := 5 * time.Second
+	if container {
+		drainTimeout = containerDrainTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
 	defer cancel()
 
 	// Gracefully shutdown the server
@@ -91,6 +293,19 @@ func main() {
 		log.Printf("Server forced to shutdown: %v\n", err)
 	}
 
+	// Store the events still waiting for an ingest worker
+	appServer.StopIngestWorkers()
+
+	// Deliver the events still queued for sinks until the drain deadline, then
+	// abort any delivery still in flight
+	appServer.CloseSinks(ctx)
+	stopForwarding()
+
+	// Persist the last events and close the store; os.Exit skips deferred calls
+	if err := appServer.CloseEventStore(); err != nil {
+		log.Printf("Error closing event store: %v\n", err)
+	}
+
 	log.Println("Server stopped")
 	os.Exit(0)
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"goplow/internal/handlers"
+	"goplow/internal/server"
+)
+
+// runQuality prints the data-quality score of a goplow server's events for CI,
+// exiting non-zero if it is below the minimum
+// Usage: goplow quality [-url http://localhost:8081] [-run-id id] [-min 90]
+func runQuality(args []string) {
+	fs := flag.NewFlagSet("quality", flag.ExitOnError)
+	serverURL := fs.String("url", "", "goplow server URL (defaults to http://localhost:$GOPLOW_PORT, then port 8081)")
+	runID := fs.String("run-id", "", "Score only the events sent with this run ID")
+	sessionID := fs.Int("session-id", 0, "Score only the events of this capture session")
+	minimum := fs.Float64("min", 0, "Exit with status 1 if the score is below this (0 to 100)")
+	asJSON := fs.Bool("json", false, "Print the score as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: goplow quality [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Print the data-quality score of a running server's events: validation pass rate,\n")
+		fmt.Fprintf(fs.Output(), "required context coverage, duplicate rate and stale schema usage. Exits with\n")
+		fmt.Fprintf(fs.Output(), "status 1 if there are no events or the score is below -min.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *serverURL == "" {
+		port := os.Getenv("GOPLOW_PORT")
+		if port == "" {
+			port = "8081"
+		}
+		*serverURL = "http://localhost:" + port
+	}
+	query := url.Values{}
+	if *runID != "" {
+		query.Set("run_id", *runID)
+	}
+	if *sessionID > 0 {
+		query.Set("session_id", strconv.Itoa(*sessionID))
+	}
+	endpoint := strings.TrimSuffix(*serverURL, "/") + handlers.QualityPath
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		log.Fatalf("Error fetching quality score: %v\n", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("Error fetching quality score: status %d\n", resp.StatusCode)
+	}
+	var score server.QualityScore
+	if err := json.NewDecoder(resp.Body).Decode(&score); err != nil {
+		log.Fatalf("Error reading quality score: %v\n", err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(score)
+	} else {
+		printQuality(score, *minimum)
+	}
+
+	if score.Score == nil || *score.Score < *minimum {
+		os.Exit(1)
+	}
+}
+
+// printQuality prints a score and its components, one per line
+func printQuality(score server.QualityScore, minimum float64) {
+	if score.Score == nil {
+		fmt.Println("Data quality: no tracker events to score FAIL")
+		return
+	}
+	verdict := "ok"
+	if *score.Score < minimum {
+		verdict = "FAIL"
+	}
+	fmt.Printf("Data quality: %.1f (minimum %.1f) %s\n", *score.Score, minimum, verdict)
+	fmt.Printf("  %-18s %d\n", "tracker events", score.TrackerEvents)
+	fmt.Printf("  %-18s %5.1f%%\n", "validation passed", score.ValidationPassRate*100)
+	if score.ContextCoverage != nil {
+		fmt.Printf("  %-18s %5.1f%%%s\n", "context coverage", *score.ContextCoverage*100, describeCounts(score.MissingContexts, "missing"))
+	}
+	fmt.Printf("  %-18s %5.1f%%\n", "duplicates", score.DuplicateRate*100)
+	stale := make([]string, 0, len(score.StaleSchemas))
+	for schema, latest := range score.StaleSchemas {
+		stale = append(stale, schema+" (latest "+latest+")")
+	}
+	sort.Strings(stale)
+	fmt.Printf("  %-18s %5.1f%%\n", "stale schemas", score.StaleSchemaRate*100)
+	for _, schema := range stale {
+		fmt.Printf("    %s\n", schema)
+	}
+}
+
+// describeCounts formats counts by name as " (label: a 2, b 1)", or "" if empty
+func describeCounts(counts map[string]int, label string) string {
+	if len(counts) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %d", name, counts[name])
+	}
+	return " (" + label + ": " + strings.Join(parts, ", ") + ")"
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"goplow/internal/export"
+	"goplow/internal/replay"
+)
+
+// runReplay re-sends captured events to an external collector
+// Usage: goplow replay -target https://collector.acme.com [flags] file.ndjson
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	target := fs.String("target", "", "Collector URL to send events to (path defaults to "+replay.DefaultPath+")")
+	from := fs.String("from", "", "Input format: "+strings.Join(convertInputs, ", ")+" (guessed from the file extension if omitted)")
+	concurrency := fs.Int("concurrency", 4, "Number of requests in flight")
+	rate := fs.Float64("rate", 0, "Maximum requests per second (0 for no limit)")
+	retries := fs.Int("retries", 2, "Retries for network errors and 5xx or 429 responses")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for each request")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: goplow replay -target <collector-url> [flags] [file]\n\n")
+		fmt.Fprintf(fs.Output(), "Re-send captured events to a Snowplow collector, one request per event,\n")
+		fmt.Fprintf(fs.Output(), "to backfill lost events or load a staging pipeline. Reads stdin if file is omitted.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *target == "" || fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	input := fs.Arg(0)
+
+	inputFormat := convertFormat(*from, input, export.FormatNDJSON)
+	if !isConvertInput(inputFormat) {
+		log.Fatalf("Unknown input format %q, expected one of %s\n", inputFormat, strings.Join(convertInputs, ", "))
+	}
+	in := io.Reader(os.Stdin)
+	if input != "" && input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			log.Fatalf("Error opening %s: %v\n", input, err)
+		}
+		defer file.Close()
+		in = file
+	}
+	events, err := readConvertInput(bufio.NewReader(in), inputFormat)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v\n", inputFormat, err)
+	}
+
+	targetURL, err := replay.TargetURL(*target)
+	if err != nil {
+		log.Fatalf("Invalid target: %v\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "Replaying %d events to %s\n", len(events), targetURL)
+
+	// Stop sending on Ctrl+C, still reporting what was sent
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := replay.Run(ctx, events, replay.Options{
+		Target:      *target,
+		Concurrency: *concurrency,
+		Rate:        *rate,
+		Retries:     *retries,
+		Timeout:     *timeout,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Replay interrupted: %v\n", err)
+	}
+
+	fmt.Printf("Sent %d, failed %d in %s\n", report.Sent, report.Failed, report.Duration.Round(time.Millisecond))
+	statuses := make([]int, 0, len(report.Statuses))
+	for status := range report.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		label := fmt.Sprint(status)
+		if status == 0 {
+			label = "no response"
+		}
+		fmt.Printf("  %s: %d\n", label, report.Statuses[status])
+	}
+	if report.Failed > 0 || err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,142 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"goplow/internal/outbound"
+	"goplow/internal/server"
+	"goplow/internal/sinks"
+)
+
+// IngestPath is the aggregator endpoint that leaf instances push events to
+const IngestPath = "/api/cluster/events"
+
+// Envelope is the payload a leaf instance pushes to an aggregator
+type Envelope struct {
+	Source    string                   `json:"source"`
+	Schema    string                   `json:"schema"`
+	Data      []map[string]interface{} `json:"data"`
+	Timestamp time.Time                `json:"timestamp"`
+	Namespace string                   `json:"namespace,omitempty"`
+	// Enriched holds the fields the leaf derived from the tracker's request,
+	// such as its client IP, user agent and location
+	Enriched map[string]interface{} `json:"enriched,omitempty"`
+	// Session is the capture session active on the leaf when the event arrived
+	Session *server.Session       `json:"session,omitempty"`
+	Trace   *server.TraceContext  `json:"trace,omitempty"`
+	RunID   string                `json:"runId,omitempty"`
+	Batch   *server.BatchPosition `json:"batch,omitempty"`
+}
+
+// SinkName names the aggregator forwarder among the sinks
+const SinkName = "aggregator"
+
+// Forwarder pushes locally received events to an aggregator instance
+// Queueing, retries and spilling are handled by the embedded sink
+type Forwarder struct {
+	*sinks.Sink
+	targetURL string
+	source    string
+	client    *outbound.Client
+}
+
+// NewForwarder creates a forwarder that pushes events to the aggregator at aggregatorURL
+// through client
+// If source is empty, the machine's hostname is used as the label
+func NewForwarder(aggregatorURL string, source string, client *outbound.Client, options sinks.Options) (*Forwarder, error) {
+	if source == "" {
+		if hostname, err := os.Hostname(); err == nil {
+			source = hostname
+		} else {
+			source = "unknown"
+		}
+	}
+
+	forwarder := &Forwarder{
+		targetURL: strings.TrimSuffix(aggregatorURL, "/") + IngestPath,
+		source:    source,
+		client:    client,
+	}
+	sink, err := sinks.New(SinkName, forwarder.push, options)
+	if err != nil {
+		return nil, err
+	}
+	forwarder.Sink = sink
+	return forwarder, nil
+}
+
+// Sinks builds the forwarder to the aggregator_url, if one is set; it is
+// registered as a server.SinkFactory
+func Sinks(appServer *server.AppServer) ([]server.EventSink, error) {
+	config := appServer.GetConfig()
+	if config.AggregatorURL == "" {
+		return nil, nil
+	}
+
+	options, err := sinks.OptionsFromConfig(config, SinkName)
+	if err != nil {
+		return nil, err
+	}
+	client, err := outbound.NewClient(outbound.OptionsFromConfig(config))
+	if err != nil {
+		return nil, err
+	}
+	forwarder, err := NewForwarder(config.AggregatorURL, config.SourceLabel, client, options)
+	if err != nil {
+		return nil, err
+	}
+	forwarder.OnFailure = func(reason string) {
+		appServer.CountMetric(server.MetricForwardFailures, reason)
+	}
+	log.Printf("Forwarding events to aggregator %s as %q\n", config.AggregatorURL, forwarder.Source())
+	return []server.EventSink{forwarder}, nil
+}
+
+// Source returns the label attached to forwarded events
+func (f *Forwarder) Source() string {
+	return f.source
+}
+
+// push sends a single event to the aggregator
+func (f *Forwarder) push(ctx context.Context, event server.Event) error {
+	body, err := json.Marshal(Envelope{
+		Source:    f.source,
+		Schema:    event.Schema,
+		Data:      event.Data,
+		Timestamp: event.Timestamp,
+		Namespace: event.Namespace,
+		Enriched:  event.Enriched,
+		Session:   event.Session,
+		Trace:     event.Trace,
+		RunID:     event.RunID,
+		Batch:     event.Batch,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.targetURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
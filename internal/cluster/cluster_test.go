@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"goplow/internal/outbound"
+	"goplow/internal/server"
+	"goplow/internal/sinks"
+)
+
+func TestPushForwardsTheLeafsEnrichments(t *testing.T) {
+	var received Envelope
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer aggregator.Close()
+
+	client, err := outbound.NewClient(outbound.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forwarder, err := NewForwarder(aggregator.URL, "checkout-service", client, sinks.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := server.Event{
+		Schema:    "iglu:com.snowplowanalytics.snowplow/payload_data/jsonschema/1-0-4",
+		Data:      []map[string]interface{}{{"e": "pv"}},
+		Timestamp: time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		Namespace: "/com.acme/events",
+		Enriched:  map[string]interface{}{"user_ipaddress": "203.0.113.7", "geo_country": "GB"},
+	}
+	if err := forwarder.push(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	if received.Source != "checkout-service" || received.Namespace != event.Namespace {
+		t.Errorf("pushed source %q and namespace %q", received.Source, received.Namespace)
+	}
+	if received.Enriched["user_ipaddress"] != "203.0.113.7" || received.Enriched["geo_country"] != "GB" {
+		t.Errorf("pushed enrichments %v, want the leaf's", received.Enriched)
+	}
+}
@@ -0,0 +1,99 @@
+package enrich
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"goplow/internal/server"
+)
+
+// IPAnonymizer masks the trailing octets (IPv4) or segments (IPv6) of
+// user_ipaddress and the IP fields of the payload with "x", matching the
+// Snowplow IP anonymization enrichment
+type IPAnonymizer struct {
+	octets   int
+	segments int
+}
+
+// NewIPAnonymizer creates an anonymizer masking the given number of IPv4 octets
+// (1-4) and IPv6 segments (1-8). Zero leaves that address family untouched.
+func NewIPAnonymizer(octets int, segments int) (*IPAnonymizer, error) {
+	if octets < 0 || octets > 4 {
+		return nil, fmt.Errorf("anonymize_ip_octets must be between 0 and 4, got %d", octets)
+	}
+	if segments < 0 || segments > 8 {
+		return nil, fmt.Errorf("anonymize_ip_segments must be between 0 and 8, got %d", segments)
+	}
+	return &IPAnonymizer{octets: octets, segments: segments}, nil
+}
+
+// Name identifies the enrichment
+func (a *IPAnonymizer) Name() string {
+	return "ip_anonymization"
+}
+
+// ipDataFields are the payload fields trackers and adapters send client IPs
+// in: the Snowplow ip parameter, GA4's ip_override and _uip, and the ip of a
+// Segment call's context
+var ipDataFields = []string{"ip", "ip_override", "_uip"}
+
+// Enrich masks user_ipaddress and the IP fields of every payload item in place
+// It runs after lookups such as geo-IP, which need the full address
+func (a *IPAnonymizer) Enrich(event *server.Event) {
+	if address := stringField(event, "user_ipaddress"); address != "" {
+		event.Enriched["user_ipaddress"] = a.Anonymize(address)
+	}
+	for _, item := range event.Data {
+		a.anonymizeFields(item)
+		if context, ok := item["context"].(map[string]interface{}); ok {
+			a.anonymizeFields(context)
+		}
+	}
+}
+
+// UsesClientIP reports that the enrichment masks the client's address
+func (a *IPAnonymizer) UsesClientIP() bool {
+	return true
+}
+
+// anonymizeFields masks the IP fields of a payload item
+func (a *IPAnonymizer) anonymizeFields(item map[string]interface{}) {
+	for _, field := range ipDataFields {
+		if address, ok := item[field].(string); ok && address != "" {
+			item[field] = a.Anonymize(address)
+		}
+	}
+}
+
+// Anonymize masks an IP address; values that are not IP addresses are returned unchanged
+func (a *IPAnonymizer) Anonymize(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return address
+	}
+
+	if ipv4 := ip.To4(); ipv4 != nil {
+		if a.octets == 0 {
+			return address
+		}
+		parts := strings.Split(ipv4.String(), ".")
+		for i := len(parts) - a.octets; i < len(parts); i++ {
+			parts[i] = "x"
+		}
+		return strings.Join(parts, ".")
+	}
+
+	if a.segments == 0 {
+		return address
+	}
+	// Expand to the full 8-segment form so the masked segments are unambiguous
+	parts := make([]string, 8)
+	for i := 0; i < 8; i++ {
+		parts[i] = fmt.Sprintf("%x", uint16(ip[i*2])<<8|uint16(ip[i*2+1]))
+	}
+	for i := len(parts) - a.segments; i < len(parts); i++ {
+		parts[i] = "x"
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,55 @@
+package enrich
+
+import (
+	"testing"
+
+	"goplow/internal/server"
+)
+
+func TestIPAnonymizerMasksPayloadIPs(t *testing.T) {
+	anonymizer, err := NewIPAnonymizer(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := &server.Event{
+		Enriched: map[string]interface{}{"user_ipaddress": "203.0.113.42"},
+		Data: []map[string]interface{}{
+			{"e": "pv", "ip": "198.51.100.7"},
+			{"e": "pv", "ip": "2001:db8::1"},
+			{"type": "track", "context": map[string]interface{}{"ip": "192.0.2.1"}},
+			{"name": "page_view", "ip_override": "192.0.2.2", "_uip": "192.0.2.3"},
+		},
+	}
+
+	anonymizer.Enrich(event)
+
+	checks := []struct {
+		got, want interface{}
+	}{
+		{event.Enriched["user_ipaddress"], "203.0.x.x"},
+		{event.Data[0]["ip"], "198.51.x.x"},
+		{event.Data[1]["ip"], "2001:db8:0:0:0:x:x:x"},
+		{event.Data[2]["context"].(map[string]interface{})["ip"], "192.0.x.x"},
+		{event.Data[3]["ip_override"], "192.0.x.x"},
+		{event.Data[3]["_uip"], "192.0.x.x"},
+	}
+	for i, check := range checks {
+		if check.got != check.want {
+			t.Errorf("check %d: got %v, want %v", i, check.got, check.want)
+		}
+	}
+}
+
+func TestIPAnonymizerLeavesOtherFields(t *testing.T) {
+	anonymizer, _ := NewIPAnonymizer(1, 0)
+	event := &server.Event{
+		Enriched: map[string]interface{}{},
+		Data:     []map[string]interface{}{{"ip": "not an ip", "url": "https://203.0.113.42/"}},
+	}
+
+	anonymizer.Enrich(event)
+
+	if event.Data[0]["ip"] != "not an ip" || event.Data[0]["url"] != "https://203.0.113.42/" {
+		t.Errorf("unexpected changes: %v", event.Data[0])
+	}
+}
@@ -0,0 +1,70 @@
+package enrich
+
+import (
+	"net/url"
+
+	"goplow/internal/server"
+)
+
+// campaignParameters maps mkt_* fields to the query parameters they are read
+// from, in priority order, matching the Snowplow campaign_attribution defaults
+var campaignParameters = []struct {
+	field      string
+	parameters []string
+}{
+	{"mkt_medium", []string{"utm_medium"}},
+	{"mkt_source", []string{"utm_source"}},
+	{"mkt_term", []string{"utm_term"}},
+	{"mkt_content", []string{"utm_content"}},
+	{"mkt_campaign", []string{"utm_campaign"}},
+}
+
+// clickIDNetworks maps click ID query parameters to their ad network
+var clickIDNetworks = []struct {
+	parameter string
+	network   string
+}{
+	{"gclid", "Google"},
+	{"msclkid", "Microsoft"},
+	{"dclid", "DoubleClick"},
+	{"fbclid", "Facebook"},
+}
+
+// CampaignAttribution derives mkt_* fields from the page URL's query string,
+// like the Snowplow campaign_attribution enrichment
+type CampaignAttribution struct{}
+
+// Name identifies the enrichment
+func (c *CampaignAttribution) Name() string {
+	return "campaign_attribution"
+}
+
+// Enrich adds mkt_* fields for UTM parameters and click IDs in the page URL
+func (c *CampaignAttribution) Enrich(event *server.Event) {
+	pageURL := dataField(event, "url")
+	if pageURL == "" {
+		return
+	}
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return
+	}
+	query := parsed.Query()
+
+	for _, mapping := range campaignParameters {
+		for _, parameter := range mapping.parameters {
+			if value := query.Get(parameter); value != "" {
+				event.Enriched[mapping.field] = value
+				break
+			}
+		}
+	}
+
+	for _, click := range clickIDNetworks {
+		if value := query.Get(click.parameter); value != "" {
+			event.Enriched["mkt_clickid"] = value
+			event.Enriched["mkt_network"] = click.network
+			break
+		}
+	}
+}
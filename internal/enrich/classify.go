@@ -0,0 +1,52 @@
+package enrich
+
+import (
+	"goplow/internal/jsonpath"
+	"goplow/internal/server"
+)
+
+// EventClassifier labels events with the classification rules they match,
+// e.g. "checkout", "navigation" or "errors"
+type EventClassifier struct {
+	labels     []string
+	conditions []*jsonpath.Condition
+}
+
+// NewEventClassifier compiles the classification rules
+func NewEventClassifier(rules []server.ClassificationRule) (*EventClassifier, error) {
+	classifier := &EventClassifier{}
+	for _, rule := range rules {
+		condition, err := jsonpath.CompileCondition(rule.When)
+		if err != nil {
+			return nil, err
+		}
+		classifier.labels = append(classifier.labels, rule.Label)
+		classifier.conditions = append(classifier.conditions, condition)
+	}
+	return classifier, nil
+}
+
+// Name identifies the enrichment
+func (e *EventClassifier) Name() string {
+	return "classification"
+}
+
+// Enrich sets the labels of the rules matching any of the event's payload
+// items, in rule order and each once
+func (e *EventClassifier) Enrich(event *server.Event) {
+	var labels []string
+	seen := make(map[string]bool)
+	for i, condition := range e.conditions {
+		if seen[e.labels[i]] {
+			continue
+		}
+		for _, item := range event.Data {
+			if condition.Match(map[string]interface{}{"data": item}) {
+				labels = append(labels, e.labels[i])
+				seen[e.labels[i]] = true
+				break
+			}
+		}
+	}
+	event.Classification = labels
+}
@@ -0,0 +1,71 @@
+package enrich
+
+import (
+	"goplow/internal/server"
+)
+
+// Configure registers the enrichments enabled in the server's configuration
+func Configure(appServer *server.AppServer) error {
+	config := appServer.GetConfig()
+
+	appServer.AddEnricher(&CampaignAttribution{})
+
+	exclude := config.FingerprintExclude
+	if exclude == nil {
+		exclude = DefaultFingerprintExclude
+	}
+	appServer.AddEnricher(NewEventFingerprint(exclude))
+
+	if config.GeoIPDatabase != "" {
+		geo, err := NewGeoIP(config.GeoIPDatabase)
+		if err != nil {
+			return err
+		}
+		appServer.AddEnricher(geo)
+	}
+
+	// Anonymization runs after lookups that need the full address
+	if config.AnonymizeIPOctets > 0 || config.AnonymizeIPSegments > 0 {
+		anonymizer, err := NewIPAnonymizer(config.AnonymizeIPOctets, config.AnonymizeIPSegments)
+		if err != nil {
+			return err
+		}
+		appServer.AddEnricher(anonymizer)
+	}
+
+	if len(config.SummaryTemplates) > 0 {
+		summary, err := NewEventSummary(config.SummaryTemplates)
+		if err != nil {
+			return err
+		}
+		summary.OnError = func(error) {
+			appServer.CountMetric(server.MetricTransformErrors, "summary")
+		}
+		appServer.AddEnricher(summary)
+	}
+
+	if len(config.ClassificationRules) > 0 {
+		classifier, err := NewEventClassifier(config.ClassificationRules)
+		if err != nil {
+			return err
+		}
+		appServer.AddEnricher(classifier)
+	}
+
+	return nil
+}
+
+// stringField returns a string value from the event's enriched fields
+func stringField(event *server.Event, field string) string {
+	value, _ := event.Enriched[field].(string)
+	return value
+}
+
+// dataField returns a string value from the event's first tracker payload item
+func dataField(event *server.Event, field string) string {
+	if len(event.Data) == 0 {
+		return ""
+	}
+	value, _ := event.Data[0][field].(string)
+	return value
+}
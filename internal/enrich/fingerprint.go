@@ -0,0 +1,67 @@
+package enrich
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"goplow/internal/server"
+)
+
+// DefaultFingerprintExclude lists the tracker parameters that change between
+// retries of the same event, matching the Snowplow event_fingerprint defaults
+var DefaultFingerprintExclude = []string{"cv", "eid", "nuid", "stm"}
+
+// EventFingerprint sets event_fingerprint to an MD5 hash of the tracker
+// payload, like the Snowplow event_fingerprint enrichment
+type EventFingerprint struct {
+	exclude map[string]bool
+}
+
+// NewEventFingerprint creates a fingerprint enrichment ignoring the given parameters
+func NewEventFingerprint(exclude []string) *EventFingerprint {
+	excluded := make(map[string]bool, len(exclude))
+	for _, parameter := range exclude {
+		excluded[parameter] = true
+	}
+	return &EventFingerprint{exclude: excluded}
+}
+
+// Name identifies the enrichment
+func (f *EventFingerprint) Name() string {
+	return "event_fingerprint"
+}
+
+// Enrich adds event_fingerprint computed from the first payload item
+func (f *EventFingerprint) Enrich(event *server.Event) {
+	if len(event.Data) == 0 {
+		return
+	}
+	event.Enriched["event_fingerprint"] = f.Fingerprint(event.Data[0])
+}
+
+// Fingerprint hashes the payload's parameters, sorted by name and concatenated
+// as name followed by value, skipping excluded parameters
+func (f *EventFingerprint) Fingerprint(payload map[string]interface{}) string {
+	keys := make([]string, 0, len(payload))
+	for key := range payload {
+		if !f.exclude[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	// Tracker values are almost always strings, so avoid formatting them
+	buffer := make([]byte, 0, 1024)
+	for _, key := range keys {
+		buffer = append(buffer, key...)
+		if value, ok := payload[key].(string); ok {
+			buffer = append(buffer, value...)
+		} else {
+			buffer = fmt.Append(buffer, payload[key])
+		}
+	}
+	sum := md5.Sum(buffer)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,98 @@
+package enrich
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"goplow/internal/server"
+)
+
+// geoRecord is the subset of a MaxMind City record used for enrichment
+type geoRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+		TimeZone  string  `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+}
+
+// GeoIP enriches events with the location of user_ipaddress, using the same
+// geo_* fields as the Snowplow IP lookups enrichment
+type GeoIP struct {
+	reader *maxminddb.Reader
+}
+
+// NewGeoIP opens the MaxMind-format database at path
+func NewGeoIP(path string) (*GeoIP, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening geoip database %s: %w", path, err)
+	}
+	log.Printf("Loaded geoip database %s (%s)\n", path, reader.Metadata.DatabaseType)
+	return &GeoIP{reader: reader}, nil
+}
+
+// Name identifies the enrichment
+func (g *GeoIP) Name() string {
+	return "geoip"
+}
+
+// Enrich adds geo_* fields for the event's IP address
+func (g *GeoIP) Enrich(event *server.Event) {
+	ip := net.ParseIP(stringField(event, "user_ipaddress"))
+	if ip == nil {
+		return
+	}
+
+	var record geoRecord
+	if err := g.reader.Lookup(ip, &record); err != nil {
+		log.Printf("Error looking up %s in geoip database: %v\n", ip, err)
+		return
+	}
+
+	setIfPresent(event, "geo_country", record.Country.IsoCode)
+	setIfPresent(event, "geo_city", record.City.Names["en"])
+	if len(record.Subdivisions) > 0 {
+		setIfPresent(event, "geo_region", record.Subdivisions[0].IsoCode)
+		setIfPresent(event, "geo_region_name", record.Subdivisions[0].Names["en"])
+	}
+	setIfPresent(event, "geo_zipcode", record.Postal.Code)
+	setIfPresent(event, "geo_timezone", record.Location.TimeZone)
+	if record.Location.Latitude != 0 || record.Location.Longitude != 0 {
+		event.Enriched["geo_latitude"] = record.Location.Latitude
+		event.Enriched["geo_longitude"] = record.Location.Longitude
+	}
+}
+
+// UsesClientIP reports that the location is looked up from the client's address
+func (g *GeoIP) UsesClientIP() bool {
+	return true
+}
+
+// Close releases the database
+func (g *GeoIP) Close() error {
+	return g.reader.Close()
+}
+
+// setIfPresent sets an enriched field if the value is not empty
+func setIfPresent(event *server.Event, field string, value string) {
+	if value != "" {
+		event.Enriched[field] = value
+	}
+}
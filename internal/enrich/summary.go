@@ -0,0 +1,76 @@
+package enrich
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"goplow/internal/iglu"
+	"goplow/internal/server"
+)
+
+// EventSummary renders a one-line summary of events from the summary template
+// of their schema, e.g. "Added SKU-123 x2 to cart"
+type EventSummary struct {
+	// exact holds templates for full schema URIs, byKey those for every version
+	// of a vendor/name
+	exact map[string]*template.Template
+	byKey map[string]*template.Template
+	// OnError is called when a template fails to render
+	OnError func(error)
+}
+
+// NewEventSummary parses the summary templates
+func NewEventSummary(templates []server.SummaryTemplate) (*EventSummary, error) {
+	summary := &EventSummary{
+		exact: make(map[string]*template.Template),
+		byKey: make(map[string]*template.Template),
+	}
+	for _, config := range templates {
+		tmpl, err := template.New(config.Schema).Option("missingkey=zero").Parse(config.Template)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing summary template for %s: %w", config.Schema, err)
+		}
+		if strings.HasPrefix(config.Schema, "iglu:") {
+			summary.exact[config.Schema] = tmpl
+		} else {
+			summary.byKey[config.Schema] = tmpl
+		}
+	}
+	return summary, nil
+}
+
+// Name identifies the enrichment
+func (e *EventSummary) Name() string {
+	return "summary"
+}
+
+// Enrich sets the event's summary from its first payload item: the decoded data
+// of a self-describing event, or the item itself under the event's schema
+func (e *EventSummary) Enrich(event *server.Event) {
+	if len(event.Data) == 0 {
+		return
+	}
+	schema, data := event.Schema, event.Data[0]
+	if eventSchema, eventData, ok := iglu.SelfDescribingEvent(data); ok {
+		schema, data = eventSchema, eventData
+	}
+
+	tmpl, found := e.exact[schema]
+	if !found {
+		tmpl, found = e.byKey[iglu.SchemaKey(schema)]
+	}
+	if !found {
+		return
+	}
+
+	var text strings.Builder
+	if err := tmpl.Execute(&text, data); err != nil {
+		if e.OnError != nil {
+			e.OnError(err)
+		}
+		return
+	}
+	// Keep the summary to one line whatever the template's layout
+	event.Summary = strings.Join(strings.Fields(text.String()), " ")
+}
@@ -0,0 +1,556 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"goplow/internal/jsonpath"
+	"goplow/internal/server"
+)
+
+// Kind is the type of values in a column
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindInt
+	KindFloat
+	KindTimestamp
+)
+
+// Column is an exported column, named after the Snowplow atomic.events column
+// where there is one
+type Column struct {
+	Name string
+	Kind Kind
+}
+
+// AtomicColumns are the atomic.events columns, in table order, which is also the
+// field order of enriched event TSV
+var AtomicColumns = []Column{
+	{"app_id", KindString},
+	{"platform", KindString},
+	{"etl_tstamp", KindTimestamp},
+	{"collector_tstamp", KindTimestamp},
+	{"dvce_created_tstamp", KindTimestamp},
+	{"event", KindString},
+	{"event_id", KindString},
+	{"txn_id", KindInt},
+	{"name_tracker", KindString},
+	{"v_tracker", KindString},
+	{"v_collector", KindString},
+	{"v_etl", KindString},
+	{"user_id", KindString},
+	{"user_ipaddress", KindString},
+	{"user_fingerprint", KindString},
+	{"domain_userid", KindString},
+	{"domain_sessionidx", KindInt},
+	{"network_userid", KindString},
+	{"geo_country", KindString},
+	{"geo_region", KindString},
+	{"geo_city", KindString},
+	{"geo_zipcode", KindString},
+	{"geo_latitude", KindFloat},
+	{"geo_longitude", KindFloat},
+	{"geo_region_name", KindString},
+	{"ip_isp", KindString},
+	{"ip_organization", KindString},
+	{"ip_domain", KindString},
+	{"ip_netspeed", KindString},
+	{"page_url", KindString},
+	{"page_title", KindString},
+	{"page_referrer", KindString},
+	{"page_urlscheme", KindString},
+	{"page_urlhost", KindString},
+	{"page_urlport", KindInt},
+	{"page_urlpath", KindString},
+	{"page_urlquery", KindString},
+	{"page_urlfragment", KindString},
+	{"refr_urlscheme", KindString},
+	{"refr_urlhost", KindString},
+	{"refr_urlport", KindInt},
+	{"refr_urlpath", KindString},
+	{"refr_urlquery", KindString},
+	{"refr_urlfragment", KindString},
+	{"refr_medium", KindString},
+	{"refr_source", KindString},
+	{"refr_term", KindString},
+	{"mkt_medium", KindString},
+	{"mkt_source", KindString},
+	{"mkt_term", KindString},
+	{"mkt_content", KindString},
+	{"mkt_campaign", KindString},
+	{"contexts", KindString},
+	{"se_category", KindString},
+	{"se_action", KindString},
+	{"se_label", KindString},
+	{"se_property", KindString},
+	{"se_value", KindFloat},
+	{"unstruct_event", KindString},
+	{"tr_orderid", KindString},
+	{"tr_affiliation", KindString},
+	{"tr_total", KindFloat},
+	{"tr_tax", KindFloat},
+	{"tr_shipping", KindFloat},
+	{"tr_city", KindString},
+	{"tr_state", KindString},
+	{"tr_country", KindString},
+	{"ti_orderid", KindString},
+	{"ti_sku", KindString},
+	{"ti_name", KindString},
+	{"ti_category", KindString},
+	{"ti_price", KindFloat},
+	{"ti_quantity", KindInt},
+	{"pp_xoffset_min", KindInt},
+	{"pp_xoffset_max", KindInt},
+	{"pp_yoffset_min", KindInt},
+	{"pp_yoffset_max", KindInt},
+	{"useragent", KindString},
+	{"br_name", KindString},
+	{"br_family", KindString},
+	{"br_version", KindString},
+	{"br_type", KindString},
+	{"br_renderengine", KindString},
+	{"br_lang", KindString},
+	{"br_features_pdf", KindString},
+	{"br_features_flash", KindString},
+	{"br_features_java", KindString},
+	{"br_features_director", KindString},
+	{"br_features_quicktime", KindString},
+	{"br_features_realplayer", KindString},
+	{"br_features_windowsmedia", KindString},
+	{"br_features_gears", KindString},
+	{"br_features_silverlight", KindString},
+	{"br_cookies", KindString},
+	{"br_colordepth", KindString},
+	{"br_viewwidth", KindInt},
+	{"br_viewheight", KindInt},
+	{"os_name", KindString},
+	{"os_family", KindString},
+	{"os_manufacturer", KindString},
+	{"os_timezone", KindString},
+	{"dvce_type", KindString},
+	{"dvce_ismobile", KindString},
+	{"dvce_screenwidth", KindInt},
+	{"dvce_screenheight", KindInt},
+	{"doc_charset", KindString},
+	{"doc_width", KindInt},
+	{"doc_height", KindInt},
+	{"tr_currency", KindString},
+	{"tr_total_base", KindFloat},
+	{"tr_tax_base", KindFloat},
+	{"tr_shipping_base", KindFloat},
+	{"ti_currency", KindString},
+	{"ti_price_base", KindFloat},
+	{"base_currency", KindString},
+	{"geo_timezone", KindString},
+	{"mkt_clickid", KindString},
+	{"mkt_network", KindString},
+	{"etl_tags", KindString},
+	{"dvce_sent_tstamp", KindTimestamp},
+	{"refr_domain_userid", KindString},
+	{"refr_dvce_tstamp", KindTimestamp},
+	{"derived_contexts", KindString},
+	{"domain_sessionid", KindString},
+	{"derived_tstamp", KindTimestamp},
+	{"event_vendor", KindString},
+	{"event_name", KindString},
+	{"event_format", KindString},
+	{"event_version", KindString},
+	{"event_fingerprint", KindString},
+	{"true_tstamp", KindTimestamp},
+}
+
+// goplowColumns describe where goplow received each event
+var goplowColumns = []Column{
+	{"goplow_id", KindInt},
+	{"goplow_schema", KindString},
+	{"goplow_namespace", KindString},
+	{"goplow_source", KindString},
+	{"goplow_session", KindString},
+}
+
+// Columns returns the atomic columns followed by the goplow columns
+func Columns() []Column {
+	return append(append([]Column{}, AtomicColumns...), goplowColumns...)
+}
+
+// columnKinds indexes every column's kind by name
+var columnKinds = func() map[string]Kind {
+	kinds := make(map[string]Kind)
+	for _, column := range Columns() {
+		kinds[column.Name] = column.Kind
+	}
+	return kinds
+}()
+
+// trackerParams maps tracker protocol parameters to the columns they fill; the
+// first parameter present wins when two fill the same column
+var trackerParams = []struct{ param, column string }{
+	{"aid", "app_id"},
+	{"p", "platform"},
+	{"dtm", "dvce_created_tstamp"},
+	{"stm", "dvce_sent_tstamp"},
+	{"ttm", "true_tstamp"},
+	{"eid", "event_id"},
+	{"tid", "txn_id"},
+	{"tna", "name_tracker"},
+	{"tv", "v_tracker"},
+	{"uid", "user_id"},
+	{"ip", "user_ipaddress"},
+	{"fp", "user_fingerprint"},
+	{"duid", "domain_userid"},
+	{"vid", "domain_sessionidx"},
+	{"sid", "domain_sessionid"},
+	{"nuid", "network_userid"},
+	{"tnuid", "network_userid"},
+	{"url", "page_url"},
+	{"page", "page_title"},
+	{"refr", "page_referrer"},
+	{"se_ca", "se_category"},
+	{"se_ac", "se_action"},
+	{"se_la", "se_label"},
+	{"se_pr", "se_property"},
+	{"se_va", "se_value"},
+	{"tr_id", "tr_orderid"},
+	{"tr_af", "tr_affiliation"},
+	{"tr_tt", "tr_total"},
+	{"tr_tx", "tr_tax"},
+	{"tr_sh", "tr_shipping"},
+	{"tr_ci", "tr_city"},
+	{"tr_st", "tr_state"},
+	{"tr_co", "tr_country"},
+	{"tr_cu", "tr_currency"},
+	{"ti_id", "ti_orderid"},
+	{"ti_sk", "ti_sku"},
+	{"ti_nm", "ti_name"},
+	{"ti_na", "ti_name"},
+	{"ti_ca", "ti_category"},
+	{"ti_pr", "ti_price"},
+	{"ti_qu", "ti_quantity"},
+	{"ti_cu", "ti_currency"},
+	{"pp_mix", "pp_xoffset_min"},
+	{"pp_max", "pp_xoffset_max"},
+	{"pp_miy", "pp_yoffset_min"},
+	{"pp_may", "pp_yoffset_max"},
+	{"ua", "useragent"},
+	{"lang", "br_lang"},
+	{"cookie", "br_cookies"},
+	{"cd", "br_colordepth"},
+	{"tz", "os_timezone"},
+	{"cs", "doc_charset"},
+	{"mkt_clk", "mkt_clickid"},
+}
+
+// dimensionParams are "<width>x<height>" parameters split into two columns
+var dimensionParams = map[string][2]string{
+	"res": {"dvce_screenwidth", "dvce_screenheight"},
+	"vp":  {"br_viewwidth", "br_viewheight"},
+	"ds":  {"doc_width", "doc_height"},
+}
+
+// eventTypes maps the tracker e parameter to the atomic event column
+var eventTypes = map[string]string{
+	"pv": "page_view",
+	"pp": "page_ping",
+	"se": "struct",
+	"ue": "unstruct",
+	"tr": "transaction",
+	"ti": "transaction_item",
+}
+
+// Record is one tracker event as typed column values; missing columns are null
+type Record map[string]interface{}
+
+// Records flattens events into one record per tracker event, in order
+func Records(events []server.Event) []Record {
+	records := make([]Record, 0, len(events))
+	for _, event := range events {
+		for _, item := range event.Data {
+			records = append(records, newRecord(event, item))
+		}
+	}
+	return records
+}
+
+// newRecord builds the record for one tracker payload item of an event
+func newRecord(event server.Event, item map[string]interface{}) Record {
+	record := Record{
+		"collector_tstamp": event.ReceivedAt,
+		"v_collector":      "goplow",
+		"goplow_id":        int64(event.ID),
+	}
+	record.set("goplow_schema", event.Schema)
+	record.set("goplow_namespace", event.Namespace)
+	record.set("goplow_source", event.Source)
+	if event.Session != nil {
+		record.set("goplow_session", event.Session.Name)
+	}
+	if event.DeviceTimestamp != nil {
+		record["derived_tstamp"] = *event.DeviceTimestamp
+	}
+
+	for _, param := range trackerParams {
+		if _, exists := record[param.column]; !exists {
+			record.set(param.column, stringValue(item[param.param]))
+		}
+	}
+	for param, columns := range dimensionParams {
+		if width, height, ok := strings.Cut(stringValue(item[param]), "x"); ok {
+			record.set(columns[0], width)
+			record.set(columns[1], height)
+		}
+	}
+	record.setURL("page", stringValue(item["url"]))
+	record.setURL("refr", stringValue(item["refr"]))
+
+	eventType := stringValue(item["e"])
+	record.set("event", eventType)
+	name, known := eventTypes[eventType]
+	if known {
+		record["event"] = name
+	}
+	if schema := server.ItemSchema(item); schema != "" {
+		record.setSchema(schema)
+	} else if known {
+		record.setSchema("iglu:com.snowplowanalytics.snowplow/" + name + "/jsonschema/1-0-0")
+	}
+	if unstruct, ok := embeddedJSON(item, "ue_pr", "ue_px"); ok {
+		record.set("unstruct_event", marshalString(unstruct))
+	}
+	if contexts, ok := embeddedJSON(item, "co", "cx"); ok {
+		record.set("contexts", marshalString(contexts))
+	}
+
+	// Enrichments take precedence over what the tracker sent
+	for field, value := range event.Enriched {
+		if _, known := columnKinds[field]; known {
+			record.set(field, stringValue(value))
+		} else if isSDKField(field) {
+			record[field] = value
+		}
+	}
+	return record
+}
+
+// payloadDataSchema is the schema given to events rebuilt from records that
+// were not captured by goplow
+const payloadDataSchema = "iglu:com.snowplowanalytics.snowplow/payload_data/jsonschema/1-0-4"
+
+// collectorColumns are recorded by the collector rather than the tracker, so
+// rebuilt events keep them as enriched fields like ingested events do
+var collectorColumns = map[string]bool{"user_ipaddress": true, "useragent": true}
+
+// derivedColumns are computed from other columns when records are built
+var derivedColumns = []string{
+	"v_collector", "event_vendor", "event_name", "event_format", "event_version",
+	"page_urlscheme", "page_urlhost", "page_urlport", "page_urlpath", "page_urlquery", "page_urlfragment",
+	"refr_urlscheme", "refr_urlhost", "refr_urlport", "refr_urlpath", "refr_urlquery", "refr_urlfragment",
+}
+
+// Event rebuilds a goplow event from a record, the reverse of Records: tracker
+// columns become payload parameters and the remaining columns enriched fields
+func (r Record) Event() server.Event {
+	event := server.Event{Schema: payloadDataSchema}
+	item := make(map[string]interface{})
+	consumed := make(map[string]bool)
+	for _, column := range derivedColumns {
+		consumed[column] = true
+	}
+	take := func(column string) (interface{}, bool) {
+		consumed[column] = true
+		value, ok := r[column]
+		return value, ok && value != nil
+	}
+
+	if id, ok := take("goplow_id"); ok {
+		number, _ := id.(int64)
+		event.ID = int(number)
+	}
+	if schema, ok := take("goplow_schema"); ok {
+		event.Schema = stringValue(schema)
+	}
+	if namespace, ok := take("goplow_namespace"); ok {
+		event.Namespace = stringValue(namespace)
+	}
+	if source, ok := take("goplow_source"); ok {
+		event.Source = stringValue(source)
+	}
+	if session, ok := take("goplow_session"); ok {
+		event.Session = &server.Session{Name: stringValue(session)}
+	}
+	if received, ok := take("collector_tstamp"); ok {
+		event.ReceivedAt, _ = received.(time.Time)
+		event.Timestamp = event.ReceivedAt
+	}
+	if derived, ok := take("derived_tstamp"); ok {
+		if timestamp, ok := derived.(time.Time); ok {
+			event.DeviceTimestamp = &timestamp
+		}
+	}
+
+	if eventType, ok := take("event"); ok {
+		item["e"] = stringValue(eventType)
+		for param, name := range eventTypes {
+			if name == eventType {
+				item["e"] = param
+			}
+		}
+	}
+	for _, param := range trackerParams {
+		if consumed[param.column] || collectorColumns[param.column] {
+			continue
+		}
+		if value, ok := take(param.column); ok {
+			item[param.param] = trackerValue(value)
+		}
+	}
+	for param, columns := range dimensionParams {
+		width, hasWidth := take(columns[0])
+		height, hasHeight := take(columns[1])
+		if hasWidth && hasHeight {
+			item[param] = trackerValue(width) + "x" + trackerValue(height)
+		}
+	}
+	if unstruct, ok := take("unstruct_event"); ok {
+		item["ue_pr"] = stringValue(unstruct)
+	}
+	if contexts, ok := take("contexts"); ok {
+		item["co"] = stringValue(contexts)
+	}
+	event.Data = []map[string]interface{}{item}
+
+	for column, value := range r {
+		if consumed[column] || value == nil {
+			continue
+		}
+		if event.Enriched == nil {
+			event.Enriched = make(map[string]interface{})
+		}
+		if timestamp, ok := value.(time.Time); ok {
+			value = timestamp.Format(atomicTimestampFormat)
+		}
+		event.Enriched[column] = value
+	}
+	return event
+}
+
+// trackerValue formats a column value as a tracker protocol parameter
+func trackerValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return strconv.FormatInt(v.UnixMilli(), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	default:
+		return stringValue(v)
+	}
+}
+
+// set stores a non-empty value, converted to the column's kind; values that
+// do not parse are left null
+func (r Record) set(column string, value string) {
+	if value == "" {
+		return
+	}
+	switch columnKinds[column] {
+	case KindInt:
+		if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+			r[column] = number
+		}
+	case KindFloat:
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			r[column] = number
+		}
+	case KindTimestamp:
+		// Tracker timestamps are milliseconds since the epoch; enriched events
+		// and the Analytics SDKs format them as text
+		if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+			r[column] = time.UnixMilli(millis).UTC()
+			return
+		}
+		for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339Nano} {
+			if timestamp, err := time.Parse(layout, value); err == nil {
+				r[column] = timestamp.UTC()
+				return
+			}
+		}
+	default:
+		r[column] = value
+	}
+}
+
+// setURL fills the <prefix>_url* component columns from a URL
+func (r Record) setURL(prefix string, raw string) {
+	if raw == "" {
+		return
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return
+	}
+	r.set(prefix+"_urlscheme", parsed.Scheme)
+	r.set(prefix+"_urlhost", parsed.Hostname())
+	r.set(prefix+"_urlport", parsed.Port())
+	r.set(prefix+"_urlpath", parsed.Path)
+	r.set(prefix+"_urlquery", parsed.RawQuery)
+	r.set(prefix+"_urlfragment", parsed.Fragment)
+}
+
+// setSchema fills the event_vendor, event_name, event_format and event_version
+// columns from an Iglu URI
+func (r Record) setSchema(uri string) {
+	parts := strings.Split(strings.TrimPrefix(uri, "iglu:"), "/")
+	if len(parts) != 4 {
+		return
+	}
+	r.set("event_vendor", parts[0])
+	r.set("event_name", parts[1])
+	r.set("event_format", parts[2])
+	r.set("event_version", parts[3])
+}
+
+// embeddedJSON decodes the first of the given parameters holding JSON, plain or
+// base64-encoded
+func embeddedJSON(item map[string]interface{}, params ...string) (interface{}, bool) {
+	for _, param := range params {
+		switch value := item[param].(type) {
+		case map[string]interface{}, []interface{}:
+			return value, true
+		case string:
+			if decoded, ok := jsonpath.DecodeEmbeddedJSON(value); ok {
+				return decoded, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// stringValue formats a payload value as a string; objects are JSON-encoded
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		return marshalString(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// marshalString JSON-encodes a decoded value
+func marshalString(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
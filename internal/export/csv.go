@@ -0,0 +1,55 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// atomicTimestampFormat is how atomic.events timestamps appear in warehouse
+// exports and dbt seed files
+const atomicTimestampFormat = "2006-01-02 15:04:05.000"
+
+// WriteAtomicCSV writes records as CSV with the atomic.events columns, in
+// table order, so they can seed dbt models built on the Snowplow packages
+// Null values are left empty and timestamps are written as options set, UTC
+// in the warehouse layout by default
+func WriteAtomicCSV(w io.Writer, records []Record, options Options) error {
+	writer := csv.NewWriter(w)
+
+	header := make([]string, len(AtomicColumns))
+	for i, column := range AtomicColumns {
+		header[i] = column.Name
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	row := make([]string, len(AtomicColumns))
+	for _, record := range records {
+		for i, column := range AtomicColumns {
+			row[i] = formatCSVValue(record[column.Name], options)
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatCSVValue formats a typed record value as CSV text
+func formatCSVValue(value interface{}, options Options) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Time:
+		return options.formatTime(v, atomicTimestampFormat)
+	default:
+		return stringValue(v)
+	}
+}
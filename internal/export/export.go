@@ -0,0 +1,130 @@
+// Package export writes captured events in formats for analysis outside goplow
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"goplow/internal/server"
+)
+
+// Export formats accepted by Write
+const (
+	// FormatNDJSON writes each goplow event as a line of JSON
+	FormatNDJSON = "ndjson"
+	// FormatParquet writes a columnar file with one row per tracker event
+	FormatParquet = "parquet"
+	// FormatAtomicCSV writes one row per tracker event in atomic.events columns
+	FormatAtomicCSV = "atomic-csv"
+	// FormatSDKJSON writes one line of JSON per tracker event, shaped like the
+	// Snowplow Analytics SDK output
+	FormatSDKJSON = "sdk-json"
+	// FormatEnrichedTSV writes Snowplow enriched events, one tab-separated line
+	// per tracker event
+	FormatEnrichedTSV = "enriched-tsv"
+)
+
+// Formats lists every export format
+var Formats = []string{FormatNDJSON, FormatParquet, FormatAtomicCSV, FormatSDKJSON, FormatEnrichedTSV}
+
+// formatTypes holds the content type and file extension of each format
+var formatTypes = map[string][2]string{
+	FormatNDJSON:      {"application/x-ndjson", ".ndjson"},
+	FormatParquet:     {"application/vnd.apache.parquet", ".parquet"},
+	FormatAtomicCSV:   {"text/csv; charset=utf-8", ".csv"},
+	FormatSDKJSON:     {"application/x-ndjson", ".ndjson"},
+	FormatEnrichedTSV: {"text/tab-separated-values; charset=utf-8", ".tsv"},
+}
+
+// ParseFormat validates a format name, defaulting to NDJSON
+func ParseFormat(name string) (string, error) {
+	if name == "" {
+		return FormatNDJSON, nil
+	}
+	if _, known := formatTypes[name]; !known {
+		return "", fmt.Errorf("unknown format %q, expected one of %s", name, strings.Join(Formats, ", "))
+	}
+	return name, nil
+}
+
+// ContentType returns the media type of a format
+func ContentType(format string) string {
+	return formatTypes[format][0]
+}
+
+// Extension returns the file extension of a format, including the dot
+func Extension(format string) string {
+	return formatTypes[format][1]
+}
+
+// Options control how an export writes times, so a capture reads in the
+// display_timezone and time_format of the team reviewing it
+type Options struct {
+	// Location is the zone times are written in; UTC if nil
+	Location *time.Location
+	// TimeFormat is the Go layout of times written as text, replacing each
+	// format's own layout when set; ndjson keeps RFC 3339 and Parquet typed
+	// timestamps, so goplow and other tools can read them back
+	TimeFormat string
+}
+
+// location returns the zone times are written in
+func (o Options) location() *time.Location {
+	if o.Location == nil {
+		return time.UTC
+	}
+	return o.Location
+}
+
+// formatTime formats a time in the export's zone, with TimeFormat if set or
+// else the format's own layout
+func (o Options) formatTime(timestamp time.Time, layout string) string {
+	if o.TimeFormat != "" {
+		layout = o.TimeFormat
+	}
+	return timestamp.In(o.location()).Format(layout)
+}
+
+// InLocation returns copies of events with their times in location, so ndjson
+// exports show local times while staying RFC 3339
+func InLocation(events []server.Event, location *time.Location) []server.Event {
+	localized := make([]server.Event, len(events))
+	for i, event := range events {
+		event.Timestamp = event.Timestamp.In(location)
+		event.ReceivedAt = event.ReceivedAt.In(location)
+		if event.DeviceTimestamp != nil {
+			deviceTimestamp := event.DeviceTimestamp.In(location)
+			event.DeviceTimestamp = &deviceTimestamp
+		}
+		localized[i] = event
+	}
+	return localized
+}
+
+// Write writes events to w in the given format, with times as options set
+func Write(w io.Writer, format string, events []server.Event, options Options) error {
+	switch format {
+	case FormatParquet:
+		return WriteParquet(w, Columns(), Records(events), options)
+	case FormatAtomicCSV:
+		return WriteAtomicCSV(w, Records(events), options)
+	case FormatSDKJSON:
+		return WriteSDKJSON(w, Records(events), options)
+	case FormatEnrichedTSV:
+		return WriteEnrichedTSV(w, Records(events), options)
+	default:
+		if options.Location != nil {
+			events = InLocation(events, options.Location)
+		}
+		encoder := json.NewEncoder(w)
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
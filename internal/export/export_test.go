@@ -0,0 +1,109 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"goplow/internal/server"
+)
+
+// testEvents returns a page view received at 12:30 UTC on 20 October 2025
+func testEvents() []server.Event {
+	received := time.Date(2025, 10, 20, 12, 30, 0, 0, time.UTC)
+	return []server.Event{{
+		ID:         1,
+		Schema:     "iglu:com.snowplowanalytics.snowplow/payload_data/jsonschema/1-0-4",
+		ReceivedAt: received,
+		Timestamp:  received,
+		Data:       []map[string]interface{}{{"e": "pv", "eid": "c6ef3124-b53a-4b13-a233-000000000001", "dtm": "1760963400000"}},
+	}}
+}
+
+func testOptions(t *testing.T) Options {
+	t.Helper()
+	location, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	return Options{Location: location, TimeFormat: "02/01/2006 15:04"}
+}
+
+func TestTextFormatsUseLocationAndTimeFormat(t *testing.T) {
+	options := testOptions(t)
+	for _, format := range []string{FormatAtomicCSV, FormatEnrichedTSV, FormatSDKJSON} {
+		t.Run(format, func(t *testing.T) {
+			var local, utc bytes.Buffer
+			if err := Write(&local, format, testEvents(), options); err != nil {
+				t.Fatal(err)
+			}
+			if err := Write(&utc, format, testEvents(), Options{}); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(local.String(), "20/10/2025 14:30") {
+				t.Errorf("no local collector_tstamp in %s", local.String())
+			}
+			if strings.Contains(utc.String(), "20/10/2025") || !strings.Contains(utc.String(), "2025-10-20") {
+				t.Errorf("default options changed the layout: %s", utc.String())
+			}
+		})
+	}
+}
+
+func TestSDKJSONDefaultsToUTC(t *testing.T) {
+	var out bytes.Buffer
+	if err := Write(&out, FormatSDKJSON, testEvents(), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	var event map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event["collector_tstamp"] != "2025-10-20T12:30:00Z" {
+		t.Errorf("got collector_tstamp %v", event["collector_tstamp"])
+	}
+}
+
+func TestNDJSONUsesLocation(t *testing.T) {
+	var out bytes.Buffer
+	if err := Write(&out, FormatNDJSON, testEvents(), testOptions(t)); err != nil {
+		t.Fatal(err)
+	}
+	var event server.Event
+	if err := json.Unmarshal(out.Bytes(), &event); err != nil {
+		t.Fatalf("ndjson export does not read back: %v", err)
+	}
+	if !strings.Contains(out.String(), `"2025-10-20T14:30:00+02:00"`) {
+		t.Errorf("no local RFC 3339 time in %s", out.String())
+	}
+	if !event.ReceivedAt.Equal(testEvents()[0].ReceivedAt) {
+		t.Errorf("read back %s", event.ReceivedAt)
+	}
+}
+
+func TestParquetWritesLocalTimestamps(t *testing.T) {
+	options := testOptions(t)
+	received := testEvents()[0].ReceivedAt
+
+	var values bytes.Buffer
+	writeParquetValue(&values, KindTimestamp, received, options.Location)
+	var millis int64
+	binary.Read(&values, binary.LittleEndian, &millis)
+	if want := received.Add(2 * time.Hour).UnixMilli(); millis != want {
+		t.Errorf("wrote %d, want the Paris wall clock time %d", millis, want)
+	}
+
+	var utc, local bytes.Buffer
+	if err := Write(&utc, FormatParquet, testEvents(), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(&local, FormatParquet, testEvents(), options); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(utc.Bytes(), local.Bytes()) {
+		t.Error("the Parquet file ignores the location")
+	}
+}
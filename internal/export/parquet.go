@@ -0,0 +1,380 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// parquetMagic starts and ends every Parquet file
+const parquetMagic = "PAR1"
+
+// Parquet enum values, from the parquet-format Thrift definitions
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetGzip = 2
+
+	parquetDataPage = 0
+)
+
+// WriteParquet writes records as a single row group Parquet file
+// Every column is optional and written as one gzip-compressed, plain-encoded
+// data page; strings are UTF8 byte arrays and timestamps are INT64 milliseconds,
+// since the epoch in UTC or, outside UTC, local timestamps in options.Location
+func WriteParquet(w io.Writer, columns []Column, records []Record, options Options) error {
+	// A local timestamp holds the wall clock time, so tools show it as it was
+	// in the export's zone rather than converting it to UTC
+	var local *time.Location
+	if options.location() != time.UTC {
+		local = options.location()
+	}
+
+	var file bytes.Buffer
+	file.WriteString(parquetMagic)
+
+	chunks := make([]parquetChunk, 0, len(columns))
+	if len(records) > 0 {
+		for _, column := range columns {
+			chunk, err := writeParquetColumn(&file, column, records, local)
+			if err != nil {
+				return err
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	footer := parquetFooter(columns, chunks, len(records), local != nil)
+	file.Write(footer)
+	binary.Write(&file, binary.LittleEndian, uint32(len(footer)))
+	file.WriteString(parquetMagic)
+
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// parquetChunk records where a column's data page was written
+type parquetChunk struct {
+	column           Column
+	offset           int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+// writeParquetColumn appends a column's data page to file, with timestamps as
+// wall clock times in local if it is set
+func writeParquetColumn(file *bytes.Buffer, column Column, records []Record, local *time.Location) (parquetChunk, error) {
+	// Definition levels: 1 where the record has a value, 0 where it is null
+	levels := make([]bool, len(records))
+	var values bytes.Buffer
+	for i, record := range records {
+		value, ok := record[column.Name]
+		if !ok || value == nil {
+			continue
+		}
+		levels[i] = true
+		writeParquetValue(&values, column.Kind, value, local)
+	}
+
+	encodedLevels := encodeDefinitionLevels(levels)
+	var page bytes.Buffer
+	binary.Write(&page, binary.LittleEndian, uint32(len(encodedLevels)))
+	page.Write(encodedLevels)
+	page.Write(values.Bytes())
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(page.Bytes())
+	if err := gz.Close(); err != nil {
+		return parquetChunk{}, err
+	}
+
+	var header thriftWriter
+	header.i32(1, parquetDataPage)
+	header.i32(2, int32(page.Len()))
+	header.i32(3, int32(compressed.Len()))
+	header.structBegin(5)
+	header.i32(1, int32(len(records)))
+	header.i32(2, parquetPlain)
+	header.i32(3, parquetRLE)
+	header.i32(4, parquetRLE)
+	header.structEnd()
+	header.stop()
+
+	chunk := parquetChunk{
+		column:           column,
+		offset:           int64(file.Len()),
+		uncompressedSize: int64(header.buf.Len() + page.Len()),
+		compressedSize:   int64(header.buf.Len() + compressed.Len()),
+	}
+	file.Write(header.buf.Bytes())
+	file.Write(compressed.Bytes())
+	return chunk, nil
+}
+
+// writeParquetValue plain-encodes a value, with a timestamp as the wall clock
+// time in local if it is set
+func writeParquetValue(values *bytes.Buffer, kind Kind, value interface{}, local *time.Location) {
+	switch kind {
+	case KindInt:
+		number, _ := value.(int64)
+		binary.Write(values, binary.LittleEndian, number)
+	case KindFloat:
+		number, _ := value.(float64)
+		binary.Write(values, binary.LittleEndian, math.Float64bits(number))
+	case KindTimestamp:
+		timestamp, _ := value.(time.Time)
+		millis := timestamp.UnixMilli()
+		if local != nil {
+			_, offset := timestamp.In(local).Zone()
+			millis += int64(offset) * 1000
+		}
+		binary.Write(values, binary.LittleEndian, millis)
+	default:
+		text := stringValue(value)
+		binary.Write(values, binary.LittleEndian, uint32(len(text)))
+		values.WriteString(text)
+	}
+}
+
+// encodeDefinitionLevels encodes one-bit definition levels as RLE runs of the
+// RLE/bit-packing hybrid encoding
+func encodeDefinitionLevels(levels []bool) []byte {
+	var encoded []byte
+	for start := 0; start < len(levels); {
+		end := start
+		for end < len(levels) && levels[end] == levels[start] {
+			end++
+		}
+		encoded = binary.AppendUvarint(encoded, uint64(end-start)<<1)
+		if levels[start] {
+			encoded = append(encoded, 1)
+		} else {
+			encoded = append(encoded, 0)
+		}
+		start = end
+	}
+	return encoded
+}
+
+// parquetFooter encodes the FileMetaData describing the schema and row group,
+// with local timestamps, not adjusted to UTC, if local is set
+func parquetFooter(columns []Column, chunks []parquetChunk, rows int, local bool) []byte {
+	var meta thriftWriter
+	meta.i32(1, 1)
+
+	meta.listBegin(2, thriftStruct, len(columns)+1)
+	meta.elementBegin()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.elementEnd()
+	for _, column := range columns {
+		meta.elementBegin()
+		physical, converted := parquetTypes(column.Kind)
+		meta.i32(1, physical)
+		meta.i32(3, parquetOptional)
+		meta.binary(4, column.Name)
+		if column.Kind == KindTimestamp && local {
+			// The TIMESTAMP_MILLIS converted type means UTC, so local
+			// timestamps are described by the logical type alone
+			parquetLocalTimestamp(&meta)
+		} else if converted >= 0 {
+			meta.i32(6, converted)
+		}
+		meta.elementEnd()
+	}
+
+	meta.i64(3, int64(rows))
+
+	if len(chunks) == 0 {
+		meta.listBegin(4, thriftStruct, 0)
+	} else {
+		meta.listBegin(4, thriftStruct, 1)
+		meta.elementBegin()
+		meta.listBegin(1, thriftStruct, len(chunks))
+		var total int64
+		for _, chunk := range chunks {
+			physical, _ := parquetTypes(chunk.column.Kind)
+			meta.elementBegin()
+			meta.i64(2, chunk.offset)
+			meta.structBegin(3)
+			meta.i32(1, physical)
+			meta.listBegin(2, thriftI32, 2)
+			meta.listI32(parquetPlain)
+			meta.listI32(parquetRLE)
+			meta.listBegin(3, thriftBinary, 1)
+			meta.listBinary(chunk.column.Name)
+			meta.i32(4, parquetGzip)
+			meta.i64(5, int64(rows))
+			meta.i64(6, chunk.uncompressedSize)
+			meta.i64(7, chunk.compressedSize)
+			meta.i64(9, chunk.offset)
+			meta.structEnd()
+			meta.elementEnd()
+			total += chunk.uncompressedSize
+		}
+		meta.i64(2, total)
+		meta.i64(3, int64(rows))
+		meta.elementEnd()
+	}
+
+	meta.binary(6, "goplow")
+	meta.stop()
+	return meta.buf.Bytes()
+}
+
+// parquetTypes returns the physical and converted type of a column kind, with
+// -1 for no converted type
+func parquetTypes(kind Kind) (int32, int32) {
+	switch kind {
+	case KindInt:
+		return parquetInt64, -1
+	case KindFloat:
+		return parquetDouble, -1
+	case KindTimestamp:
+		return parquetInt64, parquetTimestampMillis
+	default:
+		return parquetByteArray, parquetUTF8
+	}
+}
+
+// parquetLocalTimestamp writes the logical type of millisecond timestamps that
+// are not adjusted to UTC
+func parquetLocalTimestamp(meta *thriftWriter) {
+	meta.structBegin(10) // logicalType
+	meta.structBegin(8)  // TIMESTAMP
+	meta.boolean(1, false)
+	meta.structBegin(2) // unit
+	meta.structBegin(1) // MILLIS
+	meta.structEnd()
+	meta.structEnd()
+	meta.structEnd()
+	meta.structEnd()
+}
+
+// Thrift compact protocol type codes
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs with the Thrift compact protocol, which Parquet
+// uses for its page headers and footer
+type thriftWriter struct {
+	buf bytes.Buffer
+	// lastField holds the previous field ID of each open struct, innermost last
+	lastField []int16
+}
+
+// field writes a field header, using the short delta form when it fits
+func (t *thriftWriter) field(id int16, fieldType byte) {
+	last := int16(0)
+	if len(t.lastField) > 0 {
+		last = t.lastField[len(t.lastField)-1]
+		t.lastField[len(t.lastField)-1] = id
+	} else {
+		t.lastField = append(t.lastField, id)
+	}
+	if delta := id - last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | fieldType)
+		return
+	}
+	t.buf.WriteByte(fieldType)
+	t.varint(zigzag(int64(id)))
+}
+
+func (t *thriftWriter) varint(value uint64) {
+	t.buf.Write(binary.AppendUvarint(nil, value))
+}
+
+func zigzag(value int64) uint64 {
+	return uint64((value << 1) ^ (value >> 63))
+}
+
+func (t *thriftWriter) i32(id int16, value int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(value)))
+}
+
+func (t *thriftWriter) i64(id int16, value int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(value))
+}
+
+// boolean writes a bool field, whose value is its type code
+func (t *thriftWriter) boolean(id int16, value bool) {
+	if value {
+		t.field(id, thriftTrue)
+		return
+	}
+	t.field(id, thriftFalse)
+}
+
+func (t *thriftWriter) binary(id int16, value string) {
+	t.field(id, thriftBinary)
+	t.listBinary(value)
+}
+
+// structBegin opens a struct field; close it with structEnd
+func (t *thriftWriter) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.elementBegin()
+}
+
+func (t *thriftWriter) structEnd() {
+	t.elementEnd()
+}
+
+// listBegin writes a list field header; the elements follow
+func (t *thriftWriter) listBegin(id int16, elementType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elementType)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elementType)
+	t.varint(uint64(size))
+}
+
+// elementBegin opens a struct written as a list element
+func (t *thriftWriter) elementBegin() {
+	t.lastField = append(t.lastField, 0)
+}
+
+// elementEnd closes the innermost struct
+func (t *thriftWriter) elementEnd() {
+	t.stop()
+	t.lastField = t.lastField[:len(t.lastField)-1]
+}
+
+func (t *thriftWriter) listI32(value int32) {
+	t.varint(zigzag(int64(value)))
+}
+
+func (t *thriftWriter) listBinary(value string) {
+	t.varint(uint64(len(value)))
+	t.buf.WriteString(value)
+}
+
+// stop ends a struct's fields
+func (t *thriftWriter) stop() {
+	t.buf.WriteByte(0)
+}
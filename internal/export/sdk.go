@@ -0,0 +1,165 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// sdkTimestampFormat matches the ISO 8601 timestamps of the Analytics SDKs
+const sdkTimestampFormat = "2006-01-02T15:04:05.999Z07:00"
+
+// WriteSDKJSON writes records as lines of JSON in the shape produced by the
+// Snowplow Analytics SDKs, with timestamps written as options set
+func WriteSDKJSON(w io.Writer, records []Record, options Options) error {
+	encoder := json.NewEncoder(w)
+	for _, record := range records {
+		if err := encoder.Encode(SDKEvent(record, options)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SDKEvent flattens a record like the Analytics SDKs: atomic columns keep their
+// names, null columns are omitted, the self-describing event becomes an
+// unstruct_event_<vendor>_<name>_<model> field and each context type a
+// contexts_<vendor>_<name>_<model> array
+func SDKEvent(record Record, options Options) map[string]interface{} {
+	event := make(map[string]interface{})
+	for _, column := range AtomicColumns {
+		value, ok := record[column.Name]
+		if !ok || value == nil {
+			continue
+		}
+		switch column.Name {
+		case "unstruct_event":
+			addSDKUnstructEvent(event, value)
+		case "contexts":
+			addSDKContexts(event, value)
+		default:
+			if timestamp, ok := value.(time.Time); ok {
+				value = options.formatTime(timestamp, sdkTimestampFormat)
+			}
+			event[column.Name] = value
+		}
+	}
+	for field, value := range record {
+		if _, exists := event[field]; !exists && isSDKField(field) {
+			event[field] = value
+		}
+	}
+	return event
+}
+
+// unstructEventSchema is the envelope schema of the unstruct_event column
+const unstructEventSchema = "iglu:com.snowplowanalytics.snowplow/unstruct_event/jsonschema/1-0-0"
+
+// isSDKField reports whether a field holds Analytics SDK self-describing data,
+// which is carried through records unchanged when its schema URI is unknown
+func isSDKField(field string) bool {
+	return strings.HasPrefix(field, "contexts_") || strings.HasPrefix(field, "unstruct_event_")
+}
+
+// ReadSDKJSON reads lines of Analytics SDK JSON
+// The self-describing event is rebuilt from the event_vendor, event_name,
+// event_format and event_version columns; context fields cannot be mapped back
+// to full schema URIs, so they are carried through unchanged
+func ReadSDKJSON(r io.Reader) ([]Record, error) {
+	var records []Record
+	decoder := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var event map[string]interface{}
+		if err := decoder.Decode(&event); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("event %d: %w", line, err)
+		}
+
+		record := make(Record)
+		for field, value := range event {
+			switch {
+			case strings.HasPrefix(field, "unstruct_event_") && event["event_vendor"] != nil:
+				schema := fmt.Sprintf("iglu:%s/%s/%s/%s", event["event_vendor"], event["event_name"], event["event_format"], event["event_version"])
+				record["unstruct_event"] = marshalString(selfDescribing{
+					Schema: unstructEventSchema,
+					Data:   selfDescribing{Schema: schema, Data: value},
+				})
+			case isSDKField(field):
+				record[field] = value
+			default:
+				if _, known := columnKinds[field]; known {
+					record.set(field, stringValue(value))
+				}
+			}
+		}
+		records = append(records, record)
+	}
+}
+
+// addSDKUnstructEvent adds the data of an unstruct_event envelope
+func addSDKUnstructEvent(event map[string]interface{}, value interface{}) {
+	var envelope struct {
+		Data selfDescribing `json:"data"`
+	}
+	if json.Unmarshal([]byte(stringValue(value)), &envelope) != nil {
+		return
+	}
+	if key, ok := sdkFieldName("unstruct_event", envelope.Data.Schema); ok {
+		event[key] = envelope.Data.Data
+	}
+}
+
+// addSDKContexts groups the data of a contexts envelope by context type
+func addSDKContexts(event map[string]interface{}, value interface{}) {
+	var envelope struct {
+		Data []selfDescribing `json:"data"`
+	}
+	if json.Unmarshal([]byte(stringValue(value)), &envelope) != nil {
+		return
+	}
+	for _, context := range envelope.Data {
+		key, ok := sdkFieldName("contexts", context.Schema)
+		if !ok {
+			continue
+		}
+		existing, _ := event[key].([]interface{})
+		event[key] = append(existing, context.Data)
+	}
+}
+
+// selfDescribing is self-describing JSON: data with the schema it conforms to
+type selfDescribing struct {
+	Schema string      `json:"schema"`
+	Data   interface{} `json:"data"`
+}
+
+// sdkFieldName names the field for an Iglu schema the way the Analytics SDKs
+// do, e.g. contexts_com_snowplowanalytics_snowplow_web_page_1
+func sdkFieldName(prefix string, uri string) (string, bool) {
+	parts := strings.Split(strings.TrimPrefix(uri, "iglu:"), "/")
+	if len(parts) != 4 {
+		return "", false
+	}
+	model, _, _ := strings.Cut(parts[3], "-")
+	vendor := strings.NewReplacer(".", "_", "-", "_").Replace(parts[0])
+	name := strings.ReplaceAll(camelToSnake(parts[1]), "-", "_")
+	return strings.ToLower(prefix + "_" + vendor + "_" + name + "_" + model), true
+}
+
+// camelToSnake inserts an underscore before each upper case letter that
+// follows a lower case letter or digit
+func camelToSnake(name string) string {
+	var snake strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])) {
+			snake.WriteByte('_')
+		}
+		snake.WriteRune(unicode.ToLower(r))
+	}
+	return snake.String()
+}
@@ -0,0 +1,51 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// tsvEscaper replaces the characters that would break a TSV row, as Snowplow
+// enrich does
+var tsvEscaper = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// WriteEnrichedTSV writes records as Snowplow enriched events: one
+// tab-separated line per record with the atomic.events columns in table order,
+// with timestamps written as options set
+func WriteEnrichedTSV(w io.Writer, records []Record, options Options) error {
+	writer := bufio.NewWriter(w)
+	fields := make([]string, len(AtomicColumns))
+	for _, record := range records {
+		for i, column := range AtomicColumns {
+			fields[i] = tsvEscaper.Replace(formatCSVValue(record[column.Name], options))
+		}
+		if _, err := writer.WriteString(strings.Join(fields, "\t") + "\n"); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// ReadEnrichedTSV reads Snowplow enriched events, one tab-separated line each
+func ReadEnrichedTSV(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != len(AtomicColumns) {
+			return nil, fmt.Errorf("line %d has %d fields, expected %d", line, len(fields), len(AtomicColumns))
+		}
+		record := make(Record)
+		for i, column := range AtomicColumns {
+			record.set(column.Name, fields[i])
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
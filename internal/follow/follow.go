@@ -0,0 +1,121 @@
+package follow
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"goplow/internal/outbound"
+	"goplow/internal/server"
+)
+
+// reconnectDelay is how long to wait before reconnecting to the remote stream
+const reconnectDelay = 3 * time.Second
+
+// Follower subscribes to a remote goplow instance's stream of stored events
+// and mirrors them into the local server
+type Follower struct {
+	remoteURL string
+	appServer *server.AppServer
+	client    *outbound.Client
+}
+
+// New creates a follower for the goplow instance at remoteURL, connecting through client
+func New(remoteURL string, appServer *server.AppServer, client *outbound.Client) *Follower {
+	return &Follower{
+		remoteURL: strings.TrimSuffix(remoteURL, "/"),
+		appServer: appServer,
+		client:    client,
+	}
+}
+
+// StreamURL returns the JSON Lines stream of the remote instance, which sends
+// each event as it was stored, without display transforms or control messages
+func (f *Follower) StreamURL() string {
+	return f.remoteURL + "/api/stream.jsonl"
+}
+
+// Run follows the remote stream until the context is cancelled, reconnecting
+// whenever the connection drops
+func (f *Follower) Run(ctx context.Context) {
+	for {
+		log.Printf("Following remote events from %s\n", f.StreamURL())
+		if err := f.stream(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Remote stream error: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// stream reads events from the remote instance until the connection ends
+func (f *Follower) stream(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.StreamURL(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/x-ndjson")
+
+	resp, err := f.client.Stream(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	// Event payloads with large contexts can exceed the default token size
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := f.mirror(line); err != nil {
+			log.Printf("Skipping remote event: %v\n", err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("remote stream closed")
+}
+
+// mirror decodes one stored event and adds it to the local server, keeping
+// its namespace, enrichments, session and trace
+// The data is the remote's raw data, so local display transforms apply once
+func (f *Follower) mirror(line []byte) error {
+	var event server.Event
+	if err := json.Unmarshal(line, &event); err != nil {
+		return err
+	}
+	if len(event.Data) == 0 {
+		return fmt.Errorf("event %d has no data", event.ID)
+	}
+
+	// The local server numbers the event, and validates, summarizes, labels
+	// and orders it with its own schemas and rules
+	event.ID = 0
+	event.Violations = nil
+	event.Summary = ""
+	event.Classification = nil
+	event.OutOfOrder = false
+	event.Mirrored = true
+	f.appServer.AddEventRecord(event)
+	return nil
+}
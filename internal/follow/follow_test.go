@@ -0,0 +1,66 @@
+package follow
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"goplow/internal/outbound"
+	"goplow/internal/server"
+)
+
+func TestFollowerMirrorsStoredEvents(t *testing.T) {
+	stored := server.Event{
+		ID:        41,
+		Schema:    "iglu:com.snowplowanalytics.snowplow/payload_data/jsonschema/1-0-4",
+		Data:      []map[string]interface{}{{"e": "pv", "url": "https://shop.example/"}},
+		Timestamp: time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		Namespace: "/com.acme/events",
+		Enriched:  map[string]interface{}{"user_ipaddress": "203.0.113.7", "geo_country": "GB"},
+		Session:   &server.Session{Name: "release-1.42 smoke"},
+		Trace:     &server.TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"},
+		Summary:   "remote summary",
+	}
+	line, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/stream.jsonl" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write(append(line, '\n'))
+	}))
+	defer remote.Close()
+
+	config := server.EnvironmentConfig{MaxMsgs: 10, DataDir: t.TempDir()}
+	appServer := server.New(config)
+	client, err := outbound.NewClient(outbound.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower := New(remote.URL, appServer, client)
+	if err := follower.stream(context.Background()); err == nil {
+		t.Fatal("expected the stream to end with an error")
+	}
+
+	events := appServer.GetEvents()
+	if len(events) != 1 {
+		t.Fatalf("mirrored %d events, want 1", len(events))
+	}
+	event := events[0]
+	if event.ID != 1 || event.Namespace != stored.Namespace || event.Enriched["geo_country"] != "GB" {
+		t.Errorf("mirrored %+v, want the stored event renumbered", event)
+	}
+	if event.Session == nil || event.Session.Name != stored.Session.Name || event.Trace == nil || event.Trace.TraceID != stored.Trace.TraceID {
+		t.Errorf("mirrored session %+v and trace %+v, want the remote's", event.Session, event.Trace)
+	}
+	if !event.Timestamp.Equal(stored.Timestamp) || event.Data[0]["url"] != "https://shop.example/" || event.Summary != "" {
+		t.Errorf("mirrored %+v, want the remote's time and raw data, without its summary", event)
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// WithAccessControl rejects requests from client IPs that the ingest or admin
+// access lists do not allow
+// Routes registered for ingest endpoints use the ingest lists; every other
+// route (web interface, API, schemas) uses the admin lists. The health route
+// is always reachable so container healthchecks keep working.
+func WithAccessControl(appServer *server.AppServer, router *Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := router.Handler(r)
+		ip := clientIP(r)
+
+		switch {
+		case pattern == HealthPath:
+		case router.IsIngest(pattern):
+			if !appServer.AllowsIngestFrom(ip) {
+				log.Printf("Rejected ingest request from %s to %s\n", ip, r.URL.Path)
+				utils.WriteProblem(w, r, http.StatusForbidden, utils.CodeForbidden, "Your address may not send events to this collector")
+				return
+			}
+		default:
+			if !appServer.AllowsAdminFrom(ip) {
+				utils.WriteProblem(w, r, http.StatusForbidden, utils.CodeForbidden, "Your address may not view this collector")
+				return
+			}
+		}
+		router.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// readAdapterBody reads the body of a request to an adapter endpoint, writing
+// the problem and returning false if it cannot be read or is too large
+func readAdapterBody(w http.ResponseWriter, r *http.Request, appServer *server.AppServer, capture *bodyCapture, name string) ([]byte, bool) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody+1))
+	if err != nil {
+		rejectIngest(w, r, appServer, capture, http.StatusBadRequest, utils.CodeInvalidDataFormat, "Could not read "+name+" payload", server.BadEvent{Error: err.Error()})
+		return nil, false
+	}
+	if len(body) > maxWebhookBody {
+		rejectIngest(w, r, appServer, capture, http.StatusRequestEntityTooLarge, utils.CodeInvalidDataFormat, name+" payload is too large", server.BadEvent{})
+		return nil, false
+	}
+	return body, true
+}
+
+// adapterSubpath returns the part of the request path under the endpoint's
+// path, such as "v1/track" for /segment/v1/track, or "" for the path itself
+func adapterSubpath(r *http.Request, endpoint server.EndpointConfig) string {
+	return strings.Trim(strings.TrimPrefix(r.URL.Path, server.NormalizeEndpointPath(endpoint.Path)), "/")
+}
+
+// addAdapterEvent stores an item received by an adapter endpoint as an event
+// Events are namespaced by the endpoint's path, so every path of a mounted
+// adapter shares one namespace
+func addAdapterEvent(r *http.Request, appServer *server.AppServer, endpoint server.EndpointConfig, schema string, item map[string]interface{}, enriched map[string]interface{}, receivedAt time.Time) {
+	fields := ingestFields(r, nil)
+	for field, value := range enriched {
+		fields[field] = value
+	}
+	appServer.AddEventRecordContext(r.Context(), server.Event{
+		Schema:    schema,
+		Data:      []map[string]interface{}{item},
+		Timestamp: receivedAt,
+		Namespace: server.NormalizeEndpointPath(endpoint.Path),
+		Enriched:  fields,
+		Trace:     eventTrace(r, nil),
+		RunID:     requestRunID(r, appServer),
+	})
+}
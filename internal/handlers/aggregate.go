@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// aggregateResponse is the body of GET /api/aggregate
+type aggregateResponse struct {
+	GroupBy  []string `json:"groupBy"`
+	Metric   string   `json:"metric"`
+	Interval string   `json:"interval,omitempty"`
+	// Rows counts the tracker events aggregated
+	Rows   int                     `json:"rows"`
+	Groups []server.AggregateGroup `json:"groups"`
+}
+
+// HandleAggregate groups buffered tracker events by field paths and time
+// buckets, e.g. ?group_by=data.se_ca&metric=count&interval=1m for events per
+// category per minute
+// trace_id and run_id limit it to the events of a distributed trace or test run
+func HandleAggregate(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	params := r.URL.Query()
+	query, err := server.ParseAggregateQuery(params.Get("group_by"), params.Get("metric"), params.Get("interval"))
+	if err != nil {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, err.Error())
+		return
+	}
+
+	events := appServer.GetEvents()
+	if traceID := params.Get("trace_id"); traceID != "" {
+		events = server.FilterEventsByTrace(events, traceID)
+	}
+	if runID := params.Get("run_id"); runID != "" {
+		events = server.FilterEventsByRun(events, runID)
+	}
+
+	groups, rows, err := server.Aggregate(events, query)
+	if err != nil {
+		log.Printf("Error aggregating events: %v\n", err)
+		utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeInternalError, "Events could not be aggregated")
+		return
+	}
+
+	response := aggregateResponse{
+		GroupBy: make([]string, len(query.GroupBy)),
+		Metric:  query.Metric,
+		Rows:    rows,
+		Groups:  groups,
+	}
+	for i, path := range query.GroupBy {
+		response.GroupBy[i] = path.String()
+	}
+	if query.MetricPath != nil {
+		response.Metric = query.Metric + ":" + query.MetricPath.String()
+	}
+	if query.Interval > 0 {
+		response.Interval = query.Interval.String()
+	}
+	if err := utils.WriteCachedJSON(w, r, response); err != nil {
+		log.Printf("Error writing aggregate: %v\n", err)
+	}
+}
@@ -0,0 +1,33 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAggregateReportsUnencodableResultsAsProblems(t *testing.T) {
+	appServer, router := newTestServer(t, 100, nil)
+	// Two finite values whose sum overflows to +Inf, which JSON cannot encode
+	body, _ := json.Marshal(map[string]interface{}{
+		"schema": payloadDataSchema,
+		"data": []map[string]interface{}{
+			{"e": "se", "se_ca": "shop", "se_ac": "buy", "se_va": "1e308"},
+			{"e": "se", "se_ca": "shop", "se_ac": "buy", "se_va": "1e308"},
+		},
+	})
+	if err := postPayload(router, appServer.GetEventsEndpoint(), body); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/aggregate?group_by=data.se_ca&metric=sum:data.se_va", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want 500: %s", rec.Code, rec.Body)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Errorf("got content type %q, want a problem", contentType)
+	}
+}
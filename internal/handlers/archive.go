@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// archivesPrefix is the path prefix for individual archives
+const archivesPrefix = "/api/archives/"
+
+// archiveRequest is the optional body accepted by the archive endpoint
+type archiveRequest struct {
+	Clear bool `json:"clear"`
+}
+
+// HandleArchive writes the buffered events to a compressed archive in the data
+// directory, clearing the buffer if asked to
+func HandleArchive(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodPost {
+		utils.WriteMethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	var req archiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidJSON, "Invalid JSON payload")
+		return
+	}
+
+	info, err := appServer.ArchiveEvents(req.Clear, requestActor(r))
+	if err != nil {
+		log.Printf("Error archiving events: %v\n", err)
+		utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeArchiveFailed, "Events could not be archived")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(info)
+}
+
+// HandleListArchives lists the capture archives in the data directory, newest first
+func HandleListArchives(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	archives, err := appServer.ListArchives()
+	if err != nil {
+		log.Printf("Error listing archives: %v\n", err)
+		utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeArchiveFailed, "Archives could not be listed")
+		return
+	}
+	if err := utils.WriteCachedJSON(w, r, archives); err != nil {
+		log.Printf("Error writing archives: %v\n", err)
+	}
+}
+
+// HandleArchiveFile downloads an archive (GET /api/archives/{name}) or its
+// manifest (GET /api/archives/{name}/manifest), or loads it back into the buffer
+// (POST /api/archives/{name}/load)
+func HandleArchiveFile(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if name, manifest := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, archivesPrefix), "/manifest"); manifest {
+		if r.Method != http.MethodGet {
+			utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		writeArchiveManifest(w, r, appServer, name)
+		return
+	}
+
+	name, load := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, archivesPrefix), "/load")
+
+	if load {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		loaded, err := appServer.LoadArchive(name, requestActor(r))
+		if err != nil {
+			writeArchiveError(w, r, name, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "loaded": loaded})
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	path, err := appServer.ArchivePath(name)
+	if err != nil {
+		writeArchiveError(w, r, name, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeFile(w, r, path)
+}
+
+// writeArchiveManifest writes the manifest saved with an archive
+func writeArchiveManifest(w http.ResponseWriter, r *http.Request, appServer *server.AppServer, name string) {
+	manifest, err := appServer.ReadArchiveManifest(name)
+	if errors.Is(err, server.ErrManifestNotFound) {
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeManifestNotFound, "Archive "+name+" was written without a manifest")
+		return
+	}
+	if err != nil {
+		writeArchiveError(w, r, name, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+// writeArchiveError reports a missing archive as 404 and anything else as 500
+func writeArchiveError(w http.ResponseWriter, r *http.Request, name string, err error) {
+	if errors.Is(err, server.ErrArchiveNotFound) {
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeArchiveNotFound, "No archive named "+name)
+		return
+	}
+	log.Printf("Error reading archive %s: %v\n", name, err)
+	utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeArchiveFailed, "Archive could not be read")
+}
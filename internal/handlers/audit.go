@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// defaultAuditLimit is how many audit entries are returned without a limit parameter
+const defaultAuditLimit = 100
+
+// HandleGetAudit returns the latest audit log entries as JSON, oldest first
+// The optional limit query parameter sets how many (0 for all)
+func HandleGetAudit(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	limit := defaultAuditLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "Invalid limit - must be a non-negative integer")
+			return
+		}
+		limit = parsed
+	}
+
+	entries, err := appServer.GetAuditEntries(limit)
+	if err != nil {
+		log.Printf("Error reading audit log: %v\n", err)
+		utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeAuditUnavailable, "Audit log could not be read")
+		return
+	}
+	if err := utils.WriteCachedJSON(w, r, entries); err != nil {
+		log.Printf("Error writing audit log: %v\n", err)
+	}
+}
+
+// requestActor identifies who made an admin request: the user reported by a
+// trusted proxy (X-Forwarded-User), the client address and the user agent
+func requestActor(r *http.Request) server.Actor {
+	return server.Actor{
+		User:      r.Header.Get("X-Forwarded-User"),
+		Address:   clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
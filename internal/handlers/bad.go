@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// HandleGetBadEvents returns the buffered rejected events as JSON
+func HandleGetBadEvents(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	bad := appServer.GetBadEvents()
+	start, end, ok := pageWindow(w, r, len(bad), func(i int) int { return bad[i].ID })
+	if !ok {
+		return
+	}
+	if err := utils.WriteCachedJSON(w, r, bad[start:end]); err != nil {
+		log.Printf("Error writing bad events list: %v\n", err)
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// batchesPrefix is the path prefix of the batch API, /api/batches/{id}
+const batchesPrefix = "/api/batches/"
+
+// HandleBatch returns a tracker batch reassembled from its buffered events, in
+// the order they were flushed
+func HandleBatch(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, batchesPrefix)
+	if id == "" || strings.Contains(id, "/") {
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeNotFound, "Not found")
+		return
+	}
+
+	batch, found := appServer.GetBatch(id)
+	if !found {
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeBatchNotFound, "No buffered events from batch "+id)
+		return
+	}
+	if err := utils.WriteCachedJSON(w, r, batch); err != nil {
+		log.Printf("Error writing batch %s: %v\n", id, err)
+	}
+}
@@ -0,0 +1,326 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"goplow/internal/enrich"
+	"goplow/internal/handlers"
+	"goplow/internal/server"
+	"goplow/internal/validation"
+)
+
+// budget enables TestPerformanceBudget, which is sensitive to the machine and
+// its load: go test ./internal/handlers -run PerformanceBudget -budget
+var budget = flag.Bool("budget", false, "check the ingest benchmarks against the performance budget")
+
+// Performance budget
+const (
+	// eventBudget is the slowest acceptable ingest time per event, for a
+	// sustained 10,000 events per second on one core
+	eventBudget = 100 * time.Microsecond
+	// bufferEvents is the buffer size the heap budget is measured at
+	bufferEvents = 10000
+	// heapBudget is the largest acceptable heap with a full buffer of
+	// bufferEvents events, keeping steady RSS under 50MB
+	heapBudget = 40 << 20
+)
+
+// broadcastClients is the number of SSE clients connected in BenchmarkBroadcast
+const broadcastClients = 10
+
+// budgetCases are the hot path benchmarks and their budgets
+var budgetCases = []struct {
+	name string
+	// events is the number of events each benchmark operation handles
+	events int
+	budget time.Duration
+	f      func(b *testing.B)
+}{
+	{"Ingest", 1, eventBudget, BenchmarkIngest},
+	{"IngestBatch", 100, eventBudget, BenchmarkIngestBatch},
+	{"Enrich", 1, 10 * time.Microsecond, BenchmarkEnrich},
+	{"Validate", 1, 30 * time.Microsecond, BenchmarkValidate},
+	{"Broadcast", 1, eventBudget, BenchmarkBroadcast},
+}
+
+// TestPerformanceBudget runs the hot path benchmarks and fails for any over
+// its budget per event, or if a full buffer takes more heap than heapBudget
+func TestPerformanceBudget(t *testing.T) {
+	if !*budget {
+		t.Skip("run with -budget to check the performance budget")
+	}
+
+	for _, c := range budgetCases {
+		result := testing.Benchmark(c.f)
+		perEvent := time.Duration(result.NsPerOp() / int64(c.events))
+		t.Logf("%-12s %s/event (budget %s), %d B/op, %d allocs/op", c.name, perEvent.Round(10*time.Nanosecond), c.budget, result.AllocedBytesPerOp(), result.AllocsPerOp())
+		if perEvent > c.budget {
+			t.Errorf("%s takes %s per event, over its budget of %s", c.name, perEvent, c.budget)
+		}
+	}
+
+	heap := bufferHeap(t)
+	t.Logf("Heap with %d buffered events: %.1f MB (budget %d MB)", bufferEvents, float64(heap)/(1<<20), heapBudget>>20)
+	if heap > heapBudget {
+		t.Errorf("heap with %d buffered events is %.1f MB, over its budget of %d MB", bufferEvents, float64(heap)/(1<<20), heapBudget>>20)
+	}
+}
+
+// BenchmarkIngest posts single page views through the events endpoint, with the
+// default enrichments and validation
+func BenchmarkIngest(b *testing.B) {
+	benchmarkIngest(b, 1)
+}
+
+// BenchmarkIngestBatch posts batches of 100 events, as mobile trackers flush them
+func BenchmarkIngestBatch(b *testing.B) {
+	benchmarkIngest(b, 100)
+}
+
+func benchmarkIngest(b *testing.B, batch int) {
+	appServer, router := newTestServer(b, bufferEvents, nil)
+	body := payload(batch)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := postPayload(router, appServer.GetEventsEndpoint(), body); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*batch), "ns/event")
+}
+
+// BenchmarkEnrich runs the default enrichments over a page view
+func BenchmarkEnrich(b *testing.B) {
+	enrichers := []server.Enricher{&enrich.CampaignAttribution{}, enrich.NewEventFingerprint(enrich.DefaultFingerprintExclude)}
+	item := pageView(0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		event := server.Event{
+			Schema:   payloadDataSchema,
+			Data:     []map[string]interface{}{item},
+			Enriched: map[string]interface{}{"user_ipaddress": "203.0.113.7", "useragent": userAgent},
+		}
+		for _, enricher := range enrichers {
+			enricher.Enrich(&event)
+		}
+	}
+}
+
+// BenchmarkValidate validates a self-describing event with two contexts
+func BenchmarkValidate(b *testing.B) {
+	validator := validation.New(schemas)
+	event := server.Event{Schema: payloadDataSchema, Data: []map[string]interface{}{selfDescribing(0)}}
+	if violations := validator.Validate(event); len(violations) > 0 {
+		b.Fatalf("benchmark event is invalid: %v", violations)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		validator.Validate(event)
+	}
+}
+
+// BenchmarkBroadcast stores events and waits for them to reach connected SSE clients
+func BenchmarkBroadcast(b *testing.B) {
+	appServer, _ := newTestServer(b, bufferEvents, map[string]string{"sse_queue_size": fmt.Sprint(b.N + 1)})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	writers := make([]*streamWriter, broadcastClients)
+	for i := range writers {
+		writers[i] = &streamWriter{header: make(http.Header)}
+		client, err := appServer.AddSSEClient(fmt.Sprintf("bench_%d", i), writers[i], nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		go appServer.ServeSSEClient(ctx, client)
+	}
+	item := pageView(0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		appServer.AddEventRecord(server.Event{
+			Schema:   payloadDataSchema,
+			Data:     []map[string]interface{}{item},
+			Enriched: map[string]interface{}{"user_ipaddress": "203.0.113.7", "useragent": userAgent},
+		})
+	}
+	for _, writer := range writers {
+		for writer.frames.Load() < int64(b.N) {
+			runtime.Gosched()
+		}
+	}
+}
+
+// bufferHeap fills a buffer of bufferEvents events through the events endpoint
+// and returns the heap in use afterwards
+func bufferHeap(t *testing.T) uint64 {
+	appServer, router := newTestServer(t, bufferEvents, nil)
+	body := payload(100)
+	for i := 0; i < bufferEvents/100; i++ {
+		if err := postPayload(router, appServer.GetEventsEndpoint(), body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if events := len(appServer.GetEvents()); events != bufferEvents {
+		t.Fatalf("buffered %d events, expected %d", events, bufferEvents)
+	}
+
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	runtime.KeepAlive(appServer)
+	return stats.HeapInuse
+}
+
+// newTestServer returns a server with the default enrichments, validation and
+// routes, buffering up to maxMessages events, with config overrides keyed by
+// config key
+func newTestServer(tb testing.TB, maxMessages int, overrides map[string]string) (*server.AppServer, *handlers.Router) {
+	tb.Helper()
+	flags := map[string]string{"max_messages": fmt.Sprint(maxMessages)}
+	for key, value := range overrides {
+		flags[key] = value
+	}
+	config, _, err := server.LoadContainerConfig(flags)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	config.DataDir = tb.TempDir()
+	appServer := server.New(config)
+	if err := enrich.Configure(appServer); err != nil {
+		tb.Fatal(err)
+	}
+	appServer.SetValidator(validation.New(schemas))
+	router := handlers.NewRouter()
+	handlers.RegisterRoutes(router, appServer)
+	return appServer, router
+}
+
+// postPayload posts a tracker payload to the events endpoint
+func postPayload(router http.Handler, path string, body []byte) error {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		return fmt.Errorf("ingest returned status %d: %s", rec.Code, rec.Body)
+	}
+	return nil
+}
+
+// streamWriter is an SSE connection that counts the frames written to it
+type streamWriter struct {
+	header http.Header
+	frames atomic.Int64
+}
+
+func (w *streamWriter) Header() http.Header { return w.header }
+
+func (w *streamWriter) WriteHeader(int) {}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.frames.Add(1)
+	return len(p), nil
+}
+
+func (w *streamWriter) Flush() {}
+
+const (
+	payloadDataSchema = "iglu:com.snowplowanalytics.snowplow/payload_data/jsonschema/1-0-4"
+	contextsSchema    = "iglu:com.snowplowanalytics.snowplow/contexts/jsonschema/1-0-0"
+	unstructSchema    = "iglu:com.snowplowanalytics.snowplow/unstruct_event/jsonschema/1-0-0"
+	userAgent         = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+)
+
+// schemas is the Iglu registry used for validation: a page context and a
+// checkout event
+var schemas = fstest.MapFS{
+	"com.acme/page/jsonschema/1-0-0": {Data: []byte(`{
+		"type": "object",
+		"properties": {
+			"pageType": {"type": "string", "enum": ["home", "product", "checkout"]},
+			"language": {"type": "string", "maxLength": 8}
+		},
+		"required": ["pageType"],
+		"additionalProperties": false
+	}`)},
+	"com.acme/checkout_step/jsonschema/1-0-0": {Data: []byte(`{
+		"type": "object",
+		"properties": {
+			"step": {"type": "integer", "minimum": 1},
+			"total": {"type": "number"},
+			"currency": {"type": "string", "pattern": "^[A-Z]{3}$"}
+		},
+		"required": ["step", "currency"]
+	}`)},
+}
+
+// payload returns a tracker payload of batch events, mostly page views with a
+// self-describing event every tenth item
+func payload(batch int) []byte {
+	data := make([]map[string]interface{}, batch)
+	for i := range data {
+		data[i] = pageView(i)
+		if i%10 == 9 {
+			data[i] = selfDescribing(i)
+		}
+	}
+	body, _ := json.Marshal(map[string]interface{}{"schema": payloadDataSchema, "data": data})
+	return body
+}
+
+// pageView returns a page view tracker event with a page context
+func pageView(n int) map[string]interface{} {
+	return map[string]interface{}{
+		"e":      "pv",
+		"eid":    fmt.Sprintf("c6ef3124-b53a-4b13-a233-%012d", n),
+		"aid":    "shop",
+		"p":      "web",
+		"tv":     "js-3.17.0",
+		"tna":    "sp",
+		"duid":   "5c1b1a0e-6ff2-4d5f-8a6c-0d3b7a9e4f21",
+		"sid":    "f0d5c9a4-2f7e-4d9b-9d0b-1c2e3f4a5b6c",
+		"vid":    "3",
+		"url":    "https://shop.acme.com/products/42?utm_source=newsletter&utm_medium=email&utm_campaign=spring",
+		"page":   "Product 42",
+		"refr":   "https://www.google.com/",
+		"res":    "1920x1080",
+		"vp":     "1280x720",
+		"lang":   "en-GB",
+		"dtm":    "1760000000000",
+		"stm":    "1760000000100",
+		"cookie": "1",
+		"cs":     "UTF-8",
+		"tz":     "Europe/London",
+		"co":     `{"schema":"` + contextsSchema + `","data":[{"schema":"iglu:com.acme/page/jsonschema/1-0-0","data":{"pageType":"product","language":"en"}}]}`,
+	}
+}
+
+// selfDescribing returns a self-describing tracker event with two contexts
+func selfDescribing(n int) map[string]interface{} {
+	item := pageView(n)
+	item["e"] = "ue"
+	item["ue_pr"] = `{"schema":"` + unstructSchema + `","data":{"schema":"iglu:com.acme/checkout_step/jsonschema/1-0-0","data":{"step":2,"total":59.99,"currency":"GBP"}}}`
+	item["co"] = `{"schema":"` + contextsSchema + `","data":[` +
+		`{"schema":"iglu:com.acme/page/jsonschema/1-0-0","data":{"pageType":"checkout","language":"en"}},` +
+		`{"schema":"iglu:com.acme/page/jsonschema/1-0-0","data":{"pageType":"product"}}]}`
+	return item
+}
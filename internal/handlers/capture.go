@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"goplow/internal/server"
+)
+
+// bodyCapture keeps the first limit bytes read from a request body, so payloads
+// that fail to parse can be recorded in the bad events stream
+type bodyCapture struct {
+	limit     int
+	buffer    []byte
+	truncated bool
+}
+
+// captureBody wraps the request body so that the first limitKB kilobytes read are captured
+// A negative limit disables capture and returns nil
+func captureBody(r *http.Request, limitKB int) *bodyCapture {
+	if limitKB < 0 {
+		return nil
+	}
+	capture := &bodyCapture{limit: limitKB * 1024}
+	// Size the buffer up front for bodies of known length, so it is not regrown as they are read
+	if r.ContentLength > 0 {
+		capture.buffer = make([]byte, 0, min(r.ContentLength, int64(capture.limit)))
+	}
+	r.Body = readCloser{Reader: io.TeeReader(r.Body, capture), Closer: r.Body}
+	return capture
+}
+
+// Write keeps bytes up to the limit and discards the rest
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	remaining := c.limit - len(c.buffer)
+	if len(p) > remaining {
+		c.buffer = append(c.buffer, p[:remaining]...)
+		c.truncated = true
+	} else {
+		c.buffer = append(c.buffer, p...)
+	}
+	return len(p), nil
+}
+
+// record reads any unread body up to the limit, so a parser that stopped early
+// does not hide the rest of the payload, and fills in the bad event's body
+func (c *bodyCapture) record(r *http.Request, bad *server.BadEvent) {
+	if c == nil {
+		return
+	}
+	if !c.truncated {
+		io.Copy(io.Discard, io.LimitReader(r.Body, int64(c.limit-len(c.buffer)+1)))
+	}
+	bad.ContentType = r.Header.Get("Content-Type")
+	bad.Body = string(c.buffer)
+	bad.BodyTruncated = c.truncated
+}
+
+// readCloser combines a reader with the original body's Close
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
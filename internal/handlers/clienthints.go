@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// clientHintBrand is one entry of a Sec-CH-UA brand list
+type clientHintBrand struct {
+	Brand   string `json:"brand"`
+	Version string `json:"version"`
+}
+
+// parseClientHints returns the request's User-Agent client hints in the shape of
+// the org.ietf/http_client_hints entity, or nil if the client sent none
+func parseClientHints(r *http.Request) map[string]interface{} {
+	brands := parseBrandList(r.Header.Get("Sec-CH-UA"))
+	if brands == nil {
+		return nil
+	}
+
+	hints := map[string]interface{}{
+		"brands":   brands,
+		"isMobile": r.Header.Get("Sec-CH-UA-Mobile") == "?1",
+	}
+	for header, field := range map[string]string{
+		"Sec-CH-UA-Platform":         "platform",
+		"Sec-CH-UA-Platform-Version": "platformVersion",
+		"Sec-CH-UA-Arch":             "architecture",
+		"Sec-CH-UA-Model":            "model",
+		"Sec-CH-UA-Full-Version":     "uaFullVersion",
+	} {
+		if value := unquoteHint(r.Header.Get(header)); value != "" {
+			hints[field] = value
+		}
+	}
+	if fullVersions := parseBrandList(r.Header.Get("Sec-CH-UA-Full-Version-List")); fullVersions != nil {
+		hints["fullVersionList"] = fullVersions
+	}
+	return hints
+}
+
+// parseBrandList parses a structured header brand list such as
+// "Chromium";v="118", "Google Chrome";v="118", "Not=A?Brand";v="99"
+func parseBrandList(header string) []clientHintBrand {
+	if strings.TrimSpace(header) == "" {
+		return nil
+	}
+
+	var brands []clientHintBrand
+	for _, entry := range strings.Split(header, ",") {
+		parts := strings.Split(entry, ";")
+		brand := clientHintBrand{Brand: unquoteHint(parts[0])}
+		for _, parameter := range parts[1:] {
+			if name, value, found := strings.Cut(strings.TrimSpace(parameter), "="); found && name == "v" {
+				brand.Version = unquoteHint(value)
+			}
+		}
+		if brand.Brand != "" {
+			brands = append(brands, brand)
+		}
+	}
+	return brands
+}
+
+// unquoteHint strips whitespace and the quotes around a structured header string
+func unquoteHint(value string) string {
+	return strings.Trim(strings.TrimSpace(value), `"`)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"goplow/internal/cluster"
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// HandleClusterIngest accepts events pushed from leaf instances and stores them
+// with their source label, keeping the fields the leaf derived from the
+// tracker's request
+func HandleClusterIngest(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodPost {
+		utils.WriteMethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	var envelope cluster.Envelope
+	if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidJSON, "Invalid JSON payload")
+		return
+	}
+
+	if envelope.Source == "" {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeMissingField, "Missing source field")
+		return
+	}
+	if len(envelope.Data) == 0 {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeMissingData, "Missing data field")
+		return
+	}
+
+	timestamp := envelope.Timestamp
+	if timestamp.IsZero() {
+		timestamp = appServer.Now()
+	}
+
+	appServer.AddEventRecordContext(r.Context(), server.Event{
+		Schema:    envelope.Schema,
+		Data:      envelope.Data,
+		Timestamp: timestamp,
+		Namespace: envelope.Namespace,
+		Enriched:  envelope.Enriched,
+		Mirrored:  true,
+		Session:   envelope.Session,
+		Source:    envelope.Source,
+		Trace:     envelope.Trace,
+		RunID:     envelope.RunID,
+		Batch:     envelope.Batch,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
@@ -0,0 +1,97 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"goplow/internal/cluster"
+	"goplow/internal/server"
+)
+
+// fakeGeo locates every client address in the same country
+type fakeGeo struct{}
+
+func (fakeGeo) Name() string { return "fake_geo" }
+
+func (fakeGeo) Enrich(event *server.Event) {
+	if _, ok := event.Enriched["user_ipaddress"]; ok {
+		event.Enriched["geo_country"] = "XX"
+	}
+}
+
+func (fakeGeo) UsesClientIP() bool { return true }
+
+func TestClusterIngestKeepsTheLeafsEnrichments(t *testing.T) {
+	appServer, router := newTestServer(t, 100, nil)
+	appServer.AddEnricher(fakeGeo{})
+
+	body, _ := json.Marshal(cluster.Envelope{
+		Source:    "checkout-service",
+		Schema:    payloadDataSchema,
+		Data:      []map[string]interface{}{pageView(0)},
+		Namespace: "/com.acme/events",
+		Enriched:  map[string]interface{}{"user_ipaddress": "203.0.113.7", "geo_country": "GB"},
+	})
+	req := httptest.NewRequest(http.MethodPost, cluster.IngestPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	// A tracker event sent to the aggregator itself is still located
+	if err := postPayload(router, appServer.GetEventsEndpoint(), payload(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	events := appServer.GetEvents()
+	if len(events) != 2 {
+		t.Fatalf("stored %d events, want 2", len(events))
+	}
+	pushed := events[0]
+	if pushed.Source != "checkout-service" || pushed.Namespace != "/com.acme/events" {
+		t.Errorf("stored source %q and namespace %q, want the leaf's", pushed.Source, pushed.Namespace)
+	}
+	if pushed.Enriched["user_ipaddress"] != "203.0.113.7" || pushed.Enriched["geo_country"] != "GB" {
+		t.Errorf("stored enrichments %v, want the leaf's", pushed.Enriched)
+	}
+	if events[1].Enriched["geo_country"] != "XX" {
+		t.Errorf("tracker event enrichments %v, want it located by the aggregator", events[1].Enriched)
+	}
+}
+
+func TestClusterIngestKeepsTheLeafsSession(t *testing.T) {
+	appServer, router := newTestServer(t, 100, nil)
+	appServer.StartSession("aggregator run", nil, server.SystemActor)
+
+	for _, session := range []*server.Session{{Name: "release-1.42 smoke"}, nil} {
+		body, _ := json.Marshal(cluster.Envelope{
+			Source:  "checkout-service",
+			Schema:  payloadDataSchema,
+			Data:    []map[string]interface{}{pageView(0)},
+			Session: session,
+		})
+		req := httptest.NewRequest(http.MethodPost, cluster.IngestPath, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	events := appServer.GetEvents()
+	if len(events) != 2 {
+		t.Fatalf("stored %d events, want 2", len(events))
+	}
+	if events[0].Session == nil || events[0].Session.Name != "release-1.42 smoke" {
+		t.Errorf("pushed event has session %+v, want the leaf's", events[0].Session)
+	}
+	// Leaves without a session get the aggregator's
+	if events[1].Session == nil || events[1].Session.Name != "aggregator run" {
+		t.Errorf("pushed event has session %+v, want the aggregator's", events[1].Session)
+	}
+}
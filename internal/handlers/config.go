@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// HandleGetConfig returns the resolved configuration as JSON, with the
+// source of each value and with secrets masked
+func HandleGetConfig(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	if err := utils.WriteCachedJSON(w, r, appServer.GetConfigSettings()); err != nil {
+		log.Printf("Error writing config: %v\n", err)
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"goplow/internal/iglu"
+	"goplow/internal/server"
+	"goplow/internal/utils"
+	"goplow/pkg/collector"
+)
+
+// ConsentStats is a breakdown of the consent state attached to buffered events
+type ConsentStats struct {
+	TotalEvents    int            `json:"totalEvents"`
+	WithConsent    int            `json:"withConsent"`
+	WithoutConsent int            `json:"withoutConsent"`
+	ByBasis        map[string]int `json:"byBasis"`
+	ByDocument     map[string]int `json:"byDocument"`
+	ByPreference   map[string]int `json:"byPreference"`
+}
+
+// GetConsentStats summarises the consent state of every buffered event
+func GetConsentStats(appServer *server.AppServer) ConsentStats {
+	stats := ConsentStats{
+		ByBasis:      map[string]int{},
+		ByDocument:   map[string]int{},
+		ByPreference: map[string]int{},
+	}
+
+	for _, event := range appServer.GetEvents() {
+		for _, item := range event.Data {
+			stats.TotalEvents++
+			summary := collector.ConsentSummary(item, iglu.ContextEntities(item))
+			if summary == nil {
+				stats.WithoutConsent++
+				continue
+			}
+			stats.WithConsent++
+
+			if basis, ok := summary["basis"]; ok {
+				stats.ByBasis[fmt.Sprint(basis)]++
+			}
+			if id, ok := summary["document_id"]; ok {
+				stats.ByDocument[fmt.Sprintf("%v@%v", id, summary["document_version"])]++
+			}
+			documents, _ := summary["documents"].([]map[string]interface{})
+			for _, document := range documents {
+				stats.ByDocument[fmt.Sprintf("%v@%v", document["id"], document["version"])]++
+			}
+			if preference, ok := summary["preference"]; ok {
+				stats.ByPreference[fmt.Sprint(preference)]++
+			}
+		}
+	}
+
+	return stats
+}
+
+// HandleConsentStats returns a breakdown of the consent state of buffered events
+func HandleConsentStats(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GetConsentStats(appServer))
+}
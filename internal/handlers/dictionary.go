@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// compiledDefinition is a field definition with its path split into keys
+type compiledDefinition struct {
+	keys  []string
+	label string
+}
+
+// CompileFieldDictionary compiles the field dictionary into a post-processor that
+// renames each defined field of the display event to its label
+// Fields the earlier stages left out, such as custom tracker parameters, are
+// copied from the raw event instead
+// A field is left alone if the label is already taken, so no value is overwritten
+func CompileFieldDictionary(definitions []server.FieldDefinition) utils.PostProcessor {
+	compiled := make([]compiledDefinition, 0, len(definitions))
+	for _, definition := range definitions {
+		compiled = append(compiled, compiledDefinition{
+			keys:  strings.Split(definition.Field, "."),
+			label: definition.Label,
+		})
+	}
+
+	return func(raw map[string]interface{}, transformed map[string]interface{}) map[string]interface{} {
+		// Copy before renaming, as pass-through items share the stored event's map
+		result := make(map[string]interface{}, len(transformed))
+		for key, value := range transformed {
+			result[key] = value
+		}
+		for _, definition := range compiled {
+			if !renameField(result, definition.keys, definition.label) && len(definition.keys) == 1 {
+				if value, ok := raw[definition.keys[0]]; ok {
+					if _, taken := result[definition.label]; !taken {
+						result[definition.label] = value
+					}
+				}
+			}
+		}
+		return result
+	}
+}
+
+// renameField moves the value at keys to label, in the object holding it, and
+// reports whether the field was found
+// Nested objects are copied before they are changed, as they may be shared
+func renameField(item map[string]interface{}, keys []string, label string) bool {
+	value, ok := item[keys[0]]
+	if !ok {
+		return false
+	}
+	if len(keys) == 1 {
+		if _, taken := item[label]; !taken {
+			delete(item, keys[0])
+			item[label] = value
+		}
+		return true
+	}
+
+	nested, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	copied := make(map[string]interface{}, len(nested))
+	for key, value := range nested {
+		copied[key] = value
+	}
+	found := renameField(copied, keys[1:], label)
+	item[keys[0]] = copied
+	return found
+}
+
+// HandleFieldDictionary lists the configured field labels and descriptions, so
+// the dashboard can explain renamed fields
+func HandleFieldDictionary(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	definitions := appServer.GetConfig().FieldDictionary
+	if definitions == nil {
+		definitions = []server.FieldDefinition{}
+	}
+	if err := utils.WriteCachedJSON(w, r, definitions); err != nil {
+		log.Printf("Error writing field dictionary: %v\n", err)
+	}
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// pagesPrefix is the path prefix of the per-page API, /api/pages/{url}/engagement
+const pagesPrefix = "/api/pages/"
+
+// PageEngagement summarises the page views and page pings received for a page
+type PageEngagement struct {
+	URL       string `json:"url"`
+	PageViews int    `json:"pageViews"`
+	PingCount int    `json:"pingCount"`
+	// MaxScrollDepth is the furthest point scrolled to, as a percentage of the document height
+	MaxScrollDepth float64 `json:"maxScrollDepth"`
+	// MaxVerticalOffset is the largest pp_may reported by a ping, in pixels
+	MaxVerticalOffset float64 `json:"maxVerticalOffset"`
+	// EngagedSeconds is the time from the first page view or ping to the last ping
+	EngagedSeconds float64    `json:"engagedSeconds"`
+	FirstSeen      *time.Time `json:"firstSeen,omitempty"`
+	LastPing       *time.Time `json:"lastPing,omitempty"`
+}
+
+// GetPageEngagement summarises the buffered page views and page pings for pageURL
+func GetPageEngagement(appServer *server.AppServer, pageURL string) PageEngagement {
+	engagement := PageEngagement{URL: pageURL}
+	var first, last time.Time
+
+	for _, event := range appServer.GetEvents() {
+		at := event.Timestamp
+		if event.DeviceTimestamp != nil {
+			at = *event.DeviceTimestamp
+		}
+
+		for _, item := range event.Data {
+			if item["url"] != pageURL {
+				continue
+			}
+			switch item["e"] {
+			case "pv":
+				engagement.PageViews++
+			case "pp":
+				engagement.PingCount++
+				if offset, ok := numericParam(item["pp_may"]); ok {
+					engagement.MaxVerticalOffset = math.Max(engagement.MaxVerticalOffset, offset)
+					if depth, ok := scrollDepth(item, offset); ok {
+						engagement.MaxScrollDepth = math.Max(engagement.MaxScrollDepth, depth)
+					}
+				}
+				if last.IsZero() || at.After(last) {
+					last = at
+				}
+			default:
+				continue
+			}
+			if first.IsZero() || at.Before(first) {
+				first = at
+			}
+		}
+	}
+
+	if !first.IsZero() {
+		engagement.FirstSeen = &first
+	}
+	if !last.IsZero() {
+		engagement.LastPing = &last
+		engagement.EngagedSeconds = last.Sub(first).Seconds()
+	}
+	return engagement
+}
+
+// scrollDepth returns how far down the document the viewport reached, as a
+// percentage, from the ping's viewport (vp) and document (ds) sizes
+func scrollDepth(item map[string]interface{}, offset float64) (float64, bool) {
+	_, viewportHeight, ok := parseDimensions(item["vp"])
+	if !ok {
+		return 0, false
+	}
+	_, documentHeight, ok := parseDimensions(item["ds"])
+	if !ok || documentHeight <= 0 {
+		return 0, false
+	}
+	return math.Min(100, (offset+viewportHeight)/documentHeight*100), true
+}
+
+// parseDimensions parses a tracker "WIDTHxHEIGHT" parameter
+func parseDimensions(value interface{}) (float64, float64, bool) {
+	text, _ := value.(string)
+	width, height, found := strings.Cut(text, "x")
+	if !found {
+		return 0, 0, false
+	}
+	w, err := strconv.ParseFloat(width, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	h, err := strconv.ParseFloat(height, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return w, h, true
+}
+
+// numericParam returns a tracker parameter as a number; trackers send numbers
+// as strings in GET requests and as either in POST payloads
+func numericParam(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		return parsed, err == nil
+	}
+	return 0, false
+}
+
+// HandlePageEngagement serves /api/pages/{url}/engagement, where url is the
+// URL-encoded page URL
+func HandlePageEngagement(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	// Use the escaped path so encoded slashes in the page URL survive
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), pagesPrefix)
+	encoded, found := strings.CutSuffix(rest, "/engagement")
+	if !found || encoded == "" {
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeNotFound, "Expected /api/pages/{url}/engagement")
+		return
+	}
+	pageURL, err := url.PathUnescape(encoded)
+	if err != nil {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, fmt.Sprintf("Invalid page URL: %v", err))
+		return
+	}
+
+	// ServeMux collapses the "//" after the scheme when cleaning the path, so restore it
+	if i := strings.Index(pageURL, ":/"); i > 0 && !strings.HasPrefix(pageURL[i:], "://") {
+		pageURL = pageURL[:i] + "://" + pageURL[i+2:]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(GetPageEngagement(appServer, pageURL)); err != nil {
+		log.Printf("Error encoding page engagement: %v\n", err)
+	}
+}
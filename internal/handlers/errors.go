@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+
+	"goplow/internal/iglu"
+	"goplow/internal/server"
+	"goplow/pkg/collector"
+)
+
+// NewErrorAlert returns an event listener that logs an alert, rendered from the
+// given text/template, for every application_error event
+// The template is executed with the error's fields plus eventId and appId
+func NewErrorAlert(text string) (func(context.Context, server.Event), error) {
+	tmpl, err := template.New("error_alert").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing error_alert template: %w", err)
+	}
+
+	return func(_ context.Context, event server.Event) {
+		for _, item := range event.Data {
+			schema, data, ok := iglu.SelfDescribingEvent(item)
+			if !ok || iglu.SchemaKey(schema) != collector.ApplicationErrorSchema {
+				continue
+			}
+
+			fields := make(map[string]interface{}, len(data)+2)
+			for key, value := range data {
+				fields[key] = value
+			}
+			fields["eventId"] = event.ID
+			fields["appId"] = item["aid"]
+
+			var alert strings.Builder
+			if err := tmpl.Execute(&alert, fields); err != nil {
+				log.Printf("Error rendering error_alert template: %v\n", err)
+				continue
+			}
+			log.Printf("ALERT: %s\n", alert.String())
+		}
+	}, nil
+}
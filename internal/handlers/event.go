@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// HandleEvent serves the per-event API: a buffered event (GET /api/events/{id}),
+// the detail URL linked from notifications, and its schema validation
+// (GET /api/events/{id}/validation)
+func HandleEvent(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	rawID := strings.TrimPrefix(r.URL.Path, eventsPrefix)
+	if strings.Contains(rawID, "/") {
+		HandleEventValidation(w, r, appServer)
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "Event ID must be an integer")
+		return
+	}
+	event, ok := appServer.GetEvent(id)
+	if !ok {
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeEventNotFound, "No buffered event with ID "+rawID)
+		return
+	}
+	if err := utils.WriteCachedJSON(w, r, event); err != nil {
+		log.Printf("Error writing event: %v\n", err)
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"goplow/internal/export"
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// HandleExport downloads the buffered events, or those of ?archive=<name>, in
+// the format given by ?format= (ndjson by default); with ?manifest=true the
+// file is bundled in a zip with the manifest of the events it holds
+func HandleExport(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	query := r.URL.Query()
+	format, err := export.ParseFormat(query.Get("format"))
+	if err != nil {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, err.Error())
+		return
+	}
+	withManifest := false
+	if value := query.Get("manifest"); value != "" {
+		if withManifest, err = strconv.ParseBool(value); err != nil {
+			utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "manifest must be true or false")
+			return
+		}
+	}
+
+	config := appServer.GetConfig()
+	location := config.DisplayLocation()
+	events := appServer.GetEvents()
+	name := "goplow-" + appServer.Now().In(location).Format("20060102T150405Z0700")
+	archive := query.Get("archive")
+	if archive != "" {
+		events, err = appServer.ReadArchive(archive)
+		if err != nil {
+			writeArchiveError(w, r, archive, err)
+			return
+		}
+		name = archive
+	}
+
+	// Encode fully first, so a failure can still be reported as a problem
+	var body bytes.Buffer
+	options := export.Options{Location: location, TimeFormat: config.TimeFormat}
+	if err := export.Write(&body, format, events, options); err != nil {
+		log.Printf("Error exporting events as %s: %v\n", format, err)
+		utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeExportFailed, "Events could not be exported")
+		return
+	}
+	filename := name + export.Extension(format)
+	content := body.Bytes()
+	contentType := export.ContentType(format)
+
+	if withManifest {
+		manifest := exportManifest(appServer, archive, events)
+		manifest.File = server.NewManifestFile(filename, format, content)
+		if content, err = exportBundle(filename, content, name+".manifest.json", manifest); err != nil {
+			log.Printf("Error bundling export with its manifest: %v\n", err)
+			utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeExportFailed, "Events could not be exported")
+			return
+		}
+		filename = name + ".zip"
+		contentType = "application/zip"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Write(content)
+}
+
+// exportManifest returns the manifest of exported events: for an archive the
+// one saved with it, which records the configuration at capture time, or else
+// one built for the events
+func exportManifest(appServer *server.AppServer, archive string, events []server.Event) server.Manifest {
+	if archive != "" {
+		if manifest, err := appServer.ReadArchiveManifest(archive); err == nil {
+			return manifest
+		}
+	}
+	manifest := appServer.BuildManifest(events)
+	manifest.Archive = archive
+	return manifest
+}
+
+// exportBundle zips an export file with its manifest
+func exportBundle(filename string, content []byte, manifestName string, manifest server.Manifest) ([]byte, error) {
+	var bundle bytes.Buffer
+	archive := zip.NewWriter(&bundle)
+	file, err := archive.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(content); err != nil {
+		return nil, err
+	}
+	file, err = archive.Create(manifestName)
+	if err != nil {
+		return nil, err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return bundle.Bytes(), nil
+}
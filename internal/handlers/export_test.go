@@ -0,0 +1,87 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goplow/internal/server"
+)
+
+func TestExportWithManifestDescribesTheExportedEvents(t *testing.T) {
+	appServer, router := newTestServer(t, 1000, nil)
+	if err := postPayload(router, appServer.GetEventsEndpoint(), payload(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/export?manifest=true", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/zip" {
+		t.Errorf("got content type %q, want application/zip", contentType)
+	}
+
+	bundle, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, file := range bundle.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name] = content
+	}
+	if len(files) != 2 {
+		t.Fatalf("bundle holds %d files, want 2", len(files))
+	}
+
+	var exported, manifestFile []byte
+	for name, content := range files {
+		if strings.HasSuffix(name, ".manifest.json") {
+			manifestFile = content
+		} else {
+			exported = content
+		}
+	}
+	var manifest server.Manifest
+	if err := json.Unmarshal(manifestFile, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(exported, []byte("\n")); manifest.Events != lines || manifest.Events != 3 {
+		t.Errorf("manifest counts %d events, export holds %d", manifest.Events, lines)
+	}
+	sum := sha256.Sum256(exported)
+	if manifest.File == nil || manifest.File.SHA256 != hex.EncodeToString(sum[:]) || manifest.File.Bytes != int64(len(exported)) {
+		t.Errorf("manifest file %+v does not match the export", manifest.File)
+	}
+	if manifest.IDRange == nil || manifest.IDRange.To-manifest.IDRange.From != 2 {
+		t.Errorf("unexpected ID range %+v", manifest.IDRange)
+	}
+}
+
+func TestExportRejectsInvalidManifestParameter(t *testing.T) {
+	_, router := newTestServer(t, 100, nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/export?manifest=maybe", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want 400", rec.Code)
+	}
+}
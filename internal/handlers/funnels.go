@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// funnelsPath lists the funnels, and funnelsPrefix serves one, /api/funnels/{name}
+const (
+	funnelsPath   = "/api/funnels"
+	funnelsPrefix = funnelsPath + "/"
+)
+
+// maxFunnelBytes limits the size of a funnel definition body
+const maxFunnelBytes = 64 << 10
+
+// HandleFunnels lists the funnels with their completion by the buffered events'
+// sessions; run_id limits them to the events of a test run
+func HandleFunnels(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	reports := appServer.FunnelReports(funnelEvents(r, appServer))
+	if err := utils.WriteCachedJSON(w, r, reports); err != nil {
+		log.Printf("Error writing funnels: %v\n", err)
+	}
+}
+
+// HandleFunnel reports on one funnel with each session's progress (GET),
+// defines or replaces it (PUT), or deletes it (DELETE)
+// Funnels from the configuration cannot be replaced or deleted
+func HandleFunnel(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	name := strings.TrimPrefix(r.URL.Path, funnelsPrefix)
+	if name == "" || strings.Contains(name, "/") {
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeNotFound, "Not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var config server.FunnelConfig
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFunnelBytes)).Decode(&config); err != nil {
+			utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidJSON, "Invalid JSON payload")
+			return
+		}
+		if config.Name == "" {
+			config.Name = name
+		} else if config.Name != name {
+			utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "Funnel name does not match the URL")
+			return
+		}
+		if err := appServer.SetFunnel(config, requestActor(r)); err != nil {
+			writeFunnelError(w, r, err)
+			return
+		}
+	case http.MethodDelete:
+		if err := appServer.DeleteFunnel(name, requestActor(r)); err != nil {
+			writeFunnelError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+		return
+	}
+
+	report, ok := appServer.FunnelReport(name, funnelEvents(r, appServer))
+	if !ok {
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeFunnelNotFound, "No funnel named "+name)
+		return
+	}
+	if err := utils.WriteCachedJSON(w, r, report); err != nil {
+		log.Printf("Error writing funnel %s: %v\n", name, err)
+	}
+}
+
+// funnelEvents returns the buffered events funnels are reported on
+func funnelEvents(r *http.Request, appServer *server.AppServer) []server.Event {
+	events := appServer.GetEvents()
+	if runID := r.URL.Query().Get("run_id"); runID != "" {
+		events = server.FilterEventsByRun(events, runID)
+	}
+	return events
+}
+
+// writeFunnelError writes the problem for a failed funnel change
+func writeFunnelError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, server.ErrFunnelNotFound):
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeFunnelNotFound, "No funnel named "+strings.TrimPrefix(r.URL.Path, funnelsPrefix))
+	case errors.Is(err, server.ErrFunnelConfigured):
+		utils.WriteProblem(w, r, http.StatusConflict, utils.CodeFunnelConfigured, "Funnels from the configuration cannot be changed through the API")
+	default:
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, err.Error())
+	}
+}
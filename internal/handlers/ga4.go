@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// ga4SchemaPrefix names GA4 events by event name, e.g. "ga4/purchase"
+const ga4SchemaPrefix = "ga4/"
+
+// HandleGA4 ingests GA4 hits sent under the endpoint's path: Measurement
+// Protocol requests to /mp/collect (or /debug/mp/collect), with a JSON body of
+// events, and gtag.js requests to /g/collect, with the event in the query
+// string and any further events one per body line. Each event is stored with
+// the schema ga4/<event name>. Measurement Protocol requests carry their
+// api_secret in the query string, which the endpoint's auth_token can check.
+func HandleGA4(w http.ResponseWriter, r *http.Request, appServer *server.AppServer, endpoint server.EndpointConfig) {
+	capture := captureBody(r, appServer.GetConfig().BadBodyCaptureKB)
+	body, ok := readAdapterBody(w, r, appServer, capture, "GA4")
+	if !ok {
+		return
+	}
+
+	var items []map[string]interface{}
+	var err error
+	switch adapterSubpath(r, endpoint) {
+	case "mp/collect", "debug/mp/collect":
+		items, err = ga4MeasurementItems(r.URL.Query(), body)
+	case "g/collect":
+		items, err = ga4GtagItems(r.URL.Query(), body)
+	default:
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeNotFound, "GA4 hits are sent to mp/collect or g/collect")
+		return
+	}
+	if err != nil {
+		rejectIngest(w, r, appServer, capture, http.StatusBadRequest, utils.CodeInvalidDataFormat, "Invalid GA4 payload: "+err.Error(), server.BadEvent{Error: err.Error()})
+		return
+	}
+
+	receivedAt := appServer.Now()
+	for _, item := range items {
+		name, _ := item["name"].(string)
+		addAdapterEvent(r, appServer, endpoint, ga4SchemaPrefix+name, item, nil, receivedAt)
+	}
+
+	// Like Google's collectors, answer with no content
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ga4MeasurementItems returns the events of a Measurement Protocol request,
+// each with the request's client, user and stream IDs
+func ga4MeasurementItems(query url.Values, body []byte) ([]map[string]interface{}, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	events, ok := payload["events"].([]interface{})
+	if !ok || len(events) == 0 {
+		return nil, fmt.Errorf("no events array")
+	}
+
+	shared := map[string]interface{}{}
+	for _, field := range []string{"client_id", "app_instance_id", "user_id", "timestamp_micros", "user_properties"} {
+		if value, ok := payload[field]; ok {
+			shared[field] = value
+		}
+	}
+	for _, param := range []string{"measurement_id", "firebase_app_id"} {
+		if value := query.Get(param); value != "" {
+			shared[param] = value
+		}
+	}
+
+	items := make([]map[string]interface{}, 0, len(events))
+	for i, element := range events {
+		event, _ := element.(map[string]interface{})
+		if name, _ := event["name"].(string); name == "" {
+			return nil, fmt.Errorf("events[%d] has no name", i)
+		}
+		item := map[string]interface{}{"name": event["name"], "params": event["params"]}
+		for field, value := range shared {
+			item[field] = value
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// ga4GtagItems returns the events of a gtag.js request: the query string's
+// parameters, with the event name (en) as name, and for batched hits each body
+// line's parameters over them
+func ga4GtagItems(query url.Values, body []byte) ([]map[string]interface{}, error) {
+	lines := []string{""}
+	if trimmed := strings.TrimSpace(string(body)); trimmed != "" {
+		lines = strings.Split(trimmed, "\n")
+	}
+
+	items := make([]map[string]interface{}, 0, len(lines))
+	for i, line := range lines {
+		values, err := url.ParseQuery(strings.TrimSpace(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		item := make(map[string]interface{}, len(query)+len(values))
+		for key := range query {
+			item[key] = query.Get(key)
+		}
+		for key := range values {
+			item[key] = values.Get(key)
+		}
+		name, _ := item["en"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("hit %d has no event name (en)", i+1)
+		}
+		item["name"] = name
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -2,286 +2,460 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
+	"goplow/internal/cluster"
 	"goplow/internal/server"
 	"goplow/internal/static"
+	"goplow/internal/utils"
+	"goplow/pkg/collector"
 )
 
 // RegisterRoutes registers all HTTP routes
-func RegisterRoutes(mux *http.ServeMux, appServer *server.AppServer) {
-	// Set the event transformer for SSE broadcast
-	appServer.SetEventTransformer(transformEventForDisplay)
+func RegisterRoutes(router *Router, appServer *server.AppServer) {
+	// Register the built-in transforms and set the event transformer for SSE broadcast
+	RegisterBuiltinEventHandlers(appServer.EventHandlers())
+	chains := transformChains(appServer)
+	appServer.SetEventTransformer(newDisplayTransformer(appServer.EventHandlers(), chains))
 
-	mux.HandleFunc("/", HandleIndex)
+	// Wrap each route group in its configured logging, recovery and limits
+	for _, name := range []string{server.RouteGroupIngest, server.RouteGroupAPI, server.RouteGroupUI} {
+		router.Group(name).Use(routeGroupMiddleware(appServer, appServer.GetConfig().RouteGroup(name))...)
+	}
+	api := router.Group(server.RouteGroupAPI)
+
+	router.Group(server.RouteGroupUI).HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		HandleIndex(w, r, appServer)
+	})
 
 	// Get the configured events endpoint
 	eventsEndpoint := appServer.GetEventsEndpoint()
 
 	// Register the events endpoint (for ingesting analytics events) with CORS
-	mux.HandleFunc(eventsEndpoint, func(w http.ResponseWriter, r *http.Request) {
-		// Apply CORS headers from config
-		ApplyCORSHeaders(w, appServer)
-
-		switch r.Method {
-		case http.MethodPost, http.MethodOptions:
-			HandlePostMessage(w, r, appServer)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	defaultEndpoint := server.EndpointConfig{Path: eventsEndpoint}
+	router.MountEndpoint(defaultEndpoint, appServer, ingestHandler(defaultEndpoint, appServer))
+
+	// Register any additional ingest endpoints, mounting adapters under their path
+	for _, endpoint := range appServer.GetConfig().Endpoints {
+		path := server.NormalizeEndpointPath(endpoint.Path)
+		if path == eventsEndpoint || path == "" {
+			continue
 		}
-	})
+		router.MountEndpoint(endpoint, appServer, ingestHandler(endpoint, appServer))
+		if endpoint.Mounted() {
+			log.Printf("Mounted %s adapter at %s/\n", endpoint.Adapter, path)
+		} else {
+			log.Printf("Registered ingest endpoint %s\n", path)
+		}
+	}
 
 	// Register GET endpoint for retrieving events with CORS
-	mux.HandleFunc(eventsEndpoint+"/list", func(w http.ResponseWriter, r *http.Request) {
-		// Apply CORS headers from config
-		ApplyCORSHeaders(w, appServer)
-
+	api.HandleWith(eventsEndpoint+"/list", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			HandleGetMessages(w, r, appServer)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			utils.WriteMethodNotAllowed(w, r, http.MethodGet)
 		}
-	})
+	}), CORS(appServer, appServer.GetCORSAllowedOrigins, http.MethodGet))
 
 	// SSE endpoint remains fixed (no CORS)
-	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
 		HandleSSE(w, r, appServer)
 	})
 
-	// Schema latest version endpoint
-	mux.HandleFunc("/api/schema-latest", func(w http.ResponseWriter, r *http.Request) {
-		static.HandleGetLatestSchemaVersion(w, r)
+	// Rejected events, like the Snowplow bad rows stream
+	api.HandleFunc("/api/bad-events", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetBadEvents(w, r, appServer)
 	})
-}
 
-// ApplyCORSHeaders applies CORS headers from config to the response
-func ApplyCORSHeaders(w http.ResponseWriter, appServer *server.AppServer) {
-	corsOrigins := appServer.GetCORSAllowedOrigins()
-	if corsOrigins != "" {
-		w.Header().Set("Access-Control-Allow-Origin", corsOrigins)
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-	}
-}
+	// Liveness check for container orchestrators, recovering from panics
+	// like every route but without the api group's limits
+	health := router.Group(healthRouteGroup)
+	health.Use(Recover(appServer))
+	health.HandleFunc(HealthPath, HandleHealth)
 
-// transformEvent transforms an event based on its "e" key type
-func transformEvent(eventData map[string]interface{}) map[string]interface{} {
-	eventType, ok := eventData["e"].(string)
-	if !ok {
-		// If no "e" key, return as-is
-		return eventData
-	}
+	// Prometheus-style metrics, including events goplow itself lost
+	api.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		HandleMetrics(w, r, appServer)
+	})
 
-	switch eventType {
-	case "pv":
-		return transformPageView(eventData)
-	case "se":
-		return transformStructuredEvent(eventData)
-	case "ue":
-		return transformUnstructuredEvent(eventData)
-	default:
-		// For unknown event types, return as-is
-		return eventData
-	}
-}
+	// Audit log of admin actions
+	api.HandleFunc("/api/audit", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetAudit(w, r, appServer)
+	})
 
-// transformPageView transforms a Page View event
-func transformPageView(data map[string]interface{}) map[string]interface{} {
-	result := map[string]interface{}{
-		"kind": "Page View",
-	}
+	// Resolved configuration, with the source of each value
+	api.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetConfig(w, r, appServer)
+	})
 
-	if v, ok := data["url"]; ok {
-		result["url"] = v
-	}
-	if v, ok := data["page"]; ok {
-		result["page"] = v
-	}
-	if v, ok := data["refr"]; ok {
-		result["referrer"] = v
-	}
-	if v, ok := data["tna"]; ok {
-		result["tracker"] = v
-	}
-	if v, ok := data["aid"]; ok {
-		result["app_id"] = v
-	}
-	if v, ok := data["duid"]; ok {
-		result["device_id"] = v
-	}
-	if v, ok := data["cx"]; ok {
-		result["context"] = v
-	}
+	// Per-event details, such as schema validation results
+	api.HandleFunc(eventsPrefix, func(w http.ResponseWriter, r *http.Request) {
+		HandleEvent(w, r, appServer)
+	})
+
+	// Aggregator endpoint for events pushed from leaf instances
+	router.Group(server.RouteGroupIngest).HandleFunc(cluster.IngestPath, func(w http.ResponseWriter, r *http.Request) {
+		HandleClusterIngest(w, r, appServer)
+	})
+
+	// Timeline markers for test segmentation
+	api.HandleFunc("/api/markers", func(w http.ResponseWriter, r *http.Request) {
+		HandleAddMarker(w, r, appServer)
+	})
 
-	return result
+	// Clear all buffered events
+	api.HandleFunc("/api/clear", func(w http.ResponseWriter, r *http.Request) {
+		HandleClearEvents(w, r, appServer)
+	})
+
+	// Named capture sessions, recorded with every event
+	api.HandleFunc("/api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		HandleGetSessions(w, r, appServer)
+	})
+	api.HandleFunc("/api/sessions/start", func(w http.ResponseWriter, r *http.Request) {
+		HandleStartSession(w, r, appServer)
+	})
+	api.HandleFunc("/api/sessions/stop", func(w http.ResponseWriter, r *http.Request) {
+		HandleStopSession(w, r, appServer)
+	})
+
+	// Compressed capture archives in the data directory
+	api.HandleFunc("/api/archive", func(w http.ResponseWriter, r *http.Request) {
+		HandleArchive(w, r, appServer)
+	})
+	api.HandleFunc("/api/archives", func(w http.ResponseWriter, r *http.Request) {
+		HandleListArchives(w, r, appServer)
+	})
+	api.HandleFunc(archivesPrefix, func(w http.ResponseWriter, r *http.Request) {
+		HandleArchiveFile(w, r, appServer)
+	})
+
+	// Time zone and format the dashboard displays times with
+	api.HandleFunc("/api/ui-config", func(w http.ResponseWriter, r *http.Request) {
+		HandleUIConfig(w, r, appServer)
+	})
+
+	// Dashboard preferences saved in the data directory
+	api.HandleFunc("/api/preferences", func(w http.ResponseWriter, r *http.Request) {
+		HandlePreferences(w, r, appServer)
+	})
+
+	// Translated dashboard and field labels
+	api.HandleFunc("/api/labels", func(w http.ResponseWriter, r *http.Request) {
+		HandleLabels(w, r, appServer)
+	})
+
+	// Friendly names and descriptions of custom payload fields
+	api.HandleFunc("/api/fields", func(w http.ResponseWriter, r *http.Request) {
+		HandleFieldDictionary(w, r, appServer)
+	})
+
+	// Status and dead letters of the sinks events are delivered to
+	api.HandleFunc("/api/sinks", func(w http.ResponseWriter, r *http.Request) {
+		HandleListSinks(w, r, appServer)
+	})
+	api.HandleFunc(sinksPrefix, func(w http.ResponseWriter, r *http.Request) {
+		HandleSink(w, r, appServer)
+	})
+
+	// Buffered or archived events in analysis formats
+	api.HandleFunc("/api/export", func(w http.ResponseWriter, r *http.Request) {
+		HandleExport(w, r, appServer)
+	})
+
+	// New events as JSON Lines, a simpler live stream than SSE
+	api.HandleFunc("/api/stream.jsonl", func(w http.ResponseWriter, r *http.Request) {
+		HandleStreamJSONL(w, r, appServer)
+	})
+
+	// Stats snapshot and live stats stream
+	api.HandleFunc("/api/stats", func(w http.ResponseWriter, r *http.Request) {
+		HandleStats(w, r, appServer)
+	})
+	api.HandleFunc("/api/stats/stream", func(w http.ResponseWriter, r *http.Request) {
+		HandleStatsStream(w, r, appServer)
+	})
+	api.HandleFunc("/api/stats/consent", func(w http.ResponseWriter, r *http.Request) {
+		HandleConsentStats(w, r, appServer)
+	})
+
+	// Buffered events grouped by field paths and time buckets
+	api.HandleFunc("/api/aggregate", func(w http.ResponseWriter, r *http.Request) {
+		HandleAggregate(w, r, appServer)
+	})
+
+	// Data-quality score of a run or session
+	api.HandleFunc(QualityPath, func(w http.ResponseWriter, r *http.Request) {
+		HandleQuality(w, r, appServer)
+	})
+
+	// Tracker batches reassembled from their events
+	api.HandleFunc(batchesPrefix, func(w http.ResponseWriter, r *http.Request) {
+		HandleBatch(w, r, appServer)
+	})
+
+	// Funnel definitions and their completion per tracker session
+	api.HandleFunc(funnelsPath, func(w http.ResponseWriter, r *http.Request) {
+		HandleFunnels(w, r, appServer)
+	})
+	api.HandleFunc(funnelsPrefix, func(w http.ResponseWriter, r *http.Request) {
+		HandleFunnel(w, r, appServer)
+	})
+
+	// Page view and page ping engagement per page
+	api.HandleFunc(pagesPrefix, func(w http.ResponseWriter, r *http.Request) {
+		HandlePageEngagement(w, r, appServer)
+	})
+
+	// Media events grouped by playback session
+	api.HandleFunc("/api/media/sessions", func(w http.ResponseWriter, r *http.Request) {
+		HandleMediaSessions(w, r, appServer)
+	})
+
+	// Versioned schema of the SSE frames, served ahead of the user's Iglu schemas
+	api.HandleFunc(server.SSEEventSchemaPath, HandleSSEEventSchema)
+
+	// Schema latest version endpoint
+	api.HandleFunc("/api/schema-latest", func(w http.ResponseWriter, r *http.Request) {
+		static.HandleGetLatestSchemaVersion(w, r)
+	})
 }
 
-// transformStructuredEvent transforms a Structured Event
-func transformStructuredEvent(data map[string]interface{}) map[string]interface{} {
-	result := map[string]interface{}{
-		"kind": "Structured Event",
-	}
+// ingestHandler returns the handler of an endpoint for ingesting analytics events
+// The endpoint's adapter decides how request bodies are parsed
+func ingestHandler(endpoint server.EndpointConfig, appServer *server.AppServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			switch endpoint.Adapter {
+			case server.AdapterWebhook:
+				HandleWebhook(w, r, appServer, endpoint)
+			case server.AdapterSegment:
+				HandleSegment(w, r, appServer, endpoint)
+			case server.AdapterGA4:
+				HandleGA4(w, r, appServer, endpoint)
+			default:
+				HandlePostMessage(w, r, appServer)
+			}
+		default:
+			utils.WriteMethodNotAllowed(w, r, http.MethodPost, http.MethodOptions)
+		}
+	})
+}
 
-	if v, ok := data["se_ca"]; ok {
-		result["category"] = v
-	}
-	if v, ok := data["se_ac"]; ok {
-		result["action"] = v
-	}
-	if v, ok := data["se_la"]; ok {
-		result["label"] = v
-	}
-	if v, ok := data["se_pr"]; ok {
-		if v != nil {
-			result["property"] = v
-		} else {
-			result["property"] = "N/A"
+// transformChains returns the configured transform chain for each ingest endpoint path
+// Unknown stage names are reported at startup and skipped
+func transformChains(appServer *server.AppServer) map[string][]string {
+	registry := appServer.EventHandlers()
+	chains := make(map[string][]string)
+	for _, endpoint := range appServer.GetConfig().Endpoints {
+		if len(endpoint.Transformers) == 0 {
+			continue
 		}
-	} else {
-		result["property"] = "N/A"
-	}
-	if v, ok := data["se_va"]; ok {
-		if v != nil {
-			result["value"] = v
-		} else {
-			result["value"] = "N/A"
+		for _, stage := range endpoint.Transformers {
+			if !registry.HasStage(stage) {
+				log.Printf("Warning: unknown transformer %q for endpoint %s\n", stage, endpoint.Path)
+			}
 		}
-	} else {
-		result["value"] = "N/A"
-	}
-	if v, ok := data["url"]; ok {
-		result["url"] = v
-	}
-	if v, ok := data["aid"]; ok {
-		result["app_id"] = v
-	}
-	if v, ok := data["duid"]; ok {
-		result["device_id"] = v
-	}
-	if v, ok := data["cx"]; ok {
-		result["context"] = v
+		chains[server.NormalizeEndpointPath(endpoint.Path)] = endpoint.Transformers
 	}
-
-	return result
+	return chains
 }
 
-// transformUnstructuredEvent transforms an Unstructured (Self-Describing) Event
-func transformUnstructuredEvent(data map[string]interface{}) map[string]interface{} {
-	result := map[string]interface{}{
-		"kind": "Self-Describing Event",
+// applyCORSOrigins applies CORS headers allowing the given origins to the response
+func applyCORSOrigins(w http.ResponseWriter, appServer *server.AppServer, corsOrigins string) {
+	if corsOrigins != "" {
+		w.Header().Set("Access-Control-Allow-Origin", corsOrigins)
+		if expose := appServer.GetConfig().CORSExposeHeaders; len(expose) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(expose, ", "))
+		}
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
 	}
+}
 
-	if v, ok := data["url"]; ok {
-		result["url"] = v
-	}
-	if v, ok := data["ue_px"]; ok {
-		result["payload"] = v
+// RegisterBuiltinEventHandlers registers the display transforms for the standard
+// Snowplow event types, keeping any custom handlers already registered
+func RegisterBuiltinEventHandlers(registry *utils.EventHandlerRegistry) {
+	for eventType, transform := range collector.BuiltinTransforms() {
+		registry.RegisterDefault(eventType, utils.EventHandler(transform))
 	}
-	if v, ok := data["aid"]; ok {
-		result["app_id"] = v
-	}
-	if v, ok := data["duid"]; ok {
-		result["device_id"] = v
-	}
-	if v, ok := data["cx"]; ok {
-		result["context"] = v
-	}
-
-	return result
 }
 
-// transformEventForDisplay transforms an entire Event for display via SSE
-// This transforms each data item in the event based on the event type
+// newDisplayTransformer returns a function that transforms an entire Event for display via SSE
+// Each data item is transformed by the chain configured for the event's ingest endpoint,
+// or by the registry's default chain
 // For single-item arrays, it will unwrap them in the JSON output
-func transformEventForDisplay(event server.Event) server.Event {
-	transformedEvent := event
-	transformedEvent.Data = make([]map[string]interface{}, len(event.Data))
+func newDisplayTransformer(registry *utils.EventHandlerRegistry, chains map[string][]string) func(server.Event) server.Event {
+	return func(event server.Event) server.Event {
+		transformedEvent := event
+		transformedEvent.Data = make([]map[string]interface{}, len(event.Data))
+
+		chain, hasChain := chains[event.Namespace]
+		for i, dataItem := range event.Data {
+			if hasChain {
+				transformedEvent.Data[i] = registry.TransformWith(chain, dataItem)
+			} else {
+				transformedEvent.Data[i] = registry.Transform(dataItem)
+			}
+		}
 
-	for i, dataItem := range event.Data {
-		transformedEvent.Data[i] = transformEvent(dataItem)
-	}
+		// If there's only one data item, mark it for unwrapping in JSON output
+		if len(transformedEvent.Data) == 1 {
+			transformedEvent.UnwrapSingleItem = true
+		}
 
-	// If there's only one data item, mark it for unwrapping in JSON output
-	if len(transformedEvent.Data) == 1 {
-		transformedEvent.UnwrapSingleItem = true
+		return transformedEvent
 	}
-
-	return transformedEvent
 }
 
 // HandleIndex serves the main HTML page
-func HandleIndex(w http.ResponseWriter, r *http.Request) {
+func HandleIndex(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
 	if r.URL.Path != "/" {
-		http.NotFound(w, r)
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeNotFound, "Page not found")
 		return
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write([]byte(static.GetHTMLContent()))
+	w.Write([]byte(rebaseHTML(static.GetHTMLContent(), appServer.GetBasePath())))
 }
 
 // HandlePostMessage handles incoming POST requests with analytics events
 func HandlePostMessage(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
-	// Handle preflight OPTIONS request
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
+	// Keep the start of the body in case it fails to parse
+	capture := captureBody(r, appServer.GetConfig().BadBodyCaptureKB)
 
 	// Accept both form data (for backward compatibility) and JSON
 	contentType := r.Header.Get("Content-Type")
 
 	if strings.Contains(contentType, "application/json") {
-		// Handle JSON payload (Snowplow format)
-		var payload map[string]interface{}
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		// Handle JSON payload (Snowplow format), decoding one item at a time
+		// and storing the items once the whole payload is read, so a body that
+		// breaks part way stores nothing; items of a batch share a timestamp
+		// and a batch ID, so what was flushed together can be reassembled
+		var sharedTime time.Time
+		batchID := ""
+		runID := requestRunID(r, appServer)
+		strict := appServer.GetConfig().Strict
+		stream := appServer.NewIngestStream(r.Context())
+		items := 0
+		rejected := 0
+		var violations []server.Violation
+
+		payload, err := collector.ParsePayloadFunc(r.Body, func(item collector.PayloadItem) error {
+			items++
+			var batch *server.BatchPosition
+			if !item.Single {
+				if batchID == "" {
+					sharedTime = appServer.Now()
+					batchID = server.NewBatchID()
+				}
+				batch = &server.BatchPosition{ID: batchID, Index: item.Index}
+			}
+			// Batches can mix page views, structured and self-describing events,
+			// so each item is classified by its own schema as well as the envelope's
+			event := server.Event{
+				Schema:      item.Schema,
+				EventSchema: server.ItemSchema(item.Data),
+				Data:        []map[string]interface{}{item.Data},
+				Timestamp:   sharedTime,
+				Namespace:   r.URL.Path,
+				Enriched:    ingestFields(r, item.Data),
+				Trace:       eventTrace(r, item.Data),
+				RunID:       runID,
+				Batch:       batch,
+				ItemBytes:   []int{item.Bytes},
+			}
+
+			// In strict mode, schema-invalid events go to the bad events stream
+			// instead of the buffer, and their request is rejected
+			if strict {
+				event.Violations = appServer.ValidateEvent(event)
+				if len(event.Violations) > 0 {
+					rejected++
+					appServer.AddBadEvent(server.BadEvent{
+						Namespace:  event.Namespace,
+						Code:       utils.CodeSchemaViolation,
+						Detail:     "Event failed schema validation",
+						Schema:     event.Schema,
+						Data:       event.Data,
+						Violations: event.Violations,
+					})
+					if batch != nil {
+						violations = append(violations, batchViolations(event.Violations, item.Index)...)
+					} else {
+						violations = append(violations, event.Violations...)
+					}
+					return nil
+				}
+				event.Violations = []server.Violation{}
+			}
+			stream.Add(event)
+			return nil
+		})
+		if err != nil {
+			stream.Discard()
+			detail := "Invalid JSON payload"
+			if items > 0 {
+				detail = fmt.Sprintf("Invalid JSON payload after %d events", items)
+			}
+			rejectIngest(w, r, appServer, capture, http.StatusBadRequest, utils.CodeInvalidJSON, detail, server.BadEvent{Error: err.Error()})
 			return
 		}
 
 		// Extract schema from Snowplow payload
-		schema, schemaOk := payload["schema"].(string)
-		if !schemaOk {
-			http.Error(w, "Missing schema field", http.StatusBadRequest)
+		schema := payload.Schema
+		if !payload.HasSchema {
+			stream.Discard()
+			rejectIngest(w, r, appServer, capture, http.StatusBadRequest, utils.CodeMissingSchema, "Missing schema field", server.BadEvent{})
 			return
 		}
 
 		// Check if data is an array or a single object
-		dataRaw, dataExists := payload["data"]
-		if !dataExists {
-			http.Error(w, "Missing data field", http.StatusBadRequest)
+		if !payload.HasData {
+			stream.Discard()
+			rejectIngest(w, r, appServer, capture, http.StatusBadRequest, utils.CodeMissingData, "Missing data field", server.BadEvent{Schema: schema})
+			return
+		}
+		if payload.InvalidData {
+			stream.Discard()
+			rejectIngest(w, r, appServer, capture, http.StatusBadRequest, utils.CodeInvalidDataFormat, "Invalid data format - must be an object or array", server.BadEvent{Schema: schema})
+			return
+		}
+		if items == 0 {
+			rejectIngest(w, r, appServer, capture, http.StatusBadRequest, utils.CodeInvalidDataFormat, "Invalid data format", server.BadEvent{Schema: schema})
 			return
 		}
 
-		// Try to handle data as an array first
-		if dataArray, ok := dataRaw.([]interface{}); ok {
-			// Data is an array - send a separate event for each item
-			eventDataList := make([][]map[string]interface{}, 0)
-			for _, item := range dataArray {
-				if dataMap, ok := item.(map[string]interface{}); ok {
-					eventDataList = append(eventDataList, []map[string]interface{}{dataMap})
-				}
-			}
-
-			if len(eventDataList) == 0 {
-				http.Error(w, "Invalid data format", http.StatusBadRequest)
-				return
-			}
+		// Trackers retry the whole request, so a batch with an invalid item
+		// is rejected as a whole instead of storing the valid items twice
+		if rejected > 0 {
+			stream.Discard()
+			appServer.RecordRejected()
+			appServer.RecordRejectedEvents(rejected, items)
+			utils.WriteProblemDetails(w, r, utils.Problem{
+				Status:     http.StatusUnprocessableEntity,
+				Code:       utils.CodeSchemaViolation,
+				Detail:     fmt.Sprintf("%d of %d events failed schema validation, so none were stored", rejected, items),
+				Violations: violations,
+			})
+			return
+		}
 
-			// Send each data item as a separate event with shared timestamp
-			sharedTime := time.Now()
-			for _, eventData := range eventDataList {
-				appServer.AddEventWithTime(schema, eventData, sharedTime)
-			}
-		} else if dataMap, ok := dataRaw.(map[string]interface{}); ok {
-			// Data is a single object - wrap in array and send as single event
-			appServer.AddEvent(schema, []map[string]interface{}{dataMap})
-		} else {
-			http.Error(w, "Invalid data format - must be an object or array", http.StatusBadRequest)
+		err = stream.Commit(items)
+		if errors.Is(err, server.ErrIngestQueueFull) {
+			w.Header().Set("Retry-After", "1")
+			utils.WriteProblem(w, r, http.StatusServiceUnavailable, utils.CodeIngestQueueFull, "Too many events are waiting to be processed, retry later")
+			return
+		}
+		if err != nil {
+			// The client went away while waiting for room in the queue
 			return
 		}
 
@@ -293,55 +467,242 @@ func HandlePostMessage(w http.ResponseWriter, r *http.Request, appServer *server
 		message := r.FormValue("message")
 
 		if message == "" {
-			http.Error(w, "Message cannot be empty", http.StatusBadRequest)
+			rejectIngest(w, r, appServer, capture, http.StatusBadRequest, utils.CodeEmptyMessage, "Message cannot be empty", server.BadEvent{})
 			return
 		}
 
 		// For legacy form data, create a simple event
-		appServer.AddEvent("form/message", []map[string]interface{}{
-			{
-				"message": message,
+		event := server.Event{
+			Schema: "form/message",
+			Data: []map[string]interface{}{
+				{
+					"message": message,
+				},
 			},
-		})
+			Namespace: r.URL.Path,
+			Enriched:  ingestFields(r, nil),
+			Trace:     eventTrace(r, nil),
+			RunID:     requestRunID(r, appServer),
+		}
+		if !ingestEvents(w, r, appServer, []server.Event{event}) {
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 	}
 }
 
+// ingestEvents stores the accepted events of a request, or queues them for the
+// ingest workers
+// It writes a 503 and returns false if the queue is full and overflowing
+// requests are rejected, so trackers retry later
+func ingestEvents(w http.ResponseWriter, r *http.Request, appServer *server.AppServer, events []server.Event) bool {
+	err := appServer.IngestEvents(r.Context(), events)
+	if errors.Is(err, server.ErrIngestQueueFull) {
+		w.Header().Set("Retry-After", "1")
+		utils.WriteProblem(w, r, http.StatusServiceUnavailable, utils.CodeIngestQueueFull, "Too many events are waiting to be processed, retry later")
+		return false
+	}
+	// The client went away while waiting for room in the queue
+	return err == nil
+}
+
+// rejectIngest counts a rejected ingest request, records it in the bad events
+// stream with the captured body and writes the problem response
+// In strict mode every rejection is reported as 422 Unprocessable Entity
+func rejectIngest(w http.ResponseWriter, r *http.Request, appServer *server.AppServer, capture *bodyCapture, status int, code string, detail string, bad server.BadEvent) {
+	appServer.RecordRejected()
+
+	capture.record(r, &bad)
+	bad.Namespace = r.URL.Path
+	bad.Code = code
+	bad.Detail = detail
+	appServer.AddBadEvent(bad)
+
+	if appServer.GetConfig().Strict {
+		status = http.StatusUnprocessableEntity
+	}
+	utils.WriteProblem(w, r, status, code, detail)
+}
+
+// batchViolations prefixes violation locations with the index of an item of a
+// data array
+func batchViolations(violations []server.Violation, index int) []server.Violation {
+	prefixed := make([]server.Violation, len(violations))
+	for i, violation := range violations {
+		violation.Location = fmt.Sprintf("data[%d].%s", index, violation.Location)
+		prefixed[i] = violation
+	}
+	return prefixed
+}
+
+// ingestFields returns the collector-side fields recorded for an ingested event
+// As in Snowplow, tracker-supplied ip and ua fields override the request's address and User-Agent
+func ingestFields(r *http.Request, item map[string]interface{}) map[string]interface{} {
+	ip := clientIP(r)
+	if trackerIP, ok := item["ip"].(string); ok && trackerIP != "" {
+		ip = trackerIP
+	}
+	fields := map[string]interface{}{
+		"user_ipaddress": ip,
+	}
+	userAgent := r.Header.Get("User-Agent")
+	if trackerUA, ok := item["ua"].(string); ok && trackerUA != "" {
+		userAgent = trackerUA
+	}
+	if userAgent != "" {
+		fields["useragent"] = userAgent
+	}
+	if hints := parseClientHints(r); hints != nil {
+		fields["http_client_hints"] = hints
+	}
+	return fields
+}
+
+// clientIP returns the IP address of the client that sent the request, taken
+// from X-Forwarded-For when goplow is behind a trusted reverse proxy
+func clientIP(r *http.Request) string {
+	if forwarded := forwardedClientIP(r); forwarded != "" {
+		return forwarded
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // HandleGetMessages returns all events as JSON
+// The optional since_marker query parameter (marker ID or label) limits the
+// results to events after that marker, trace_id and run_id to the events of a
+// distributed trace or test run, classification to those labelled by a
+// classification rule, event_schema to those whose items have a schema (an
+// Iglu URI or vendor/name key), and order=device sorts by device timestamp
 func HandleGetMessages(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
 	events := appServer.GetEvents()
+	if marker := r.URL.Query().Get("since_marker"); marker != "" {
+		var found bool
+		events, found = appServer.GetEventsSinceMarker(marker)
+		if !found {
+			utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeMarkerNotFound, "Marker not found")
+			return
+		}
+	}
+
+	if traceID := r.URL.Query().Get("trace_id"); traceID != "" {
+		events = server.FilterEventsByTrace(events, traceID)
+	}
+	if runID := r.URL.Query().Get("run_id"); runID != "" {
+		events = server.FilterEventsByRun(events, runID)
+	}
+	if label := r.URL.Query().Get("classification"); label != "" {
+		events = server.FilterEventsByClassification(events, label)
+	}
+	if schema := r.URL.Query().Get("event_schema"); schema != "" {
+		events = server.FilterEventsByEventSchema(events, schema)
+	}
+
+	// Cursors follow arrival order, whatever ?order= the page is sorted in
+	start, end, ok := pageWindow(w, r, len(events), func(i int) int { return events[i].ID })
+	if !ok {
+		return
+	}
+	events = events[start:end]
+
+	switch r.URL.Query().Get("order") {
+	case "", "arrival":
+		// Events are stored in arrival order
+	case "device":
+		server.SortEventsByDeviceTime(events)
+	default:
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "Invalid order - must be arrival or device")
+		return
+	}
+
+	// ?fields=id,schema,data.e returns only the listed fields of each event
+	var body interface{} = events
+	if r.URL.Query().Has("fields") {
+		paths, err := server.ParseFieldPaths(r.URL.Query().Get("fields"))
+		if err != nil {
+			utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, err.Error())
+			return
+		}
+		if body, err = server.ProjectEvents(events, paths); err != nil {
+			log.Printf("Error projecting events list: %v\n", err)
+			utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeInternalError, "Events could not be listed")
+			return
+		}
+	}
+	if err := utils.WriteCachedJSON(w, r, body); err != nil {
+		log.Printf("Error writing events list: %v\n", err)
+	}
+}
+
+// HandleClearEvents clears all buffered events, or with ?ns= or ?run_id= only
+// those of one ingest namespace or run
+func HandleClearEvents(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodPost {
+		utils.WriteMethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	scope := server.ClearScope{RunID: r.URL.Query().Get("run_id")}
+	if ns := r.URL.Query().Get("ns"); ns != "" {
+		scope.Namespace = server.NormalizeEndpointPath(ns)
+	}
+	var cleared int
+	if scope == (server.ClearScope{}) {
+		cleared = appServer.ClearEvents("manual", requestActor(r))
+	} else {
+		cleared = appServer.ClearScopedEvents(scope, "manual", requestActor(r))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(events)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "cleared": cleared})
 }
 
 // HandleSSE handles Server-Sent Events connections
 func HandleSSE(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	// ?channels= opts in to named events, e.g. ?channels=new,bad,stats
+	var channels []string
+	if r.URL.Query().Has("channels") {
+		var err error
+		if channels, err = server.ParseSSEChannels(r.URL.Query().Get("channels")); err != nil {
+			utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, err.Error())
+			return
+		}
+	}
+
 	// Set SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	// Note: No CORS headers on SSE endpoint
 
+	if appServer.GetConfig().SSECompression {
+		var finish func()
+		w, finish = utils.GzipStream(w, r)
+		defer finish()
+	}
+
 	// Generate client ID
-	clientID := fmt.Sprintf("client_%d", time.Now().UnixNano())
+	clientID := appServer.NewClientID("client")
 
 	// Add client to server
-	client := appServer.AddSSEClient(clientID, w)
-	if client == nil {
-		http.Error(w, "SSE not supported", http.StatusInternalServerError)
+	client, err := appServer.AddSSEClient(clientID, w, channels)
+	if errors.Is(err, server.ErrTooManySSEClients) {
+		w.Header().Set("Retry-After", "30")
+		utils.WriteProblem(w, r, http.StatusServiceUnavailable, utils.CodeTooManyClients, "Too many event stream clients are connected")
+		return
+	}
+	if err != nil {
+		utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeStreamUnsupported, "SSE not supported")
 		return
 	}
 
 	// Send initial messages (but don't send them via SSE since we load them via REST API first)
 	// The client will load existing messages via /api/messages and SSE will handle new ones
 
-	// Keep connection alive until client disconnects
-	select {
-	case <-r.Context().Done():
-		// Client disconnected
-		appServer.RemoveSSEClient(clientID)
-	case <-client.Done:
-		// Server is closing the connection
-	}
+	// Write queued frames until the client disconnects or the server closes the connection
+	appServer.ServeSSEClient(r.Context(), client)
 }
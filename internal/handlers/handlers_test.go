@@ -0,0 +1,133 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goplow/internal/server"
+)
+
+func TestPostBatchStoresItemsInOrder(t *testing.T) {
+	for _, workers := range []string{"0", "2"} {
+		t.Run("workers="+workers, func(t *testing.T) {
+			appServer, router := newTestServer(t, 1000, map[string]string{"ingest_workers": workers})
+			appServer.StartIngestWorkers()
+
+			if err := postPayload(router, appServer.GetEventsEndpoint(), payload(150)); err != nil {
+				t.Fatal(err)
+			}
+			appServer.StopIngestWorkers()
+
+			events := appServer.GetEvents()
+			if len(events) != 150 {
+				t.Fatalf("stored %d events, want 150", len(events))
+			}
+			for i, event := range events {
+				if event.Batch == nil || event.Batch.Index != i || event.Batch.Size != 150 {
+					t.Fatalf("event %d has batch %+v", i, event.Batch)
+				}
+			}
+			batch, ok := appServer.GetBatch(events[0].Batch.ID)
+			if !ok || batch.Size != 150 || len(batch.Missing) != 0 {
+				t.Errorf("unexpected batch: size %d, missing %v", batch.Size, batch.Missing)
+			}
+		})
+	}
+}
+
+func TestPostInvalidBatchStoresNothing(t *testing.T) {
+	bodies := map[string]string{
+		"truncated":       `{"schema":"` + payloadDataSchema + `","data":[{"e":"pv"},{"e":"pp"},{"e":`,
+		"malformed item":  `{"schema":"` + payloadDataSchema + `","data":[{"e":"pv"},{"e":"pp",},{"e":"se"}]}`,
+		"invalid trailer": `{"schema":"` + payloadDataSchema + `","data":[{"e":"pv"},{"e":"pp"}]`,
+	}
+	for _, workers := range []string{"0", "2"} {
+		for name, body := range bodies {
+			t.Run(name+"/workers="+workers, func(t *testing.T) {
+				appServer, router := newTestServer(t, 100, map[string]string{"ingest_workers": workers})
+				appServer.StartIngestWorkers()
+
+				req := httptest.NewRequest(http.MethodPost, appServer.GetEventsEndpoint(), bytes.NewReader([]byte(body)))
+				req.Header.Set("Content-Type", "application/json")
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				appServer.StopIngestWorkers()
+
+				if rec.Code != http.StatusBadRequest {
+					t.Errorf("got status %d, want 400", rec.Code)
+				}
+				// The tracker retries the whole request, so storing the items
+				// before the error would duplicate them
+				if events := appServer.GetEvents(); len(events) != 0 {
+					t.Errorf("stored %d events, want none", len(events))
+				}
+			})
+		}
+	}
+}
+
+func TestStrictModeRejectsAMixedBatchAsAWhole(t *testing.T) {
+	appServer, router := newTestServer(t, 100, map[string]string{"strict": "true"})
+	invalid := selfDescribing(1)
+	invalid["ue_pr"] = `{"schema":"` + unstructSchema + `","data":{"schema":"iglu:com.acme/checkout_step/jsonschema/1-0-0","data":{"step":2,"currency":"gbp"}}}`
+	body, _ := json.Marshal(map[string]interface{}{
+		"schema": payloadDataSchema,
+		"data":   []map[string]interface{}{pageView(0), invalid, selfDescribing(2)},
+	})
+
+	err := postPayload(router, appServer.GetEventsEndpoint(), body)
+	if err == nil || !strings.Contains(err.Error(), "status 422") || !strings.Contains(err.Error(), "1 of 3 events") {
+		t.Errorf("got %v, want a 422 for the invalid item", err)
+	}
+	// Trackers retry the whole batch, so its valid items are not stored either
+	if events := appServer.GetEvents(); len(events) != 0 {
+		t.Errorf("stored %d events, want none", len(events))
+	}
+	if bad := appServer.GetBadEvents(); len(bad) != 1 {
+		t.Errorf("recorded %d bad events, want the invalid item", len(bad))
+	}
+}
+
+func TestPostSingleItemHasNoBatch(t *testing.T) {
+	appServer, router := newTestServer(t, 100, nil)
+	body := []byte(`{"schema":"` + payloadDataSchema + `","data":{"e":"pv"}}`)
+	if err := postPayload(router, appServer.GetEventsEndpoint(), body); err != nil {
+		t.Fatal(err)
+	}
+
+	events := appServer.GetEvents()
+	if len(events) != 1 || events[0].Batch != nil || events[0].Timestamp.IsZero() {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
+
+func TestPostBatchIsTimestampedByTheServerClock(t *testing.T) {
+	appServer, router := newTestServer(t, 100, nil)
+	clock := fixedClock{time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC)}
+	appServer.SetClock(clock)
+
+	if err := postPayload(router, appServer.GetEventsEndpoint(), payload(3)); err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range appServer.GetEvents() {
+		if !event.Timestamp.Equal(clock.now) || !event.ReceivedAt.Equal(clock.now) {
+			t.Errorf("event %d at %s, received %s, want %s", event.ID, event.Timestamp, event.ReceivedAt, clock.now)
+		}
+	}
+}
+
+// fixedClock is a server clock that stands still
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time { return c.now }
+
+func (c fixedClock) NewTicker(d time.Duration) server.Ticker {
+	return server.SystemClock{}.NewTicker(d)
+}
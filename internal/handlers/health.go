@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"goplow/internal/utils"
+)
+
+// HealthPath is the liveness route polled by container healthchecks
+const HealthPath = "/api/health"
+
+// healthRouteGroup holds the liveness route outside the configurable groups,
+// so rate and body limits never fail a healthcheck and polls are not logged
+const healthRouteGroup = "health"
+
+// HandleHealth reports that the server is up and serving requests
+func HandleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
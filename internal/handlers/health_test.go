@@ -0,0 +1,39 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"goplow/internal/handlers"
+	"goplow/internal/server"
+)
+
+func TestHealthIsOutsideTheAPIGroupLimits(t *testing.T) {
+	config, _, err := server.LoadContainerConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.DataDir = t.TempDir()
+	config.RouteGroups = []server.RouteGroupConfig{{Name: server.RouteGroupAPI, RateLimit: 1, RateBurst: 1}}
+	router := handlers.NewRouter()
+	handlers.RegisterRoutes(router, server.New(config))
+
+	get := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "203.0.113.7:4321"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 5; i++ {
+		if code := get(handlers.HealthPath); code != http.StatusOK {
+			t.Fatalf("healthcheck %d answered %d, want 200", i+1, code)
+		}
+	}
+	get("/api/bad-events")
+	if code := get("/api/bad-events"); code != http.StatusTooManyRequests {
+		t.Errorf("second API request answered %d, want the api group's rate limit", code)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// labelsResponse is the body of GET /api/labels
+type labelsResponse struct {
+	Lang      string            `json:"lang"`
+	Languages []string          `json:"languages"`
+	Labels    map[string]string `json:"labels"`
+}
+
+// HandleLabels serves the dashboard and field labels in the language given by
+// ?lang=, or else the first language of the Accept-Language header
+func HandleLabels(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	lang := r.URL.Query().Get("lang")
+	if lang == "" {
+		lang = preferredLanguage(r.Header.Get("Accept-Language"))
+	}
+	chosen, labels := appServer.Labels(lang)
+
+	w.Header().Set("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", chosen)
+	response := labelsResponse{Lang: chosen, Languages: appServer.LabelLanguages(), Labels: labels}
+	if err := utils.WriteCachedJSON(w, r, response); err != nil {
+		log.Printf("Error writing labels: %v\n", err)
+	}
+}
+
+// preferredLanguage returns the first language tag of an Accept-Language header,
+// e.g. "de-CH" for "de-CH,de;q=0.9,en;q=0.8"
+func preferredLanguage(header string) string {
+	first, _, _ := strings.Cut(header, ",")
+	tag, _, _ := strings.Cut(first, ";")
+	if tag = strings.TrimSpace(tag); tag == "*" {
+		return ""
+	}
+	return tag
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// markerRequest is the body accepted by the markers endpoint
+type markerRequest struct {
+	Label string `json:"label"`
+}
+
+// HandleAddMarker inserts a labelled marker into the event timeline
+func HandleAddMarker(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodPost {
+		utils.WriteMethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	var req markerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidJSON, "Invalid JSON payload")
+		return
+	}
+
+	label := strings.TrimSpace(req.Label)
+	if label == "" {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeMissingField, "Missing label field")
+		return
+	}
+
+	marker := appServer.AddMarker(label)
+	appServer.Audit(server.AuditMarker, requestActor(r), map[string]interface{}{"label": label, "eventId": marker.ID})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(marker)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+	"goplow/pkg/collector"
+)
+
+// MediaSession groups the media events of one playback session
+type MediaSession struct {
+	ID         string              `json:"id"`
+	Label      string              `json:"label,omitempty"`
+	FirstEvent time.Time           `json:"firstEvent"`
+	LastEvent  time.Time           `json:"lastEvent"`
+	Events     []MediaSessionEvent `json:"events"`
+}
+
+// MediaSessionEvent is a single media event within a session
+type MediaSessionEvent struct {
+	EventID         int         `json:"eventId"`
+	Type            string      `json:"type"`
+	CurrentTime     interface{} `json:"currentTime,omitempty"`
+	PercentProgress interface{} `json:"percentProgress,omitempty"`
+	Timestamp       time.Time   `json:"timestamp"`
+}
+
+// GetMediaSessions groups buffered media events by media session, ordered by first event
+func GetMediaSessions(appServer *server.AppServer) []*MediaSession {
+	sessions := map[string]*MediaSession{}
+	var ordered []*MediaSession
+
+	for _, event := range appServer.GetEvents() {
+		for _, item := range event.Data {
+			media, ok := collector.ParseMediaEvent(item)
+			if !ok {
+				continue
+			}
+
+			session, exists := sessions[media.SessionID]
+			if !exists {
+				session = &MediaSession{ID: media.SessionID, FirstEvent: event.Timestamp}
+				sessions[media.SessionID] = session
+				ordered = append(ordered, session)
+			}
+			if session.Label == "" {
+				session.Label = media.Label
+			}
+			session.LastEvent = event.Timestamp
+			session.Events = append(session.Events, MediaSessionEvent{
+				EventID:         event.ID,
+				Type:            media.Type,
+				CurrentTime:     media.Player["currentTime"],
+				PercentProgress: media.Player["percentProgress"],
+				Timestamp:       event.Timestamp,
+			})
+		}
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].FirstEvent.Before(ordered[j].FirstEvent)
+	})
+	return ordered
+}
+
+// HandleMediaSessions returns buffered media events grouped by media session
+func HandleMediaSessions(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	sessions := GetMediaSessions(appServer)
+	if sessions == nil {
+		sessions = []*MediaSession{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sessions); err != nil {
+		log.Printf("Error encoding media sessions: %v\n", err)
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// metricsPrefix namespaces every exported metric
+const metricsPrefix = "goplow_"
+
+// HandleMetrics writes the server statistics and internal counters in the
+// Prometheus text exposition format
+func HandleMetrics(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	stats := appServer.GetStats()
+	var b strings.Builder
+
+	writeMetric(&b, "events_total", "counter", "Events accepted into the buffer.", "", []server.MetricValue{{Value: stats.TotalEvents}})
+	byType := make([]server.MetricValue, 0)
+	for eventType, count := range appServer.EventTypeCounts() {
+		byType = append(byType, server.MetricValue{Label: eventType, Value: count})
+	}
+	sort.Slice(byType, func(i, j int) bool { return byType[i].Label < byType[j].Label })
+	writeMetric(&b, "events_by_type_total", "counter", "Events accepted into the buffer, by tracker event type.", "event_type", byType)
+	writeMetric(&b, "ingest_rejected_total", "counter", "Ingest requests rejected as malformed or invalid.", "", []server.MetricValue{{Value: stats.TotalRejected}})
+
+	suppressed := make([]server.MetricValue, 0, len(stats.SuppressedByType))
+	for eventType, count := range stats.SuppressedByType {
+		suppressed = append(suppressed, server.MetricValue{Label: eventType, Value: count})
+	}
+	sort.Slice(suppressed, func(i, j int) bool { return suppressed[i].Label < suppressed[j].Label })
+	writeMetric(&b, "events_suppressed_total", "counter", "Events dropped by sampling rules.", "event_type", suppressed)
+
+	writeMetric(&b, "buffered_events", "gauge", "Events currently held in memory.", "", []server.MetricValue{{Value: stats.BufferedEvents}})
+	writeMetric(&b, "sse_clients", "gauge", "Connected event stream clients.", "", []server.MetricValue{{Value: stats.SSEClients}})
+	writeMetric(&b, "ingest_queued_requests", "gauge", "Tracker requests waiting for an ingest worker.", "", []server.MetricValue{{Value: appServer.IngestQueueDepth()}})
+
+	counters := appServer.GetMetrics()
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeMetric(&b, name, "counter", server.MetricHelp[name], server.MetricLabels[name], counters[name])
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// writeMetric writes one metric family with its HELP and TYPE lines
+func writeMetric(b *strings.Builder, name string, kind string, help string, label string, values []server.MetricValue) {
+	fmt.Fprintf(b, "# HELP %s%s %s\n", metricsPrefix, name, help)
+	fmt.Fprintf(b, "# TYPE %s%s %s\n", metricsPrefix, name, kind)
+	for _, value := range values {
+		if label == "" {
+			fmt.Fprintf(b, "%s%s %d\n", metricsPrefix, name, value.Value)
+			continue
+		}
+		fmt.Fprintf(b, "%s%s{%s=%q} %d\n", metricsPrefix, name, label, value.Label, value.Value)
+	}
+}
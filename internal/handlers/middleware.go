@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// Middleware wraps a handler with a concern shared by many routes, such as
+// logging, CORS or auth
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps a handler in middleware, the first outermost
+func Chain(handler http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// routeGroupMiddleware returns the configured middleware of a route group:
+// request logging, panic recovery, the rate limit and the body limit, in order
+func routeGroupMiddleware(appServer *server.AppServer, config server.RouteGroupConfig) []Middleware {
+	var middleware []Middleware
+	if config.LogRequests {
+		middleware = append(middleware, LogRequests(config.Name))
+	}
+	middleware = append(middleware, Recover(appServer))
+	if config.RateLimit > 0 {
+		middleware = append(middleware, RateLimit(config.RateLimit, config.RateBurst))
+	}
+	if config.MaxBodyKB > 0 {
+		middleware = append(middleware, LimitBody(int64(config.MaxBodyKB)<<10))
+	}
+	return middleware
+}
+
+// LogRequests logs each request's method, path, status and duration once it
+// has been answered, labelled with its route group
+func LogRequests(group string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			log.Printf("[%s] %s %s %d %s\n", group, r.Method, r.URL.Path, recorder.status, time.Since(started).Round(time.Microsecond))
+		})
+	}
+}
+
+// Recover answers requests whose handler panics with a 500 problem, so one
+// bad request does not stop the server; the panic is logged with its stack
+// trace and recorded as a goplow error event
+func Recover(appServer *server.AppServer) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				stack := string(debug.Stack())
+				log.Printf("Panic serving %s %s: %v\n%s", r.Method, r.URL.Path, recovered, stack)
+				appServer.RecordInternalError(server.InternalError{Method: r.Method, Path: r.URL.Path, Panic: recovered, Stack: stack})
+				utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeInternalError, "The request could not be handled")
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CORS applies the CORS headers allowing the origins returned by origins, and
+// answers OPTIONS requests for a route that allows methods: preflights get
+// those methods, the headers they asked for and how long to cache the answer
+func CORS(appServer *server.AppServer, origins func() string, methods ...string) Middleware {
+	allowed := strings.Join(append(append([]string{}, methods...), http.MethodOptions), ", ")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			corsOrigins := origins()
+			applyCORSOrigins(w, appServer, corsOrigins)
+			if r.Method != http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Allow", allowed)
+			if corsOrigins != "" && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", allowed)
+				w.Header().Set("Access-Control-Allow-Headers", preflightHeaders(r, appServer))
+				w.Header().Add("Vary", "Access-Control-Request-Method, Access-Control-Request-Headers")
+				if maxAge := appServer.GetCORSMaxAge(); maxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// preflightHeaders returns the request headers a preflight allows: the ones
+// goplow reads and those in cors_allow_headers, or if none are configured the
+// ones it asked for
+func preflightHeaders(r *http.Request, appServer *server.AppServer) string {
+	config := appServer.GetConfig()
+	if requested := strings.TrimSpace(r.Header.Get("Access-Control-Request-Headers")); requested != "" && len(config.CORSAllowHeaders) == 0 {
+		return requested
+	}
+	// Browser tests may send trace and run IDs with their events
+	headers := append([]string{"Content-Type", "Authorization", "traceparent", config.RunIDHeader}, config.CORSAllowHeaders...)
+	return strings.Join(headers, ", ")
+}
+
+// RequireToken rejects requests other than preflights that do not carry the
+// token as a bearer token, the basic auth user or password, or the api_secret
+// query parameter
+func RequireToken(token string, realm string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodOptions && !hasToken(r, token) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="goplow"`)
+				utils.WriteProblem(w, r, http.StatusUnauthorized, utils.CodeUnauthorized, "Missing or invalid auth token for "+realm)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasToken reports whether a request carries the token
+func hasToken(r *http.Request, token string) bool {
+	candidates := []string{r.URL.Query().Get("api_secret")}
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		candidates = append(candidates, strings.TrimSpace(bearer))
+	}
+	if user, password, ok := r.BasicAuth(); ok {
+		candidates = append(candidates, user, password)
+	}
+	for _, candidate := range candidates {
+		if candidate != "" && subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// LimitBody stops reading request bodies after maxBytes; handlers see an
+// error reading the rest, and answer as they do for unreadable bodies
+func LimitBody(maxBytes int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				utils.WriteProblem(w, r, http.StatusRequestEntityTooLarge, utils.CodeBodyTooLarge, fmt.Sprintf("Request bodies are limited to %d bytes", maxBytes))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// maxRateClients bounds the clients a rate limit tracks; idle clients with
+// full buckets are forgotten first
+const maxRateClients = 10000
+
+// RateLimit answers 429 to client IPs making more than perSecond requests per
+// second, allowing bursts of up to burst requests (perSecond rounded up if 0)
+func RateLimit(perSecond float64, burst int) Middleware {
+	if burst <= 0 {
+		burst = int(math.Ceil(perSecond))
+	}
+	limiter := &rateLimiter{perSecond: perSecond, burst: float64(burst), buckets: make(map[string]*rateBucket)}
+	retryAfter := fmt.Sprint(int(math.Ceil(1 / perSecond)))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limiter.allow(clientIP(r), time.Now()) {
+				w.Header().Set("Retry-After", retryAfter)
+				utils.WriteProblem(w, r, http.StatusTooManyRequests, utils.CodeRateLimited, "Too many requests, retry later")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimiter is a token bucket per client IP
+type rateLimiter struct {
+	mutex     sync.Mutex
+	perSecond float64
+	burst     float64
+	buckets   map[string]*rateBucket
+}
+
+// rateBucket holds a client's remaining requests as of its last request
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token from the client's bucket, reporting false if it is empty
+func (l *rateLimiter) allow(client string, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxRateClients {
+			l.forgetIdle(now)
+		}
+		bucket = &rateBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.perSecond)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// forgetIdle drops the buckets that have refilled, which behave like new ones
+func (l *rateLimiter) forgetIdle(now time.Time) {
+	for client, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.perSecond >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// statusRecorder remembers the status a handler answered with
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+// WriteHeader records the status before sending it
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the default status if none was sent
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush keeps SSE streams working through the wrapper
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// pageWindow applies the request's pagination parameters to n items in
+// ascending ID order, setting Link headers to the neighbouring pages
+// It returns the bounds of the page, or false after writing a problem
+func pageWindow(w http.ResponseWriter, r *http.Request, n int, id func(i int) int) (int, int, bool) {
+	page, paged, err := server.ParsePage(r.URL.Query())
+	if err != nil {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, err.Error())
+		return 0, 0, false
+	}
+	if !paged {
+		return 0, n, true
+	}
+
+	start, end := page.Window(n, id)
+	var links []string
+	if start < end && start > 0 {
+		links = append(links, `<`+pageURL(r, "before_id", id(start))+`>; rel="prev"`)
+	}
+	if start < end && end < n {
+		links = append(links, `<`+pageURL(r, "after_id", id(end-1))+`>; rel="next"`)
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	return start, end, true
+}
+
+// pageURL returns the request's URL with its cursor replaced by cursor=id
+func pageURL(r *http.Request, cursor string, id int) string {
+	query := r.URL.Query()
+	query.Del("after_id")
+	query.Del("before_id")
+	query.Set(cursor, strconv.Itoa(id))
+	return r.URL.Path + "?" + query.Encode()
+}
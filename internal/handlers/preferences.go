@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// maxPreferencesBytes limits the size of a preferences body
+const maxPreferencesBytes = 64 << 10
+
+// preferencesResponse is the body of GET and PUT /api/preferences
+type preferencesResponse struct {
+	Scope       string             `json:"scope"`
+	User        string             `json:"user,omitempty"`
+	Preferences server.Preferences `json:"preferences"`
+}
+
+// HandlePreferences reads (GET) or replaces (PUT) the dashboard preferences
+// ?scope=user selects those of the user named by the trusted proxy's
+// X-Forwarded-User header and ?scope=global the shared ones; by default a
+// request's user is used if it has one
+func HandlePreferences(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet, http.MethodPut)
+		return
+	}
+
+	actor := requestActor(r)
+	user := actor.User
+	switch r.URL.Query().Get("scope") {
+	case "":
+	case "global":
+		user = ""
+	case "user":
+		if user == "" {
+			utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "User preferences need an X-Forwarded-User header from a trusted proxy")
+			return
+		}
+	default:
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "scope must be user or global")
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var preferences server.Preferences
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPreferencesBytes)).Decode(&preferences); err != nil {
+			utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidJSON, "Invalid JSON payload")
+			return
+		}
+		if err := preferences.Validate(); err != nil {
+			utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, err.Error())
+			return
+		}
+		if err := appServer.SetPreferences(user, preferences, actor); err != nil {
+			log.Printf("Error saving preferences: %v\n", err)
+			utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodePreferencesFailed, "Preferences could not be saved")
+			return
+		}
+	}
+
+	preferences, err := appServer.GetPreferences(user)
+	if err != nil {
+		log.Printf("Error reading preferences: %v\n", err)
+		utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodePreferencesFailed, "Preferences could not be read")
+		return
+	}
+	response := preferencesResponse{Scope: "global", User: user, Preferences: preferences}
+	if user != "" {
+		response.Scope = "user"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
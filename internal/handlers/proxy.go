@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"goplow/internal/server"
+)
+
+// WithBasePath serves next under basePath (e.g. "/goplow") for running behind a
+// reverse proxy. Requests are accepted with or without the prefix, so it works
+// whether or not the proxy strips it, and redirects keep the prefix.
+func WithBasePath(basePath string, next http.Handler) http.Handler {
+	if basePath == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == basePath {
+			http.Redirect(w, r, externalURL(r, basePath+"/"), http.StatusMovedPermanently)
+			return
+		}
+
+		inner := r
+		if rest, found := strings.CutPrefix(r.URL.Path, basePath+"/"); found {
+			inner = r.Clone(r.Context())
+			inner.URL.Path = "/" + rest
+			inner.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, basePath)
+		}
+		next.ServeHTTP(&basePathWriter{ResponseWriter: w, request: r, basePath: basePath}, inner)
+	})
+}
+
+// forwardedHeaders are only believed when set by a trusted proxy
+var forwardedHeaders = []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "X-Forwarded-User"}
+
+// WithTrustedProxies drops X-Forwarded-* headers from requests whose direct
+// peer is not a trusted proxy, so clients cannot spoof their IP address
+// For trusted peers, X-Forwarded-For is reduced to the client address: the
+// rightmost entry that is not itself a trusted proxy.
+func WithTrustedProxies(appServer *server.AppServer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hasForwarded := false
+		for _, header := range forwardedHeaders {
+			if r.Header.Get(header) != "" {
+				hasForwarded = true
+			}
+		}
+		if !hasForwarded {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		peer, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil || !appServer.IsTrustedProxy(peer) {
+			for _, header := range forwardedHeaders {
+				r.Header.Del(header)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if client := untrustedForwardedFor(r, appServer); client != "" {
+			r.Header.Set("X-Forwarded-For", client)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// untrustedForwardedFor walks X-Forwarded-For from the nearest proxy back
+// towards the client and returns the first address that is not a trusted proxy
+func untrustedForwardedFor(r *http.Request, appServer *server.AppServer) string {
+	entries := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	client := ""
+	for i := len(entries) - 1; i >= 0; i-- {
+		client = strings.TrimSpace(entries[i])
+		if !appServer.IsTrustedProxy(client) {
+			break
+		}
+	}
+	return client
+}
+
+// basePathWriter adds the base path to root-relative redirect locations
+type basePathWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	basePath    string
+	wroteHeader bool
+}
+
+// WriteHeader rewrites the Location header before sending the status
+func (w *basePathWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		location := w.Header().Get("Location")
+		if strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//") && !strings.HasPrefix(location, w.basePath+"/") {
+			w.Header().Set("Location", externalURL(w.request, w.basePath+location))
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write sends the default status first, so it passes through WriteHeader
+func (w *basePathWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush keeps SSE streams working through the wrapper
+func (w *basePathWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *basePathWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// externalURL returns the absolute URL of path as the client sees it,
+// honouring the X-Forwarded-Proto and X-Forwarded-Host set by trusted proxies
+func externalURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := firstForwardedValue(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	host := r.Host
+	if forwardedHost := firstForwardedValue(r.Header.Get("X-Forwarded-Host")); forwardedHost != "" {
+		host = forwardedHost
+	}
+	return (&url.URL{Scheme: scheme, Host: host}).String() + path
+}
+
+// firstForwardedValue returns the first entry of a comma-separated forwarded
+// header, which was added by the proxy closest to the client
+func firstForwardedValue(header string) string {
+	first, _, _ := strings.Cut(header, ",")
+	return strings.TrimSpace(first)
+}
+
+// forwardedClientIP returns the original client address from X-Forwarded-For,
+// or "" if the header is missing or malformed
+// WithTrustedProxies has already dropped the header unless a trusted proxy set it
+func forwardedClientIP(r *http.Request) string {
+	ip := firstForwardedValue(r.Header.Get("X-Forwarded-For"))
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	ip = strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")
+	if net.ParseIP(ip) == nil {
+		return ""
+	}
+	return ip
+}
+
+// rebaseHTML points the web interface at basePath: asset URLs get the prefix,
+// and a small script prefixes the root-relative URLs the app fetches and streams
+func rebaseHTML(html string, basePath string) string {
+	if basePath == "" {
+		return html
+	}
+	quoted, _ := json.Marshal(basePath)
+	shim := `<script>(function(base){` +
+		`function rebase(u){return typeof u==="string"&&u[0]==="/"&&u[1]!=="/"?base+u:u}` +
+		`var fetch=window.fetch;window.fetch=function(u,o){return fetch.call(this,rebase(u),o)};` +
+		`var ES=window.EventSource;function Rebased(u,c){return new ES(rebase(u),c)}` +
+		`Rebased.prototype=ES.prototype;Rebased.CONNECTING=0;Rebased.OPEN=1;Rebased.CLOSED=2;window.EventSource=Rebased` +
+		`})(` + string(quoted) + `)</script>`
+
+	html = strings.ReplaceAll(html, `="/assets/`, `="`+basePath+`/assets/`)
+	html = strings.ReplaceAll(html, `="/static/`, `="`+basePath+`/static/`)
+	return strings.Replace(html, "<head>", "<head>\n    "+shim, 1)
+}
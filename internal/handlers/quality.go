@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// QualityPath serves the data-quality score, and is read by goplow quality
+const QualityPath = "/api/quality"
+
+// HandleQuality returns the data-quality score of the buffered events
+// run_id, session_id and trace_id score only the events of a test run, capture
+// session or distributed trace
+func HandleQuality(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	events := appServer.GetEvents()
+	if runID := r.URL.Query().Get("run_id"); runID != "" {
+		events = server.FilterEventsByRun(events, runID)
+	}
+	if value := r.URL.Query().Get("session_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "Invalid session_id - must be a positive integer")
+			return
+		}
+		events = server.FilterEventsBySession(events, id)
+	}
+	if traceID := r.URL.Query().Get("trace_id"); traceID != "" {
+		events = server.FilterEventsByTrace(events, traceID)
+	}
+
+	if err := utils.WriteCachedJSON(w, r, appServer.ScoreQuality(events)); err != nil {
+		log.Printf("Error writing quality score: %v\n", err)
+	}
+}
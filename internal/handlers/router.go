@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+
+	"goplow/internal/server"
+)
+
+// Router dispatches the requests of the main listener to route groups: the
+// ingest endpoints, including adapters mounted under a path prefix, the API
+// and the web interface, each wrapped in its own middleware
+type Router struct {
+	mux    *http.ServeMux
+	groups map[string]*RouteGroup
+	// ingest holds the patterns of routes that accept events, which the
+	// ingest access lists apply to
+	ingest map[string]bool
+}
+
+// RouteGroup registers routes on a router wrapped in the group's middleware
+type RouteGroup struct {
+	name       string
+	router     *Router
+	middleware []Middleware
+}
+
+// NewRouter returns a router with no routes
+func NewRouter() *Router {
+	return &Router{mux: http.NewServeMux(), groups: make(map[string]*RouteGroup), ingest: make(map[string]bool)}
+}
+
+// Group returns the route group with the name, created without middleware
+// the first time
+func (rt *Router) Group(name string) *RouteGroup {
+	group, ok := rt.groups[name]
+	if !ok {
+		group = &RouteGroup{name: name, router: rt}
+		rt.groups[name] = group
+	}
+	return group
+}
+
+// Use adds middleware to the routes the group registers from now on, inside
+// the middleware already added
+func (g *RouteGroup) Use(middleware ...Middleware) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+// Handle registers a handler for a pattern, as http.ServeMux does, wrapped in
+// the group's middleware
+func (g *RouteGroup) Handle(pattern string, handler http.Handler) {
+	g.HandleWith(pattern, handler)
+}
+
+// HandleWith registers a handler for a pattern wrapped in the group's
+// middleware and then the route's own
+func (g *RouteGroup) HandleWith(pattern string, handler http.Handler, middleware ...Middleware) {
+	if g.name == server.RouteGroupIngest {
+		g.router.ingest[pattern] = true
+	}
+	g.router.mux.Handle(pattern, Chain(Chain(handler, middleware...), g.middleware...))
+}
+
+// HandleFunc registers a handler function for a pattern, as http.ServeMux
+// does, wrapped in the group's middleware
+func (g *RouteGroup) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	g.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// MountEndpoint registers an ingest endpoint's handler in the ingest group at
+// its path, and at every path under it if the endpoint is mounted, answering
+// with the endpoint's CORS headers and rejecting requests without its auth token
+func (rt *Router) MountEndpoint(endpoint server.EndpointConfig, appServer *server.AppServer, handler http.Handler) {
+	path := server.NormalizeEndpointPath(endpoint.Path)
+	middleware := []Middleware{CORS(appServer, func() string { return endpointOrigins(endpoint, appServer) }, http.MethodPost)}
+	if endpoint.AuthToken != "" {
+		middleware = append(middleware, RequireToken(endpoint.AuthToken, path))
+	}
+
+	ingest := rt.Group(server.RouteGroupIngest)
+	ingest.HandleWith(path, handler, middleware...)
+	if endpoint.Mounted() {
+		ingest.HandleWith(path+"/", handler, middleware...)
+	}
+}
+
+// Handler returns the handler and pattern for a request, as http.ServeMux does
+func (rt *Router) Handler(r *http.Request) (http.Handler, string) {
+	return rt.mux.Handler(r)
+}
+
+// IsIngest reports whether a pattern belongs to a route that accepts events
+func (rt *Router) IsIngest(pattern string) bool {
+	return rt.ingest[pattern]
+}
+
+// ServeHTTP dispatches the request to the handler of its route
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// endpointOrigins returns the CORS origins of an ingest endpoint: its own
+// allowed_origins, or the server's
+func endpointOrigins(endpoint server.EndpointConfig, appServer *server.AppServer) string {
+	if endpoint.AllowedOrigins != "" {
+		return endpoint.AllowedOrigins
+	}
+	return appServer.GetCORSAllowedOrigins()
+}
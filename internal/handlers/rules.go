@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+
+	"goplow/internal/jsonpath"
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// compiledRule is a transform rule with its path parsed
+type compiledRule struct {
+	field string
+	path  *jsonpath.Path
+}
+
+// CompileTransformRules compiles the configured transform rules into a post-processor
+// that adds each rule's field to the display event when its path matches
+func CompileTransformRules(rules []server.TransformRule) (utils.PostProcessor, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Field == "" {
+			return nil, fmt.Errorf("transform rule %d: missing field", i+1)
+		}
+		path, err := jsonpath.Compile(rule.Path)
+		if err != nil {
+			return nil, fmt.Errorf("transform rule %d (%s): %w", i+1, rule.Field, err)
+		}
+		compiled = append(compiled, compiledRule{field: rule.Field, path: path})
+	}
+
+	return func(raw map[string]interface{}, transformed map[string]interface{}) map[string]interface{} {
+		root := map[string]interface{}{"data": raw}
+
+		// Copy before adding fields, as pass-through items share the stored event's map
+		result := make(map[string]interface{}, len(transformed)+len(compiled))
+		for key, value := range transformed {
+			result[key] = value
+		}
+		for _, rule := range compiled {
+			if value, ok := rule.path.Eval(root); ok {
+				result[rule.field] = value
+			}
+		}
+		return result
+	}, nil
+}
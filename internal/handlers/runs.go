@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"net/http"
+
+	"goplow/internal/server"
+)
+
+// requestRunID returns the run ID an ingest request was sent with, from the
+// configured run_id_header
+func requestRunID(r *http.Request, appServer *server.AppServer) string {
+	return server.NormalizeRunID(r.Header.Get(appServer.GetConfig().RunIDHeader))
+}
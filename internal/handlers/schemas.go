@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// HandleSSEEventSchema serves goplow's own schema for the frames on the SSE stream
+func HandleSSEEventSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	version := strings.TrimPrefix(r.URL.Path, server.SSEEventSchemaPath)
+	schema, ok := server.GetSSEEventSchema(version)
+	if !ok {
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeSchemaNotFound, "Schema not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(schema)
+}
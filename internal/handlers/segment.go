@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// segmentSchemaPrefix names Segment events by call type, e.g. "segment/track"
+const segmentSchemaPrefix = "segment/"
+
+// segmentCalls are the Segment HTTP tracking API call types
+var segmentCalls = map[string]bool{
+	"identify": true,
+	"track":    true,
+	"page":     true,
+	"screen":   true,
+	"group":    true,
+	"alias":    true,
+}
+
+// HandleSegment ingests Segment HTTP tracking API calls sent under the
+// endpoint's path: /v1/track, /v1/page and the other calls, each stored as an
+// event with the schema segment/<type>, and /v1/batch or /v1/import with a
+// batch of calls. Segment libraries send their write key as the basic auth
+// user, which the endpoint's auth_token can check.
+func HandleSegment(w http.ResponseWriter, r *http.Request, appServer *server.AppServer, endpoint server.EndpointConfig) {
+	capture := captureBody(r, appServer.GetConfig().BadBodyCaptureKB)
+	body, ok := readAdapterBody(w, r, appServer, capture, "Segment")
+	if !ok {
+		return
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		rejectIngest(w, r, appServer, capture, http.StatusBadRequest, utils.CodeInvalidJSON, "Invalid Segment payload", server.BadEvent{Error: err.Error()})
+		return
+	}
+
+	calls, err := segmentCallItems(path.Base(adapterSubpath(r, endpoint)), payload)
+	if err != nil {
+		rejectIngest(w, r, appServer, capture, http.StatusBadRequest, utils.CodeInvalidParameter, err.Error(), server.BadEvent{Error: err.Error()})
+		return
+	}
+
+	receivedAt := appServer.Now()
+	for _, call := range calls {
+		addAdapterEvent(r, appServer, endpoint, segmentSchemaPrefix+call["type"].(string), call, nil, receivedAt)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// segmentCallItems returns the calls of a Segment request: the calls of a
+// batch or import, or the payload itself, typed by the request path if it
+// has no type
+func segmentCallItems(pathCall string, payload map[string]interface{}) ([]map[string]interface{}, error) {
+	var calls []map[string]interface{}
+	if pathCall == "batch" || pathCall == "import" {
+		batch, ok := payload["batch"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s payload has no batch array", pathCall)
+		}
+		for _, element := range batch {
+			if call, ok := element.(map[string]interface{}); ok {
+				calls = append(calls, call)
+			}
+		}
+	} else {
+		if _, typed := payload["type"].(string); !typed {
+			payload["type"] = pathCall
+		}
+		calls = []map[string]interface{}{payload}
+	}
+
+	for i, call := range calls {
+		callType, _ := call["type"].(string)
+		if !segmentCalls[callType] {
+			return nil, fmt.Errorf("calls[%d] has unknown Segment call type %q", i, callType)
+		}
+	}
+	return calls, nil
+}
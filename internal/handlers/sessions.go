@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// sessionRequest is the body accepted when starting a capture session
+type sessionRequest struct {
+	Name     string                 `json:"name"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// HandleGetSessions returns the current capture session and those that have
+// ended, which are paginated
+func HandleGetSessions(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	current, ended := appServer.GetSessions()
+	start, end, ok := pageWindow(w, r, len(ended), func(i int) int { return ended[i].ID })
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"current": current, "ended": ended[start:end]})
+}
+
+// HandleStartSession starts a named capture session, recorded with every event until it stops
+func HandleStartSession(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodPost {
+		utils.WriteMethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	var req sessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidJSON, "Invalid JSON payload")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeMissingField, "Missing name field")
+		return
+	}
+
+	session := appServer.StartSession(name, req.Metadata, requestActor(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// HandleStopSession ends the current capture session
+func HandleStopSession(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodPost {
+		utils.WriteMethodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	session, ok := appServer.StopSession(requestActor(r))
+	if !ok {
+		utils.WriteProblem(w, r, http.StatusConflict, utils.CodeNoActiveSession, "No capture session is active")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// sinksPrefix is the path prefix for individual sinks
+const sinksPrefix = "/api/sinks/"
+
+// redeliverRequest selects dead letters to redeliver; no IDs selects all of them
+type redeliverRequest struct {
+	IDs []int `json:"ids"`
+}
+
+// HandleListSinks returns the delivery status of every sink (GET /api/sinks)
+func HandleListSinks(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	statuses := []server.SinkStatus{}
+	for _, sink := range appServer.Sinks() {
+		statuses = append(statuses, sink.Status())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// HandleSink serves the per-sink routes: the dead letters of a sink
+// (GET /api/sinks/{name}/dead-letter) and redelivering them
+// (POST /api/sinks/{name}/dead-letter/redeliver)
+func HandleSink(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	name, route, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, sinksPrefix), "/")
+	sink, ok := appServer.GetSink(name)
+	if !ok {
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeSinkNotFound, "No sink named "+name)
+		return
+	}
+
+	switch route {
+	case "dead-letter":
+		if r.Method != http.MethodGet {
+			utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		letters := sink.DeadLetters()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sink":        sink.Name(),
+			"count":       len(letters),
+			"deadLetters": letters,
+		})
+	case "dead-letter/redeliver":
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		var req redeliverRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidJSON, "Invalid JSON payload")
+			return
+		}
+		redelivered := sink.Redeliver(req.IDs)
+		appServer.Audit(server.AuditRedeliver, requestActor(r), map[string]interface{}{"sink": sink.Name(), "redelivered": redelivered})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":      "success",
+			"redelivered": redelivered,
+			"remaining":   len(sink.DeadLetters()),
+		})
+	default:
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeNotFound, "Expected /api/sinks/{name}/dead-letter or /api/sinks/{name}/dead-letter/redeliver")
+	}
+}
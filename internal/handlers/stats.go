@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// statsInterval is how often the stats stream emits a snapshot
+const statsInterval = time.Second
+
+// HandleStats returns a snapshot of the server statistics as JSON
+func HandleStats(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(appServer.GetStats())
+}
+
+// HandleStatsStream streams a stats snapshot every second over SSE
+func HandleStatsStream(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeStreamUnsupported, "SSE not supported")
+		return
+	}
+
+	// Set SSE headers
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	if appServer.GetConfig().SSECompression {
+		var finish func()
+		w, finish = utils.GzipStream(w, r)
+		defer finish()
+		flusher = w.(http.Flusher)
+	}
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	// The snapshot is encoded straight into the response; Encode ends the data line
+	encoder := json.NewEncoder(w)
+	for {
+		if _, err := io.WriteString(w, "data: "); err != nil {
+			return
+		}
+		if err := encoder.Encode(appServer.GetStats()); err != nil {
+			return
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// HandleStreamJSONL streams each new event as a line of JSON (GET /api/stream.jsonl),
+// for curl and jq pipelines and editor plugins that do not want SSE framing
+// Each line is the stored event as returned by the events list
+func HandleStreamJSONL(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	clientID := appServer.NewClientID("stream")
+	client, err := appServer.AddStreamClient(clientID, w)
+	if errors.Is(err, server.ErrTooManySSEClients) {
+		w.Header().Set("Retry-After", "30")
+		utils.WriteProblem(w, r, http.StatusServiceUnavailable, utils.CodeTooManyClients, "Too many event stream clients are connected")
+		return
+	}
+	if err != nil {
+		utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeStreamUnsupported, "Streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	client.Flusher.Flush()
+
+	// Write events until the client disconnects or the server closes the connection
+	appServer.ServeSSEClient(r.Context(), client)
+}
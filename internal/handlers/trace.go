@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+
+	"goplow/internal/iglu"
+	"goplow/internal/server"
+)
+
+// traceparentHeader is the W3C Trace Context request header
+const traceparentHeader = "traceparent"
+
+// eventTrace returns the trace context an ingested event was produced under:
+// a traceparent field in any of the item's context entities, which is specific
+// to the event, or else the request's traceparent header
+func eventTrace(r *http.Request, item map[string]interface{}) *server.TraceContext {
+	for _, entity := range iglu.ContextEntities(item) {
+		if value, ok := entity.Data[traceparentHeader].(string); ok {
+			if trace, ok := server.ParseTraceparent(value); ok {
+				return trace
+			}
+		}
+	}
+	trace, _ := server.ParseTraceparent(r.Header.Get(traceparentHeader))
+	return trace
+}
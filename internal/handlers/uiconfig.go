@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// uiConfig is the body of GET /api/ui-config
+type uiConfig struct {
+	DisplayTimezone string `json:"displayTimezone"`
+	// UTCOffset is the zone's current offset, e.g. "+01:00"
+	UTCOffset  string `json:"utcOffset"`
+	TimeFormat string `json:"timeFormat"`
+	// TimeFormatPattern is TimeFormat as a Unicode date pattern, e.g.
+	// "yyyy-MM-dd HH:mm:ss", for JavaScript date libraries
+	TimeFormatPattern string `json:"timeFormatPattern"`
+	// Example is the current time in the zone and format
+	Example string `json:"example"`
+}
+
+// HandleUIConfig serves the settings the dashboard displays times with
+func HandleUIConfig(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	config := appServer.GetConfig()
+	location := config.DisplayLocation()
+	now := appServer.Now().In(location)
+	response := uiConfig{
+		DisplayTimezone:   location.String(),
+		UTCOffset:         now.Format("-07:00"),
+		TimeFormat:        config.TimeFormat,
+		TimeFormatPattern: datePattern(config.TimeFormat),
+		Example:           now.Format(config.TimeFormat),
+	}
+	if err := utils.WriteCachedJSON(w, r, response); err != nil {
+		log.Printf("Error writing UI config: %v\n", err)
+	}
+}
+
+// layoutElements maps Go reference time elements to Unicode date pattern fields,
+// longest first so that e.g. "2006" is matched before "2"
+var layoutElements = []struct {
+	element string
+	pattern string
+}{
+	{"January", "MMMM"}, {"Jan", "MMM"}, {"Monday", "EEEE"}, {"Mon", "EEE"}, {"MST", "z"},
+	{".000000000", ".SSSSSSSSS"}, {".000000", ".SSSSSS"}, {".000", ".SSS"},
+	{"Z07:00", "XXX"}, {"Z0700", "XX"}, {"Z07", "X"}, {"-07:00", "xxx"}, {"-0700", "xx"}, {"-07", "x"},
+	{"2006", "yyyy"}, {"01", "MM"}, {"02", "dd"}, {"_2", "d"}, {"03", "hh"}, {"04", "mm"},
+	{"05", "ss"}, {"06", "yy"}, {"15", "HH"}, {"PM", "a"}, {"pm", "a"},
+	{"1", "M"}, {"2", "d"}, {"3", "h"}, {"4", "m"}, {"5", "s"},
+}
+
+// datePattern converts a Go time layout to a Unicode date pattern, quoting
+// literal letters
+func datePattern(layout string) string {
+	var pattern strings.Builder
+	for len(layout) > 0 {
+		matched := false
+		for _, element := range layoutElements {
+			if strings.HasPrefix(layout, element.element) {
+				pattern.WriteString(element.pattern)
+				layout = layout[len(element.element):]
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		if c := layout[0]; c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			pattern.WriteString("'" + string(c) + "'")
+		} else if c == '\'' {
+			pattern.WriteString("''")
+		} else {
+			pattern.WriteByte(c)
+		}
+		layout = layout[1:]
+	}
+	return pattern.String()
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// eventsPrefix is the path prefix of the per-event API, /api/events/{id}/...
+const eventsPrefix = "/api/events/"
+
+// EventValidation is the validation result of a single buffered event
+type EventValidation struct {
+	EventID    int                `json:"eventId"`
+	Valid      bool               `json:"valid"`
+	Violations []server.Violation `json:"violations"`
+}
+
+// HandleEventValidation serves /api/events/{id}/validation, listing each schema
+// violation of the event with its JSON pointer, expected value and offending value
+func HandleEventValidation(w http.ResponseWriter, r *http.Request, appServer *server.AppServer) {
+	if r.Method != http.MethodGet {
+		utils.WriteMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	rawID, found := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, eventsPrefix), "/validation")
+	if !found {
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeNotFound, "Expected /api/events/{id} or /api/events/{id}/validation")
+		return
+	}
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "Event ID must be an integer")
+		return
+	}
+	event, ok := appServer.GetEvent(id)
+	if !ok {
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeEventNotFound, "No buffered event with ID "+rawID)
+		return
+	}
+
+	result := EventValidation{
+		EventID:    event.ID,
+		Valid:      len(event.Violations) == 0,
+		Violations: event.Violations,
+	}
+	if result.Violations == nil {
+		result.Violations = []server.Violation{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error encoding event validation: %v\n", err)
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"goplow/internal/server"
+	"goplow/internal/utils"
+)
+
+// maxWebhookBody bounds the webhook payloads read for signature verification
+const maxWebhookBody = 10 << 20
+
+// stripeTolerance is how far a Stripe style signature timestamp may be from now,
+// matching Stripe's own libraries
+const stripeTolerance = 5 * time.Minute
+
+// defaultWebhookSchema is used when neither the request nor the endpoint names a schema
+const defaultWebhookSchema = "webhook"
+
+// Signature header defaults for each signature_style
+var signatureHeaders = map[string]string{
+	server.SignatureStyleGitHub: "X-Hub-Signature-256",
+	server.SignatureStyleStripe: "Stripe-Signature",
+}
+
+// HandleWebhook ingests an arbitrary JSON or form payload, like the Snowplow
+// Iglu webhook adapter: the schema comes from the schema query parameter, then
+// the endpoint's schema setting, then for mounted endpoints the path under the
+// endpoint's (e.g. "github" for /hooks/github). If the endpoint has a
+// signature_secret, each event is marked with whether its HMAC signature verified.
+func HandleWebhook(w http.ResponseWriter, r *http.Request, appServer *server.AppServer, endpoint server.EndpointConfig) {
+	capture := captureBody(r, appServer.GetConfig().BadBodyCaptureKB)
+	body, ok := readAdapterBody(w, r, appServer, capture, "Webhook")
+	if !ok {
+		return
+	}
+
+	schema := r.URL.Query().Get("schema")
+	if schema == "" {
+		schema = endpoint.Schema
+	}
+	if schema == "" && endpoint.Mount {
+		schema = adapterSubpath(r, endpoint)
+	}
+	if schema == "" {
+		schema = defaultWebhookSchema
+	}
+
+	items, err := webhookItems(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		rejectIngest(w, r, appServer, capture, http.StatusBadRequest, utils.CodeInvalidDataFormat, "Invalid webhook payload", server.BadEvent{Schema: schema, Error: err.Error()})
+		return
+	}
+
+	// Signature timestamps are checked against the server clock, as the
+	// events are timestamped by it
+	receivedAt := appServer.Now()
+	var signature map[string]interface{}
+	if endpoint.SignatureSecret != "" {
+		signature = map[string]interface{}{"signature_verified": true}
+		if err := verifySignature(endpoint, r.Header, body, receivedAt); err != nil {
+			signature = map[string]interface{}{"signature_verified": false, "signature_error": err.Error()}
+		}
+	}
+
+	for _, item := range items {
+		addAdapterEvent(r, appServer, endpoint, schema, item, signature, receivedAt)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// webhookItems decodes a webhook body into event payloads
+// A JSON array becomes one event per object; form bodies become a single event
+// JSON sent with a form content type (as curl -d does) is still read as JSON
+func webhookItems(contentType string, body []byte) ([]map[string]interface{}, error) {
+	trimmed := bytes.TrimSpace(body)
+	looksLikeJSON := len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+	if strings.Contains(contentType, "application/x-www-form-urlencoded") && !looksLikeJSON {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		item := make(map[string]interface{}, len(values))
+		for key := range values {
+			item[key] = values.Get(key)
+		}
+		return []map[string]interface{}{item}, nil
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	switch value := payload.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{value}, nil
+	case []interface{}:
+		var items []map[string]interface{}
+		for _, element := range value {
+			if item, ok := element.(map[string]interface{}); ok {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			return nil, fmt.Errorf("array contains no objects")
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("payload must be a JSON object or array")
+}
+
+// verifySignature checks the request's HMAC-SHA256 signature of body
+// GitHub style headers carry the hex digest, optionally prefixed with
+// "sha256="; Stripe style headers carry "t=<timestamp>,v1=<hex digest>" over
+// "<timestamp>.<body>", and the timestamp must be within stripeTolerance of now
+func verifySignature(endpoint server.EndpointConfig, header http.Header, body []byte, now time.Time) error {
+	style := endpoint.SignatureStyle
+	if style == "" {
+		style = server.SignatureStyleGitHub
+	}
+	headerName := endpoint.SignatureHeader
+	if headerName == "" {
+		headerName = signatureHeaders[style]
+	}
+	value := header.Get(headerName)
+	if value == "" {
+		return fmt.Errorf("missing %s header", headerName)
+	}
+
+	signed := body
+	var candidates []string
+	switch style {
+	case server.SignatureStyleStripe:
+		var timestamp string
+		for _, part := range strings.Split(value, ",") {
+			key, item, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch key {
+			case "t":
+				timestamp = item
+			case "v1":
+				candidates = append(candidates, item)
+			}
+		}
+		if timestamp == "" || len(candidates) == 0 {
+			return fmt.Errorf("%s header has no t= timestamp or v1= signature", headerName)
+		}
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s timestamp %q is not a number", headerName, timestamp)
+		}
+		if age := now.Sub(time.Unix(seconds, 0)); age > stripeTolerance || age < -stripeTolerance {
+			return fmt.Errorf("%s timestamp is more than %s from now", headerName, stripeTolerance)
+		}
+		signed = append([]byte(timestamp+"."), body...)
+	default:
+		candidates = []string{strings.TrimPrefix(value, "sha256=")}
+	}
+
+	mac := hmac.New(sha256.New, []byte(endpoint.SignatureSecret))
+	mac.Write(signed)
+	expected := mac.Sum(nil)
+	for _, candidate := range candidates {
+		if digest, err := hex.DecodeString(candidate); err == nil && hmac.Equal(digest, expected) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature does not match")
+}
@@ -0,0 +1,110 @@
+package handlers_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goplow/internal/handlers"
+	"goplow/internal/server"
+)
+
+const webhookSecret = "whsec_test"
+
+// webhookBody is the payload every signature test sends
+const webhookBody = `{"action":"opened","number":42}`
+
+// newWebhookServer returns a server with GitHub and Stripe style signed
+// webhook endpoints, on a clock standing at now
+func newWebhookServer(t *testing.T, now time.Time) (*server.AppServer, http.Handler) {
+	t.Helper()
+	config, _, err := server.LoadContainerConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.DataDir = t.TempDir()
+	config.Endpoints = append(config.Endpoints,
+		server.EndpointConfig{Path: "/hooks/github", Adapter: server.AdapterWebhook, SignatureSecret: webhookSecret},
+		server.EndpointConfig{Path: "/hooks/stripe", Adapter: server.AdapterWebhook, SignatureSecret: webhookSecret, SignatureStyle: server.SignatureStyleStripe},
+	)
+	appServer := server.New(config)
+	appServer.SetClock(fixedClock{now})
+	router := handlers.NewRouter()
+	handlers.RegisterRoutes(router, appServer)
+	return appServer, router
+}
+
+// sign returns the hex HMAC-SHA256 digest of message with the test secret
+func sign(message string) string {
+	mac := hmac.New(sha256.New, []byte(webhookSecret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhook posts body to path with a signature header and returns the
+// enriched fields of the event it stored
+func postWebhook(t *testing.T, appServer *server.AppServer, router http.Handler, path string, header string, value string, body string) map[string]interface{} {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(header, value)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	events := appServer.GetEvents()
+	if len(events) != 1 {
+		t.Fatalf("stored %d events, want 1", len(events))
+	}
+	return events[0].Enriched
+}
+
+func TestWebhookSignatures(t *testing.T) {
+	now := time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC)
+	stripeHeader := func(at time.Time, body string) string {
+		timestamp := fmt.Sprint(at.Unix())
+		return "t=" + timestamp + ",v1=" + sign(timestamp+"."+body)
+	}
+	tests := []struct {
+		name     string
+		path     string
+		header   string
+		value    string
+		body     string
+		verified bool
+		err      string
+	}{
+		{"github valid", "/hooks/github", "X-Hub-Signature-256", "sha256=" + sign(webhookBody), webhookBody, true, ""},
+		{"github tampered", "/hooks/github", "X-Hub-Signature-256", "sha256=" + sign(webhookBody), `{"action":"closed","number":42}`, false, "does not match"},
+		{"github wrong secret", "/hooks/github", "X-Hub-Signature-256", "sha256=" + hex.EncodeToString(make([]byte, 32)), webhookBody, false, "does not match"},
+		{"github missing", "/hooks/github", "X-Other", "x", webhookBody, false, "missing X-Hub-Signature-256"},
+		{"stripe valid", "/hooks/stripe", "Stripe-Signature", stripeHeader(now.Add(-4*time.Minute), webhookBody), webhookBody, true, ""},
+		{"stripe tampered", "/hooks/stripe", "Stripe-Signature", stripeHeader(now, webhookBody), `{"action":"closed","number":42}`, false, "does not match"},
+		{"stripe expired", "/hooks/stripe", "Stripe-Signature", stripeHeader(now.Add(-6*time.Minute), webhookBody), webhookBody, false, "more than 5m0s from now"},
+		{"stripe from the future", "/hooks/stripe", "Stripe-Signature", stripeHeader(now.Add(6*time.Minute), webhookBody), webhookBody, false, "more than 5m0s from now"},
+		{"stripe without timestamp", "/hooks/stripe", "Stripe-Signature", "v1=" + sign(webhookBody), webhookBody, false, "no t= timestamp"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The server clock, not the system clock, decides whether a
+			// Stripe timestamp has expired
+			appServer, router := newWebhookServer(t, now)
+			enriched := postWebhook(t, appServer, router, test.path, test.header, test.value, test.body)
+
+			if enriched["signature_verified"] != test.verified {
+				t.Errorf("signature_verified is %v, want %v (%v)", enriched["signature_verified"], test.verified, enriched["signature_error"])
+			}
+			message, _ := enriched["signature_error"].(string)
+			if test.err == "" && message != "" || !strings.Contains(message, test.err) {
+				t.Errorf("signature_error is %q, want %q", message, test.err)
+			}
+		})
+	}
+}
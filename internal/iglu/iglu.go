@@ -0,0 +1,39 @@
+package iglu
+
+import (
+	"strings"
+
+	"goplow/pkg/events"
+)
+
+// Entity is a self-describing JSON: a schema URI and the data it describes
+type Entity = events.Entity
+
+// SelfDescribingEvent decodes a ue event's ue_pr or ue_px payload and returns
+// the inner event's schema and data
+func SelfDescribingEvent(item map[string]interface{}) (string, map[string]interface{}, bool) {
+	return events.SelfDescribingEvent(item)
+}
+
+// ContextEntities decodes a tracker payload's co or cx contexts
+func ContextEntities(item map[string]interface{}) []Entity {
+	return events.DecodeContexts(item)
+}
+
+// SchemaKey returns the "vendor/name" part of an Iglu schema URI
+func SchemaKey(schema string) string {
+	return events.SchemaKey(schema)
+}
+
+// SchemaPath returns the vendor/name/format/version path of an Iglu schema URI,
+// as schemas are laid out in a static registry, or false if it is not an Iglu URI
+func SchemaPath(schema string) (string, bool) {
+	if !strings.HasPrefix(schema, "iglu:") {
+		return "", false
+	}
+	path := strings.TrimPrefix(schema, "iglu:")
+	if strings.Count(path, "/") != 3 {
+		return "", false
+	}
+	return path, true
+}
@@ -0,0 +1,291 @@
+package jsonpath
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Condition is a compiled boolean expression over paths, such as
+// `data.se_ca == "checkout" && data.se_ac != "view"`
+type Condition struct {
+	expr string
+	// any holds alternatives joined by ||, each a list of comparisons joined by &&
+	any [][]comparison
+}
+
+// comparison tests the value at a path; with no operator it tests that the
+// path exists
+type comparison struct {
+	path    *Path
+	negate  bool
+	op      string
+	literal string
+	// number is the literal's value if it is numeric, compared with numeric values
+	number   float64
+	isNumber bool
+	pattern  *regexp.Regexp
+}
+
+// Comparison operators
+const (
+	opEquals    = "=="
+	opNotEquals = "!="
+	opMatches   = "=~"
+)
+
+// CompileCondition parses a condition
+// Each comparison is a path, optionally negated with "!" to test that it is
+// missing, or a path, an operator and a literal: == and != compare the value as
+// text or, with a number literal, as numbers (so "3.0" equals 3, and a missing
+// value equals nothing), and =~ matches it against a regular expression.
+// Literals are JSON strings, numbers, true, false or null. Comparisons are
+// joined with && and ||, && binding tighter; paths matching several values
+// (through [*]) compare true if any value does
+func CompileCondition(expr string) (*Condition, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition %q: %w", expr, err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty condition")
+	}
+
+	condition := &Condition{expr: expr}
+	var all []comparison
+	for len(tokens) > 0 {
+		var current comparison
+		current, tokens, err = parseComparison(tokens)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition %q: %w", expr, err)
+		}
+		all = append(all, current)
+		if len(tokens) == 0 {
+			break
+		}
+		switch tokens[0] {
+		case "&&":
+		case "||":
+			condition.any = append(condition.any, all)
+			all = nil
+		default:
+			return nil, fmt.Errorf("invalid condition %q: expected && or || before %s", expr, tokens[0])
+		}
+		tokens = tokens[1:]
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("invalid condition %q: missing comparison at end", expr)
+		}
+	}
+	condition.any = append(condition.any, all)
+	return condition, nil
+}
+
+// parseComparison parses one comparison from the start of tokens
+func parseComparison(tokens []string) (comparison, []string, error) {
+	var current comparison
+	if tokens[0] == "!" {
+		current.negate = true
+		tokens = tokens[1:]
+		if len(tokens) == 0 {
+			return current, nil, fmt.Errorf("missing path after !")
+		}
+	}
+	if isOperator(tokens[0]) || isLiteral(tokens[0]) {
+		return current, nil, fmt.Errorf("expected a path, found %s", tokens[0])
+	}
+	path, err := Compile(tokens[0])
+	if err != nil {
+		return current, nil, err
+	}
+	current.path = path
+	tokens = tokens[1:]
+
+	if len(tokens) == 0 || !isOperator(tokens[0]) {
+		return current, tokens, nil
+	}
+	if current.negate {
+		return current, nil, fmt.Errorf("! only applies to a bare path")
+	}
+	current.op = tokens[0]
+	if len(tokens) < 2 || !isLiteral(tokens[1]) {
+		return current, nil, fmt.Errorf("expected a literal after %s", current.op)
+	}
+	current.literal, err = literalText(tokens[1])
+	if err != nil {
+		return current, nil, err
+	}
+	if !strings.HasPrefix(tokens[1], `"`) {
+		current.number, err = strconv.ParseFloat(tokens[1], 64)
+		current.isNumber = err == nil
+	}
+	if current.op == opMatches {
+		if current.pattern, err = regexp.Compile(current.literal); err != nil {
+			return current, nil, err
+		}
+	}
+	return current, tokens[2:], nil
+}
+
+// String returns the original expression
+func (c *Condition) String() string {
+	return c.expr
+}
+
+// Match evaluates the condition against decoded JSON
+func (c *Condition) Match(root interface{}) bool {
+	for _, all := range c.any {
+		matched := true
+		for _, current := range all {
+			if !current.match(root) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// match evaluates one comparison
+func (c comparison) match(root interface{}) bool {
+	value, found := c.path.Eval(root)
+	if c.op == "" {
+		return found != c.negate
+	}
+	if !found {
+		return c.op == opNotEquals
+	}
+
+	values := []interface{}{value}
+	if c.path.hasWildcard() {
+		values, _ = value.([]interface{})
+	}
+	for _, value := range values {
+		text := valueText(value)
+		switch c.op {
+		case opEquals:
+			if c.equals(text) {
+				return true
+			}
+		case opNotEquals:
+			if !c.equals(text) {
+				return true
+			}
+		case opMatches:
+			if c.pattern.MatchString(text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// equals compares a value's text with the literal, as numbers if both are
+// numeric so that "10.0" equals 10
+func (c comparison) equals(text string) bool {
+	if c.isNumber {
+		if number, err := strconv.ParseFloat(text, 64); err == nil {
+			return number == c.number
+		}
+	}
+	return text == c.literal
+}
+
+// hasWildcard reports whether the path can match several values
+func (p *Path) hasWildcard() bool {
+	for _, current := range p.segments {
+		if current.wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// valueText returns a decoded JSON value as the text comparisons use
+func valueText(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case nil:
+		return "null"
+	}
+	return fmt.Sprint(value)
+}
+
+// literalText returns a literal token as the text comparisons use
+func literalText(token string) (string, error) {
+	if strings.HasPrefix(token, `"`) {
+		text, err := strconv.Unquote(token)
+		if err != nil {
+			return "", fmt.Errorf("bad string %s", token)
+		}
+		return text, nil
+	}
+	if number, err := strconv.ParseFloat(token, 64); err == nil {
+		return strconv.FormatFloat(number, 'f', -1, 64), nil
+	}
+	return token, nil
+}
+
+// isOperator reports whether a token is a comparison operator
+func isOperator(token string) bool {
+	return token == opEquals || token == opNotEquals || token == opMatches
+}
+
+// isLiteral reports whether a token is a string, number, boolean or null literal
+func isLiteral(token string) bool {
+	if strings.HasPrefix(token, `"`) || token == "true" || token == "false" || token == "null" {
+		return true
+	}
+	_, err := strconv.ParseFloat(token, 64)
+	return err == nil
+}
+
+// tokenize splits a condition into paths, literals, operators and connectives
+func tokenize(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		switch c := expr[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(expr) && expr[end] != '"' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, expr[i:end+1])
+			i = end + 1
+		case strings.HasPrefix(expr[i:], "&&"), strings.HasPrefix(expr[i:], "||"),
+			strings.HasPrefix(expr[i:], opEquals), strings.HasPrefix(expr[i:], opNotEquals), strings.HasPrefix(expr[i:], opMatches):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		case c == '!':
+			tokens = append(tokens, "!")
+			i++
+		default:
+			end := i
+			for end < len(expr) && !strings.ContainsRune(" \t\n\"!=&|", rune(expr[end])) {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("unexpected %q", expr[i:])
+			}
+			tokens = append(tokens, expr[i:end])
+			i = end
+		}
+	}
+	return tokens, nil
+}
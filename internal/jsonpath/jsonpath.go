@@ -0,0 +1,135 @@
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"goplow/pkg/events"
+)
+
+// segment is one step of a path: an object key, an array index or a wildcard
+type segment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// Path is a compiled jq/JSONPath-style expression such as
+// "data.ue_px.data.data.label", ".data.cx.data[0].schema" or "$.data.cx.data[*].schema"
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+// Compile parses a path expression
+// A leading "$" or "." is optional. Keys are separated by dots and array
+// elements are selected with [n] or [*].
+func Compile(expr string) (*Path, error) {
+	rest := strings.TrimSpace(expr)
+	rest = strings.TrimPrefix(rest, "$")
+	rest = strings.TrimPrefix(rest, ".")
+	if rest == "" {
+		return nil, fmt.Errorf("empty path expression")
+	}
+
+	var segments []segment
+	for _, part := range strings.Split(rest, ".") {
+		key := part
+		var indexes []string
+		if open := strings.Index(part, "["); open >= 0 {
+			key = part[:open]
+			for _, index := range strings.Split(part[open:], "[")[1:] {
+				if !strings.HasSuffix(index, "]") {
+					return nil, fmt.Errorf("invalid path %q: unclosed bracket", expr)
+				}
+				indexes = append(indexes, strings.TrimSuffix(index, "]"))
+			}
+		}
+
+		if key == "" && len(indexes) == 0 {
+			return nil, fmt.Errorf("invalid path %q: empty key", expr)
+		}
+		if key != "" {
+			segments = append(segments, segment{key: key})
+		}
+		for _, index := range indexes {
+			if index == "*" {
+				segments = append(segments, segment{wildcard: true})
+				continue
+			}
+			n, err := strconv.Atoi(index)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid path %q: bad index %q", expr, index)
+			}
+			segments = append(segments, segment{index: n, isIndex: true})
+		}
+	}
+
+	return &Path{expr: expr, segments: segments}, nil
+}
+
+// String returns the original expression
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Eval evaluates the path against decoded JSON
+// Strings holding JSON or base64-encoded JSON (such as ue_px and cx) are decoded
+// transparently when the path continues into them. A wildcard returns an array
+// of the matched values. The second return value is false if nothing matched.
+func (p *Path) Eval(root interface{}) (interface{}, bool) {
+	return eval(root, p.segments)
+}
+
+func eval(value interface{}, segments []segment) (interface{}, bool) {
+	if len(segments) == 0 {
+		return value, true
+	}
+	if s, ok := value.(string); ok {
+		decoded, ok := DecodeEmbeddedJSON(s)
+		if !ok {
+			return nil, false
+		}
+		value = decoded
+	}
+
+	current := segments[0]
+	switch {
+	case current.wildcard:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		results := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			if result, ok := eval(item, segments[1:]); ok {
+				results = append(results, result)
+			}
+		}
+		return results, len(results) > 0
+	case current.isIndex:
+		items, ok := value.([]interface{})
+		if !ok || current.index >= len(items) {
+			return nil, false
+		}
+		return eval(items[current.index], segments[1:])
+	default:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		next, exists := object[current.key]
+		if !exists {
+			return nil, false
+		}
+		return eval(next, segments[1:])
+	}
+}
+
+// DecodeEmbeddedJSON decodes a string holding a JSON object or array, either
+// directly or base64/base64url-encoded as Snowplow trackers send ue_px and cx
+func DecodeEmbeddedJSON(s string) (interface{}, bool) {
+	return events.DecodeEmbeddedJSON(s)
+}
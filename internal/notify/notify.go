@@ -0,0 +1,328 @@
+// Package notify posts a readable message for matching events to a webhook or
+// chat service, rendered from the Go templates of a notification's config
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"goplow/internal/iglu"
+	"goplow/internal/outbound"
+	"goplow/internal/server"
+	"goplow/internal/sinks"
+)
+
+// DefaultTitle is used when a notification has no title template
+const DefaultTitle = "{{.EventType}} event {{.ID}}{{if .AppID}} from {{.AppID}}{{end}}"
+
+// DefaultAnomalyTitle is used for volume anomalies when a notification has no
+// title template
+const DefaultAnomalyTitle = "{{.Data.message}}"
+
+// funcs are available in every notification template
+var funcs = template.FuncMap{
+	// json renders a value as compact JSON, e.g. {{json .Data}}
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+}
+
+// Data is what notification templates are executed with
+type Data struct {
+	ID int
+	// EventType is the tracker event type (e.g. "pv"), the schema key of a
+	// self-describing event (e.g. "com.acme/checkout"), "goplow/anomaly" for
+	// volume anomalies or "goplow/error" for requests that failed inside goplow
+	EventType string
+	AppID     string
+	// Schema and Data are the self-describing event, or the event's own schema
+	// and first payload item for other events
+	Schema string
+	Data   map[string]interface{}
+	// Params are the tracker parameters of the first payload item
+	Params    map[string]interface{}
+	Source    string
+	Namespace string
+	Timestamp time.Time
+	// Link is the event's detail URL on this instance
+	Link  string
+	Event server.Event
+}
+
+// Field is a named value of a rendered message
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Message is the body posted in the json format
+type Message struct {
+	Title  string       `json:"title"`
+	Fields []Field      `json:"fields"`
+	Link   string       `json:"link"`
+	Event  server.Event `json:"event"`
+}
+
+// field is a parsed field template
+type field struct {
+	name  string
+	value *template.Template
+}
+
+// Notifier posts a message for each matching event it is given
+// Queueing and retries are handled by the embedded sink
+type Notifier struct {
+	*sinks.Sink
+	webhookURL string
+	format     string
+	eventTypes map[string]bool
+	title      *template.Template
+	// anomalyTitle is the title of anomaly and goplow error events:
+	// DefaultAnomalyTitle, or the configured title template
+	anomalyTitle *template.Template
+	fields       []field
+	// linkBase is prepended to an event's ID to form its detail URL
+	linkBase string
+	client   *outbound.Client
+}
+
+// New creates a notifier from its config, linking events to the instance at publicURL
+func New(config server.NotificationConfig, publicURL string, client *outbound.Client, options sinks.Options) (*Notifier, error) {
+	title := config.Title
+	if title == "" {
+		title = DefaultTitle
+	}
+	notifier := &Notifier{
+		webhookURL: config.WebhookURL,
+		format:     config.Format,
+		eventTypes: make(map[string]bool, len(config.EventTypes)),
+		linkBase:   strings.TrimSuffix(publicURL, "/") + "/api/events/",
+		client:     client,
+	}
+	if notifier.format == "" {
+		notifier.format = server.NotificationFormatJSON
+	}
+	for _, eventType := range config.EventTypes {
+		notifier.eventTypes[eventType] = true
+	}
+
+	var err error
+	if notifier.title, err = parse("title", title); err != nil {
+		return nil, err
+	}
+	notifier.anomalyTitle = notifier.title
+	if config.Title == "" {
+		notifier.anomalyTitle, _ = parse("title", DefaultAnomalyTitle)
+	}
+	for _, configField := range config.Fields {
+		value, err := parse(configField.Name, configField.Value)
+		if err != nil {
+			return nil, err
+		}
+		notifier.fields = append(notifier.fields, field{name: configField.Name, value: value})
+	}
+
+	sink, err := sinks.New(config.Name, notifier.post, options)
+	if err != nil {
+		return nil, err
+	}
+	notifier.Sink = sink
+	return notifier, nil
+}
+
+// parse parses a notification template, naming it in errors
+func parse(name string, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// Notify queues a notification for the event if its type matches
+func (n *Notifier) Notify(event server.Event) {
+	if len(n.eventTypes) > 0 {
+		data := n.data(event)
+		if !n.eventTypes[data.EventType] && !n.eventTypes[trackerEventType(event)] {
+			return
+		}
+	}
+	n.Enqueue(event)
+}
+
+// Send queues a notification for the event if its type matches, as Notify does
+func (n *Notifier) Send(event server.Event) {
+	n.Notify(event)
+}
+
+// Sinks builds a notifier for each configured notification, linking back to
+// each event on this instance; it is registered as a server.SinkFactory
+func Sinks(appServer *server.AppServer) ([]server.EventSink, error) {
+	config := appServer.GetConfig()
+	publicURL := config.PublicURL
+	if publicURL == "" {
+		publicURL = appServer.GetURL()
+	}
+
+	var notifiers []server.EventSink
+	for _, notification := range config.Notifications {
+		options, err := sinks.OptionsFromConfig(config, notification.Name)
+		if err != nil {
+			return nil, fmt.Errorf("notification %s: %w", notification.Name, err)
+		}
+		client, err := outbound.NewClient(outbound.OptionsFromConfig(config))
+		if err != nil {
+			return nil, err
+		}
+		notifier, err := New(notification, publicURL, client, options)
+		if err != nil {
+			return nil, fmt.Errorf("notification %s: %w", notification.Name, err)
+		}
+		name := notification.Name
+		notifier.OnFailure = func(string) {
+			appServer.CountMetric(server.MetricNotificationFailures, name)
+		}
+		notifiers = append(notifiers, notifier)
+		log.Printf("Sending notification %s for %s\n", name, describeEventTypes(notification.EventTypes))
+	}
+	return notifiers, nil
+}
+
+// describeEventTypes lists the event types a notification is sent for
+func describeEventTypes(eventTypes []string) string {
+	if len(eventTypes) == 0 {
+		return "every event"
+	}
+	return strings.Join(eventTypes, ", ") + " events"
+}
+
+// Render executes the notification's templates for an event
+func (n *Notifier) Render(event server.Event) (Message, error) {
+	data := n.data(event)
+	message := Message{Fields: []Field{}, Link: data.Link, Event: event}
+
+	title := n.title
+	if event.Schema == server.AnomalySchema || event.Schema == server.InternalErrorSchema {
+		title = n.anomalyTitle
+	}
+	var text strings.Builder
+	if err := title.Execute(&text, data); err != nil {
+		return message, err
+	}
+	message.Title = text.String()
+	for _, field := range n.fields {
+		text.Reset()
+		if err := field.value.Execute(&text, data); err != nil {
+			return message, err
+		}
+		message.Fields = append(message.Fields, Field{Name: field.name, Value: text.String()})
+	}
+	return message, nil
+}
+
+// data collects the template data of an event
+func (n *Notifier) data(event server.Event) Data {
+	data := Data{
+		ID:        event.ID,
+		EventType: trackerEventType(event),
+		Schema:    event.Schema,
+		Source:    event.Source,
+		Namespace: event.Namespace,
+		Timestamp: event.Timestamp,
+		Link:      n.linkBase + strconv.Itoa(event.ID),
+		Event:     event,
+	}
+	if event.Schema == server.AnomalySchema || event.Schema == server.InternalErrorSchema {
+		data.EventType = event.Schema
+	}
+	if len(event.Data) == 0 {
+		return data
+	}
+	item := event.Data[0]
+	data.Params = item
+	data.Data = item
+	data.AppID, _ = item["aid"].(string)
+	if schema, selfDescribing, ok := iglu.SelfDescribingEvent(item); ok {
+		data.EventType = iglu.SchemaKey(schema)
+		data.Schema = schema
+		data.Data = selfDescribing
+	}
+	return data
+}
+
+// trackerEventType returns the tracker event type of an event, if it has one
+func trackerEventType(event server.Event) string {
+	if len(event.Data) == 0 {
+		return ""
+	}
+	eventType, _ := event.Data[0]["e"].(string)
+	return eventType
+}
+
+// post renders the message for an event and sends it to the webhook
+func (n *Notifier) post(ctx context.Context, event server.Event) error {
+	message, err := n.Render(event)
+	if err != nil {
+		return fmt.Errorf("rendering notification: %w", err)
+	}
+
+	var body interface{} = message
+	if n.format == server.NotificationFormatSlack {
+		body = slackMessage(message)
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// slackMessage formats a message for Slack-compatible incoming webhooks, as
+// text with the title linked to the event and an attachment of short fields
+func slackMessage(message Message) map[string]interface{} {
+	fields := make([]map[string]interface{}, 0, len(message.Fields))
+	for _, field := range message.Fields {
+		fields = append(fields, map[string]interface{}{
+			"title": field.Name,
+			"value": field.Value,
+			"short": len(field.Value) <= 40,
+		})
+	}
+	body := map[string]interface{}{
+		"text": fmt.Sprintf("<%s|%s>", message.Link, slackEscape(message.Title)),
+	}
+	if len(fields) > 0 {
+		body["attachments"] = []map[string]interface{}{{"fields": fields}}
+	}
+	return body
+}
+
+// slackEscape escapes the characters Slack treats as markup in message text
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
@@ -0,0 +1,148 @@
+// Package outbound builds the HTTP clients goplow uses for requests to other
+// services, such as the aggregator forwarder and the follow stream
+package outbound
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"goplow/internal/server"
+)
+
+// Defaults for the outbound_* duration settings
+const (
+	DefaultTimeout      = 5 * time.Second
+	DefaultRetryBackoff = 500 * time.Millisecond
+)
+
+// maxBackoff caps the delay between retries
+const maxBackoff = 30 * time.Second
+
+// Options configures outbound requests
+type Options struct {
+	// Timeout bounds each attempt, including reading the response
+	Timeout time.Duration
+	// Proxy is the proxy URL; if empty, HTTPS_PROXY, HTTP_PROXY and NO_PROXY apply
+	Proxy string
+	// InsecureSkipVerify disables TLS certificate verification
+	InsecureSkipVerify bool
+	// Retries is the number of times a failed request is retried
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled for each one after
+	RetryBackoff time.Duration
+}
+
+// OptionsFromConfig returns the outbound options of a validated configuration
+func OptionsFromConfig(config server.EnvironmentConfig) Options {
+	options := Options{
+		Timeout:            DefaultTimeout,
+		Proxy:              config.OutboundProxy,
+		InsecureSkipVerify: config.OutboundInsecureSkipVerify,
+		Retries:            config.OutboundRetries,
+		RetryBackoff:       DefaultRetryBackoff,
+	}
+	if timeout, err := time.ParseDuration(config.OutboundTimeout); err == nil {
+		options.Timeout = timeout
+	}
+	if backoff, err := time.ParseDuration(config.OutboundRetryBackoff); err == nil {
+		options.RetryBackoff = backoff
+	}
+	return options
+}
+
+// Client sends outbound requests with the configured proxy, TLS and retry settings
+type Client struct {
+	http    *http.Client
+	stream  *http.Client
+	retries int
+	backoff time.Duration
+}
+
+// NewClient creates a client for the given options
+func NewClient(options Options) (*Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if options.Proxy != "" {
+		proxyURL, err := url.Parse(options.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid outbound proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if options.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &Client{
+		http:    &http.Client{Transport: transport, Timeout: options.Timeout},
+		stream:  &http.Client{Transport: transport},
+		retries: options.Retries,
+		backoff: options.RetryBackoff,
+	}, nil
+}
+
+// Do sends a request, retrying network errors, 429 and 5xx responses with
+// exponential backoff
+// A request whose body cannot be replayed (no GetBody) is not retried, and
+// retrying stops when the request's context is done
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.http.Do(req)
+		if attempt >= c.retries || !retryable(req, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			// Drain a little of the body so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(backoff(c.backoff, attempt))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		req = req.Clone(req.Context())
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// Stream sends a request for a long-lived response, such as an SSE stream,
+// without the timeout or retries
+func (c *Client) Stream(req *http.Request) (*http.Response, error) {
+	return c.stream.Do(req)
+}
+
+// retryable reports whether a request that got resp or err should be sent again
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// backoff returns the delay before retry number attempt+1
+func backoff(initial time.Duration, attempt int) time.Duration {
+	delay := initial
+	for i := 0; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
@@ -0,0 +1,208 @@
+package replay
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"goplow/internal/server"
+)
+
+// loadTestTick is how often the load generator schedules requests
+const loadTestTick = 10 * time.Millisecond
+
+// LoadOptions configure a load test
+type LoadOptions struct {
+	// Target is the collector URL; DefaultPath is used if it has no path
+	Target string
+	// Rate is the number of requests started per second
+	Rate float64
+	// Duration is how long requests are started for
+	Duration time.Duration
+	// Concurrency caps the requests in flight; requests due while all are busy
+	// are skipped, so a slow target shows up as a lower achieved rate
+	Concurrency int
+	// Batch is the number of tracker events in each request
+	Batch int
+	// Timeout bounds each request
+	Timeout time.Duration
+}
+
+// LoadReport summarizes a load test
+type LoadReport struct {
+	Sent     int           `json:"sent"`
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Errors   int           `json:"errors"`
+	Skipped  int           `json:"skipped"`
+	Duration time.Duration `json:"duration"`
+	// Statuses counts the response status of each request
+	Statuses map[int]int `json:"statuses"`
+	// Latency holds percentiles of the request latency, keyed "p50", "p90",
+	// "p99" and "max"
+	Latency map[string]time.Duration `json:"latency"`
+}
+
+// AcceptRate returns the fraction of sent requests the target accepted
+func (r LoadReport) AcceptRate() float64 {
+	if r.Sent == 0 {
+		return 0
+	}
+	return float64(r.Accepted) / float64(r.Sent)
+}
+
+// LoadTest fires synthetic tracker payloads at the target at a fixed rate and
+// measures how many are accepted and how long they take
+func LoadTest(ctx context.Context, options LoadOptions) (LoadReport, error) {
+	targetURL, err := TargetURL(options.Target)
+	if err != nil {
+		return LoadReport{}, err
+	}
+	if options.Rate <= 0 {
+		return LoadReport{}, fmt.Errorf("rate must be positive")
+	}
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+	if options.Batch < 1 {
+		options.Batch = 1
+	}
+	client := &http.Client{
+		Timeout:   options.Timeout,
+		Transport: &http.Transport{MaxIdleConnsPerHost: options.Concurrency},
+	}
+
+	report := LoadReport{Statuses: make(map[int]int)}
+	var latencies []time.Duration
+	var mutex sync.Mutex
+	var workers sync.WaitGroup
+
+	jobs := make(chan server.Event, options.Concurrency)
+	for i := 0; i < options.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for event := range jobs {
+				body, err := payloadBody(event)
+				start := time.Now()
+				status := 0
+				if err == nil {
+					status, err = post(ctx, client, targetURL, event, body)
+				}
+				latency := time.Since(start)
+
+				mutex.Lock()
+				report.Sent++
+				report.Statuses[status]++
+				switch {
+				case err != nil:
+					report.Errors++
+				case status < 300:
+					report.Accepted++
+					latencies = append(latencies, latency)
+				default:
+					report.Rejected++
+					latencies = append(latencies, latency)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	// Start the requests due each tick, so the rate holds even when it is
+	// finer than the timer resolution
+	started := time.Now()
+	ticker := time.NewTicker(loadTestTick)
+	issued := 0
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			running = false
+		case now := <-ticker.C:
+			elapsed := now.Sub(started)
+			if elapsed >= options.Duration {
+				elapsed = options.Duration
+				running = false
+			}
+			for due := int(options.Rate * elapsed.Seconds()); issued < due; issued++ {
+				select {
+				case jobs <- syntheticEvent(issued, options.Batch):
+				default:
+					mutex.Lock()
+					report.Skipped++
+					mutex.Unlock()
+				}
+			}
+		}
+	}
+	ticker.Stop()
+	close(jobs)
+	workers.Wait()
+
+	report.Duration = time.Since(started)
+	report.Latency = percentiles(latencies)
+	return report, ctx.Err()
+}
+
+// percentiles summarizes latencies
+func percentiles(latencies []time.Duration) map[string]time.Duration {
+	if len(latencies) == 0 {
+		return map[string]time.Duration{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	at := func(fraction float64) time.Duration {
+		return latencies[int(fraction*float64(len(latencies)-1))]
+	}
+	return map[string]time.Duration{
+		"p50": at(0.5),
+		"p90": at(0.9),
+		"p99": at(0.99),
+		"max": latencies[len(latencies)-1],
+	}
+}
+
+// syntheticEvent builds the nth load test request: a mix of page views, page
+// pings and structured events, like a browsing session
+func syntheticEvent(n int, batch int) server.Event {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	data := make([]map[string]interface{}, batch)
+	for i := range data {
+		item := map[string]interface{}{
+			"e":    "pv",
+			"eid":  newUUID(),
+			"aid":  "goplow-loadtest",
+			"p":    "web",
+			"tv":   "goplow-loadtest",
+			"duid": fmt.Sprintf("loadtest-user-%d", (n*batch+i)%1000),
+			"url":  fmt.Sprintf("https://loadtest.example/page/%d", (n*batch+i)%50),
+			"dtm":  now,
+			"stm":  now,
+		}
+		switch (n*batch + i) % 10 {
+		case 7, 8:
+			item["e"] = "pp"
+			item["pp_miy"] = "0"
+			item["pp_may"] = "400"
+		case 9:
+			item["e"] = "se"
+			item["se_ca"] = "loadtest"
+			item["se_ac"] = "click"
+		}
+		data[i] = item
+	}
+	return server.Event{Schema: "iglu:com.snowplowanalytics.snowplow/payload_data/jsonschema/1-0-4", Data: data}
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
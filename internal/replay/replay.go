@@ -0,0 +1,178 @@
+// Package replay re-sends captured events to a Snowplow collector
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"goplow/internal/server"
+)
+
+// DefaultPath is the tracker protocol POST path used when the target URL has none
+const DefaultPath = "/com.snowplowanalytics.snowplow/tp2"
+
+// Options configure a replay
+type Options struct {
+	// Target is the collector URL; DefaultPath is used if it has no path
+	Target string
+	// Concurrency is the number of requests in flight
+	Concurrency int
+	// Rate limits requests per second; 0 sends as fast as possible
+	Rate float64
+	// Retries is how many times a failed request is retried
+	Retries int
+	// Timeout bounds each request
+	Timeout time.Duration
+}
+
+// Report summarizes a replay
+type Report struct {
+	Sent     int           `json:"sent"`
+	Failed   int           `json:"failed"`
+	Duration time.Duration `json:"duration"`
+	// Statuses counts the final response status of each request, 0 for
+	// requests that got no response
+	Statuses map[int]int `json:"statuses"`
+}
+
+// TargetURL returns the collector URL events are posted to
+func TargetURL(target string) (string, error) {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", fmt.Errorf("target %q must be an http or https URL", target)
+	}
+	if parsed.Path == "" || parsed.Path == "/" {
+		parsed.Path = DefaultPath
+	}
+	return parsed.String(), nil
+}
+
+// Run posts each event to the target as a tracker payload, keeping the
+// original IP address and user agent in X-Forwarded-For and User-Agent so the
+// collector attributes them as before
+func Run(ctx context.Context, events []server.Event, options Options) (Report, error) {
+	targetURL, err := TargetURL(options.Target)
+	if err != nil {
+		return Report{}, err
+	}
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+	client := &http.Client{Timeout: options.Timeout}
+
+	jobs := make(chan server.Event)
+	go func() {
+		defer close(jobs)
+		var ticks <-chan time.Time
+		if options.Rate > 0 {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / options.Rate))
+			defer ticker.Stop()
+			ticks = ticker.C
+		}
+		for _, event := range events {
+			if ticks != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticks:
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- event:
+			}
+		}
+	}()
+
+	report := Report{Statuses: make(map[int]int)}
+	var mutex sync.Mutex
+	var workers sync.WaitGroup
+	started := time.Now()
+	for i := 0; i < options.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for event := range jobs {
+				status, err := send(ctx, client, targetURL, event, options.Retries)
+				mutex.Lock()
+				report.Statuses[status]++
+				if err != nil {
+					report.Failed++
+				} else {
+					report.Sent++
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	workers.Wait()
+	report.Duration = time.Since(started)
+	return report, ctx.Err()
+}
+
+// send posts one event, retrying network errors and 5xx or 429 responses
+// with a doubling backoff, and returns the final status
+func send(ctx context.Context, client *http.Client, targetURL string, event server.Event, retries int) (int, error) {
+	body, err := payloadBody(event)
+	if err != nil {
+		return 0, err
+	}
+
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		status, err := post(ctx, client, targetURL, event, body)
+		retryable := err != nil || status >= 500 || status == http.StatusTooManyRequests
+		if !retryable || attempt >= retries || ctx.Err() != nil {
+			if err == nil && status >= 300 {
+				err = fmt.Errorf("unexpected status %d", status)
+			}
+			return status, err
+		}
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// payloadBody encodes an event as a tracker payload request body
+func payloadBody(event server.Event) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"schema": event.Schema,
+		"data":   event.Data,
+	})
+}
+
+// post makes a single request
+func post(ctx context.Context, client *http.Client, targetURL string, event server.Event, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if userAgent, ok := event.Enriched["useragent"].(string); ok && userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	if ip, ok := event.Enriched["user_ipaddress"].(string); ok && ip != "" {
+		req.Header.Set("X-Forwarded-For", ip)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,220 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// transformFunction is the global function a transform script must define
+const transformFunction = "transform"
+
+// DefaultTimeout is how long the script may run on one event before it is
+// stopped and the event is kept unchanged
+const DefaultTimeout = 250 * time.Millisecond
+
+// maxTableDepth bounds the nesting of the tables a script returns
+const maxTableDepth = 100
+
+// errCyclicTable is returned for a table that contains itself
+var errCyclicTable = errors.New("returned a table that contains itself")
+
+// LuaTransform runs a user-supplied Lua script over each decoded event
+// The script must define a global function transform(event) that receives the
+// event as a table and returns the (possibly modified) table. Returning nil keeps
+// the table passed in, so scripts may also edit it in place.
+type LuaTransform struct {
+	path  string
+	state *lua.LState
+	// LState is not safe for concurrent use
+	mutex sync.Mutex
+	// OnError, if set, is called each time the script fails on an event
+	OnError func(err error)
+	// Timeout bounds each call of the script; DefaultTimeout if zero
+	Timeout time.Duration
+}
+
+// LoadLuaTransform loads and compiles the transform script at path
+func LoadLuaTransform(path string) (*LuaTransform, error) {
+	state := lua.NewState()
+	if err := state.DoFile(path); err != nil {
+		state.Close()
+		return nil, fmt.Errorf("error loading transform script %s: %w", path, err)
+	}
+
+	if fn, ok := state.GetGlobal(transformFunction).(*lua.LFunction); !ok || fn == nil {
+		state.Close()
+		return nil, fmt.Errorf("transform script %s must define a global %s(event) function", path, transformFunction)
+	}
+
+	return &LuaTransform{
+		path:  path,
+		state: state,
+	}, nil
+}
+
+// Transform passes an event through the script
+// If the script fails, the event is returned unchanged and the error is logged
+func (t *LuaTransform) Transform(event map[string]interface{}) map[string]interface{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	// A script that never returns is stopped, so it cannot hold up every event
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	t.state.SetContext(ctx)
+	defer t.state.RemoveContext()
+
+	input := toLua(t.state, event)
+	err := t.state.CallByParam(lua.P{
+		Fn:      t.state.GetGlobal(transformFunction),
+		NRet:    1,
+		Protect: true,
+	}, input)
+	if err != nil {
+		t.state.SetTop(0)
+		log.Printf("Error running transform script %s: %v\n", t.path, err)
+		t.failed(err)
+		return event
+	}
+
+	ret := t.state.Get(-1)
+	t.state.Pop(1)
+
+	if ret == lua.LNil {
+		ret = input
+	}
+	table, ok := ret.(*lua.LTable)
+	if !ok {
+		log.Printf("Transform script %s returned %s, expected a table\n", t.path, ret.Type())
+		t.failed(fmt.Errorf("returned %s, expected a table", ret.Type()))
+		return event
+	}
+
+	converted, err := fromLua(table, make(map[*lua.LTable]bool))
+	if err != nil {
+		log.Printf("Transform script %s %v\n", t.path, err)
+		t.failed(err)
+		return event
+	}
+	if result, ok := converted.(map[string]interface{}); ok {
+		return result
+	}
+	// An empty table converts to an empty map
+	return map[string]interface{}{}
+}
+
+// failed reports a script failure to OnError
+func (t *LuaTransform) failed(err error) {
+	if t.OnError != nil {
+		t.OnError(err)
+	}
+}
+
+// Close releases the Lua state
+func (t *LuaTransform) Close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.state.Close()
+}
+
+// toLua converts decoded JSON values to Lua values
+func toLua(state *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case float64:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case map[string]interface{}:
+		table := state.NewTable()
+		for key, item := range v {
+			table.RawSetString(key, toLua(state, item))
+		}
+		return table
+	case []interface{}:
+		table := state.NewTable()
+		for _, item := range v {
+			table.Append(toLua(state, item))
+		}
+		return table
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
+
+// fromLua converts Lua values back to JSON-compatible Go values
+// Tables with only consecutive integer keys become arrays, all others become
+// objects; path holds the tables being converted, so a table that contains
+// itself is an error rather than endless recursion
+func fromLua(value lua.LValue, path map[*lua.LTable]bool) (interface{}, error) {
+	switch v := value.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LString:
+		return string(v), nil
+	case lua.LNumber:
+		return float64(v), nil
+	case *lua.LTable:
+		if path[v] {
+			return nil, errCyclicTable
+		}
+		if len(path) >= maxTableDepth {
+			return nil, fmt.Errorf("returned tables nested more than %d deep", maxTableDepth)
+		}
+		path[v] = true
+		defer delete(path, v)
+
+		if length := v.MaxN(); length > 0 && countKeys(v) == length {
+			items := make([]interface{}, 0, length)
+			for i := 1; i <= length; i++ {
+				item, err := fromLua(v.RawGetInt(i), path)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			return items, nil
+		}
+		result := make(map[string]interface{})
+		var err error
+		v.ForEach(func(key lua.LValue, value lua.LValue) {
+			if err != nil {
+				return
+			}
+			result[key.String()], err = fromLua(value, path)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	default:
+		return v.String(), nil
+	}
+}
+
+// countKeys returns the number of keys in a Lua table
+func countKeys(table *lua.LTable) int {
+	count := 0
+	table.ForEach(func(lua.LValue, lua.LValue) {
+		count++
+	})
+	return count
+}
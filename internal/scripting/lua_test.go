@@ -0,0 +1,90 @@
+package scripting
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadScript writes a transform script to a temporary file and loads it
+func loadScript(t *testing.T, source string) *LuaTransform {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "transform.lua")
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script, err := LoadLuaTransform(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(script.Close)
+	return script
+}
+
+func TestTransformStopsAScriptThatNeverReturns(t *testing.T) {
+	script := loadScript(t, `
+function transform(event)
+  if event.e == "loop" then
+    while true do end
+  end
+  event.seen = true
+  return event
+end`)
+	script.Timeout = 50 * time.Millisecond
+	var failures []error
+	script.OnError = func(err error) { failures = append(failures, err) }
+
+	start := time.Now()
+	looping := map[string]interface{}{"e": "loop"}
+	if result := script.Transform(looping); result["e"] != "loop" || result["seen"] != nil {
+		t.Errorf("got %v, want the event unchanged", result)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the script ran for %s", elapsed)
+	}
+	if len(failures) != 1 || !strings.Contains(failures[0].Error(), "deadline") {
+		t.Errorf("got failures %v, want the timeout", failures)
+	}
+
+	// The script still runs on later events
+	if result := script.Transform(map[string]interface{}{"e": "pv"}); result["seen"] != true {
+		t.Errorf("got %v after a timeout, want the transformed event", result)
+	}
+}
+
+func TestTransformRejectsATableThatContainsItself(t *testing.T) {
+	script := loadScript(t, `
+function transform(event)
+  event.self = event
+  return event
+end`)
+	var failures []error
+	script.OnError = func(err error) { failures = append(failures, err) }
+
+	event := map[string]interface{}{"e": "pv"}
+	if result := script.Transform(event); result["self"] != nil {
+		t.Errorf("got %v, want the event unchanged", result)
+	}
+	if len(failures) != 1 || failures[0] != errCyclicTable {
+		t.Errorf("got failures %v, want the cyclic table", failures)
+	}
+}
+
+func TestTransformKeepsSharedTables(t *testing.T) {
+	script := loadScript(t, `
+function transform(event)
+  local page = {url = "https://shop.example/"}
+  event.from = page
+  event.to = page
+  return event
+end`)
+
+	result := script.Transform(map[string]interface{}{"e": "pv"})
+	from, _ := result["from"].(map[string]interface{})
+	to, _ := result["to"].(map[string]interface{})
+	if from["url"] != "https://shop.example/" || to["url"] != "https://shop.example/" {
+		t.Errorf("got %v, want the table converted twice", result)
+	}
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"goplow/internal/jsonpath"
+)
+
+// Aggregate metrics
+const (
+	MetricCount = "count"
+	MetricSum   = "sum"
+	MetricAvg   = "avg"
+	MetricMin   = "min"
+	MetricMax   = "max"
+)
+
+// AggregateQuery groups tracker events by field paths and, optionally, time
+// buckets, and computes a metric for each group
+type AggregateQuery struct {
+	GroupBy []*jsonpath.Path
+	// Metric is count, or sum, avg, min or max of the numeric values at MetricPath
+	Metric     string
+	MetricPath *jsonpath.Path
+	// Interval buckets events by the time they were received; zero disables bucketing
+	Interval time.Duration
+}
+
+// ParseAggregateQuery parses comma-separated group_by paths, a metric such as
+// "count" or "sum:data.se_va", and a bucket interval such as "1m"
+func ParseAggregateQuery(groupBy string, metric string, interval string) (AggregateQuery, error) {
+	var query AggregateQuery
+	for _, field := range strings.Split(groupBy, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		path, err := jsonpath.Compile(field)
+		if err != nil {
+			return query, fmt.Errorf("group_by %q: %w", field, err)
+		}
+		query.GroupBy = append(query.GroupBy, path)
+	}
+
+	name, field, hasField := strings.Cut(metric, ":")
+	switch name {
+	case "", MetricCount:
+		query.Metric = MetricCount
+		if hasField {
+			return query, fmt.Errorf("metric count takes no field")
+		}
+	case MetricSum, MetricAvg, MetricMin, MetricMax:
+		query.Metric = name
+		if !hasField || field == "" {
+			return query, fmt.Errorf("metric %s needs a field, e.g. %s:data.se_va", name, name)
+		}
+		path, err := jsonpath.Compile(field)
+		if err != nil {
+			return query, fmt.Errorf("metric field %q: %w", field, err)
+		}
+		query.MetricPath = path
+	default:
+		return query, fmt.Errorf("unknown metric %q, expected count, sum, avg, min or max", name)
+	}
+
+	if interval != "" {
+		duration, err := time.ParseDuration(interval)
+		if err != nil || duration <= 0 {
+			return query, fmt.Errorf("interval %q must be a positive duration, e.g. 1m", interval)
+		}
+		query.Interval = duration
+	}
+
+	if len(query.GroupBy) == 0 && query.Interval == 0 {
+		return query, fmt.Errorf("group_by or interval is required")
+	}
+	return query, nil
+}
+
+// AggregateGroup is the metric of one group
+type AggregateGroup struct {
+	// Bucket is the start of the group's time bucket, if bucketing
+	Bucket *time.Time `json:"bucket,omitempty"`
+	// Key maps each group_by path to the group's value, or null if events lack it
+	Key   map[string]interface{} `json:"key"`
+	Count int                    `json:"count"`
+	// Value is the metric, or nil if no event in the group had a numeric value
+	Value *float64 `json:"value"`
+
+	// sum and numbers accumulate the metric
+	sum     float64
+	numbers int
+}
+
+// Aggregate groups the tracker events in events, one per payload item, and
+// computes the query's metric for each group
+// Paths are evaluated against each event's JSON with "data" replaced by the
+// payload item, so "data.se_ca" is the item's category and "enriched.geo_country"
+// the event's country
+func Aggregate(events []Event, query AggregateQuery) ([]AggregateGroup, int, error) {
+	encoded, err := json.Marshal(events)
+	if err != nil {
+		return nil, 0, err
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, 0, err
+	}
+
+	groups := make(map[string]*AggregateGroup)
+	rows := 0
+	for i, event := range decoded {
+		items, _ := event["data"].([]interface{})
+		for _, item := range items {
+			rows++
+			row := make(map[string]interface{}, len(event))
+			for key, value := range event {
+				row[key] = value
+			}
+			row["data"] = item
+
+			var identity strings.Builder
+			var bucket *time.Time
+			if query.Interval > 0 {
+				start := events[i].ReceivedAt.UTC().Truncate(query.Interval)
+				bucket = &start
+				identity.WriteString(start.Format(time.RFC3339Nano))
+			}
+			key := make(map[string]interface{}, len(query.GroupBy))
+			for _, path := range query.GroupBy {
+				value, _ := path.Eval(row)
+				key[path.String()] = value
+				encodedValue, _ := json.Marshal(value)
+				identity.WriteByte(0)
+				identity.Write(encodedValue)
+			}
+
+			group, exists := groups[identity.String()]
+			if !exists {
+				group = &AggregateGroup{Bucket: bucket, Key: key}
+				groups[identity.String()] = group
+			}
+			group.add(query, row)
+		}
+	}
+
+	result := make([]AggregateGroup, 0, len(groups))
+	for _, group := range groups {
+		group.finish(query.Metric)
+		result = append(result, *group)
+	}
+	sortAggregateGroups(result)
+	return result, rows, nil
+}
+
+// add counts a row into the group
+func (g *AggregateGroup) add(query AggregateQuery, row map[string]interface{}) {
+	g.Count++
+	if query.MetricPath == nil {
+		return
+	}
+	value, _ := query.MetricPath.Eval(row)
+	number, ok := numericValue(value)
+	if !ok {
+		return
+	}
+	switch {
+	case g.numbers == 0:
+		g.sum = number
+		g.Value = &number
+	case query.Metric == MetricMin && number < *g.Value, query.Metric == MetricMax && number > *g.Value:
+		*g.Value = number
+	default:
+		g.sum += number
+	}
+	g.numbers++
+}
+
+// finish computes the group's metric once every row is added
+func (g *AggregateGroup) finish(metric string) {
+	var value float64
+	switch metric {
+	case MetricCount:
+		value = float64(g.Count)
+	case MetricSum:
+		value = g.sum
+	case MetricAvg:
+		if g.numbers == 0 {
+			return
+		}
+		value = g.sum / float64(g.numbers)
+	default:
+		return
+	}
+	g.Value = &value
+}
+
+// numericValue reads a finite number, including the numeric strings tracker
+// parameters are sent as; "NaN" and "Inf" parse as floats but are skipped, as
+// they would poison sums and cannot be encoded as JSON
+func numericValue(value interface{}) (float64, bool) {
+	var number float64
+	switch value := value.(type) {
+	case float64:
+		number = value
+	case string:
+		var err error
+		if number, err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	return number, !math.IsNaN(number) && !math.IsInf(number, 0)
+}
+
+// sortAggregateGroups orders groups by bucket, then by descending metric, then
+// by key so the order is stable
+func sortAggregateGroups(groups []AggregateGroup) {
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if a.Bucket != nil && b.Bucket != nil && !a.Bucket.Equal(*b.Bucket) {
+			return a.Bucket.Before(*b.Bucket)
+		}
+		if (a.Value == nil) != (b.Value == nil) {
+			return a.Value != nil
+		}
+		if a.Value != nil && *a.Value != *b.Value {
+			return *a.Value > *b.Value
+		}
+		aKey, _ := json.Marshal(a.Key)
+		bKey, _ := json.Marshal(b.Key)
+		return string(aKey) < string(bKey)
+	})
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAggregateSkipsNonFiniteValues(t *testing.T) {
+	events := []Event{{Data: []map[string]interface{}{
+		{"e": "se", "se_va": "2.5"},
+		{"e": "se", "se_va": "NaN"},
+		{"e": "se", "se_va": "Inf"},
+		{"e": "se", "se_va": "-Infinity"},
+		{"e": "se", "se_va": "1.5"},
+	}}}
+	for metric, want := range map[string]float64{"sum": 4, "avg": 2, "min": 1.5, "max": 2.5} {
+		query, err := ParseAggregateQuery("data.e", metric+":data.se_va", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		groups, _, err := Aggregate(events, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != 1 || groups[0].Value == nil || *groups[0].Value != want {
+			t.Errorf("%s: got %+v, want %v", metric, groups, want)
+			continue
+		}
+		if _, err := json.Marshal(groups); err != nil {
+			t.Errorf("%s: groups cannot be encoded: %v", metric, err)
+		}
+	}
+}
+
+func TestNumericValueRejectsNonFiniteNumbers(t *testing.T) {
+	for _, value := range []interface{}{"NaN", "nan", "Inf", "+Inf", "-inf", "Infinity", "1e400", "x", nil, true} {
+		if number, ok := numericValue(value); ok {
+			t.Errorf("numericValue(%#v) = %v, want no number", value, number)
+		}
+	}
+	if number, ok := numericValue(" 42 "); !ok || number != 42 {
+		t.Errorf("numericValue(\" 42 \") = %v, %v", number, ok)
+	}
+}
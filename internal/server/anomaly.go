@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"goplow/internal/iglu"
+)
+
+// AnomalySchema is the schema of the events recording volume anomalies, which
+// notifications can select with event_types = ["goplow/anomaly"]
+const AnomalySchema = "goplow/anomaly"
+
+// Anomaly directions
+const (
+	AnomalySpike = "spike"
+	AnomalyDrop  = "drop"
+)
+
+// Anomaly detection defaults
+const (
+	defaultAnomalyThreshold = 3
+	defaultAnomalyMinEvents = 5
+	// anomalyBaselineIntervals is how many past intervals the baseline averages
+	anomalyBaselineIntervals = 10
+	// anomalyWarmupIntervals is how many full intervals an event type must have
+	// been seen for before it is judged
+	anomalyWarmupIntervals = 3
+)
+
+// anomalyDetector counts events per type in the current interval, and keeps the
+// counts of past intervals as each type's baseline
+type anomalyDetector struct {
+	mutex   sync.Mutex
+	current map[string]int
+	history map[string][]int
+	// flagged holds the direction of each type's ongoing anomaly, so an alert
+	// is raised once when it starts rather than every interval
+	flagged map[string]string
+}
+
+// observe counts an event
+func (d *anomalyDetector) observe(event Event) {
+	if strings.HasPrefix(event.Schema, "goplow/") {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.current != nil {
+		d.current[anomalyEventType(event)]++
+	}
+}
+
+// anomalyEventType groups events for anomaly detection: by schema key for
+// self-describing events (e.g. "com.acme/checkout"), else by tracker event type
+func anomalyEventType(event Event) string {
+	if len(event.Data) > 0 {
+		if schema, _, ok := iglu.SelfDescribingEvent(event.Data[0]); ok {
+			return iglu.SchemaKey(schema)
+		}
+	}
+	return eventTypeLabel(event)
+}
+
+// Anomaly is a sudden change in the volume of an event type
+type Anomaly struct {
+	EventType string
+	// Direction is AnomalySpike or AnomalyDrop
+	Direction string
+	// Count is the number of events in the interval, and Baseline the mean of
+	// the intervals before it
+	Count    int
+	Baseline float64
+}
+
+// close ends the current interval, returning the anomalies that started in it
+func (d *anomalyDetector) close(threshold float64, minEvents int) []Anomaly {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Event types that stopped altogether are counted as zero
+	for eventType := range d.history {
+		if _, seen := d.current[eventType]; !seen {
+			d.current[eventType] = 0
+		}
+	}
+
+	var anomalies []Anomaly
+	for eventType, count := range d.current {
+		history := d.history[eventType]
+		direction := ""
+		if len(history) >= anomalyWarmupIntervals {
+			baseline := float64(baselineSum(history)) / float64(len(history))
+			switch {
+			case count >= minEvents && float64(count) >= baseline*threshold:
+				direction = AnomalySpike
+			case baseline >= float64(minEvents) && float64(count) <= baseline/threshold:
+				direction = AnomalyDrop
+			}
+			if direction != "" && d.flagged[eventType] != direction {
+				anomalies = append(anomalies, Anomaly{EventType: eventType, Direction: direction, Count: count, Baseline: baseline})
+			}
+		}
+		if direction == "" {
+			delete(d.flagged, eventType)
+		} else {
+			d.flagged[eventType] = direction
+		}
+
+		history = append(history, count)
+		if len(history) > anomalyBaselineIntervals {
+			history = history[1:]
+		}
+		d.history[eventType] = history
+		// Forget event types that have not been seen for the whole baseline
+		if len(history) == anomalyBaselineIntervals && baselineSum(history) == 0 {
+			delete(d.history, eventType)
+		}
+	}
+	d.current = make(map[string]int)
+
+	sort.Slice(anomalies, func(i, j int) bool { return anomalies[i].EventType < anomalies[j].EventType })
+	return anomalies
+}
+
+// baselineSum adds up the counts of past intervals
+func baselineSum(history []int) int {
+	sum := 0
+	for _, count := range history {
+		sum += count
+	}
+	return sum
+}
+
+// StartAnomalyDetection flags sudden spikes and drops in the volume of each
+// event type every anomaly_interval, until the context is cancelled
+// Each anomaly is added to the timeline as an AnomalySchema event, so it is
+// streamed like other events and sent to matching notifications
+func (s *AppServer) StartAnomalyDetection(ctx context.Context) {
+	interval := parseDurationSetting("anomaly_interval", s.config.AnomalyInterval)
+	if interval == 0 {
+		return
+	}
+
+	s.anomalies.mutex.Lock()
+	s.anomalies.current = make(map[string]int)
+	s.anomalies.history = make(map[string][]int)
+	s.anomalies.flagged = make(map[string]string)
+	s.anomalies.mutex.Unlock()
+
+	log.Printf("Detecting event volume anomalies every %s\n", interval)
+	go func() {
+		ticker := s.clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				for _, anomaly := range s.anomalies.close(s.config.AnomalyThreshold, s.config.AnomalyMinEvents) {
+					s.addAnomaly(anomaly, interval)
+				}
+			}
+		}
+	}()
+}
+
+// addAnomaly logs an anomaly and adds it to the timeline
+func (s *AppServer) addAnomaly(anomaly Anomaly, interval time.Duration) {
+	verb := "dropped"
+	if anomaly.Direction == AnomalySpike {
+		verb = "spiked"
+	}
+	message := fmt.Sprintf("%s events %s to %d in %s, from a baseline of %.1f",
+		anomaly.EventType, verb, anomaly.Count, interval, anomaly.Baseline)
+	log.Printf("Anomaly: %s\n", message)
+
+	s.addEvent(context.Background(), Event{
+		Schema: AnomalySchema,
+		Data: []map[string]interface{}{
+			{
+				"kind":      "Anomaly",
+				"eventType": anomaly.EventType,
+				"direction": anomaly.Direction,
+				"count":     anomaly.Count,
+				"baseline":  anomaly.Baseline,
+				"interval":  interval.String(),
+				"message":   message,
+			},
+		},
+		Timestamp: s.Now(),
+	})
+}
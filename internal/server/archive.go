@@ -0,0 +1,312 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archivesDir is the data directory subdirectory holding capture archives
+const archivesDir = "archives"
+
+// archiveExtension marks capture archives: gzip-compressed JSON Lines, one event per line
+const archiveExtension = ".jsonl.gz"
+
+// archiveTimeFormat names archives by creation time, in UTC
+const archiveTimeFormat = "20060102T150405.000Z"
+
+// ErrArchiveNotFound is returned for archive names that are invalid or do not exist
+var ErrArchiveNotFound = errors.New("archive not found")
+
+// ArchiveInfo describes a capture archive in the data directory
+type ArchiveInfo struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Events    int       `json:"events"`
+	Size      int64     `json:"size"`
+	// Sessions names the capture sessions the archived events were recorded in
+	Sessions []string `json:"sessions,omitempty"`
+}
+
+// ArchiveEvents writes the buffered events to a new compressed archive in the
+// data directory, then removes the archived events from the buffer if clear
+// is set; events are only removed once the archive and manifest are written
+func (s *AppServer) ArchiveEvents(clear bool, actor Actor) (ArchiveInfo, error) {
+	events := s.GetEvents()
+
+	dir, err := s.config.DataPath(archivesDir)
+	if err != nil {
+		return ArchiveInfo{}, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return ArchiveInfo{}, err
+	}
+
+	// Name the archive after the current session too, so it is identifiable later
+	createdAt := s.Now().UTC()
+	name := "capture-" + createdAt.Format(archiveTimeFormat)
+	if session := s.currentSession(); session != nil {
+		if slug := archiveSlug(session.Name); slug != "" {
+			name += "-" + slug
+		}
+	}
+	name += archiveExtension
+	file, err := writeArchive(filepath.Join(dir, name), events)
+	if err != nil {
+		return ArchiveInfo{}, err
+	}
+	manifest := s.BuildManifest(events)
+	manifest.Archive = name
+	manifest.File = file
+	if err := writeManifest(filepath.Join(dir, name), manifest); err != nil {
+		return ArchiveInfo{}, err
+	}
+
+	if clear {
+		ids := make([]int, len(events))
+		for i, event := range events {
+			ids[i] = event.ID
+		}
+		s.removeEvents(ids, "archive")
+	}
+
+	info := ArchiveInfo{Name: name, CreatedAt: createdAt, Events: len(events), Sessions: sessionNames(events)}
+	if stat, err := os.Stat(filepath.Join(dir, name)); err == nil {
+		info.Size = stat.Size()
+	}
+	s.Audit(AuditArchive, actor, map[string]interface{}{"name": name, "events": len(events), "cleared": clear})
+	return info, nil
+}
+
+// archiveFormat is the format of capture archives in their manifests
+const archiveFormat = "ndjson+gzip"
+
+// writeArchive writes events to path through a temporary file, so a failed
+// write never leaves a truncated archive behind, and returns its description
+// for the manifest
+func writeArchive(path string, events []Event) (*ManifestFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), ".archive-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(file, hash)}
+	gz := gzip.NewWriter(counter)
+	encoder := json.NewEncoder(gz)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return nil, err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return nil, err
+	}
+	return &ManifestFile{Name: filepath.Base(path), Format: archiveFormat, Bytes: counter.n, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ListArchives returns the capture archives in the data directory, newest first
+func (s *AppServer) ListArchives() ([]ArchiveInfo, error) {
+	archives := make([]ArchiveInfo, 0)
+	dir := filepath.Join(s.config.DataDir, archivesDir)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return archives, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), archiveExtension) {
+			continue
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		count, sessions, err := archiveContents(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		// Archives are named by creation time; fall back to the file time for renamed files
+		stamp := strings.TrimPrefix(entry.Name(), "capture-")
+		if len(stamp) > len(archiveTimeFormat) {
+			stamp = stamp[:len(archiveTimeFormat)]
+		}
+		createdAt, err := time.Parse(archiveTimeFormat, stamp)
+		if err != nil {
+			createdAt = stat.ModTime().UTC()
+		}
+		archives = append(archives, ArchiveInfo{
+			Name:      entry.Name(),
+			CreatedAt: createdAt,
+			Events:    count,
+			Size:      stat.Size(),
+			Sessions:  sessions,
+		})
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Name > archives[j].Name })
+	return archives, nil
+}
+
+// archiveContents returns the number of events in an archive and the sessions
+// they were recorded in, from its manifest; only archives written before
+// manifests are decompressed
+func archiveContents(path string) (int, []string, error) {
+	manifest, err := readManifestFile(path)
+	if err == nil {
+		return manifest.Events, manifest.Sessions, nil
+	}
+	events, err := readArchive(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	return len(events), sessionNames(events), nil
+}
+
+// ArchivePath returns the path of the named archive, or ErrArchiveNotFound
+func (s *AppServer) ArchivePath(name string) (string, error) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, archiveExtension) {
+		return "", ErrArchiveNotFound
+	}
+	path := filepath.Join(s.config.DataDir, archivesDir, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", ErrArchiveNotFound
+	} else if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ReadArchive returns the events in an archive without loading it
+func (s *AppServer) ReadArchive(name string) ([]Event, error) {
+	path, err := s.ArchivePath(name)
+	if err != nil {
+		return nil, err
+	}
+	return readArchive(path)
+}
+
+// LoadArchive replaces the buffered events with those of the named archive,
+// keeping the latest max_messages, and replays them to SSE clients
+// The loaded events get new IDs, after those of the events they replace
+func (s *AppServer) LoadArchive(name string, actor Actor) (int, error) {
+	events, err := s.ReadArchive(name)
+	if err != nil {
+		return 0, err
+	}
+	if len(events) > s.config.MaxMsgs {
+		events = events[len(events)-s.config.MaxMsgs:]
+	}
+
+	// The clear and the load happen under one lock, so no event arriving in
+	// between is numbered before the loaded ones
+	s.mutex.Lock()
+	cleared := s.drainEventsLocked("archive_load")
+	// Loaded events are numbered after every ID given out before, so the
+	// buffer, the store and cursors stay in ID order
+	for i := range events {
+		s.eventID++
+		events[i].ID = s.eventID
+	}
+	s.events = append(s.events, events...)
+	for _, event := range events {
+		s.storeAppend(event)
+		s.queueEvent(event)
+	}
+	s.mutex.Unlock()
+
+	log.Printf("Cleared %d events (archive_load)\n", len(cleared))
+	s.Audit(AuditArchiveLoad, actor, map[string]interface{}{"name": name, "events": len(events)})
+	return len(events), nil
+}
+
+// archiveSlug reduces a session name to lowercase letters, digits and hyphens for a file name
+func archiveSlug(name string) string {
+	var slug strings.Builder
+	hyphen := false
+	for _, c := range strings.ToLower(name) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' {
+			slug.WriteRune(c)
+			hyphen = false
+		} else if !hyphen && slug.Len() > 0 {
+			slug.WriteByte('-')
+			hyphen = true
+		}
+		if slug.Len() >= 40 {
+			break
+		}
+	}
+	return strings.Trim(slug.String(), "-.")
+}
+
+// sessionNames lists the distinct session names of events, in order of first appearance
+func sessionNames(events []Event) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, event := range events {
+		if event.Session != nil && !seen[event.Session.Name] {
+			seen[event.Session.Name] = true
+			names = append(names, event.Session.Name)
+		}
+	}
+	return names
+}
+
+// readArchive decodes every event in an archive file
+func readArchive(path string) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	events := make([]Event, 0)
+	decoder := json.NewDecoder(bufio.NewReader(gz))
+	for {
+		var event Event
+		if err := decoder.Decode(&event); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestServer returns a server with the default configuration, its data
+// directory in a temporary directory
+func newTestServer(t *testing.T) *AppServer {
+	t.Helper()
+	config := defaultConfig()
+	config.DataDir = t.TempDir()
+	return New(config)
+}
+
+func TestArchiveEventsClearsOnlyAfterWriting(t *testing.T) {
+	s := newTestServer(t)
+	s.AddEvent("test", []map[string]interface{}{{"e": "pv"}})
+	s.AddEvent("test", []map[string]interface{}{{"e": "pp"}})
+
+	info, err := s.ArchiveEvents(true, SystemActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Events != 2 {
+		t.Errorf("archived %d events, want 2", info.Events)
+	}
+	if events := s.GetEvents(); len(events) != 0 {
+		t.Errorf("%d events left in the buffer, want 0", len(events))
+	}
+	archived, err := s.ReadArchive(info.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 2 {
+		t.Errorf("read %d archived events, want 2", len(archived))
+	}
+}
+
+func TestArchiveEventsKeepsEventsWhenWriteFails(t *testing.T) {
+	s := newTestServer(t)
+	// A file where the archives directory should be makes the write fail
+	if err := os.WriteFile(filepath.Join(s.config.DataDir, archivesDir), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s.AddEvent("test", []map[string]interface{}{{"e": "pv"}})
+
+	if _, err := s.ArchiveEvents(true, SystemActor); err == nil {
+		t.Fatal("expected an error archiving into a file")
+	}
+	if events := s.GetEvents(); len(events) != 1 {
+		t.Errorf("%d events left in the buffer, want 1", len(events))
+	}
+}
+
+func TestRemoveEventsKeepsLaterEvents(t *testing.T) {
+	s := newTestServer(t)
+	s.AddEvent("test", []map[string]interface{}{{"e": "pv"}})
+	snapshot := s.GetEvents()
+	s.AddEvent("test", []map[string]interface{}{{"e": "pp"}})
+
+	if removed := s.removeEvents([]int{snapshot[0].ID}, "archive"); removed != 1 {
+		t.Errorf("removed %d events, want 1", removed)
+	}
+	events := s.GetEvents()
+	if len(events) != 1 || events[0].ID != snapshot[0].ID+1 {
+		t.Errorf("unexpected events left: %+v", events)
+	}
+}
+
+func TestLoadArchiveNumbersEventsAfterTheBuffer(t *testing.T) {
+	s := newTestServer(t)
+	store := &sliceStore{}
+	if err := s.SetEventStore(store); err != nil {
+		t.Fatal(err)
+	}
+	s.AddEvent("test", []map[string]interface{}{{"e": "pv"}})
+	s.AddEvent("test", []map[string]interface{}{{"e": "pp"}})
+	info, err := s.ArchiveEvents(false, SystemActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddEvent("test", []map[string]interface{}{{"e": "se"}})
+
+	if _, err := s.LoadArchive(info.Name, SystemActor); err != nil {
+		t.Fatal(err)
+	}
+	s.AddEvent("test", []map[string]interface{}{{"e": "ue"}})
+	s.storeWrites.wait()
+
+	// IDs never go backwards, so the store's scans and cursors see them in order
+	var ids []int
+	for _, event := range s.GetEvents() {
+		ids = append(ids, event.ID)
+	}
+	if want := []int{4, 5, 6}; fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("buffered IDs %v, want %v", ids, want)
+	}
+	var stored []int
+	for _, event := range store.events {
+		stored = append(stored, event.ID)
+	}
+	if fmt.Sprint(stored) != fmt.Sprint(ids) {
+		t.Errorf("stored IDs %v, want %v", stored, ids)
+	}
+}
+
+func TestListArchivesReadsTheManifest(t *testing.T) {
+	s := newTestServer(t)
+	s.AddEvent("test", []map[string]interface{}{{"e": "pv"}})
+	info, err := s.ArchiveEvents(false, SystemActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(s.config.DataDir, archivesDir, info.Name)
+	manifest, err := s.ReadArchiveManifest(info.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Events = 42
+	if err := writeManifest(path, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	archives, err := s.ListArchives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 1 || archives[0].Events != 42 {
+		t.Errorf("listed %+v, want the manifest's count", archives)
+	}
+
+	// Archives written before manifests are counted by reading them
+	if err := os.Remove(manifestPath(path)); err != nil {
+		t.Fatal(err)
+	}
+	if archives, err = s.ListArchives(); err != nil || len(archives) != 1 || archives[0].Events != 1 {
+		t.Errorf("listed %+v (%v), want the archive's count", archives, err)
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Audited admin actions
+const (
+	AuditStart        = "start"
+	AuditConfigChange = "config_change"
+	AuditClear        = "clear"
+	AuditMarker       = "marker"
+	AuditArchive      = "archive"
+	AuditArchiveLoad  = "archive_load"
+	AuditSessionStart = "session_start"
+	AuditSessionStop  = "session_stop"
+	AuditRedeliver    = "redeliver"
+	AuditPreferences  = "preferences"
+	AuditFunnel       = "funnel"
+)
+
+// Actor identifies who performed an audited action
+type Actor struct {
+	// User is the authenticated user reported by a trusted proxy, if any
+	User      string `json:"user,omitempty"`
+	Address   string `json:"address,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// SystemActor performs goplow's own automatic actions, such as scheduled clears
+var SystemActor = Actor{User: "goplow"}
+
+// AuditEntry is one line of the audit log
+type AuditEntry struct {
+	Time    time.Time              `json:"time"`
+	Action  string                 `json:"action"`
+	Actor   Actor                  `json:"actor"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// auditLog appends entries to a JSON Lines file
+type auditLog struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// EnableAuditLog records admin actions to the JSON Lines file at path, and
+// records the server start along with any config changes since the last start
+func (s *AppServer) EnableAuditLog(path string) {
+	s.audit = &auditLog{path: path}
+
+	settings := make(map[string]interface{})
+	for _, setting := range s.GetConfigSettings() {
+		settings[setting.Key] = setting.Value
+	}
+	// Round-trip through JSON so values compare like those read back from the log
+	settings = normalizeJSON(settings)
+
+	if previous := s.lastAuditEntry(AuditStart); previous != nil {
+		if before, ok := previous.Details["settings"].(map[string]interface{}); ok {
+			if changed := changedSettings(before, settings); len(changed) > 0 {
+				s.Audit(AuditConfigChange, SystemActor, map[string]interface{}{"changed": changed})
+			}
+		}
+	}
+	s.Audit(AuditStart, SystemActor, map[string]interface{}{"settings": settings})
+}
+
+// Audit records an admin action, if the audit log is enabled
+func (s *AppServer) Audit(action string, actor Actor, details map[string]interface{}) {
+	if s.audit == nil {
+		return
+	}
+	entry := AuditEntry{Time: s.Now(), Action: action, Actor: actor, Details: details}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error encoding audit entry: %v\n", err)
+		return
+	}
+
+	s.audit.mutex.Lock()
+	defer s.audit.mutex.Unlock()
+
+	file, err := os.OpenFile(s.audit.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Printf("Error opening audit log: %v\n", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		log.Printf("Error writing audit log: %v\n", err)
+	}
+}
+
+// GetAuditEntries returns the latest limit audit entries, oldest first
+func (s *AppServer) GetAuditEntries(limit int) ([]AuditEntry, error) {
+	entries := make([]AuditEntry, 0)
+	if s.audit == nil {
+		return entries, nil
+	}
+
+	s.audit.mutex.Lock()
+	defer s.audit.mutex.Unlock()
+
+	file, err := os.Open(s.audit.path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+		if limit > 0 && len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// lastAuditEntry returns the most recent entry for action, or nil
+func (s *AppServer) lastAuditEntry(action string) *AuditEntry {
+	entries, err := s.GetAuditEntries(0)
+	if err != nil {
+		return nil
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Action == action {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// changedSettings lists the settings whose values differ, as {"from", "to"} pairs
+func changedSettings(before map[string]interface{}, after map[string]interface{}) map[string]interface{} {
+	changed := make(map[string]interface{})
+	for key, value := range after {
+		if previous, exists := before[key]; !exists || !reflect.DeepEqual(previous, value) {
+			changed[key] = map[string]interface{}{"from": before[key], "to": value}
+		}
+	}
+	return changed
+}
+
+// normalizeJSON converts values to their generic JSON form (float64 numbers,
+// []interface{} lists), so they compare equal to decoded JSON
+func normalizeJSON(value map[string]interface{}) map[string]interface{} {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(encoded, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
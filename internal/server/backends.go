@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"goplow/pkg/backend"
+)
+
+// EventSink is a Sink that is sent every new event and delivers it from Run
+type EventSink = backend.EventSink
+
+// SinkFactory builds the sinks of one kind from the server's configuration,
+// returning none when that kind is not configured
+type SinkFactory func(appServer *AppServer) ([]EventSink, error)
+
+// Backend adapts the factory to the backend registry, which opens sinks for
+// the server running goplow
+func (f SinkFactory) Backend() backend.SinkFactory {
+	return func(host backend.Host) ([]backend.EventSink, error) {
+		appServer, ok := host.(*AppServer)
+		if !ok {
+			return nil, fmt.Errorf("opened for %T, not a goplow server", host)
+		}
+		return f(appServer)
+	}
+}
+
+func init() {
+	backend.RegisterStore(StoreFile, openFileStoreFor)
+}
+
+// StoreNames returns the names the store setting accepts, sorted
+func StoreNames() []string {
+	names := append(backend.StoreNames(), StoreMemory)
+	sort.Strings(names)
+	return names
+}
+
+// hasStore reports whether name is a registered store or "memory"
+func hasStore(name string) bool {
+	_, found := backend.LookupStore(name)
+	return found || name == StoreMemory
+}
+
+// DataPath returns the path of a file in the data directory, creating the
+// directory if it does not exist
+func (s *AppServer) DataPath(name string) (string, error) {
+	return s.config.DataPath(name)
+}
+
+// openFileStoreFor opens the file store's log in the data directory
+func openFileStoreFor(host backend.Host) (EventStore, error) {
+	path, err := host.DataPath("events.log")
+	if err != nil {
+		return nil, err
+	}
+	return OpenFileStore(path)
+}
+
+// OpenConfiguredStore opens the store named by the store setting and restores
+// the buffer from it
+// It returns nil for the in-memory buffer, which has no store to close
+func (s *AppServer) OpenConfiguredStore() (EventStore, error) {
+	name := s.config.Store
+	if name == "" || name == StoreMemory {
+		return nil, nil
+	}
+
+	factory, found := backend.LookupStore(name)
+	if !found {
+		return nil, fmt.Errorf("no event store named %q", name)
+	}
+
+	store, err := factory(s)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s store: %w", name, err)
+	}
+	if err := s.SetEventStore(store); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("restoring events from the %s store: %w", name, err)
+	}
+	log.Printf("Persisting events to the %s store (%d restored)\n", name, len(s.GetEvents()))
+	return store, nil
+}
+
+// OpenSinks builds the sinks of every registered kind and adds them to the
+// server; they deliver nothing until RunSinks is called
+func (s *AppServer) OpenSinks() error {
+	kinds, factories := backend.SinkFactories()
+	for i, factory := range factories {
+		sinks, err := factory(s)
+		if err != nil {
+			return fmt.Errorf("configuring %s: %w", kinds[i], err)
+		}
+		for _, sink := range sinks {
+			s.AddEventSink(sink)
+		}
+	}
+	return nil
+}
+
+// AddEventSink registers a sink and sends it every new event
+func (s *AppServer) AddEventSink(sink EventSink) {
+	s.AddSink(sink)
+	s.AddEventListener(func(_ context.Context, event Event) {
+		sink.Send(event)
+	})
+}
+
+// eventSinks returns the registered sinks that are sent events
+func (s *AppServer) eventSinks() []EventSink {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var sinks []EventSink
+	for _, sink := range s.sinks {
+		if eventSink, ok := sink.(EventSink); ok {
+			sinks = append(sinks, eventSink)
+		}
+	}
+	return sinks
+}
+
+// RunSinks starts delivery for every event sink until the context is cancelled
+func (s *AppServer) RunSinks(ctx context.Context) {
+	for _, sink := range s.eventSinks() {
+		go sink.Run(ctx)
+	}
+}
+
+// CloseSinks delivers the events still queued for each event sink until the
+// context is done, logging the sinks that could not drain
+func (s *AppServer) CloseSinks(ctx context.Context) {
+	for _, sink := range s.eventSinks() {
+		if err := sink.Close(ctx); err != nil {
+			log.Printf("Sink %s queue not drained: %v\n", sink.Name(), err)
+		}
+	}
+}
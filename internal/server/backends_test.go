@@ -0,0 +1,116 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"goplow/pkg/backend"
+)
+
+// sliceStore is an EventStore holding events in a slice, as an embedder's
+// store would be plugged in
+type sliceStore struct {
+	events []Event
+}
+
+func (s *sliceStore) Append(event Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *sliceStore) ScanByID(from int, to int) ([]Event, error) {
+	var events []Event
+	for _, event := range s.events {
+		if event.ID >= from && event.ID <= to {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *sliceStore) ScanByTime(from time.Time, to time.Time) ([]Event, error) {
+	var events []Event
+	for _, event := range s.events {
+		if !event.ReceivedAt.Before(from) && event.ReceivedAt.Before(to) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *sliceStore) DeleteBefore(id int) error {
+	kept := s.events[:0]
+	for _, event := range s.events {
+		if event.ID >= id {
+			kept = append(kept, event)
+		}
+	}
+	s.events = kept
+	return nil
+}
+
+func (s *sliceStore) Delete(ids []int) error {
+	remove := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+	kept := s.events[:0]
+	for _, event := range s.events {
+		if !remove[event.ID] {
+			kept = append(kept, event)
+		}
+	}
+	s.events = kept
+	return nil
+}
+
+func (s *sliceStore) LastID() int {
+	if len(s.events) == 0 {
+		return 0
+	}
+	return s.events[len(s.events)-1].ID
+}
+
+func (s *sliceStore) Close() error { return nil }
+
+func TestRegisteredStoreIsOpenedForTheServer(t *testing.T) {
+	store := &sliceStore{events: []Event{{ID: 7, Schema: "restored"}}}
+	var host backend.Host
+	backend.RegisterStore("slice", func(h backend.Host) (backend.EventStore, error) {
+		host = h
+		return store, nil
+	})
+	if !hasStore("slice") || !hasStore(StoreFile) || !hasStore(StoreMemory) {
+		t.Fatalf("store names %v miss slice, file or memory", StoreNames())
+	}
+
+	s := newTestServer(t)
+	s.config.Store = "slice"
+	if _, err := s.OpenConfiguredStore(); err != nil {
+		t.Fatal(err)
+	}
+	if host != s {
+		t.Errorf("store opened for %v, want the server", host)
+	}
+	s.AddEvent("test", []map[string]interface{}{{"e": "pv"}})
+	s.storeWrites.wait()
+	if len(store.events) != 2 || store.events[1].ID != 8 {
+		t.Errorf("unexpected stored events: %+v", store.events)
+	}
+}
+
+func TestServerSinkFactoryNeedsTheServer(t *testing.T) {
+	called := false
+	factory := SinkFactory(func(*AppServer) ([]EventSink, error) {
+		called = true
+		return nil, nil
+	}).Backend()
+
+	if _, err := factory(newTestServer(t)); err != nil || !called {
+		t.Errorf("factory for the server: called %v, %v", called, err)
+	}
+	called = false
+	if _, err := factory(nil); err == nil || called {
+		t.Errorf("factory for another host: called %v, %v", called, err)
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"time"
+)
+
+// BadEvent is an ingest request, or an item of one, that was rejected
+// Like the Snowplow bad rows stream, it keeps enough of the payload and the
+// failure to debug why the event never reached the good buffer
+type BadEvent struct {
+	ID         int       `json:"id"`
+	ReceivedAt time.Time `json:"receivedAt"`
+	Namespace  string    `json:"namespace,omitempty"`
+	// Code and Detail match the problem response returned to the sender
+	Code   string                   `json:"code"`
+	Detail string                   `json:"detail"`
+	Schema string                   `json:"schema,omitempty"`
+	Data   []map[string]interface{} `json:"data,omitempty"`
+	// Violations lists schema violations for events rejected by validation
+	Violations []Violation `json:"violations,omitempty"`
+	// Error is the parser error for payloads that could not be decoded
+	Error string `json:"error,omitempty"`
+	// ContentType and Body capture the start of a request body that could not be parsed
+	ContentType   string `json:"contentType,omitempty"`
+	Body          string `json:"body,omitempty"`
+	BodyTruncated bool   `json:"bodyTruncated,omitempty"`
+}
+
+// AddBadEvent records a rejected event, keeping at most MaxMsgs, and notifies
+// SSE clients with a named "bad" message
+func (s *AppServer) AddBadEvent(bad BadEvent) BadEvent {
+	s.mutex.Lock()
+	s.badEventID++
+	bad.ID = s.badEventID
+	bad.ReceivedAt = s.Now()
+	s.badEvents = append(s.badEvents, bad)
+	if len(s.badEvents) > s.config.MaxMsgs {
+		s.badEvents = s.badEvents[1:]
+	}
+	s.queueControl("bad", bad)
+	s.mutex.Unlock()
+
+	return bad
+}
+
+// GetBadEvents returns the buffered rejected events
+func (s *AppServer) GetBadEvents() []BadEvent {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	bad := make([]BadEvent, len(s.badEvents))
+	copy(bad, s.badEvents)
+	return bad
+}
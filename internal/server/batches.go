@@ -0,0 +1,103 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"goplow/pkg/backend"
+)
+
+// BatchPosition places an event in the tracker batch it was flushed in
+type BatchPosition = backend.BatchPosition
+
+// NewBatchID returns a random ID for a batch of events
+// IDs are random rather than sequential so they stay unique across restarts
+// and across instances pushing to an aggregator
+func NewBatchID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Batch is a tracker batch reassembled from its buffered events
+type Batch struct {
+	ID        string `json:"id"`
+	Size      int    `json:"size"`
+	Schema    string `json:"schema"`
+	Namespace string `json:"namespace,omitempty"`
+	// Timestamp is when the batch was received, shared by its events
+	Timestamp time.Time `json:"timestamp"`
+	// Missing lists the indexes of items that are not buffered, because they
+	// were rejected, suppressed or have since been evicted
+	Missing []int `json:"missing,omitempty"`
+	// Events are the buffered events of the batch in index order
+	Events []Event `json:"events"`
+}
+
+// GetBatch reassembles a tracker batch from the buffered events
+// The second return value is false if none of its events are buffered
+func (s *AppServer) GetBatch(id string) (Batch, bool) {
+	batch := Batch{ID: id, Events: make([]Event, 0)}
+	for _, event := range s.GetEvents() {
+		if event.Batch == nil || event.Batch.ID != id {
+			continue
+		}
+		if len(batch.Events) == 0 {
+			batch.Schema = event.Schema
+			batch.Namespace = event.Namespace
+			batch.Timestamp = event.Timestamp
+		}
+		// Events pushed before the batch was complete have no size; without any
+		// that do, the batch is assumed to end at its last buffered item
+		if event.Batch.Size > batch.Size {
+			batch.Size = event.Batch.Size
+		}
+		if event.Batch.Index >= batch.Size && event.Batch.Size == 0 {
+			batch.Size = event.Batch.Index + 1
+		}
+		batch.Events = append(batch.Events, event)
+	}
+	if len(batch.Events) == 0 {
+		return batch, false
+	}
+
+	// Events of a batch may interleave with others, but keep their order
+	sort.SliceStable(batch.Events, func(i, j int) bool {
+		return batch.Events[i].Batch.Index < batch.Events[j].Batch.Index
+	})
+	next := 0
+	for _, event := range batch.Events {
+		for ; next < event.Batch.Index; next++ {
+			batch.Missing = append(batch.Missing, next)
+		}
+		next = event.Batch.Index + 1
+	}
+	for ; next < batch.Size; next++ {
+		batch.Missing = append(batch.Missing, next)
+	}
+	return batch, true
+}
+
+// CompleteBatch records the size of a batch whose items have all been read on
+// its buffered events
+func (s *AppServer) CompleteBatch(id string, size int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// The batch's events are among the latest
+	found := 0
+	for i := len(s.events) - 1; i >= 0 && found < size; i-- {
+		event := s.events[i]
+		if event.Batch == nil || event.Batch.ID != id {
+			continue
+		}
+		found++
+		// Copies of the event may be being read, so the position is replaced
+		// rather than updated
+		position := *event.Batch
+		position.Size = size
+		s.events[i].Batch = &position
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+// broadcastQueue runs SSE broadcasts one at a time in the order they were
+// queued, so clients see events and control messages in the order the buffer
+// changed, whatever order goroutines are scheduled in
+// Broadcasts are queued while the buffer's lock is held, and a single worker
+// runs them without it; the worker exits when the queue is empty and is
+// started again by the next push
+type broadcastQueue struct {
+	mutex   sync.Mutex
+	pending []broadcast
+	running bool
+	// failed is called with a broadcast's panic and stack trace, and whether
+	// to record it, once the queue has recovered from it
+	failed func(recovered interface{}, stack string, record bool)
+}
+
+// broadcast is a queued SSE message
+type broadcast struct {
+	send func()
+	// internalError is set for the broadcast of a goplow error event, whose
+	// failure is only logged, so a panic on every broadcast cannot loop
+	internalError bool
+}
+
+// push queues a broadcast without waiting for it
+func (q *broadcastQueue) push(b broadcast) {
+	q.mutex.Lock()
+	q.pending = append(q.pending, b)
+	start := !q.running
+	q.running = true
+	q.mutex.Unlock()
+
+	if start {
+		go q.run()
+	}
+}
+
+// run broadcasts the queued messages until none are left
+func (q *broadcastQueue) run() {
+	for {
+		q.mutex.Lock()
+		pending := q.pending
+		q.pending = nil
+		if len(pending) == 0 {
+			q.running = false
+			q.mutex.Unlock()
+			return
+		}
+		q.mutex.Unlock()
+
+		for _, b := range pending {
+			q.run1(b)
+		}
+	}
+}
+
+// run1 runs one broadcast, recovering from a panic in it so the worker goes
+// on with the broadcasts queued after it
+func (q *broadcastQueue) run1(b broadcast) {
+	defer func() {
+		if recovered := recover(); recovered != nil && q.failed != nil {
+			q.failed(recovered, string(debug.Stack()), !b.internalError)
+		}
+	}()
+	b.send()
+}
+
+// queueEvent queues the broadcast of a new event
+// Callers hold s.mutex, so events are broadcast in ID order
+func (s *AppServer) queueEvent(event Event) {
+	s.broadcasts.push(broadcast{
+		send:          func() { s.broadcastNewEvent(event) },
+		internalError: event.Schema == InternalErrorSchema,
+	})
+}
+
+// queueControl queues the broadcast of a control message, in order with events
+func (s *AppServer) queueControl(name string, payload interface{}) {
+	s.broadcasts.push(broadcast{send: func() { s.broadcastControl(name, payload) }})
+}
@@ -0,0 +1,27 @@
+package server
+
+// FilterEventsByClassification returns the events labelled by the given
+// classification rule
+func FilterEventsByClassification(events []Event, label string) []Event {
+	filtered := make([]Event, 0)
+	for _, event := range events {
+		for _, classification := range event.Classification {
+			if classification == label {
+				filtered = append(filtered, event)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// classificationCounts counts the events with each classification label
+func classificationCounts(events []Event) map[string]int {
+	counts := make(map[string]int)
+	for _, event := range events {
+		for _, label := range event.Classification {
+			counts[label]++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells the server the time: when events are received, when entries
+// are audited, and when scheduled clears and anomaly checks run
+// Tests and embedders can supply their own to control time; connection
+// deadlines and timeouts of SSE streams always use the system clock
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals, as time.Ticker does
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the Clock of the time package
+type SystemClock struct{}
+
+// Now returns the current local time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTicker returns a time.Ticker
+func (SystemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+// systemTicker adapts time.Ticker to the Ticker interface
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+// C returns the channel the ticks are delivered on
+func (t systemTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+// Stop turns off the ticker
+func (t systemTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// SetClock replaces the server's clock; call it before events are added and
+// background jobs are started
+func (s *AppServer) SetClock(clock Clock) {
+	s.clock = clock
+}
+
+// Now returns the current time by the server's clock
+func (s *AppServer) Now() time.Time {
+	return s.clock.Now()
+}
+
+// clientSequence numbers SSE and stream clients
+var clientSequence atomic.Int64
+
+// NewClientID returns a unique ID for an SSE or stream client, named after
+// the time it connected by the server's clock and a sequence number, so IDs
+// stay unique when the clock stands still
+func (s *AppServer) NewClientID(prefix string) string {
+	return fmt.Sprintf("%s_%d_%d", prefix, s.Now().UnixNano(), clientSequence.Add(1))
+}
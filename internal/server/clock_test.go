@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when advanced, delivering the ticks
+// that fall due on the way
+type fakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// newFakeClock returns a fake clock standing at 12:00 UTC on 20 October 2025
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ticker := &fakeTicker{interval: d, next: c.now.Add(d), c: make(chan time.Time), stopped: make(chan struct{})}
+	c.tickers = append(c.tickers, ticker)
+	return ticker
+}
+
+// Advance moves the clock forward by d, one due tick at a time, handing each
+// tick to the goroutine reading its ticker before moving on
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	end := c.now.Add(d)
+	c.mutex.Unlock()
+	for {
+		c.mutex.Lock()
+		var due *fakeTicker
+		for _, ticker := range c.tickers {
+			if !ticker.next.After(end) && (due == nil || ticker.next.Before(due.next)) {
+				due = ticker
+			}
+		}
+		if due == nil {
+			c.now = end
+			c.mutex.Unlock()
+			return
+		}
+		c.now = due.next
+		due.next = due.next.Add(due.interval)
+		tick := c.now
+		c.mutex.Unlock()
+
+		select {
+		case due.c <- tick:
+		case <-due.stopped:
+		}
+	}
+}
+
+// waitForTickers waits until n tickers have been started, as background jobs
+// start theirs in their own goroutines
+func (c *fakeClock) waitForTickers(t *testing.T, n int) {
+	t.Helper()
+	waitFor(t, func() bool {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		return len(c.tickers) >= n
+	})
+}
+
+// fakeTicker is a Ticker of a fakeClock
+type fakeTicker struct {
+	interval time.Duration
+	next     time.Time
+	c        chan time.Time
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.stopOnce.Do(func() { close(t.stopped) })
+}
+
+// waitFor waits up to a second for condition to hold
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newFakeClockServer returns a server on a fake clock, with config changed by configure
+func newFakeClockServer(t *testing.T, configure func(*EnvironmentConfig)) (*AppServer, *fakeClock) {
+	t.Helper()
+	config := defaultConfig()
+	config.DataDir = t.TempDir()
+	configure(&config)
+	s := New(config)
+	clock := newFakeClock()
+	s.SetClock(clock)
+	return s, clock
+}
+
+func TestEventsAreReceivedByTheServerClock(t *testing.T) {
+	s, clock := newFakeClockServer(t, func(*EnvironmentConfig) {})
+	s.AddEvent("test", []map[string]interface{}{{"e": "pv"}})
+	if received := s.GetEvents()[0].ReceivedAt; !received.Equal(clock.Now()) {
+		t.Errorf("received at %s, want %s", received, clock.Now())
+	}
+}
+
+func TestIdleClearFollowsTheClock(t *testing.T) {
+	s, clock := newFakeClockServer(t, func(config *EnvironmentConfig) {
+		config.ClearAfterIdle = "1m"
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.StartAutoClear(ctx)
+	clock.waitForTickers(t, 1)
+
+	s.AddEvent("test", []map[string]interface{}{{"e": "pv"}})
+	clock.Advance(50 * time.Second)
+	if events := s.GetEvents(); len(events) != 1 {
+		t.Fatalf("%d events left before the idle timeout, want 1", len(events))
+	}
+
+	clock.Advance(10 * time.Second)
+	waitFor(t, func() bool { return len(s.GetEvents()) == 0 })
+}
+
+func TestAnomalyDetectionTicksWithTheClock(t *testing.T) {
+	s, clock := newFakeClockServer(t, func(config *EnvironmentConfig) {
+		config.AnomalyInterval = "1m"
+		config.AnomalyThreshold = 3
+		config.AnomalyMinEvents = 5
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.StartAnomalyDetection(ctx)
+	clock.waitForTickers(t, 1)
+
+	intervals := func() int {
+		s.anomalies.mutex.Lock()
+		defer s.anomalies.mutex.Unlock()
+		return len(s.anomalies.history["pv"])
+	}
+	addPageViews := func(n int) {
+		for i := 0; i < n; i++ {
+			s.AddEvent("test", []map[string]interface{}{{"e": "pv"}})
+		}
+	}
+
+	// A baseline of 5 page views a minute, then a spike of 30
+	for interval := 1; interval <= anomalyWarmupIntervals; interval++ {
+		addPageViews(5)
+		clock.Advance(time.Minute)
+		waitFor(t, func() bool { return intervals() == interval })
+	}
+	addPageViews(30)
+	clock.Advance(time.Minute)
+	waitFor(t, func() bool { return intervals() == anomalyWarmupIntervals+1 })
+
+	var anomalies []Event
+	for _, event := range s.GetEvents() {
+		if event.Schema == AnomalySchema {
+			anomalies = append(anomalies, event)
+		}
+	}
+	if len(anomalies) != 1 {
+		t.Fatalf("flagged %d anomalies, want 1", len(anomalies))
+	}
+	if direction := anomalies[0].Data[0]["direction"]; direction != AnomalySpike {
+		t.Errorf("flagged a %v, want a spike", direction)
+	}
+	if !anomalies[0].Timestamp.Equal(clock.Now()) {
+		t.Errorf("anomaly at %s, want the tick at %s", anomalies[0].Timestamp, clock.Now())
+	}
+}
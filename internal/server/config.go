@@ -0,0 +1,619 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configExtensions lists the supported config file formats, in lookup order
+var configExtensions = []string{".toml", ".yaml", ".yml", ".json"}
+
+// Config represents the application configuration
+type Config struct {
+	Default      EnvironmentConfig            `toml:"default"`
+	Environments map[string]EnvironmentConfig `toml:"-"`
+}
+
+// EnvironmentConfig represents environment-specific configuration
+// All fields are flattened (no sub-sections)
+type EnvironmentConfig struct {
+	// Extends names the environment this one inherits from (default if empty)
+	Extends        string `toml:"extends,omitempty"`
+	Port           int    `toml:"port"`
+	Host           string `toml:"host"`
+	MaxMsgs        int    `toml:"max_messages"`
+	EventsEndpoint string `toml:"events_endpoint"`
+	AllowedOrigins string `toml:"allowed_origins"`
+	// CORSMaxAge is how long browsers may cache preflight responses (default "10m")
+	CORSMaxAge string `toml:"cors_max_age"`
+	// CORSAllowHeaders lists the request headers CORS preflights allow, on top
+	// of Content-Type, Authorization, traceparent and the run ID header; if
+	// empty, preflights allow whatever headers they ask for
+	CORSAllowHeaders []string `toml:"cors_allow_headers"`
+	// CORSExposeHeaders lists the response headers browser scripts may read
+	// (default ["ETag"])
+	CORSExposeHeaders []string `toml:"cors_expose_headers"`
+	// RunIDHeader is the ingest request header whose value is recorded as the
+	// event's run ID, so parallel test runs can tell their events apart
+	RunIDHeader string `toml:"run_id_header"`
+	// AggregatorURL is the base URL of a goplow aggregator to push events to
+	AggregatorURL string `toml:"aggregator_url"`
+	// SourceLabel identifies this instance's events on an aggregator
+	SourceLabel string `toml:"source_label"`
+	// SinkMaxAttempts is how many times an event is sent to a sink, such as the
+	// aggregator, before it is dropped (default 5)
+	SinkMaxAttempts int `toml:"sink_max_attempts"`
+	// SinkRetryBackoff is the delay before an event's second attempt, doubled for
+	// each one after up to a minute (default "1s")
+	SinkRetryBackoff string `toml:"sink_retry_backoff"`
+	// SinkSpill writes events to a file in the data directory when a sink's
+	// queue is full, instead of dropping them, and keeps undelivered events
+	// across restarts
+	SinkSpill bool `toml:"sink_spill"`
+	// SinkSpillMaxMB bounds each sink's spill file, in megabytes (default 100)
+	SinkSpillMaxMB int `toml:"sink_spill_max_mb"`
+	// OutboundTimeout bounds each outbound request, e.g. to the aggregator (default "5s")
+	OutboundTimeout string `toml:"outbound_timeout"`
+	// OutboundProxy is the proxy for outbound requests; if empty, the
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables apply
+	OutboundProxy string `toml:"outbound_proxy"`
+	// OutboundInsecureSkipVerify disables TLS certificate verification for
+	// outbound requests, for self-signed development certificates only
+	OutboundInsecureSkipVerify bool `toml:"outbound_insecure_skip_verify"`
+	// OutboundRetries is how many times a failed outbound request is retried
+	OutboundRetries int `toml:"outbound_retries"`
+	// OutboundRetryBackoff is the delay before the first retry, doubled for each
+	// one after (default "500ms")
+	OutboundRetryBackoff string `toml:"outbound_retry_backoff"`
+	// ClearInterval clears the event buffer on a fixed schedule (e.g. "24h")
+	ClearInterval string `toml:"clear_interval"`
+	// ClearAfterIdle clears the event buffer after no events arrive for this long (e.g. "30m")
+	ClearAfterIdle string `toml:"clear_after_idle"`
+	// AnomalyInterval enables volume anomaly detection, comparing the events of
+	// each type per interval (e.g. "1m") with their rolling baseline
+	AnomalyInterval string `toml:"anomaly_interval"`
+	// AnomalyThreshold is how many times above or below its baseline an event
+	// type's volume must be to be flagged
+	AnomalyThreshold float64 `toml:"anomaly_threshold"`
+	// AnomalyMinEvents is the smallest baseline, in events per interval, that
+	// drops are flagged for, and the smallest count a spike must reach
+	AnomalyMinEvents int `toml:"anomaly_min_events"`
+	// ClearOnMarker clears the event buffer when a structured event with this action arrives
+	ClearOnMarker string `toml:"clear_on_marker"`
+	// OutOfOrderThreshold is how far behind the latest device timestamp an event
+	// may be before it is flagged as out of order (e.g. "5s")
+	OutOfOrderThreshold string `toml:"out_of_order_threshold"`
+	// Endpoints declares additional ingest endpoints and per-endpoint transform chains
+	Endpoints []EndpointConfig `toml:"endpoints"`
+	// GeoIPDatabase is the path to a MaxMind-format (.mmdb) database used for geo enrichment
+	GeoIPDatabase string `toml:"geoip_database"`
+	// AnonymizeIPOctets masks this many trailing IPv4 octets of user_ipaddress (1-4)
+	AnonymizeIPOctets int `toml:"anonymize_ip_octets"`
+	// AnonymizeIPSegments masks this many trailing IPv6 segments of user_ipaddress (1-8)
+	AnonymizeIPSegments int `toml:"anonymize_ip_segments"`
+	// FingerprintExclude lists tracker parameters left out of event_fingerprint
+	// Defaults to the Snowplow defaults: cv, eid, nuid and stm
+	FingerprintExclude []string `toml:"fingerprint_exclude"`
+	// ErrorAlert is a text/template logged as an alert for every application_error event
+	ErrorAlert string `toml:"error_alert"`
+	// Notifications post a message rendered from templates to a webhook or chat
+	// service for every matching event
+	Notifications []NotificationConfig `toml:"notifications"`
+	// PublicURL is the address this instance is reached at from outside, used for
+	// links in notifications; defaults to the listen address
+	PublicURL string `toml:"public_url"`
+	// Strict rejects schema-invalid and malformed events with a 422 instead of storing them
+	Strict bool `toml:"strict"`
+	// BadBodyCaptureKB is how much of an unparseable request body is kept in the
+	// bad events stream, in kilobytes; -1 disables capture
+	BadBodyCaptureKB int `toml:"bad_body_capture_kb"`
+	// Sampling drops or samples noisy tracker event types before storage
+	Sampling []SamplingRule `toml:"sampling"`
+	// SSEIncludeRaw adds the original, untransformed payload to every SSE frame
+	SSEIncludeRaw bool `toml:"sse_include_raw"`
+	// SSEQueueSize is the number of frames buffered for each SSE client
+	SSEQueueSize int `toml:"sse_queue_size"`
+	// SSESlowClientPolicy is applied when an SSE client's queue is full:
+	// "drop_oldest", "disconnect" or "summary"
+	SSESlowClientPolicy string `toml:"sse_slow_client_policy"`
+	// SSECompression gzips event streams for clients that accept it
+	SSECompression bool `toml:"sse_compression"`
+	// SSEMaxClients caps concurrent event stream connections (0 for no limit)
+	SSEMaxClients int `toml:"sse_max_clients"`
+	// SSEIdleTimeout closes event streams that have had nothing to send for this long (e.g. "30m")
+	SSEIdleTimeout string `toml:"sse_idle_timeout"`
+	// SSEMaxConnectionAge closes event streams after this long, so abandoned
+	// browser tabs do not hold connections forever (e.g. "12h")
+	SSEMaxConnectionAge string `toml:"sse_max_connection_age"`
+	// IngestWorkers processes tracker events on a pool of workers, so requests
+	// are answered before enrichment, validation and broadcast (0 processes
+	// them in the request handler)
+	IngestWorkers int `toml:"ingest_workers"`
+	// IngestQueueSize is the number of requests that can wait for an ingest worker
+	IngestQueueSize int `toml:"ingest_queue_size"`
+	// IngestOverflow is applied when the ingest queue is full: "block", "reject" or "inline"
+	IngestOverflow string `toml:"ingest_overflow"`
+	// EvictionNoticeInterval batches evictions into one "evicted" SSE message per
+	// interval (default "1s"); "off" disables the messages
+	EvictionNoticeInterval string `toml:"eviction_notice_interval"`
+	// Store is "memory" (the default) or "file", which also persists the
+	// buffer to events.log in the data directory so it survives restarts
+	Store string `toml:"store"`
+	// TransformRules derive display fields from the raw event with path expressions
+	TransformRules []TransformRule `toml:"transform_rules"`
+	// TransformScript is the path to a Lua script applied to every event for display
+	TransformScript string `toml:"transform_script"`
+	// DisplayTimezone is the IANA time zone (e.g. "Europe/London") that the
+	// dashboard and ndjson exports show times in
+	DisplayTimezone string `toml:"display_timezone"`
+	// TimeFormat is the Go reference time layout the dashboard shows times with
+	TimeFormat string `toml:"time_format"`
+	// LabelsDir holds <lang>.json label bundles merged over the built-in ones
+	LabelsDir string `toml:"labels_dir"`
+	// SummaryTemplates render a one-line summary stored on events, per schema
+	SummaryTemplates []SummaryTemplate `toml:"summary_templates"`
+	// FieldDictionary gives custom payload fields friendly display names and
+	// descriptions, applied after the rules and script
+	FieldDictionary []FieldDefinition `toml:"field_dictionary"`
+	// RequiredContexts lists the context entities (vendor/name, or full Iglu
+	// URIs) every tracker event should carry, for the data-quality score
+	RequiredContexts []string `toml:"required_contexts"`
+	// ClassificationRules label events matching a condition at ingest, e.g.
+	// "checkout" or "errors", so large captures can be filtered by meaning
+	ClassificationRules []ClassificationRule `toml:"classification_rules"`
+	// Funnels are ordered steps whose completion is tracked per tracker session
+	Funnels []FunnelConfig `toml:"funnels"`
+	// DataDir is where persisted state is kept (defaults to DefaultDataDir)
+	DataDir string `toml:"data_dir"`
+	// BasePath mounts every route under a path prefix (e.g. "/goplow") for
+	// running behind a reverse proxy
+	BasePath string `toml:"base_path"`
+	// TrustedProxies lists the proxy IPs and CIDR ranges whose X-Forwarded-*
+	// headers are believed (defaults to loopback only)
+	TrustedProxies []string `toml:"trusted_proxies"`
+	// IngestAllow and IngestDeny restrict which client IPs and CIDR ranges may
+	// send events to the ingest endpoints
+	IngestAllow []string `toml:"ingest_allow"`
+	IngestDeny  []string `toml:"ingest_deny"`
+	// AdminAllow and AdminDeny restrict which client IPs and CIDR ranges may use
+	// the web interface and API
+	AdminAllow []string `toml:"admin_allow"`
+	AdminDeny  []string `toml:"admin_deny"`
+	// RouteGroups configures request logging, rate limits and body limits for
+	// the ingest, api and ui routes
+	RouteGroups []RouteGroupConfig `toml:"route_groups"`
+}
+
+// Route groups, each with its own middleware
+const (
+	// RouteGroupIngest holds the ingest endpoints and mounted adapters
+	RouteGroupIngest = "ingest"
+	// RouteGroupAPI holds the REST and SSE API
+	RouteGroupAPI = "api"
+	// RouteGroupUI holds the web interface, its assets and the schemas
+	RouteGroupUI = "ui"
+)
+
+// RouteGroupConfig configures the middleware applied to a group of routes
+type RouteGroupConfig struct {
+	// Name is "ingest", "api" or "ui"
+	Name string `toml:"name"`
+	// LogRequests logs each request's method, path, status and duration
+	LogRequests bool `toml:"log_requests,omitempty"`
+	// RateLimit is how many requests per second each client IP may make, 0 for no limit
+	RateLimit float64 `toml:"rate_limit,omitempty"`
+	// RateBurst is how many requests a client may make at once (defaults to
+	// rate_limit, rounded up)
+	RateBurst int `toml:"rate_burst,omitempty"`
+	// MaxBodyKB bounds request bodies, in kilobytes, 0 for no limit
+	MaxBodyKB int `toml:"max_body_kb,omitempty"`
+}
+
+// RouteGroup returns the configuration of a route group, which is empty if
+// the group is not configured
+func (c EnvironmentConfig) RouteGroup(name string) RouteGroupConfig {
+	for _, group := range c.RouteGroups {
+		if group.Name == name {
+			return group
+		}
+	}
+	return RouteGroupConfig{Name: name}
+}
+
+// EndpointConfig describes an ingest endpoint and the transform chain applied to its events
+// Transformers are stage names applied in order: "snowplow" (friendly names per event type),
+// "rules" (transform_rules), "script" (transform_script), "dictionary" (field_dictionary)
+// or "raw" (no transformation).
+// If Transformers is empty, the default chain (all stages) is used.
+type EndpointConfig struct {
+	Path         string   `toml:"path"`
+	Transformers []string `toml:"transformers"`
+	// Adapter is "snowplow" (the default, tracker payloads), "webhook" (any
+	// JSON or form payload, stored as a single event), "segment" (Segment HTTP
+	// tracking API calls) or "ga4" (GA4 Measurement Protocol and gtag hits)
+	Adapter string `toml:"adapter,omitempty"`
+	// Mount serves every path under Path as well as Path itself; segment and
+	// ga4 endpoints are always mounted
+	Mount bool `toml:"mount,omitempty"`
+	// AllowedOrigins overrides the CORS allowed_origins for this endpoint
+	AllowedOrigins string `toml:"allowed_origins,omitempty"`
+	// AuthToken, if set, must be sent as a bearer token, the basic auth user
+	// (as Segment write keys are) or the api_secret query parameter (as GA4's are)
+	AuthToken string `toml:"auth_token,omitempty"`
+	// Schema names webhook events when the request has no schema query parameter
+	Schema string `toml:"schema,omitempty"`
+	// SignatureSecret enables HMAC-SHA256 verification of webhook requests
+	SignatureSecret string `toml:"signature_secret,omitempty"`
+	// SignatureHeader overrides the header carrying the signature
+	SignatureHeader string `toml:"signature_header,omitempty"`
+	// SignatureStyle is "github" (the default) or "stripe"
+	SignatureStyle string `toml:"signature_style,omitempty"`
+}
+
+// Endpoint adapters and webhook signature styles
+const (
+	AdapterSnowplow      = "snowplow"
+	AdapterWebhook       = "webhook"
+	AdapterSegment       = "segment"
+	AdapterGA4           = "ga4"
+	SignatureStyleGitHub = "github"
+	SignatureStyleStripe = "stripe"
+)
+
+// Mounted reports whether the endpoint serves every path under its path
+func (e EndpointConfig) Mounted() bool {
+	return e.Mount || e.Adapter == AdapterSegment || e.Adapter == AdapterGA4
+}
+
+// NotificationConfig posts a message to WebhookURL for every event matching EventTypes
+// Title and each field's Value are text/templates executed with the event (see
+// the notify package); Format is "json" (the default, for any webhook) or
+// "slack" (Slack, Mattermost and other Slack-compatible incoming webhooks)
+type NotificationConfig struct {
+	// Name identifies the notification in the sinks API and its data files
+	Name       string `toml:"name"`
+	WebhookURL string `toml:"webhook_url"`
+	Format     string `toml:"format,omitempty"`
+	// EventTypes are tracker event types (e.g. "pv") or self-describing schema
+	// keys (e.g. "com.acme/checkout"); empty matches every event
+	EventTypes []string            `toml:"event_types,omitempty"`
+	Title      string              `toml:"title,omitempty"`
+	Fields     []NotificationField `toml:"fields,omitempty"`
+}
+
+// NotificationField is a named value shown in a notification, in order
+type NotificationField struct {
+	Name  string `toml:"name"`
+	Value string `toml:"value"`
+}
+
+// Notification message formats
+const (
+	NotificationFormatJSON  = "json"
+	NotificationFormatSlack = "slack"
+)
+
+// TransformRule copies the value at a jq/JSONPath-style path into a top-level display field
+// The path is evaluated against {"data": <raw event item>}
+type TransformRule struct {
+	Field string `toml:"field"`
+	Path  string `toml:"path"`
+}
+
+// ClassificationRule labels events with Label when When, a jsonpath condition
+// such as `data.se_ca == "checkout"`, matches one of their payload items
+// The condition is evaluated against {"data": <raw event item>}
+type ClassificationRule struct {
+	Label string `toml:"label"`
+	When  string `toml:"when"`
+}
+
+// FunnelConfig is an ordered list of steps sessions are expected to go through,
+// such as viewing a product, adding it to the cart and checking out
+type FunnelConfig struct {
+	Name  string       `toml:"name" json:"name"`
+	Steps []FunnelStep `toml:"steps" json:"steps"`
+}
+
+// FunnelStep is reached by an event matching When, a jsonpath condition such as
+// `data.se_ac == "add-to-cart"` evaluated against {"data": <raw event item>}
+type FunnelStep struct {
+	Name string `toml:"name" json:"name"`
+	When string `toml:"when" json:"when"`
+}
+
+// SummaryTemplate is a Go text/template executed over the decoded payload of
+// events of Schema, a full Iglu URI or "vendor/name" to match every version
+type SummaryTemplate struct {
+	Schema   string `toml:"schema"`
+	Template string `toml:"template"`
+}
+
+// DefaultTimeFormat shows times to the millisecond, without the zone
+const DefaultTimeFormat = "2006-01-02 15:04:05.000"
+
+// DisplayLocation returns the display_timezone location, or UTC if it is unset
+func (c EnvironmentConfig) DisplayLocation() *time.Location {
+	location, err := time.LoadLocation(c.DisplayTimezone)
+	if err != nil || c.DisplayTimezone == "" {
+		return time.UTC
+	}
+	return location
+}
+
+// FieldDefinition names a payload field for display
+// Field is the key as sent, or a dotted path to a key in nested objects (e.g. "payload.cd_pt")
+type FieldDefinition struct {
+	Field       string `toml:"field" json:"field"`
+	Label       string `toml:"label" json:"label"`
+	Description string `toml:"description" json:"description,omitempty"`
+}
+
+// SamplingRule keeps one in every KeepOneIn events of a tracker event type (e.g. "pp")
+// A KeepOneIn of 0 drops every event of the type
+type SamplingRule struct {
+	EventType string `toml:"event_type"`
+	KeepOneIn int    `toml:"keep_one_in"`
+}
+
+// LoadConfig loads the configuration from a TOML, YAML or JSON file, detected by extension
+// It checks multiple locations in order of precedence:
+// 1. Local file (same directory as binary), then the same name as .toml/.yaml/.yml/.json
+// 2. goplow.toml (or .yaml/.yml/.json) in the user config directory (see ConfigDir)
+// 3. $HOME/.config/goplow.toml (or .yaml/.yml/.json), the original location
+// 4. Uses defaults if none exists
+// If environment is specified, it merges the named environment with defaults.
+// GOPLOW_* environment variables and then flags (keyed by config key) override
+// the file. The returned sources record where each value came from.
+func LoadConfig(configPath string, environment string, flags map[string]string) (EnvironmentConfig, ConfigSources, error) {
+	return loadConfig(configPath, environment, flags, defaultConfig())
+}
+
+// LoadContainerConfig loads the configuration for container mode: config files
+// are ignored, so settings only come from GOPLOW_* environment variables and
+// flags, and the server listens on all interfaces by default
+func LoadContainerConfig(flags map[string]string) (EnvironmentConfig, ConfigSources, error) {
+	defaults := defaultConfig()
+	defaults.Host = "0.0.0.0"
+	return loadConfig("", "", flags, defaults)
+}
+
+// defaultConfig returns the built-in default configuration
+func defaultConfig() EnvironmentConfig {
+	config := EnvironmentConfig{
+		Port:                   8081,
+		Host:                   "localhost",
+		MaxMsgs:                100,
+		EventsEndpoint:         "com.simplybusiness/events",
+		AllowedOrigins:         "http://localhost:3000",
+		CORSMaxAge:             "10m",
+		CORSExposeHeaders:      []string{"ETag"},
+		RunIDHeader:            DefaultRunIDHeader,
+		OutOfOrderThreshold:    "5s",
+		OutboundTimeout:        "5s",
+		OutboundRetryBackoff:   "500ms",
+		SinkMaxAttempts:        5,
+		SinkRetryBackoff:       "1s",
+		SinkSpillMaxMB:         100,
+		BadBodyCaptureKB:       8,
+		SSEQueueSize:           defaultSSEQueueSize,
+		SSESlowClientPolicy:    SlowClientDropOldest,
+		EvictionNoticeInterval: defaultEvictionNoticeInterval,
+		Store:                  StoreMemory,
+		IngestQueueSize:        defaultIngestQueueSize,
+		IngestOverflow:         IngestOverflowBlock,
+		TrustedProxies:         defaultTrustedProxies,
+		DisplayTimezone:        "UTC",
+		TimeFormat:             DefaultTimeFormat,
+		AnomalyThreshold:       defaultAnomalyThreshold,
+		AnomalyMinEvents:       defaultAnomalyMinEvents,
+	}
+	if dataDir, err := DefaultDataDir(); err == nil {
+		config.DataDir = dataDir
+	}
+	return config
+}
+
+// loadConfig resolves the configuration over defaultConfig
+// An empty configPath skips the config file
+func loadConfig(configPath string, environment string, flags map[string]string, defaultConfig EnvironmentConfig) (EnvironmentConfig, ConfigSources, error) {
+	sources := newConfigSources()
+
+	finalConfig, loadedFrom, err := loadConfigFile(configPath, environment, defaultConfig, sources)
+	if err != nil {
+		return defaultConfig, sources, err
+	}
+
+	if err := applyEnvOverrides(&finalConfig, sources); err != nil {
+		return defaultConfig, sources, err
+	}
+	if err := applyFlagOverrides(&finalConfig, sources, flags); err != nil {
+		return defaultConfig, sources, err
+	}
+
+	if err := finalConfig.Validate(); err != nil {
+		if loadedFrom != "" {
+			err = fmt.Errorf("%s: %w", loadedFrom, err)
+		}
+		return defaultConfig, sources, err
+	}
+
+	return finalConfig, sources, nil
+}
+
+// loadConfigFile finds and decodes the config file, resolving the named
+// environment over the file's defaults and the built-in defaults
+// It returns the path of the file used, or "" if none was found
+func loadConfigFile(configPath string, environment string, defaultConfig EnvironmentConfig, sources ConfigSources) (EnvironmentConfig, string, error) {
+	if configPath == "" {
+		return defaultConfig, "", nil
+	}
+
+	// Try each path in order
+	var loadedFrom string
+	var rawConfig map[string]interface{}
+
+	for _, path := range configSearchPaths(configPath) {
+		if _, err := os.Stat(path); err == nil {
+			rawConfig, err = readConfigFile(path)
+			if err != nil {
+				return defaultConfig, "", fmt.Errorf("error parsing config file at %s: %w", path, err)
+			}
+			loadedFrom = path
+			break
+		}
+	}
+
+	if loadedFrom == "" {
+		log.Printf("Config file not found, using defaults\n")
+		return defaultConfig, "", nil
+	}
+
+	log.Printf("Loaded config from %s\n", loadedFrom)
+
+	// Decode every environment table, rejecting keys that match no setting
+	allEnvs := make(map[string]EnvironmentConfig)
+	undecoded, err := decodeTable(rawConfig, &allEnvs)
+	if err != nil {
+		return defaultConfig, "", fmt.Errorf("error parsing config file at %s: %w", loadedFrom, err)
+	}
+	if len(undecoded) > 0 {
+		return defaultConfig, "", fmt.Errorf("unknown keys in config file at %s: %s", loadedFrom, strings.Join(undecoded, ", "))
+	}
+
+	// Start with the file's defaults, filling in any missing values from the built-in defaults
+	finalConfig := allEnvs["default"]
+	markSources(sources, finalConfig, ConfigSource{Kind: SourceFile, Origin: loadedFrom + " [default]"})
+	fillDefaults(&finalConfig, defaultConfig)
+
+	// If an environment is specified, merge it (and any environments it extends)
+	if environment != "" {
+		if _, ok := allEnvs[environment]; ok {
+			chain, err := resolveEnvironment(&finalConfig, allEnvs, environment)
+			if err != nil {
+				return defaultConfig, "", err
+			}
+			for i := len(chain) - 1; i >= 0; i-- {
+				markSources(sources, allEnvs[chain[i]], ConfigSource{Kind: SourceFile, Origin: loadedFrom + " [" + chain[i] + "]"})
+			}
+			log.Printf("Applied environment configuration: %s\n", environment)
+		} else {
+			log.Printf("Warning: environment '%s' not found in config file\n", environment)
+		}
+	}
+
+	return finalConfig, loadedFrom, nil
+}
+
+// resolveEnvironment merges the named environment onto base, after the
+// environments it extends, so values cascade default -> parent -> child
+// It returns the inheritance chain, starting with the named environment
+func resolveEnvironment(base *EnvironmentConfig, environments map[string]EnvironmentConfig, name string) ([]string, error) {
+	var chain []string
+	seen := make(map[string]bool)
+	for current := name; current != "" && current != "default"; {
+		if seen[current] {
+			return nil, fmt.Errorf("environment inheritance cycle: %s -> %s", strings.Join(chain, " -> "), current)
+		}
+		seen[current] = true
+
+		environment, exists := environments[current]
+		if !exists {
+			return nil, fmt.Errorf("environment %q extends unknown environment %q", chain[len(chain)-1], current)
+		}
+		chain = append(chain, current)
+		current = environment.Extends
+	}
+
+	// Apply the most distant ancestor first
+	for i := len(chain) - 1; i >= 0; i-- {
+		mergeConfig(base, environments[chain[i]])
+	}
+	base.Extends = ""
+	return chain, nil
+}
+
+// configCandidates returns path followed by the same file name with each other
+// supported extension, so goplow.toml also finds goplow.yaml, goplow.yml and goplow.json
+func configCandidates(path string) []string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	candidates := []string{path}
+	for _, ext := range configExtensions {
+		if candidate := base + ext; candidate != path {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// readConfigFile decodes a TOML, YAML or JSON config file, chosen by extension,
+// into a generic table
+func readConfigFile(path string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		// JSON is valid YAML, and the YAML decoder keeps integers as ints
+		err = yaml.Unmarshal(content, &table)
+	default:
+		_, err = toml.Decode(string(content), &table)
+	}
+	return table, err
+}
+
+// decodeTable decodes a generic table into v using the toml struct tags, so
+// every config format shares the same field names
+// It returns the keys that did not match any field
+func decodeTable(table map[string]interface{}, v interface{}) ([]string, error) {
+	var buffer bytes.Buffer
+	if err := toml.NewEncoder(&buffer).Encode(table); err != nil {
+		return nil, err
+	}
+	metadata, err := toml.Decode(buffer.String(), v)
+	if err != nil {
+		return nil, err
+	}
+
+	var undecoded []string
+	for _, key := range metadata.Undecoded() {
+		undecoded = append(undecoded, key.String())
+	}
+	return undecoded, nil
+}
+
+// mergeConfig copies every non-zero field of override onto dst
+func mergeConfig(dst *EnvironmentConfig, override EnvironmentConfig) {
+	dstValue := reflect.ValueOf(dst).Elem()
+	overrideValue := reflect.ValueOf(override)
+
+	for i := 0; i < overrideValue.NumField(); i++ {
+		if field := overrideValue.Field(i); !field.IsZero() {
+			dstValue.Field(i).Set(field)
+		}
+	}
+}
+
+// fillDefaults sets every zero field of dst to the corresponding default
+func fillDefaults(dst *EnvironmentConfig, defaults EnvironmentConfig) {
+	dstValue := reflect.ValueOf(dst).Elem()
+	defaultsValue := reflect.ValueOf(defaults)
+
+	for i := 0; i < dstValue.NumField(); i++ {
+		if dstValue.Field(i).IsZero() {
+			dstValue.Field(i).Set(defaultsValue.Field(i))
+		}
+	}
+}
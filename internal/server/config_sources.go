@@ -0,0 +1,220 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is prepended to the upper-cased config key to form the
+// environment variable that overrides it (e.g. GOPLOW_PORT)
+const EnvPrefix = "GOPLOW_"
+
+// Kinds of config source, in increasing order of precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// secretSuffixes mark config keys whose values are masked when displayed
+// Chat webhook URLs carry their credentials in the path
+var secretSuffixes = []string{"_secret", "_token", "_password", "_key", "webhook_url"}
+
+// maskedValue replaces secrets when displaying the configuration
+const maskedValue = "********"
+
+// ConfigSource records where a config value came from
+type ConfigSource struct {
+	Kind string `json:"source"`
+	// Origin names the file and environment, environment variable or flag
+	Origin string `json:"origin,omitempty"`
+}
+
+// String formats the source for display, e.g. "env GOPLOW_PORT"
+func (s ConfigSource) String() string {
+	if s.Origin == "" {
+		return s.Kind
+	}
+	return s.Kind + " " + s.Origin
+}
+
+// ConfigSources maps config keys to the source of their resolved value
+type ConfigSources map[string]ConfigSource
+
+// ConfigSetting is a resolved config value with its source, for display
+type ConfigSetting struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+	Origin string      `json:"origin,omitempty"`
+}
+
+// configKey returns the config file key of a struct field
+func configKey(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("toml"), ",")[0]
+}
+
+// newConfigSources attributes every setting to the built-in defaults
+func newConfigSources() ConfigSources {
+	sources := make(ConfigSources)
+	configType := reflect.TypeOf(EnvironmentConfig{})
+	for i := 0; i < configType.NumField(); i++ {
+		sources[configKey(configType.Field(i))] = ConfigSource{Kind: SourceDefault}
+	}
+	return sources
+}
+
+// markSources attributes every non-zero field of values to source
+func markSources(sources ConfigSources, values EnvironmentConfig, source ConfigSource) {
+	value := reflect.ValueOf(values)
+	for i := 0; i < value.NumField(); i++ {
+		if !value.Field(i).IsZero() {
+			sources[configKey(value.Type().Field(i))] = source
+		}
+	}
+}
+
+// applyEnvOverrides sets every scalar or list setting that has a GOPLOW_*
+// environment variable, e.g. GOPLOW_PORT=9000 or GOPLOW_FINGERPRINT_EXCLUDE=eid,stm
+func applyEnvOverrides(config *EnvironmentConfig, sources ConfigSources) error {
+	configType := reflect.TypeOf(*config)
+	for i := 0; i < configType.NumField(); i++ {
+		key := configKey(configType.Field(i))
+		name := EnvPrefix + strings.ToUpper(key)
+		raw, ok := os.LookupEnv(name)
+		if !ok || !overridable(configType.Field(i).Type) {
+			continue
+		}
+		if err := setConfigValue(config, key, raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		sources[key] = ConfigSource{Kind: SourceEnv, Origin: name}
+	}
+	return nil
+}
+
+// applyFlagOverrides sets settings from command-line flags, keyed by config key
+// Flags are named after the key with hyphens, e.g. -data-dir for data_dir
+func applyFlagOverrides(config *EnvironmentConfig, sources ConfigSources, flags map[string]string) error {
+	for key, raw := range flags {
+		if err := setConfigValue(config, key, raw); err != nil {
+			return fmt.Errorf("-%s: %w", key, err)
+		}
+		sources[key] = ConfigSource{Kind: SourceFlag, Origin: "-" + strings.ReplaceAll(key, "_", "-")}
+	}
+	return nil
+}
+
+// overridable reports whether a setting can be given as a single string
+func overridable(fieldType reflect.Type) bool {
+	switch fieldType.Kind() {
+	case reflect.String, reflect.Int, reflect.Bool:
+		return true
+	case reflect.Slice:
+		return fieldType.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// setConfigValue parses raw into the setting named by key
+// Lists are comma-separated
+func setConfigValue(config *EnvironmentConfig, key string, raw string) error {
+	value := reflect.ValueOf(config).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if configKey(value.Type().Field(i)) != key {
+			continue
+		}
+		field := value.Field(i)
+		switch {
+		case field.Kind() == reflect.String:
+			field.SetString(raw)
+		case field.Kind() == reflect.Int:
+			number, err := strconv.Atoi(strings.TrimSpace(raw))
+			if err != nil {
+				return fmt.Errorf("%q is not an integer", raw)
+			}
+			field.SetInt(int64(number))
+		case field.Kind() == reflect.Bool:
+			flag, err := strconv.ParseBool(strings.TrimSpace(raw))
+			if err != nil {
+				return fmt.Errorf("%q is not a boolean", raw)
+			}
+			field.SetBool(flag)
+		case overridable(field.Type()):
+			var items []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+		default:
+			return fmt.Errorf("%s can only be set in a config file", key)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown setting %q", key)
+}
+
+// Settings lists every resolved setting in config file order, with its
+// source and with secrets masked
+func (c EnvironmentConfig) Settings(sources ConfigSources) []ConfigSetting {
+	var settings []ConfigSetting
+	value := reflect.ValueOf(c)
+	for i := 0; i < value.NumField(); i++ {
+		key := configKey(value.Type().Field(i))
+		if key == "extends" {
+			continue
+		}
+		source := sources[key]
+		if source.Kind == "" {
+			source.Kind = SourceDefault
+		}
+		settings = append(settings, ConfigSetting{
+			Key:    key,
+			Value:  maskSecret(key, value.Field(i).Interface()),
+			Source: source.Kind,
+			Origin: source.Origin,
+		})
+	}
+	return settings
+}
+
+// maskSecret hides secret settings and passwords embedded in URLs, including
+// those nested in lists of tables such as endpoints
+func maskSecret(key string, value interface{}) interface{} {
+	if list := reflect.ValueOf(value); list.Kind() == reflect.Slice && list.Len() > 0 && list.Type().Elem().Kind() == reflect.Struct {
+		masked := reflect.MakeSlice(list.Type(), list.Len(), list.Len())
+		for i := 0; i < list.Len(); i++ {
+			item := masked.Index(i)
+			item.Set(list.Index(i))
+			for j := 0; j < item.NumField(); j++ {
+				if field := item.Field(j); field.Kind() == reflect.String {
+					field.Set(reflect.ValueOf(maskSecret(configKey(item.Type().Field(j)), field.String())))
+				}
+			}
+		}
+		return masked.Interface()
+	}
+
+	text, ok := value.(string)
+	if !ok || text == "" {
+		return value
+	}
+	for _, suffix := range secretSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return maskedValue
+		}
+	}
+	if parsed, err := url.Parse(text); err == nil && parsed.User != nil {
+		if _, hasPassword := parsed.User.Password(); hasPassword {
+			return parsed.Redacted()
+		}
+	}
+	return value
+}
@@ -0,0 +1,384 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"goplow/internal/jsonpath"
+)
+
+// reservedPaths are served by goplow itself and cannot be used as ingest endpoints
+var reservedPaths = []string{"api", "assets", "metrics", "schemas", "static"}
+
+// ConfigError lists every problem found in a configuration
+type ConfigError struct {
+	Problems []string
+}
+
+// Error formats the problems as a bulleted list
+func (e *ConfigError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the resolved configuration and returns a *ConfigError
+// describing every invalid setting, or nil if it is valid
+func (c EnvironmentConfig) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		add("port %d is out of range (1-65535)", c.Port)
+	}
+	if !validHost(listenHost(c.Host)) {
+		add("host %q is not an IP address or hostname (use \"::\" to listen on all interfaces over IPv6 and IPv4)", c.Host)
+	}
+	if c.MaxMsgs < 1 {
+		add("max_messages must be at least 1, got %d", c.MaxMsgs)
+	}
+
+	checkOrigins := func(setting string, origins string) {
+		for _, origin := range strings.Split(origins, ",") {
+			origin = strings.TrimSpace(origin)
+			if origin == "" || origin == "*" {
+				continue
+			}
+			if parsed, err := url.Parse(origin); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				add("%s entry %q is not an http(s) origin such as http://localhost:3000", setting, origin)
+			} else if parsed.Path != "" && parsed.Path != "/" {
+				add("%s entry %q must not include a path", setting, origin)
+			}
+		}
+	}
+	checkOrigins("allowed_origins", c.AllowedOrigins)
+
+	for name, headers := range map[string][]string{
+		"cors_allow_headers":  c.CORSAllowHeaders,
+		"cors_expose_headers": c.CORSExposeHeaders,
+	} {
+		for _, header := range headers {
+			if header == "*" {
+				add("%s cannot use *, which browsers ignore for requests with credentials; list the header names", name)
+			} else if !validHeaderName(header) {
+				add("%s entry %q is not a valid HTTP header name", name, header)
+			}
+		}
+	}
+
+	if !validHeaderName(c.RunIDHeader) {
+		add("run_id_header %q is not a valid HTTP header name", c.RunIDHeader)
+	}
+
+	if c.AggregatorURL != "" {
+		if parsed, err := url.Parse(c.AggregatorURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			add("aggregator_url %q is not an http(s) URL", c.AggregatorURL)
+		}
+	}
+	if c.OutboundProxy != "" {
+		if parsed, err := url.Parse(c.OutboundProxy); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https" && parsed.Scheme != "socks5") || parsed.Host == "" {
+			add("outbound_proxy %q is not an http(s) or socks5 URL", c.OutboundProxy)
+		}
+	}
+	if c.OutboundRetries < 0 {
+		add("outbound_retries must be 0 (no retries) or more, got %d", c.OutboundRetries)
+	}
+	if c.SinkMaxAttempts < 1 {
+		add("sink_max_attempts must be at least 1, got %d", c.SinkMaxAttempts)
+	}
+	if c.SinkSpillMaxMB < 1 {
+		add("sink_spill_max_mb must be at least 1, got %d", c.SinkSpillMaxMB)
+	}
+
+	// Every ingest endpoint needs a distinct, valid path that does not shadow a built-in route
+	seen := make(map[string]string)
+	checkEndpoint := func(setting string, path string) {
+		normalized := NormalizeEndpointPath(path)
+		trimmed := strings.Trim(normalized, "/")
+		switch {
+		case trimmed == "":
+			add("%s must not be empty", setting)
+			return
+		case strings.ContainsAny(trimmed, " ?#\t"):
+			add("%s %q must not contain spaces, '?' or '#'", setting, path)
+			return
+		}
+		for _, reserved := range reservedPaths {
+			if trimmed == reserved || strings.HasPrefix(trimmed, reserved+"/") {
+				add("%s %q conflicts with the built-in /%s routes", setting, path, reserved)
+				return
+			}
+		}
+		if previous, exists := seen[normalized]; exists {
+			add("%s %q conflicts with %s, which uses the same path", setting, path, previous)
+			return
+		}
+		seen[normalized] = setting
+	}
+	checkEndpoint("events_endpoint", c.EventsEndpoint)
+	for i, endpoint := range c.Endpoints {
+		checkEndpoint(fmt.Sprintf("endpoints[%d].path", i), endpoint.Path)
+		switch endpoint.Adapter {
+		case "", AdapterSnowplow, AdapterWebhook, AdapterSegment, AdapterGA4:
+		default:
+			add("endpoints[%d].adapter %q must be snowplow, webhook, segment or ga4", i, endpoint.Adapter)
+		}
+		if endpoint.Mount && (endpoint.Adapter == "" || endpoint.Adapter == AdapterSnowplow) {
+			add("endpoints[%d].mount is only supported with the webhook, segment and ga4 adapters", i)
+		}
+		checkOrigins(fmt.Sprintf("endpoints[%d].allowed_origins", i), endpoint.AllowedOrigins)
+		switch endpoint.SignatureStyle {
+		case "", SignatureStyleGitHub, SignatureStyleStripe:
+		default:
+			add("endpoints[%d].signature_style %q must be github or stripe", i, endpoint.SignatureStyle)
+		}
+		if endpoint.SignatureSecret != "" && endpoint.Adapter != AdapterWebhook {
+			add("endpoints[%d].signature_secret is only supported with adapter = \"webhook\"", i)
+		}
+	}
+
+	if c.BasePath != "" && strings.ContainsAny(c.BasePath, " ?#\t\"'<>\\") {
+		add("base_path %q must not contain spaces, quotes, '?', '#', '<', '>' or '\\'", c.BasePath)
+	}
+
+	for name, entries := range map[string][]string{
+		"trusted_proxies": c.TrustedProxies,
+		"ingest_allow":    c.IngestAllow,
+		"ingest_deny":     c.IngestDeny,
+		"admin_allow":     c.AdminAllow,
+		"admin_deny":      c.AdminDeny,
+	} {
+		if _, err := ParseNetworks(entries); err != nil {
+			add("%s entry %v", name, err)
+		}
+	}
+
+	for name, value := range map[string]string{
+		"cors_max_age":             c.CORSMaxAge,
+		"clear_interval":           c.ClearInterval,
+		"clear_after_idle":         c.ClearAfterIdle,
+		"anomaly_interval":         c.AnomalyInterval,
+		"out_of_order_threshold":   c.OutOfOrderThreshold,
+		"sse_idle_timeout":         c.SSEIdleTimeout,
+		"sse_max_connection_age":   c.SSEMaxConnectionAge,
+		"eviction_notice_interval": c.EvictionNoticeInterval,
+		"outbound_timeout":         c.OutboundTimeout,
+		"outbound_retry_backoff":   c.OutboundRetryBackoff,
+		"sink_retry_backoff":       c.SinkRetryBackoff,
+	} {
+		if value == "" || (name == "eviction_notice_interval" && value == EvictionNoticesOff) {
+			continue
+		}
+		if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+			add("%s %q is not a positive duration such as 30s or 5m", name, value)
+		}
+	}
+
+	if c.AnomalyThreshold <= 1 {
+		add("anomaly_threshold must be greater than 1, got %g", c.AnomalyThreshold)
+	}
+	if c.AnomalyMinEvents < 1 {
+		add("anomaly_min_events must be at least 1, got %d", c.AnomalyMinEvents)
+	}
+
+	if c.AnonymizeIPOctets < 0 || c.AnonymizeIPOctets > 4 {
+		add("anonymize_ip_octets must be between 0 and 4, got %d", c.AnonymizeIPOctets)
+	}
+	if c.AnonymizeIPSegments < 0 || c.AnonymizeIPSegments > 8 {
+		add("anonymize_ip_segments must be between 0 and 8, got %d", c.AnonymizeIPSegments)
+	}
+	if c.Store != "" && !hasStore(c.Store) {
+		add("store %q must be one of %s", c.Store, strings.Join(StoreNames(), ", "))
+	}
+	if c.SSEMaxClients < 0 {
+		add("sse_max_clients must be 0 (no limit) or more, got %d", c.SSEMaxClients)
+	}
+	if c.SSEQueueSize < 1 {
+		add("sse_queue_size must be at least 1, got %d", c.SSEQueueSize)
+	}
+	switch c.SSESlowClientPolicy {
+	case "", SlowClientDropOldest, SlowClientDisconnect, SlowClientSummary:
+	default:
+		add("sse_slow_client_policy %q must be drop_oldest, disconnect or summary", c.SSESlowClientPolicy)
+	}
+	if c.IngestWorkers < 0 {
+		add("ingest_workers must be 0 (process in the handler) or more, got %d", c.IngestWorkers)
+	}
+	if c.IngestQueueSize < 1 {
+		add("ingest_queue_size must be at least 1, got %d", c.IngestQueueSize)
+	}
+	switch c.IngestOverflow {
+	case "", IngestOverflowBlock, IngestOverflowReject, IngestOverflowInline:
+	default:
+		add("ingest_overflow %q must be block, reject or inline", c.IngestOverflow)
+	}
+	if c.BadBodyCaptureKB < -1 {
+		add("bad_body_capture_kb must be -1 (disabled) or more, got %d", c.BadBodyCaptureKB)
+	}
+	for i, rule := range c.Sampling {
+		if rule.EventType == "" {
+			add("sampling[%d].event_type must not be empty", i)
+		}
+		if rule.KeepOneIn < 0 {
+			add("sampling[%d].keep_one_in must be 0 (drop all) or more, got %d", i, rule.KeepOneIn)
+		}
+	}
+	if c.PublicURL != "" {
+		if parsed, err := url.Parse(c.PublicURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			add("public_url %q is not an http(s) URL", c.PublicURL)
+		}
+	}
+	// Notifications are sinks alongside the aggregator forwarder, named in URLs and file names
+	notificationNames := map[string]bool{"aggregator": true}
+	for i, notification := range c.Notifications {
+		if !validSinkName(notification.Name) {
+			add("notifications[%d].name %q must be letters, digits, '-' or '_'", i, notification.Name)
+		} else if notificationNames[notification.Name] {
+			add("notifications[%d].name %q is already used by another sink", i, notification.Name)
+		}
+		notificationNames[notification.Name] = true
+		if parsed, err := url.Parse(notification.WebhookURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			add("notifications[%d].webhook_url is not an http(s) URL", i)
+		}
+		switch notification.Format {
+		case "", NotificationFormatJSON, NotificationFormatSlack:
+		default:
+			add("notifications[%d].format %q must be json or slack", i, notification.Format)
+		}
+		for j, field := range notification.Fields {
+			if field.Name == "" {
+				add("notifications[%d].fields[%d].name must not be empty", i, j)
+			}
+		}
+	}
+	for i, rule := range c.TransformRules {
+		if rule.Field == "" || rule.Path == "" {
+			add("transform_rules[%d] needs both field and path", i)
+		}
+	}
+	if _, err := time.LoadLocation(c.DisplayTimezone); err != nil {
+		add("display_timezone %q is not an IANA time zone, e.g. \"Europe/London\"", c.DisplayTimezone)
+	}
+	if reference := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC); c.TimeFormat != "" && reference.Format(c.TimeFormat) == c.TimeFormat {
+		add("time_format %q has no Go reference time elements, e.g. \"2006-01-02 15:04:05\"", c.TimeFormat)
+	}
+	summarySchemas := make(map[string]bool)
+	for i, summary := range c.SummaryTemplates {
+		if summary.Schema == "" || summary.Template == "" {
+			add("summary_templates[%d] needs both schema and template", i)
+		} else if summarySchemas[summary.Schema] {
+			add("summary_templates[%d] defines schema %q again", i, summary.Schema)
+		}
+		summarySchemas[summary.Schema] = true
+	}
+	dictionaryFields := make(map[string]bool)
+	for i, definition := range c.FieldDictionary {
+		if definition.Field == "" || definition.Label == "" {
+			add("field_dictionary[%d] needs both field and label", i)
+		} else if dictionaryFields[definition.Field] {
+			add("field_dictionary[%d] defines field %q again", i, definition.Field)
+		}
+		dictionaryFields[definition.Field] = true
+	}
+	for i, rule := range c.ClassificationRules {
+		if rule.Label == "" || rule.When == "" {
+			add("classification_rules[%d] needs both label and when", i)
+		} else if _, err := jsonpath.CompileCondition(rule.When); err != nil {
+			add("classification_rules[%d]: %v", i, err)
+		}
+	}
+	funnelNames := make(map[string]bool)
+	for i, funnel := range c.Funnels {
+		if err := funnel.Validate(); err != nil {
+			add("funnels[%d]: %v", i, err)
+		} else if funnelNames[funnel.Name] {
+			add("funnels[%d] defines funnel %q again", i, funnel.Name)
+		}
+		funnelNames[funnel.Name] = true
+	}
+	groupNames := make(map[string]bool)
+	for i, group := range c.RouteGroups {
+		switch group.Name {
+		case RouteGroupIngest, RouteGroupAPI, RouteGroupUI:
+		default:
+			add("route_groups[%d].name %q must be ingest, api or ui", i, group.Name)
+		}
+		if groupNames[group.Name] {
+			add("route_groups[%d] configures route group %q again", i, group.Name)
+		}
+		groupNames[group.Name] = true
+		if group.RateLimit < 0 {
+			add("route_groups[%d].rate_limit must not be negative, got %g", i, group.RateLimit)
+		}
+		if group.RateBurst < 0 {
+			add("route_groups[%d].rate_burst must not be negative, got %d", i, group.RateBurst)
+		}
+		if group.MaxBodyKB < 0 {
+			add("route_groups[%d].max_body_kb must not be negative, got %d", i, group.MaxBodyKB)
+		}
+	}
+	for i, schema := range c.RequiredContexts {
+		if strings.TrimSpace(schema) == "" {
+			add("required_contexts[%d] must not be empty", i)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return &ConfigError{Problems: problems}
+}
+
+// validHeaderName reports whether name is a non-empty HTTP header field name
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// validSinkName reports whether name is a non-empty run of letters, digits,
+// '-' and '_', safe to use in URL paths and file names
+func validSinkName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// validHost reports whether host is empty (all interfaces), an IP address or
+// a DNS hostname
+func validHost(host string) bool {
+	if host == "" || net.ParseIP(host) != nil {
+		return true
+	}
+	if len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// counterShards is the number of independently locked shards in shardedCounts
+const counterShards = 16
+
+// shardedCounts counts occurrences by key, e.g. events by type
+// Keys are spread over shards with their own locks and the counts are atomic,
+// so concurrent ingest only takes a write lock the first time a key is seen
+// The zero value is ready to use
+type shardedCounts struct {
+	shards [counterShards]countShard
+}
+
+// countShard holds the counters for the keys hashed to it
+type countShard struct {
+	mutex  sync.RWMutex
+	counts map[string]*atomic.Int64
+}
+
+// shard returns the shard for key, using an FNV-1a hash
+func (c *shardedCounts) shard(key string) *countShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return &c.shards[hash%counterShards]
+}
+
+// add increments the count for key
+func (c *shardedCounts) add(key string) {
+	shard := c.shard(key)
+	shard.mutex.RLock()
+	count := shard.counts[key]
+	shard.mutex.RUnlock()
+
+	if count == nil {
+		shard.mutex.Lock()
+		if count = shard.counts[key]; count == nil {
+			if shard.counts == nil {
+				shard.counts = make(map[string]*atomic.Int64)
+			}
+			count = new(atomic.Int64)
+			shard.counts[key] = count
+		}
+		shard.mutex.Unlock()
+	}
+	count.Add(1)
+}
+
+// snapshot returns the count for every key seen, and their total
+func (c *shardedCounts) snapshot() (int, map[string]int) {
+	total := 0
+	counts := make(map[string]int)
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.mutex.RLock()
+		for key, count := range shard.counts {
+			value := int(count.Load())
+			counts[key] = value
+			total += value
+		}
+		shard.mutex.RUnlock()
+	}
+	return total, counts
+}
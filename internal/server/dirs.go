@@ -0,0 +1,73 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// appName names goplow's directory inside the platform config and data directories
+const appName = "goplow"
+
+// ConfigDir returns the directory the user's config file is looked up in:
+// $XDG_CONFIG_HOME/goplow if set, otherwise the platform config directory
+// (~/.config/goplow, ~/Library/Application Support/goplow or %AppData%\goplow)
+func ConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, appName), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName), nil
+}
+
+// DefaultDataDir returns the directory persisted state is kept in unless
+// data_dir is set: $XDG_DATA_HOME/goplow if set, otherwise ~/.local/share/goplow,
+// ~/Library/Application Support/goplow or %LocalAppData%\goplow
+func DefaultDataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, appName), nil
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("LocalAppData"); dir != "" {
+			return filepath.Join(dir, appName), nil
+		}
+	case "darwin", "ios":
+		// macOS keeps application data alongside its config
+		return ConfigDir()
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", appName), nil
+}
+
+// configSearchPaths returns the config file locations to try, in precedence order:
+// the given path, the user config directory, then the legacy $HOME/.config/goplow.toml
+func configSearchPaths(configPath string) []string {
+	paths := configCandidates(configPath)
+	name := filepath.Base(configPath)
+
+	if dir, err := ConfigDir(); err == nil {
+		paths = append(paths, configCandidates(filepath.Join(dir, name))...)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, configCandidates(filepath.Join(home, ".config", name))...)
+	}
+	return paths
+}
+
+// DataPath returns the path of name inside the data directory, creating the
+// data directory if it does not exist yet
+func (c EnvironmentConfig) DataPath(name string) (string, error) {
+	if err := os.MkdirAll(c.DataDir, 0o755); err != nil {
+		return "", err
+	}
+	return filepath.Join(c.DataDir, name), nil
+}
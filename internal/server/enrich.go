@@ -0,0 +1,47 @@
+package server
+
+// Enricher derives additional fields for an event before it is stored,
+// mirroring the enrichments run by the Snowplow enrich pipeline
+type Enricher interface {
+	// Name identifies the enrichment in logs
+	Name() string
+	// Enrich adds fields to event.Enriched (and may rewrite existing ones)
+	Enrich(event *Event)
+}
+
+// ClientIPEnricher is an Enricher that derives fields from the client's IP
+// address, such as its location; it is skipped for mirrored events, whose
+// address may already be masked and whose fields were derived where they
+// were received
+type ClientIPEnricher interface {
+	Enricher
+	UsesClientIP() bool
+}
+
+// AddEnricher registers an enrichment that runs on every new event, in registration order
+func (s *AppServer) AddEnricher(enricher Enricher) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.enrichers = append(s.enrichers, enricher)
+}
+
+// enrich runs all registered enrichers over the event
+func (s *AppServer) enrich(event *Event) {
+	s.mutex.RLock()
+	enrichers := s.enrichers
+	s.mutex.RUnlock()
+
+	if len(enrichers) == 0 {
+		return
+	}
+	if event.Enriched == nil {
+		event.Enriched = make(map[string]interface{})
+	}
+	for _, enricher := range enrichers {
+		if ipEnricher, ok := enricher.(ClientIPEnricher); ok && event.Mirrored && ipEnricher.UsesClientIP() {
+			continue
+		}
+		enricher.Enrich(event)
+	}
+}
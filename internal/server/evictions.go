@@ -0,0 +1,75 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// EvictionNoticesOff disables eviction notices when set as eviction_notice_interval
+const EvictionNoticesOff = "off"
+
+// defaultEvictionNoticeInterval is how long evictions are collected before a notice is sent
+const defaultEvictionNoticeInterval = "1s"
+
+// EvictionNotice describes a range of events evicted from the buffer, sent to
+// SSE clients as a named "evicted" message so they can mark the gap
+type EvictionNotice struct {
+	// FromID and ToID are the first and last evicted event IDs
+	FromID int `json:"fromId"`
+	ToID   int `json:"toId"`
+	// Count is the number of events evicted in the range
+	Count int `json:"count"`
+	// Reason is the policy that evicted them, e.g. "max_messages"
+	Reason string `json:"reason"`
+}
+
+// evictions collects evicted event IDs until the next notice
+type evictions struct {
+	mutex   sync.Mutex
+	pending *EvictionNotice
+}
+
+// recordEviction notes an evicted event and schedules a notice for the range
+func (s *AppServer) recordEviction(event Event, reason string) {
+	s.CountMetric(MetricEvicted, "")
+
+	interval := s.evictionNoticeInterval()
+	if interval == 0 {
+		return
+	}
+
+	s.evictions.mutex.Lock()
+	defer s.evictions.mutex.Unlock()
+
+	if s.evictions.pending != nil {
+		s.evictions.pending.ToID = event.ID
+		s.evictions.pending.Count++
+		return
+	}
+	s.evictions.pending = &EvictionNotice{FromID: event.ID, ToID: event.ID, Count: 1, Reason: reason}
+	time.AfterFunc(interval, s.flushEvictions)
+}
+
+// flushEvictions sends the pending eviction notice, if any
+func (s *AppServer) flushEvictions() {
+	s.evictions.mutex.Lock()
+	pending := s.evictions.pending
+	s.evictions.pending = nil
+	s.evictions.mutex.Unlock()
+
+	if pending != nil {
+		s.queueControl(SSEChannelEvicted, *pending)
+	}
+}
+
+// evictionNoticeInterval returns how long evictions are batched, or 0 if notices are off
+func (s *AppServer) evictionNoticeInterval() time.Duration {
+	value := s.config.EvictionNoticeInterval
+	if value == EvictionNoticesOff {
+		return 0
+	}
+	if value == "" {
+		value = defaultEvictionNoticeInterval
+	}
+	return parseDurationSetting("eviction_notice_interval", value)
+}
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"goplow/internal/jsonpath"
+)
+
+// Funnel sources
+const (
+	FunnelSourceConfig = "config"
+	FunnelSourceAPI    = "api"
+)
+
+// Errors returned when defining and deleting funnels
+var (
+	ErrFunnelNotFound   = errors.New("funnel not found")
+	ErrFunnelConfigured = errors.New("funnel is defined in the configuration")
+)
+
+// funnel is a funnel with its step conditions compiled
+type funnel struct {
+	config     FunnelConfig
+	conditions []*jsonpath.Condition
+	source     string
+}
+
+// Validate checks the funnel's name and steps, and compiles their conditions
+func (f FunnelConfig) Validate() error {
+	_, err := compileFunnel(f, "")
+	return err
+}
+
+// compileFunnel compiles the conditions of a funnel's steps
+func compileFunnel(config FunnelConfig, source string) (funnel, error) {
+	compiled := funnel{config: config, source: source}
+	if !validSinkName(config.Name) {
+		return compiled, fmt.Errorf("name %q must be letters, digits, '-' or '_'", config.Name)
+	}
+	if len(config.Steps) == 0 {
+		return compiled, fmt.Errorf("funnel %s needs at least one step", config.Name)
+	}
+	for i, step := range config.Steps {
+		if step.Name == "" || step.When == "" {
+			return compiled, fmt.Errorf("steps[%d] needs both name and when", i)
+		}
+		condition, err := jsonpath.CompileCondition(step.When)
+		if err != nil {
+			return compiled, fmt.Errorf("steps[%d]: %w", i, err)
+		}
+		compiled.conditions = append(compiled.conditions, condition)
+	}
+	return compiled, nil
+}
+
+// configuredFunnels compiles the funnels of the validated configuration
+func configuredFunnels(configs []FunnelConfig) []funnel {
+	funnels := make([]funnel, 0, len(configs))
+	for _, config := range configs {
+		if compiled, err := compileFunnel(config, FunnelSourceConfig); err == nil {
+			funnels = append(funnels, compiled)
+		}
+	}
+	return funnels
+}
+
+// FunnelReport is the completion of a funnel by the tracker sessions of a set
+// of events
+type FunnelReport struct {
+	Name string `json:"name"`
+	// Source is "config" for funnels from the configuration, or "api"
+	Source string             `json:"source"`
+	Steps  []FunnelStepReport `json:"steps"`
+	// Sessions counts the sessions that reached the first step, and Completed
+	// those that reached the last
+	Sessions       int     `json:"sessions"`
+	Completed      int     `json:"completed"`
+	CompletionRate float64 `json:"completionRate"`
+	// Progress is each session's way through the funnel, most recently active
+	// first; left out of funnel lists
+	Progress []FunnelSession `json:"progress,omitempty"`
+}
+
+// FunnelStepReport counts the sessions that reached a step
+type FunnelStepReport struct {
+	FunnelStep
+	Sessions int `json:"sessions"`
+	// Conversion is the share of the sessions at the previous step that reached
+	// this one
+	Conversion float64 `json:"conversion"`
+}
+
+// FunnelSession is one tracker session's progress through a funnel
+type FunnelSession struct {
+	// Session is the tracker's session ID (sid), or its device ID (duid) for
+	// trackers without sessions
+	Session   string `json:"session"`
+	Reached   int    `json:"reached"`
+	Completed bool   `json:"completed"`
+	// NextStep is the name of the step the session has yet to reach
+	NextStep string `json:"nextStep,omitempty"`
+	// Hits are the events that reached each step, in order
+	Hits         []FunnelHit `json:"hits"`
+	LastActiveAt time.Time   `json:"lastActiveAt"`
+}
+
+// FunnelHit is the event that reached a funnel step
+type FunnelHit struct {
+	Step       string    `json:"step"`
+	EventID    int       `json:"eventId"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// GetFunnels returns the defined funnels, those from the configuration first
+func (s *AppServer) GetFunnels() []FunnelConfig {
+	s.funnelsMutex.RLock()
+	defer s.funnelsMutex.RUnlock()
+
+	configs := make([]FunnelConfig, len(s.funnels))
+	for i, defined := range s.funnels {
+		configs[i] = defined.config
+	}
+	return configs
+}
+
+// SetFunnel defines a funnel, or replaces one defined through the API
+// Funnels from the configuration cannot be replaced
+func (s *AppServer) SetFunnel(config FunnelConfig, actor Actor) error {
+	compiled, err := compileFunnel(config, FunnelSourceAPI)
+	if err != nil {
+		return err
+	}
+
+	s.funnelsMutex.Lock()
+	replaced := false
+	for i, defined := range s.funnels {
+		if defined.config.Name != config.Name {
+			continue
+		}
+		if defined.source == FunnelSourceConfig {
+			s.funnelsMutex.Unlock()
+			return ErrFunnelConfigured
+		}
+		s.funnels[i] = compiled
+		replaced = true
+	}
+	if !replaced {
+		s.funnels = append(s.funnels, compiled)
+	}
+	s.funnelsMutex.Unlock()
+
+	s.Audit(AuditFunnel, actor, map[string]interface{}{"name": config.Name, "action": "define", "steps": len(config.Steps)})
+	return nil
+}
+
+// DeleteFunnel removes a funnel defined through the API
+func (s *AppServer) DeleteFunnel(name string, actor Actor) error {
+	s.funnelsMutex.Lock()
+	found := false
+	for i, defined := range s.funnels {
+		if defined.config.Name != name {
+			continue
+		}
+		if defined.source == FunnelSourceConfig {
+			s.funnelsMutex.Unlock()
+			return ErrFunnelConfigured
+		}
+		s.funnels = append(s.funnels[:i:i], s.funnels[i+1:]...)
+		found = true
+		break
+	}
+	s.funnelsMutex.Unlock()
+
+	if !found {
+		return ErrFunnelNotFound
+	}
+	s.Audit(AuditFunnel, actor, map[string]interface{}{"name": name, "action": "delete"})
+	return nil
+}
+
+// FunnelReports returns the completion of every funnel by the sessions of
+// events, without each session's progress
+func (s *AppServer) FunnelReports(events []Event) []FunnelReport {
+	s.funnelsMutex.RLock()
+	funnels := make([]funnel, len(s.funnels))
+	copy(funnels, s.funnels)
+	s.funnelsMutex.RUnlock()
+
+	reports := make([]FunnelReport, len(funnels))
+	for i, defined := range funnels {
+		reports[i] = defined.report(events)
+		reports[i].Progress = nil
+	}
+	return reports
+}
+
+// FunnelReport returns the completion of a funnel by the sessions of events,
+// with each session's progress
+// The second return value is false if there is no funnel with the name
+func (s *AppServer) FunnelReport(name string, events []Event) (FunnelReport, bool) {
+	s.funnelsMutex.RLock()
+	var found *funnel
+	for i := range s.funnels {
+		if s.funnels[i].config.Name == name {
+			defined := s.funnels[i]
+			found = &defined
+			break
+		}
+	}
+	s.funnelsMutex.RUnlock()
+
+	if found == nil {
+		return FunnelReport{}, false
+	}
+	return found.report(events), true
+}
+
+// report follows each tracker session through the funnel's steps in arrival
+// order; a step counts once every earlier step has been reached
+func (f funnel) report(events []Event) FunnelReport {
+	progress := make(map[string]*FunnelSession)
+	for _, event := range events {
+		for _, item := range event.Data {
+			session := funnelSessionKey(item)
+			if session == "" {
+				continue
+			}
+			current := progress[session]
+			reached := 0
+			if current != nil {
+				reached = current.Reached
+			}
+			if reached == len(f.conditions) || !f.conditions[reached].Match(map[string]interface{}{"data": item}) {
+				if current != nil {
+					current.LastActiveAt = event.ReceivedAt
+				}
+				continue
+			}
+			if current == nil {
+				current = &FunnelSession{Session: session}
+				progress[session] = current
+			}
+			current.Hits = append(current.Hits, FunnelHit{Step: f.config.Steps[reached].Name, EventID: event.ID, ReceivedAt: event.ReceivedAt})
+			current.Reached++
+			current.LastActiveAt = event.ReceivedAt
+		}
+	}
+
+	report := FunnelReport{
+		Name:     f.config.Name,
+		Source:   f.source,
+		Steps:    make([]FunnelStepReport, len(f.config.Steps)),
+		Sessions: len(progress),
+		Progress: make([]FunnelSession, 0, len(progress)),
+	}
+	for i, step := range f.config.Steps {
+		report.Steps[i].FunnelStep = step
+	}
+	for _, session := range progress {
+		session.Completed = session.Reached == len(f.config.Steps)
+		if session.Completed {
+			report.Completed++
+		} else {
+			session.NextStep = f.config.Steps[session.Reached].Name
+		}
+		for i := 0; i < session.Reached; i++ {
+			report.Steps[i].Sessions++
+		}
+		report.Progress = append(report.Progress, *session)
+	}
+	for i := range report.Steps {
+		previous := report.Sessions
+		if i > 0 {
+			previous = report.Steps[i-1].Sessions
+		}
+		if previous > 0 {
+			report.Steps[i].Conversion = float64(report.Steps[i].Sessions) / float64(previous)
+		}
+	}
+	if report.Sessions > 0 {
+		report.CompletionRate = float64(report.Completed) / float64(report.Sessions)
+	}
+	sort.Slice(report.Progress, func(i, j int) bool {
+		a, b := report.Progress[i], report.Progress[j]
+		if !a.LastActiveAt.Equal(b.LastActiveAt) {
+			return a.LastActiveAt.After(b.LastActiveAt)
+		}
+		return a.Session < b.Session
+	})
+	return report
+}
+
+// funnelSessionKey returns the tracker session of a payload item: its session
+// ID, or its device ID for trackers without sessions
+func funnelSessionKey(item map[string]interface{}) string {
+	if sid, _ := item["sid"].(string); sid != "" {
+		return sid
+	}
+	duid, _ := item["duid"].(string)
+	return duid
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"sync/atomic"
+
+	"goplow/internal/iglu"
+)
+
+// Upper bounds of the payload size (bytes) and context count histogram buckets
+var (
+	payloadBytesBounds = []int64{256, 512, 1024, 2048, 4096, 8192, 16384, 32768, 65536}
+	contextCountBounds = []int64{0, 1, 2, 3, 4, 5, 10, 20}
+)
+
+// Histogram is the distribution of a value over the events accepted since startup
+type Histogram struct {
+	Count int   `json:"count"`
+	Sum   int64 `json:"sum"`
+	Max   int64 `json:"max"`
+	// Mean is Sum divided by Count
+	Mean float64 `json:"mean"`
+	// Buckets hold the number of events with a value up to each bound, not
+	// counting those of the previous buckets; the last has no bound
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+// HistogramBucket counts the values up to UpTo, or above the last bound if UpTo
+// is nil
+type HistogramBucket struct {
+	UpTo  *int64 `json:"upTo"`
+	Count int    `json:"count"`
+}
+
+// histogram counts values into fixed buckets
+// Counts are atomic so ingest never waits for a stats reader
+type histogram struct {
+	bounds  []int64
+	buckets []atomic.Int64
+	count   atomic.Int64
+	sum     atomic.Int64
+	max     atomic.Int64
+}
+
+// newHistogram returns a histogram with the given ascending bucket bounds, and
+// a bucket for values above the last
+func newHistogram(bounds []int64) *histogram {
+	return &histogram{bounds: bounds, buckets: make([]atomic.Int64, len(bounds)+1)}
+}
+
+// observe counts a value
+func (h *histogram) observe(value int64) {
+	bucket := len(h.bounds)
+	for i, bound := range h.bounds {
+		if value <= bound {
+			bucket = i
+			break
+		}
+	}
+	h.buckets[bucket].Add(1)
+	h.count.Add(1)
+	h.sum.Add(value)
+	for {
+		current := h.max.Load()
+		if value <= current || h.max.CompareAndSwap(current, value) {
+			break
+		}
+	}
+}
+
+// snapshot returns the histogram's current counts
+func (h *histogram) snapshot() Histogram {
+	snapshot := Histogram{
+		Count:   int(h.count.Load()),
+		Sum:     h.sum.Load(),
+		Max:     h.max.Load(),
+		Buckets: make([]HistogramBucket, len(h.buckets)),
+	}
+	if snapshot.Count > 0 {
+		snapshot.Mean = float64(snapshot.Sum) / float64(snapshot.Count)
+	}
+	for i := range h.buckets {
+		snapshot.Buckets[i].Count = int(h.buckets[i].Load())
+		if i < len(h.bounds) {
+			bound := h.bounds[i]
+			snapshot.Buckets[i].UpTo = &bound
+		}
+	}
+	return snapshot
+}
+
+// payloadHistograms track the size and number of attached contexts of each
+// tracker event, to spot bloated context bundles
+type payloadHistograms struct {
+	bytes    *histogram
+	contexts *histogram
+}
+
+// newPayloadHistograms returns empty payload histograms
+func newPayloadHistograms() payloadHistograms {
+	return payloadHistograms{
+		bytes:    newHistogram(payloadBytesBounds),
+		contexts: newHistogram(contextCountBounds),
+	}
+}
+
+// record counts each payload item of an event, sized as it was received, or
+// as its JSON encoding if the ingest path did not record its size
+func (p payloadHistograms) record(event Event) {
+	for i, item := range event.Data {
+		var size int64
+		if i < len(event.ItemBytes) {
+			size = int64(event.ItemBytes[i])
+		} else {
+			size = encodedSize(item)
+		}
+		if size < 0 {
+			continue
+		}
+		p.bytes.observe(size)
+		p.contexts.observe(int64(len(iglu.ContextEntities(item))))
+	}
+}
+
+// encodedSize returns the length of an item's JSON encoding, counted as it is
+// written rather than held, or -1 if it cannot be encoded
+func encodedSize(item map[string]interface{}) int64 {
+	counter := &countingWriter{w: io.Discard}
+	if err := json.NewEncoder(counter).Encode(item); err != nil {
+		return -1
+	}
+	// Encode ends the value with a newline
+	return counter.n - 1
+}
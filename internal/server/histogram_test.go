@@ -0,0 +1,41 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPayloadHistogramsUseReceivedSizes(t *testing.T) {
+	p := newPayloadHistograms()
+	p.record(Event{
+		Data:      []map[string]interface{}{{"e": "pv"}, {"e": "pp"}},
+		ItemBytes: []int{300, 5000},
+	})
+	bytes := p.bytes.snapshot()
+	if bytes.Count != 2 || bytes.Sum != 5300 || bytes.Max != 5000 {
+		t.Errorf("unexpected histogram: %+v", bytes)
+	}
+}
+
+func TestPayloadHistogramsEncodeUnsizedItems(t *testing.T) {
+	item := map[string]interface{}{"e": "se", "se_ca": "shop", "url": "https://shop.acme.com/?a=1&b=<2>"}
+	encoded, _ := json.Marshal(item)
+
+	p := newPayloadHistograms()
+	p.record(Event{Data: []map[string]interface{}{item}})
+	if sum := p.bytes.snapshot().Sum; sum != int64(len(encoded)) {
+		t.Errorf("sized the item at %d bytes, want %d", sum, len(encoded))
+	}
+}
+
+func TestAddEventDropsItemSizes(t *testing.T) {
+	s := newTestServer(t)
+	s.AddEventRecord(Event{Data: []map[string]interface{}{{"e": "pv"}}, ItemBytes: []int{42}})
+	events := s.GetEvents()
+	if len(events) != 1 || events[0].ItemBytes != nil {
+		t.Errorf("unexpected events: %+v", events)
+	}
+	if sum := s.payloads.bytes.snapshot().Sum; sum != 42 {
+		t.Errorf("recorded %d bytes, want 42", sum)
+	}
+}
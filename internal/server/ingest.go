@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+// Policies for tracker requests that arrive while the ingest queue is full
+const (
+	// IngestOverflowBlock waits for room in the queue, slowing trackers down
+	IngestOverflowBlock = "block"
+	// IngestOverflowReject answers 503 so trackers retry the request later
+	IngestOverflowReject = "reject"
+	// IngestOverflowInline processes the request's events in the handler
+	IngestOverflowInline = "inline"
+)
+
+// defaultIngestQueueSize is the number of requests that can wait for an ingest worker
+const defaultIngestQueueSize = 1024
+
+// ErrIngestQueueFull is returned by IngestEvents when the queue is full and
+// the overflow policy is reject
+var ErrIngestQueueFull = errors.New("ingest queue is full")
+
+// ingestJob is one tracker request's events, queued for an ingest worker
+type ingestJob struct {
+	// ctx carries the request's values, without its cancellation, as the
+	// request has been answered by the time the job runs
+	ctx    context.Context
+	events []Event
+	// done, if set, runs once the events are stored
+	done func()
+}
+
+// ingestQueue hands accepted requests to the ingest workers
+type ingestQueue struct {
+	// mutex is held for reading while a request is queued, so the queue is not
+	// closed under it
+	mutex   sync.RWMutex
+	jobs    chan ingestJob
+	workers sync.WaitGroup
+	closed  bool
+}
+
+// ingestOverflow returns the configured policy for a full ingest queue
+func (s *AppServer) ingestOverflow() string {
+	if s.config.IngestOverflow == "" {
+		return IngestOverflowBlock
+	}
+	return s.config.IngestOverflow
+}
+
+// StartIngestWorkers starts the configured pool of ingest workers, which
+// enrich, validate, store and broadcast events after the tracker request has
+// been answered
+// Without ingest_workers, events are processed in the request handler
+func (s *AppServer) StartIngestWorkers() {
+	workers := s.config.IngestWorkers
+	if workers < 1 {
+		return
+	}
+	size := s.config.IngestQueueSize
+	if size < 1 {
+		size = defaultIngestQueueSize
+	}
+
+	s.ingest.jobs = make(chan ingestJob, size)
+	for i := 0; i < workers; i++ {
+		s.ingest.workers.Add(1)
+		go func() {
+			defer s.ingest.workers.Done()
+			for job := range s.ingest.jobs {
+				s.runIngestJob(job)
+			}
+		}()
+	}
+	log.Printf("Processing events on %d ingest workers (queue of %d requests, %s when full)\n", workers, size, s.ingestOverflow())
+}
+
+// StopIngestWorkers processes the events still queued and stops the workers
+// Events ingested afterwards are processed in the request handler
+func (s *AppServer) StopIngestWorkers() {
+	s.ingest.mutex.Lock()
+	if s.ingest.jobs == nil || s.ingest.closed {
+		s.ingest.mutex.Unlock()
+		return
+	}
+	s.ingest.closed = true
+	close(s.ingest.jobs)
+	s.ingest.mutex.Unlock()
+
+	s.ingest.workers.Wait()
+}
+
+// IngestEvents stores the events of one tracker request, in order
+// With ingest workers running the events are queued and processed later; when
+// the queue is full the ingest_overflow policy applies, and ErrIngestQueueFull
+// is returned if it rejects the request
+func (s *AppServer) IngestEvents(ctx context.Context, events []Event) error {
+	return s.ingestEvents(ctx, events, nil)
+}
+
+// ingestEvents is IngestEvents, running done once the events are stored
+func (s *AppServer) ingestEvents(ctx context.Context, events []Event, done func()) error {
+	s.ingest.mutex.RLock()
+	defer s.ingest.mutex.RUnlock()
+
+	storeNow := func() {
+		s.storeEvents(ctx, events)
+		if done != nil {
+			done()
+		}
+	}
+	if s.ingest.jobs == nil || s.ingest.closed {
+		storeNow()
+		return nil
+	}
+
+	// Events are timestamped on arrival, not when a worker gets to them
+	now := s.Now()
+	for i := range events {
+		if events[i].Timestamp.IsZero() {
+			events[i].Timestamp = now
+		}
+	}
+
+	job := ingestJob{ctx: context.WithoutCancel(ctx), events: events, done: done}
+	select {
+	case s.ingest.jobs <- job:
+		return nil
+	default:
+	}
+
+	s.CountMetric(MetricIngestOverflows, "")
+	switch s.ingestOverflow() {
+	case IngestOverflowReject:
+		return ErrIngestQueueFull
+	case IngestOverflowInline:
+		storeNow()
+		return nil
+	default:
+		select {
+		case s.ingest.jobs <- job:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// IngestStream collects the events of one tracker request as they are
+// decoded, and stores them once the whole request has been read and accepted,
+// so a request that fails part way stores nothing and the tracker's retry
+// does not duplicate its first events
+type IngestStream struct {
+	s      *AppServer
+	ctx    context.Context
+	events []Event
+	// batchID is the batch of the stream's events, if they were split from one
+	batchID string
+}
+
+// NewIngestStream returns a stream for the events of the request with ctx
+func (s *AppServer) NewIngestStream(ctx context.Context) *IngestStream {
+	return &IngestStream{s: s, ctx: ctx}
+}
+
+// Add holds an event back until the stream is committed
+func (st *IngestStream) Add(event Event) {
+	if event.Batch != nil {
+		st.batchID = event.Batch.ID
+	}
+	st.events = append(st.events, event)
+}
+
+// Discard drops the events held back, for a request that is rejected
+func (st *IngestStream) Discard() {
+	st.events = nil
+}
+
+// Commit stores the events held back as IngestEvents does, returning
+// ErrIngestQueueFull if the ingest_overflow policy rejects them; batchSize is
+// the number of items of the batch they were split from, recorded on them
+// once they are all stored
+func (st *IngestStream) Commit(batchSize int) error {
+	events := st.events
+	st.events = nil
+	var done func()
+	if st.batchID != "" && batchSize > 0 {
+		batchID := st.batchID
+		done = func() { st.s.CompleteBatch(batchID, batchSize) }
+	}
+	return st.s.ingestEvents(st.ctx, events, done)
+}
+
+// IngestQueueDepth returns the number of requests waiting for an ingest worker
+func (s *AppServer) IngestQueueDepth() int {
+	return len(s.ingest.jobs)
+}
+
+// runIngestJob stores a queued request's events on an ingest worker,
+// recovering from panics so the worker goes on with the next job
+func (s *AppServer) runIngestJob(job ingestJob) {
+	defer s.recoverTask("ingest")
+	for _, event := range job.events {
+		s.storeQueuedEvent(job.ctx, event)
+	}
+	if job.done != nil {
+		job.done()
+	}
+}
+
+// storeQueuedEvent adds an event taken from the ingest queue to the buffer,
+// recording a panic on it as a goplow error event instead of losing the
+// request's later events
+func (s *AppServer) storeQueuedEvent(ctx context.Context, event Event) {
+	defer s.recoverTask("ingest")
+	s.AddEventRecordContext(ctx, event)
+}
+
+// storeEvents adds each event to the buffer
+func (s *AppServer) storeEvents(ctx context.Context, events []Event) {
+	for _, event := range events {
+		s.AddEventRecordContext(ctx, event)
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+)
+
+// InternalErrorSchema is the schema of the events recording requests and
+// background work that failed inside goplow, which notifications can select with
+// event_types = ["goplow/error"]
+const InternalErrorSchema = "goplow/error"
+
+// InternalError describes a request whose handler panicked, or background
+// work that panicked outside a request
+type InternalError struct {
+	Method string
+	Path   string
+	// Task names the background work that panicked, such as "ingest" or
+	// "broadcast"; it is empty for requests
+	Task string
+	// Panic is the value the handler panicked with
+	Panic interface{}
+	// Stack is the goroutine's stack trace at the panic
+	Stack string
+}
+
+// RecordInternalError adds a request that failed inside goplow to the
+// timeline as an InternalErrorSchema event, so it shows in the web interface
+// alongside the events that led up to it
+func (s *AppServer) RecordInternalError(failure InternalError) {
+	data := map[string]interface{}{
+		"kind":        "goplow error",
+		"error":       fmt.Sprint(failure.Panic),
+		"stack_trace": strings.Split(strings.TrimRight(failure.Stack, "\n"), "\n"),
+	}
+	if failure.Task != "" {
+		data["task"] = failure.Task
+		data["message"] = fmt.Sprintf("%s failed: %v", failure.Task, failure.Panic)
+	} else {
+		data["method"] = failure.Method
+		data["path"] = failure.Path
+		data["message"] = fmt.Sprintf("%s %s failed: %v", failure.Method, failure.Path, failure.Panic)
+	}
+	s.addEvent(context.Background(), Event{
+		Schema:    InternalErrorSchema,
+		Data:      []map[string]interface{}{data},
+		Timestamp: s.Now(),
+	})
+}
+
+// recoverTask recovers a panic in the background work named task, so one bad
+// event does not stop the worker running it; the panic is logged with its
+// stack trace and recorded as a goplow error event
+// Call it deferred
+func (s *AppServer) recoverTask(task string) {
+	if recovered := recover(); recovered != nil {
+		s.taskFailed(task, recovered, string(debug.Stack()), true)
+	}
+}
+
+// taskFailed logs a panic in background work with its stack trace and, if
+// record is set, records it as a goplow error event
+func (s *AppServer) taskFailed(task string, recovered interface{}, stack string, record bool) {
+	log.Printf("Panic in %s: %v\n%s", task, recovered, stack)
+	if record {
+		s.RecordInternalError(InternalError{Task: task, Panic: recovered, Stack: stack})
+	}
+}
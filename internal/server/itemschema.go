@@ -0,0 +1,40 @@
+package server
+
+import "goplow/internal/iglu"
+
+// trackerEventSchemas are the schemas of the tracker's built-in event types,
+// by e value, named as in the atomic event_name column
+var trackerEventSchemas = map[string]string{
+	"pv": "iglu:com.snowplowanalytics.snowplow/page_view/jsonschema/1-0-0",
+	"pp": "iglu:com.snowplowanalytics.snowplow/page_ping/jsonschema/1-0-0",
+	"se": "iglu:com.snowplowanalytics.snowplow/struct/jsonschema/1-0-0",
+	"tr": "iglu:com.snowplowanalytics.snowplow/transaction/jsonschema/1-0-0",
+	"ti": "iglu:com.snowplowanalytics.snowplow/transaction_item/jsonschema/1-0-0",
+}
+
+// ItemSchema returns the schema of a single payload item, independent of the
+// payload_data envelope it arrived in: the inner schema of a self-describing
+// (ue) event, or the schema of the tracker's event type (e.g. page_view for
+// pv), or "" if the item has neither
+func ItemSchema(item map[string]interface{}) string {
+	if schema, _, ok := iglu.SelfDescribingEvent(item); ok {
+		return schema
+	}
+	eventType, _ := item["e"].(string)
+	return trackerEventSchemas[eventType]
+}
+
+// FilterEventsByEventSchema returns the events whose item schema matches, by
+// full Iglu URI or by schema key (e.g. "com.acme/checkout")
+func FilterEventsByEventSchema(events []Event, schema string) []Event {
+	filtered := make([]Event, 0)
+	for _, event := range events {
+		if event.EventSchema == "" {
+			continue
+		}
+		if event.EventSchema == schema || iglu.SchemaKey(event.EventSchema) == schema {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultLanguage is served for unknown languages, and fills in labels that a
+// language's bundle lacks
+const DefaultLanguage = "en"
+
+//go:embed labels
+var embeddedLabels embed.FS
+
+// labelBundles maps lowercase language tags (e.g. "de", "pt-br") to their labels
+type labelBundles map[string]map[string]string
+
+// LoadLabels reads the embedded label bundles, then merges the <lang>.json files
+// of labels_dir over them, so users can override labels or add languages
+func (s *AppServer) LoadLabels() error {
+	bundles := make(labelBundles)
+	entries, err := embeddedLabels.ReadDir("labels")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		raw, err := embeddedLabels.ReadFile("labels/" + entry.Name())
+		if err != nil {
+			return err
+		}
+		if err := bundles.merge(entry.Name(), raw); err != nil {
+			return err
+		}
+	}
+
+	if dir := s.config.LabelsDir; dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := bundles.merge(filepath.Base(path), raw); err != nil {
+				return err
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	s.labels = bundles
+	s.mutex.Unlock()
+	return nil
+}
+
+// merge adds the labels of a <lang>.json file, replacing existing ones
+func (b labelBundles) merge(name string, raw []byte) error {
+	var labels map[string]string
+	if err := json.Unmarshal(raw, &labels); err != nil {
+		return fmt.Errorf("error reading labels %s: %w", name, err)
+	}
+	lang := strings.ToLower(strings.TrimSuffix(name, ".json"))
+	if b[lang] == nil {
+		b[lang] = make(map[string]string, len(labels))
+	}
+	for key, label := range labels {
+		b[lang][key] = label
+	}
+	return nil
+}
+
+// Labels returns the labels for the closest available language to lang (e.g.
+// "de-CH" falls back to "de", then to English), with the language chosen
+// Labels missing from the language's bundle are filled in from English
+func (s *AppServer) Labels(lang string) (string, map[string]string) {
+	s.mutex.RLock()
+	bundles := s.labels
+	s.mutex.RUnlock()
+
+	chosen := DefaultLanguage
+	lang = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+	if _, ok := bundles[lang]; ok {
+		chosen = lang
+	} else if primary, _, _ := strings.Cut(lang, "-"); bundles[primary] != nil {
+		chosen = primary
+	}
+
+	labels := make(map[string]string, len(bundles[DefaultLanguage]))
+	for key, label := range bundles[DefaultLanguage] {
+		labels[key] = label
+	}
+	for key, label := range bundles[chosen] {
+		labels[key] = label
+	}
+	return chosen, labels
+}
+
+// LabelLanguages lists the languages with label bundles, sorted
+func (s *AppServer) LabelLanguages() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	languages := make([]string, 0, len(s.labels))
+	for lang := range s.labels {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
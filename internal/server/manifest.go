@@ -0,0 +1,273 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"goplow/internal/iglu"
+)
+
+// Version is the goplow version recorded in capture manifests, set at build time
+// with -ldflags "-X goplow/internal/server.Version=v1.2.3"
+// Other builds are labelled with the VCS revision they were built from, if known
+var Version = ""
+
+// manifestExtension replaces the archive extension to name an archive's manifest
+const manifestExtension = ".manifest.json"
+
+// ErrManifestNotFound is returned for archives written without a manifest
+var ErrManifestNotFound = errors.New("manifest not found")
+
+// Manifest describes a capture, so it can be reproduced and compared with
+// captures from other machines
+type Manifest struct {
+	GoplowVersion string    `json:"goplowVersion"`
+	CreatedAt     time.Time `json:"createdAt"`
+	// Archive names the archive the manifest was written with; empty for exports
+	// of the buffer
+	Archive string `json:"archive,omitempty"`
+	Events  int    `json:"events"`
+	// TrackerEvents counts payload items, as batched events hold several
+	TrackerEvents int            `json:"trackerEvents"`
+	EventTypes    map[string]int `json:"eventTypes"`
+	Sessions      []string       `json:"sessions,omitempty"`
+	// TimeRange spans the times the events were received; nil if there are none
+	TimeRange *ManifestTimeRange `json:"timeRange,omitempty"`
+	// IDRange spans the IDs of the events; nil if there are none
+	IDRange *ManifestIDRange `json:"idRange,omitempty"`
+	// File is the archive or export file the manifest describes, with its checksum
+	File    *ManifestFile    `json:"file,omitempty"`
+	Schemas []ManifestSchema `json:"schemas"`
+	// Config is the resolved configuration at capture time, with secrets masked
+	Config []ConfigSetting `json:"config"`
+}
+
+// ManifestTimeRange is the span of a capture's events
+type ManifestTimeRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// ManifestIDRange is the span of a capture's event IDs
+type ManifestIDRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// ManifestFile is the file a manifest was written with
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Bytes  int64  `json:"bytes"`
+	// SHA256 is the hex-encoded SHA-256 checksum of the file's content
+	SHA256 string `json:"sha256"`
+}
+
+// NewManifestFile describes a file in the format with the given content
+func NewManifestFile(name string, format string, content []byte) *ManifestFile {
+	sum := sha256.Sum256(content)
+	return &ManifestFile{Name: name, Format: format, Bytes: int64(len(content)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+// ManifestSchema is a schema referenced by a capture's events, with the state of
+// the local schema registry for it
+type ManifestSchema struct {
+	Schema string `json:"schema"`
+	// Events counts the events that reference the schema
+	Events     int  `json:"events"`
+	InRegistry bool `json:"inRegistry"`
+	// RegistryLatest is the newest version of the schema in the registry
+	RegistryLatest string `json:"registryLatest,omitempty"`
+}
+
+// SetSchemaRegistry sets the Iglu registry, laid out as vendor/name/format/version,
+// that capture manifests record schema versions from
+func (s *AppServer) SetSchemaRegistry(schemas fs.FS) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.schemas = schemas
+}
+
+// BuildManifest describes the given events and the current configuration
+func (s *AppServer) BuildManifest(events []Event) Manifest {
+	s.mutex.RLock()
+	schemas := s.schemas
+	s.mutex.RUnlock()
+
+	manifest := Manifest{
+		GoplowVersion: goplowVersion(),
+		CreatedAt:     s.Now().UTC(),
+		Events:        len(events),
+		EventTypes:    make(map[string]int),
+		Sessions:      sessionNames(events),
+		Schemas:       make([]ManifestSchema, 0),
+		Config:        s.GetConfigSettings(),
+	}
+
+	schemaEvents := make(map[string]int)
+	for _, event := range events {
+		manifest.TrackerEvents += len(event.Data)
+		manifest.EventTypes[eventTypeLabel(event)]++
+		if manifest.TimeRange == nil {
+			manifest.TimeRange = &ManifestTimeRange{From: event.ReceivedAt, To: event.ReceivedAt}
+		} else if event.ReceivedAt.Before(manifest.TimeRange.From) {
+			manifest.TimeRange.From = event.ReceivedAt
+		} else if event.ReceivedAt.After(manifest.TimeRange.To) {
+			manifest.TimeRange.To = event.ReceivedAt
+		}
+		if manifest.IDRange == nil {
+			manifest.IDRange = &ManifestIDRange{From: event.ID, To: event.ID}
+		} else {
+			manifest.IDRange.From = min(manifest.IDRange.From, event.ID)
+			manifest.IDRange.To = max(manifest.IDRange.To, event.ID)
+		}
+		for schema := range eventSchemas(event) {
+			schemaEvents[schema]++
+		}
+	}
+
+	for schema, count := range schemaEvents {
+		entry := ManifestSchema{Schema: schema, Events: count}
+		if schemas != nil {
+			entry.InRegistry, entry.RegistryLatest = registryVersions(schemas, schema)
+		}
+		manifest.Schemas = append(manifest.Schemas, entry)
+	}
+	sort.Slice(manifest.Schemas, func(i, j int) bool { return manifest.Schemas[i].Schema < manifest.Schemas[j].Schema })
+	return manifest
+}
+
+// eventSchemas returns the set of schemas an event references: its own, and
+// those of its self-describing events and context entities
+func eventSchemas(event Event) map[string]bool {
+	schemas := make(map[string]bool)
+	if event.Schema != "" {
+		schemas[event.Schema] = true
+	}
+	for _, item := range event.Data {
+		if schema, _, ok := iglu.SelfDescribingEvent(item); ok {
+			schemas[schema] = true
+		}
+		for _, entity := range iglu.ContextEntities(item) {
+			schemas[entity.Schema] = true
+		}
+	}
+	return schemas
+}
+
+// registryVersions reports whether the registry holds a schema, and the newest
+// version it holds of the same vendor, name and format
+func registryVersions(schemas fs.FS, schema string) (bool, string) {
+	schemaPath, ok := iglu.SchemaPath(schema)
+	if !ok {
+		return false, ""
+	}
+	_, err := fs.Stat(schemas, schemaPath)
+	found := err == nil
+
+	entries, err := fs.ReadDir(schemas, path.Dir(schemaPath))
+	if err != nil {
+		return found, ""
+	}
+	latest := ""
+	for _, entry := range entries {
+		if !entry.IsDir() && (latest == "" || newerSchemaVersion(entry.Name(), latest)) {
+			latest = entry.Name()
+		}
+	}
+	return found, latest
+}
+
+// newerSchemaVersion reports whether SchemaVer a (model-revision-addition) is
+// newer than b
+func newerSchemaVersion(a string, b string) bool {
+	aParts, bParts := strings.Split(a, "-"), strings.Split(b, "-")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNumber, aErr := strconv.Atoi(aParts[i])
+		bNumber, bErr := strconv.Atoi(bParts[i])
+		if aErr != nil || bErr != nil {
+			return a > b
+		}
+		if aNumber != bNumber {
+			return aNumber > bNumber
+		}
+	}
+	return len(aParts) > len(bParts)
+}
+
+// goplowVersion returns the build's version, e.g. "v1.2.3" or "dev+1a2b3c4d5e6f"
+func goplowVersion() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value[:min(12, len(setting.Value))]
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	version := "dev"
+	if revision != "" {
+		version += "+" + revision
+	}
+	if modified {
+		version += "-dirty"
+	}
+	return version
+}
+
+// manifestPath returns the path of an archive's manifest
+func manifestPath(archivePath string) string {
+	return strings.TrimSuffix(archivePath, archiveExtension) + manifestExtension
+}
+
+// writeManifest writes a manifest next to its archive
+func writeManifest(archivePath string, manifest Manifest) error {
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath(archivePath), append(encoded, '\n'), 0o644)
+}
+
+// ReadArchiveManifest returns the manifest written with the named archive
+func (s *AppServer) ReadArchiveManifest(name string) (Manifest, error) {
+	var manifest Manifest
+	archivePath, err := s.ArchivePath(name)
+	if err != nil {
+		return manifest, err
+	}
+	return readManifestFile(archivePath)
+}
+
+// readManifestFile reads the manifest written next to the archive at archivePath
+func readManifestFile(archivePath string) (Manifest, error) {
+	var manifest Manifest
+	encoded, err := os.ReadFile(manifestPath(archivePath))
+	if os.IsNotExist(err) {
+		return manifest, ErrManifestNotFound
+	}
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(encoded, &manifest)
+	return manifest, err
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"strconv"
+)
+
+// MarkerSchema is the schema used for timeline marker events
+const MarkerSchema = "goplow/marker"
+
+// AddMarker inserts a labelled marker into the event timeline and SSE stream
+func (s *AppServer) AddMarker(label string) Event {
+	now := s.Now()
+	return s.addEvent(context.Background(), Event{
+		Schema: MarkerSchema,
+		Data: []map[string]interface{}{
+			{
+				"kind":  "Marker",
+				"label": label,
+			},
+		},
+		Timestamp: now,
+	})
+}
+
+// markerLabel returns the label of a marker event
+func markerLabel(event Event) string {
+	if len(event.Data) == 0 {
+		return ""
+	}
+	label, _ := event.Data[0]["label"].(string)
+	return label
+}
+
+// GetEventsSinceMarker returns the events after the most recent marker matching ref,
+// which may be a marker event ID or label. The marker itself is not included.
+// The second return value is false if no matching marker is buffered.
+func (s *AppServer) GetEventsSinceMarker(ref string) ([]Event, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	markerID, idErr := strconv.Atoi(ref)
+
+	for i := len(s.events) - 1; i >= 0; i-- {
+		event := s.events[i]
+		if event.Schema != MarkerSchema {
+			continue
+		}
+		if (idErr == nil && event.ID == markerID) || markerLabel(event) == ref {
+			evts := make([]Event, len(s.events)-i-1)
+			copy(evts, s.events[i+1:])
+			return evts, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"sort"
+	"strings"
+)
+
+// Internal counters of events goplow itself lost or failed to process
+const (
+	// MetricEvicted counts events pushed out of the buffer by max_messages
+	MetricEvicted = "events_evicted_total"
+	// MetricSSEDropped counts events that could not be sent to an SSE client
+	MetricSSEDropped = "sse_events_dropped_total"
+	// MetricSSESlowDisconnects counts SSE clients disconnected for falling behind
+	MetricSSESlowDisconnects = "sse_slow_clients_disconnected_total"
+	// MetricForwardFailures counts events that were not forwarded to the aggregator,
+	// labelled with the reason
+	MetricForwardFailures = "forward_failures_total"
+	// MetricNotificationFailures counts events a notification could not be sent
+	// for, labelled with the notification's name
+	MetricNotificationFailures = "notification_failures_total"
+	// MetricTransformErrors counts events a transform stage failed on, labelled with the stage
+	MetricTransformErrors = "transform_errors_total"
+	// MetricIngestOverflows counts tracker requests that arrived while the ingest queue was full
+	MetricIngestOverflows = "ingest_queue_overflows_total"
+)
+
+// MetricHelp describes each internal counter
+var MetricHelp = map[string]string{
+	MetricEvicted:              "Events evicted from the buffer because max_messages was reached.",
+	MetricSSEDropped:           "Events that could not be delivered to an SSE client.",
+	MetricSSESlowDisconnects:   "SSE clients disconnected because their send queue was full.",
+	MetricForwardFailures:      "Events that could not be forwarded to the aggregator.",
+	MetricNotificationFailures: "Events a notification could not be sent for.",
+	MetricTransformErrors:      "Events a display transform stage failed on.",
+	MetricIngestOverflows:      "Tracker requests that arrived while the ingest queue was full.",
+}
+
+// MetricLabels names the label of each labelled counter
+var MetricLabels = map[string]string{
+	MetricForwardFailures:      "reason",
+	MetricNotificationFailures: "notification",
+	MetricTransformErrors:      "stage",
+}
+
+// MetricValue is one labelled value of a counter
+type MetricValue struct {
+	Label string
+	Value int
+}
+
+// metrics holds the internal counters, keyed by name and label value
+type metrics struct {
+	counters shardedCounts
+}
+
+// metricKey joins a counter name and label value into one key
+func metricKey(name string, label string) string {
+	return name + "\x00" + label
+}
+
+// CountMetric increments an internal counter
+// label is the value of the counter's label, or "" for unlabelled counters
+func (s *AppServer) CountMetric(name string, label string) {
+	s.metrics.counters.add(metricKey(name, label))
+}
+
+// metricTotal returns the sum of a counter over all its labels
+func (s *AppServer) metricTotal(name string) int {
+	_, counts := s.metrics.counters.snapshot()
+	total := 0
+	for key, value := range counts {
+		if strings.HasPrefix(key, name+"\x00") {
+			total += value
+		}
+	}
+	return total
+}
+
+// GetMetrics returns every internal counter, including those never incremented,
+// with values sorted by label
+func (s *AppServer) GetMetrics() map[string][]MetricValue {
+	_, counts := s.metrics.counters.snapshot()
+
+	result := make(map[string][]MetricValue)
+	for name := range MetricHelp {
+		result[name] = make([]MetricValue, 0)
+	}
+	for key, value := range counts {
+		name, label, _ := strings.Cut(key, "\x00")
+		if _, known := MetricHelp[name]; !known {
+			continue
+		}
+		result[name] = append(result[name], MetricValue{Label: label, Value: value})
+	}
+	for name, values := range result {
+		sort.Slice(values, func(i, j int) bool { return values[i].Label < values[j].Label })
+		if len(values) == 0 && MetricLabels[name] == "" {
+			values = append(values, MetricValue{})
+		}
+		result[name] = values
+	}
+	return result
+}
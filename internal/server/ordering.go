@@ -0,0 +1,93 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// defaultOutOfOrderThreshold is used when out_of_order_threshold is unset or invalid
+const defaultOutOfOrderThreshold = 5 * time.Second
+
+// parseTrackerTimestamp parses a tracker millisecond timestamp field such as dtm or stm
+func parseTrackerTimestamp(item map[string]interface{}, field string) (time.Time, bool) {
+	var millis int64
+	switch v := item[field].(type) {
+	case string:
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		millis = parsed
+	case float64:
+		millis = int64(v)
+	default:
+		return time.Time{}, false
+	}
+	return time.UnixMilli(millis).UTC(), true
+}
+
+// deviceTimestamp derives the device-side time of an event the way the Snowplow
+// pipeline does: if both dtm (created) and stm (sent) are present, the derived
+// timestamp is receivedAt minus the time the event spent queued on the device;
+// otherwise dtm is used as-is
+func deviceTimestamp(event Event) (time.Time, bool) {
+	if len(event.Data) == 0 {
+		return time.Time{}, false
+	}
+	item := event.Data[0]
+
+	created, ok := parseTrackerTimestamp(item, "dtm")
+	if !ok {
+		return time.Time{}, false
+	}
+	if sent, ok := parseTrackerTimestamp(item, "stm"); ok && !event.ReceivedAt.IsZero() {
+		return event.ReceivedAt.Add(-sent.Sub(created)), true
+	}
+	return created, true
+}
+
+// deviceKey groups events by device so out-of-order detection is per tracker queue
+func deviceKey(event Event) string {
+	if len(event.Data) == 0 {
+		return ""
+	}
+	if duid, ok := event.Data[0]["duid"].(string); ok {
+		return duid
+	}
+	return ""
+}
+
+// flagOutOfOrder sets the device timestamp on the event and flags it if it is
+// significantly older than the latest device timestamp seen for the same device.
+// Must be called with the events mutex held.
+func (s *AppServer) flagOutOfOrder(event *Event) {
+	deviceTime, ok := deviceTimestamp(*event)
+	if !ok {
+		return
+	}
+	event.DeviceTimestamp = &deviceTime
+
+	key := deviceKey(*event)
+	latest, seen := s.latestDeviceTime[key]
+	if seen && latest.Sub(deviceTime) > s.outOfOrderThreshold {
+		event.OutOfOrder = true
+	}
+	if !seen || deviceTime.After(latest) {
+		s.latestDeviceTime[key] = deviceTime
+	}
+}
+
+// SortEventsByDeviceTime orders events by their device timestamp, falling back
+// to the arrival time for events without one
+func SortEventsByDeviceTime(events []Event) {
+	sortTime := func(event Event) time.Time {
+		if event.DeviceTimestamp != nil {
+			return *event.DeviceTimestamp
+		}
+		return event.ReceivedAt
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return sortTime(events[i]).Before(sortTime(events[j]))
+	})
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// Page selects a window of a list in ascending ID order, from the ?after_id=,
+// ?before_id= and ?limit= parameters
+// IDs are never reused, so cursors stay valid while events arrive and are evicted
+type Page struct {
+	AfterID  int
+	BeforeID int
+	Limit    int
+}
+
+// ParsePage reads the pagination parameters, reporting false if none are given
+func ParsePage(query url.Values) (Page, bool, error) {
+	var page Page
+	given := false
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{{"after_id", &page.AfterID}, {"before_id", &page.BeforeID}, {"limit", &page.Limit}} {
+		raw := query.Get(param.name)
+		if raw == "" {
+			continue
+		}
+		number, err := strconv.Atoi(raw)
+		if err != nil || number < 1 {
+			return page, false, fmt.Errorf("%s must be a positive integer", param.name)
+		}
+		*param.value = number
+		given = true
+	}
+	return page, given, nil
+}
+
+// Window returns the bounds [start, end) of the page within n items whose IDs,
+// given by id, ascend
+// With only before_id, the page is the limit items closest before it, so
+// paging backwards walks towards older items
+func (p Page) Window(n int, id func(i int) int) (int, int) {
+	start, end := 0, n
+	if p.AfterID > 0 {
+		start = sort.Search(n, func(i int) bool { return id(i) > p.AfterID })
+	}
+	if p.BeforeID > 0 {
+		end = sort.Search(n, func(i int) bool { return id(i) >= p.BeforeID })
+	}
+	if end < start {
+		end = start
+	}
+	if p.Limit > 0 && end-start > p.Limit {
+		if p.BeforeID > 0 && p.AfterID == 0 {
+			start = end - p.Limit
+		} else {
+			end = start + p.Limit
+		}
+	}
+	return start, end
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// preferencesFile holds the saved dashboard preferences in the data directory
+const preferencesFile = "preferences.json"
+
+// Preferences are dashboard settings saved on the server, so they survive
+// browser storage clears and follow users across machines
+type Preferences struct {
+	// Theme is "light", "dark" or "system"
+	Theme string `json:"theme,omitempty"`
+	// Columns lists the event fields shown in the list, in order
+	Columns []string `json:"columns,omitempty"`
+	// Filters are the list filters applied on load, keyed by query parameter
+	// (e.g. "ns" or "run_id")
+	Filters map[string]string `json:"filters,omitempty"`
+}
+
+// Validate checks the preference values
+func (p Preferences) Validate() error {
+	switch p.Theme {
+	case "", "light", "dark", "system":
+	default:
+		return fmt.Errorf("theme %q must be light, dark or system", p.Theme)
+	}
+	for _, column := range p.Columns {
+		if column == "" {
+			return fmt.Errorf("columns must not be empty")
+		}
+	}
+	return nil
+}
+
+// over returns p with its unset settings taken from defaults
+func (p Preferences) over(defaults Preferences) Preferences {
+	if p.Theme == "" {
+		p.Theme = defaults.Theme
+	}
+	if p.Columns == nil {
+		p.Columns = defaults.Columns
+	}
+	if p.Filters == nil {
+		p.Filters = defaults.Filters
+	}
+	return p
+}
+
+// savedPreferences is the layout of the preferences file
+type savedPreferences struct {
+	Global Preferences            `json:"global"`
+	Users  map[string]Preferences `json:"users,omitempty"`
+}
+
+// GetPreferences returns the global preferences, or a user's preferences over
+// them if user is set
+func (s *AppServer) GetPreferences(user string) (Preferences, error) {
+	s.preferencesMutex.Lock()
+	defer s.preferencesMutex.Unlock()
+
+	saved, err := s.readPreferences()
+	if err != nil {
+		return Preferences{}, err
+	}
+	if user == "" {
+		return saved.Global, nil
+	}
+	return saved.Users[user].over(saved.Global), nil
+}
+
+// SetPreferences replaces the global preferences, or a user's if user is set
+func (s *AppServer) SetPreferences(user string, preferences Preferences, actor Actor) error {
+	if err := preferences.Validate(); err != nil {
+		return err
+	}
+
+	s.preferencesMutex.Lock()
+	defer s.preferencesMutex.Unlock()
+
+	saved, err := s.readPreferences()
+	if err != nil {
+		return err
+	}
+	if user == "" {
+		saved.Global = preferences
+	} else {
+		if saved.Users == nil {
+			saved.Users = make(map[string]Preferences)
+		}
+		saved.Users[user] = preferences
+	}
+	if err := s.writePreferences(saved); err != nil {
+		return err
+	}
+
+	scope := "global"
+	if user != "" {
+		scope = "user"
+	}
+	s.Audit(AuditPreferences, actor, map[string]interface{}{"scope": scope})
+	return nil
+}
+
+// readPreferences reads the preferences file; callers must hold preferencesMutex
+func (s *AppServer) readPreferences() (savedPreferences, error) {
+	var saved savedPreferences
+	content, err := os.ReadFile(filepath.Join(s.config.DataDir, preferencesFile))
+	if os.IsNotExist(err) {
+		return saved, nil
+	}
+	if err != nil {
+		return saved, err
+	}
+	err = json.Unmarshal(content, &saved)
+	return saved, err
+}
+
+// writePreferences replaces the preferences file through a temporary file, so
+// a failed write never loses the saved preferences; callers must hold
+// preferencesMutex
+func (s *AppServer) writePreferences(saved savedPreferences) error {
+	path, err := s.config.DataPath(preferencesFile)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".preferences-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(append(encoded, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
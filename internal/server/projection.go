@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// FieldPaths are the dot-separated paths of a ?fields= projection, e.g.
+// "id,schema,data.e"
+type FieldPaths [][]string
+
+// ParseFieldPaths parses a comma-separated list of dotted field paths
+func ParseFieldPaths(raw string) (FieldPaths, error) {
+	var paths FieldPaths
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		keys := strings.Split(field, ".")
+		for _, key := range keys {
+			if key == "" {
+				return nil, fmt.Errorf("invalid field %q", field)
+			}
+		}
+		paths = append(paths, keys)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("fields must list at least one field")
+	}
+	return paths, nil
+}
+
+// ProjectEvents returns only the selected fields of each event, as they appear
+// in its JSON
+// Paths through arrays apply to every element, so "data.e" selects the event
+// type of every payload item; fields an event lacks are left out
+func ProjectEvents(events []Event, paths FieldPaths) ([]interface{}, error) {
+	encoded, err := json.Marshal(events)
+	if err != nil {
+		return nil, err
+	}
+	var decoded []interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, err
+	}
+
+	projected := make([]interface{}, len(decoded))
+	for i, event := range decoded {
+		projected[i] = project(event, paths)
+	}
+	return projected, nil
+}
+
+// project selects the paths from a decoded JSON value, or returns nil if none of
+// them can be followed into it
+func project(value interface{}, paths FieldPaths) interface{} {
+	for _, path := range paths {
+		// A path ending here selects the whole value
+		if len(path) == 0 {
+			return value
+		}
+	}
+
+	switch value := value.(type) {
+	case []interface{}:
+		items := make([]interface{}, len(value))
+		for i, item := range value {
+			items[i] = project(item, paths)
+		}
+		return items
+	case map[string]interface{}:
+		children := make(map[string]FieldPaths)
+		for _, path := range paths {
+			children[path[0]] = append(children[path[0]], path[1:])
+		}
+		object := make(map[string]interface{}, len(children))
+		for key, rest := range children {
+			if child, ok := value[key]; ok {
+				if selected := project(child, rest); selected != nil {
+					object[key] = selected
+				}
+			}
+		}
+		return object
+	}
+	return nil
+}
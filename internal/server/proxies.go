@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// defaultTrustedProxies trusts only proxies on the same machine
+var defaultTrustedProxies = []string{"127.0.0.0/8", "::1/128"}
+
+// ParseNetworks parses CIDR ranges and single IP addresses
+func ParseNetworks(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address or CIDR range", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// IsTrustedProxy reports whether ip belongs to a configured trusted proxy,
+// whose X-Forwarded-* headers may be believed
+func (s *AppServer) IsTrustedProxy(ip string) bool {
+	return inNetworks(ip, s.trustedProxies)
+}
+
+// inNetworks reports whether ip belongs to any of networks
+func inNetworks(ip string, networks []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessList restricts a group of routes to client IPs
+// Deny entries win over allow entries; an empty allow list allows everyone else
+type accessList struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// newAccessList parses validated allow and deny settings
+func newAccessList(allow []string, deny []string) accessList {
+	allowNetworks, _ := ParseNetworks(allow)
+	denyNetworks, _ := ParseNetworks(deny)
+	return accessList{allow: allowNetworks, deny: denyNetworks}
+}
+
+// allows reports whether the client IP may use the routes
+func (l accessList) allows(ip string) bool {
+	if inNetworks(ip, l.deny) {
+		return false
+	}
+	return len(l.allow) == 0 || inNetworks(ip, l.allow)
+}
+
+// AllowsIngestFrom reports whether a client IP may send events to the ingest endpoints
+func (s *AppServer) AllowsIngestFrom(ip string) bool {
+	return s.ingestAccess.allows(ip)
+}
+
+// AllowsAdminFrom reports whether a client IP may use the web interface and API
+func (s *AppServer) AllowsAdminFrom(ip string) bool {
+	return s.adminAccess.allows(ip)
+}
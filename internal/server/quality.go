@@ -0,0 +1,168 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"path"
+	"strings"
+
+	"goplow/internal/iglu"
+)
+
+// QualityScore rates the tracking health of a set of events, such as those of
+// a test run or capture session, with one number teams can track over time
+// Rates are shares of tracker events, counting each item of a batch
+type QualityScore struct {
+	// Score is the mean of the rates below, as a percentage, with the duplicate
+	// and stale schema rates inverted; nil if there were no tracker events
+	Score         *float64 `json:"score"`
+	TrackerEvents int      `json:"trackerEvents"`
+	// ValidationPassRate is the share of tracker events without schema violations
+	ValidationPassRate float64 `json:"validationPassRate"`
+	// ContextCoverage is the share carrying every required context, or nil if
+	// required_contexts is not set
+	ContextCoverage *float64 `json:"contextCoverage"`
+	// MissingContexts counts the tracker events lacking each required context
+	MissingContexts map[string]int `json:"missingContexts,omitempty"`
+	// DuplicateRate is the share repeating the event ID (eid) of an earlier one
+	DuplicateRate float64 `json:"duplicateRate"`
+	// StaleSchemaRate is the share using a schema the registry has a newer
+	// version of
+	StaleSchemaRate float64 `json:"staleSchemaRate"`
+	// StaleSchemas maps each stale schema used to the registry's latest version
+	StaleSchemas map[string]string `json:"staleSchemas,omitempty"`
+}
+
+// ScoreQuality computes the data-quality score of events
+func (s *AppServer) ScoreQuality(events []Event) QualityScore {
+	s.mutex.RLock()
+	schemas := s.schemas
+	s.mutex.RUnlock()
+
+	required := s.config.RequiredContexts
+	score := QualityScore{StaleSchemas: make(map[string]string)}
+	if len(required) > 0 {
+		score.MissingContexts = make(map[string]int)
+	}
+
+	passed, covered, duplicates, stale := 0, 0, 0, 0
+	seenIDs := make(map[string]bool)
+	// latest caches the registry's latest version of each schema, or "" if it
+	// is current or unknown
+	latest := make(map[string]string)
+	for _, event := range events {
+		for i, item := range event.Data {
+			score.TrackerEvents++
+			if !itemViolated(event, i) {
+				passed++
+			}
+
+			entities := iglu.ContextEntities(item)
+			if len(required) > 0 {
+				complete := true
+				for _, schema := range required {
+					if !hasContext(entities, schema) {
+						score.MissingContexts[schema]++
+						complete = false
+					}
+				}
+				if complete {
+					covered++
+				}
+			}
+
+			if eid, _ := item["eid"].(string); eid != "" {
+				if seenIDs[eid] {
+					duplicates++
+				}
+				seenIDs[eid] = true
+			}
+
+			itemSchemas := make([]string, 0, len(entities)+1)
+			if schema, _, ok := iglu.SelfDescribingEvent(item); ok {
+				itemSchemas = append(itemSchemas, schema)
+			}
+			for _, entity := range entities {
+				itemSchemas = append(itemSchemas, entity.Schema)
+			}
+			usesStale := false
+			for _, schema := range itemSchemas {
+				newest, checked := latest[schema]
+				if !checked {
+					newest = newerRegistryVersion(schemas, schema)
+					latest[schema] = newest
+				}
+				if newest != "" {
+					score.StaleSchemas[schema] = newest
+					usesStale = true
+				}
+			}
+			if usesStale {
+				stale++
+			}
+		}
+	}
+
+	if score.TrackerEvents == 0 {
+		return score
+	}
+	total := float64(score.TrackerEvents)
+	score.ValidationPassRate = float64(passed) / total
+	score.DuplicateRate = float64(duplicates) / total
+	score.StaleSchemaRate = float64(stale) / total
+	rates := []float64{score.ValidationPassRate, 1 - score.DuplicateRate, 1 - score.StaleSchemaRate}
+	if len(required) > 0 {
+		coverage := float64(covered) / total
+		score.ContextCoverage = &coverage
+		rates = append(rates, coverage)
+	}
+
+	sum := 0.0
+	for _, rate := range rates {
+		sum += rate
+	}
+	overall := math.Round(sum/float64(len(rates))*1000) / 10
+	score.Score = &overall
+	return score
+}
+
+// itemViolated reports whether the item at index of an event broke a schema
+// Violations of batched events are located under "data[<index>]."
+func itemViolated(event Event, index int) bool {
+	if len(event.Data) <= 1 {
+		return len(event.Violations) > 0
+	}
+	prefix := fmt.Sprintf("data[%d].", index)
+	for _, violation := range event.Violations {
+		if strings.HasPrefix(violation.Location, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasContext reports whether entities include the required context, given as
+// vendor/name for any version or as a full Iglu URI
+func hasContext(entities []iglu.Entity, required string) bool {
+	for _, entity := range entities {
+		if entity.Schema == required || iglu.SchemaKey(entity.Schema) == required {
+			return true
+		}
+	}
+	return false
+}
+
+// newerRegistryVersion returns the registry's latest version of a schema if it
+// is newer than the schema's, or "" otherwise
+func newerRegistryVersion(schemas fs.FS, schema string) string {
+	schemaPath, ok := iglu.SchemaPath(schema)
+	if schemas == nil || !ok {
+		return ""
+	}
+	_, latest := registryVersions(schemas, schema)
+	if latest == "" || !newerSchemaVersion(latest, path.Base(schemaPath)) {
+		return ""
+	}
+	return latest
+}
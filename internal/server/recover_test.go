@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// internalErrors returns the goplow error events in the buffer
+func internalErrors(s *AppServer) []Event {
+	var failures []Event
+	for _, event := range s.GetEvents() {
+		if event.Schema == InternalErrorSchema {
+			failures = append(failures, event)
+		}
+	}
+	return failures
+}
+
+func TestIngestWorkerRecoversFromAPanickingEvent(t *testing.T) {
+	config := defaultConfig()
+	config.DataDir = t.TempDir()
+	config.IngestWorkers = 1
+	s := New(config)
+	s.AddEventListener(func(_ context.Context, event Event) {
+		if event.Data[0]["e"] == "boom" {
+			panic("listener failed")
+		}
+	})
+	s.StartIngestWorkers()
+
+	if err := s.IngestEvents(context.Background(), []Event{
+		{Schema: "test", Data: []map[string]interface{}{{"e": "boom"}}},
+		{Schema: "test", Data: []map[string]interface{}{{"e": "pv"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	stream := s.NewIngestStream(context.Background())
+	for _, name := range []string{"boom", "pp"} {
+		stream.Add(Event{Schema: "test", Data: []map[string]interface{}{{"e": name}}})
+	}
+	if err := stream.Commit(0); err != nil {
+		t.Fatal(err)
+	}
+	s.StopIngestWorkers()
+
+	var stored []interface{}
+	for _, event := range s.GetEvents() {
+		if event.Schema == "test" {
+			stored = append(stored, event.Data[0]["e"])
+		}
+	}
+	// The panicking events were stored before their listener ran
+	if len(stored) != 4 || stored[1] != "pv" || stored[3] != "pp" {
+		t.Errorf("stored %v, want the events after each panic too", stored)
+	}
+
+	failures := internalErrors(s)
+	if len(failures) != 2 {
+		t.Fatalf("recorded %d internal errors, want 2", len(failures))
+	}
+	data := failures[0].Data[0]
+	if data["task"] != "ingest" || data["message"] != "ingest failed: listener failed" {
+		t.Errorf("recorded %v, want the ingest task and its panic", data)
+	}
+	if _, ok := data["method"]; ok {
+		t.Errorf("recorded a method for background work: %v", data)
+	}
+}
+
+func TestBroadcastQueueRecoversFromAPanickingBroadcast(t *testing.T) {
+	type failure struct {
+		recovered interface{}
+		record    bool
+	}
+	var (
+		mutex    sync.Mutex
+		failures []failure
+		done     = make(chan struct{})
+	)
+	q := &broadcastQueue{failed: func(recovered interface{}, _ string, record bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		failures = append(failures, failure{recovered, record})
+	}}
+
+	q.push(broadcast{send: func() { panic("event") }})
+	q.push(broadcast{send: func() { panic("error event") }, internalError: true})
+	q.push(broadcast{send: func() { close(done) }})
+	<-done
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(failures) != 2 {
+		t.Fatalf("got %d failures, want 2", len(failures))
+	}
+	if failures[0].recovered != "event" || !failures[0].record {
+		t.Errorf("first failure is %+v, want the event's panic recorded", failures[0])
+	}
+	// Recording a failed error event's broadcast would queue another one
+	if failures[1].recovered != "error event" || failures[1].record {
+		t.Errorf("second failure is %+v, want the error event's panic only logged", failures[1])
+	}
+}
+
+func TestPanickingBroadcastIsRecordedAsAnInternalError(t *testing.T) {
+	s := newTestServer(t)
+	s.broadcasts.failed(fmt.Errorf("transform failed"), "stack", true)
+	s.broadcasts.failed("ignored", "stack", false)
+
+	failures := internalErrors(s)
+	if len(failures) != 1 {
+		t.Fatalf("recorded %d internal errors, want 1", len(failures))
+	}
+	if data := failures[0].Data[0]; data["task"] != "broadcast" || data["message"] != "broadcast failed: transform failed" {
+		t.Errorf("recorded %v, want the broadcast task and its panic", data)
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// retentionCheckInterval is how often the idle timeout is checked
+const retentionCheckInterval = 10 * time.Second
+
+// ClearEvents removes all events from the buffer and notifies SSE clients
+// Event IDs keep increasing so clients can tell old and new events apart
+// The clear is recorded in the audit log as performed by actor
+func (s *AppServer) ClearEvents(reason string, actor Actor) int {
+	cleared := len(s.drainEvents(reason))
+	s.Audit(AuditClear, actor, map[string]interface{}{"cleared": cleared, "reason": reason})
+	return cleared
+}
+
+// ClearScope limits a clear to the events of one ingest namespace, one run, or both
+type ClearScope struct {
+	// Namespace is the ingest endpoint path, e.g. "/com.simplybusiness/events"
+	Namespace string
+	RunID     string
+}
+
+// matches reports whether an event is within the scope
+func (c ClearScope) matches(event Event) bool {
+	return (c.Namespace == "" || event.Namespace == c.Namespace) && (c.RunID == "" || event.RunID == c.RunID)
+}
+
+// ClearScopedEvents removes the events within scope from the buffer, leaving
+// those of other namespaces and runs, and notifies SSE clients of the scope
+// so parallel test runs can each clear their own events
+func (s *AppServer) ClearScopedEvents(scope ClearScope, reason string, actor Actor) int {
+	s.mutex.Lock()
+	kept := make([]Event, 0, len(s.events))
+	var cleared []int
+	for _, event := range s.events {
+		if scope.matches(event) {
+			cleared = append(cleared, event.ID)
+		} else {
+			kept = append(kept, event)
+		}
+	}
+	s.events = kept
+	s.storeDelete(cleared)
+	details := map[string]interface{}{"cleared": len(cleared), "reason": reason}
+	if scope.Namespace != "" {
+		details["namespace"] = scope.Namespace
+	}
+	if scope.RunID != "" {
+		details["runId"] = scope.RunID
+	}
+	s.queueControl("clear", details)
+	s.mutex.Unlock()
+
+	log.Printf("Cleared %d events in namespace %q, run %q (%s)\n", len(cleared), scope.Namespace, scope.RunID, reason)
+	s.Audit(AuditClear, actor, details)
+	return len(cleared)
+}
+
+// drainEvents empties the buffer and returns the events it held, notifying
+// SSE clients of the clear before any event added after it
+func (s *AppServer) drainEvents(reason string) []Event {
+	s.mutex.Lock()
+	drained := s.drainEventsLocked(reason)
+	s.mutex.Unlock()
+
+	log.Printf("Cleared %d events (%s)\n", len(drained), reason)
+	return drained
+}
+
+// drainEventsLocked is drainEvents for callers that hold s.mutex
+func (s *AppServer) drainEventsLocked(reason string) []Event {
+	drained := s.events
+	s.events = make([]Event, 0)
+	s.storeDeleteBefore(s.eventID + 1)
+	s.queueControl(SSEChannelClear, map[string]interface{}{
+		"cleared": len(drained),
+		"reason":  reason,
+	})
+	return drained
+}
+
+// removeEvents removes the events with the given IDs from the buffer and the
+// store, notifying SSE clients of the clear and then replaying the events
+// that remain, such as those added while an archive was being written
+func (s *AppServer) removeEvents(ids []int, reason string) int {
+	remove := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+
+	s.mutex.Lock()
+	kept := make([]Event, 0, len(s.events))
+	removed := make([]int, 0, len(ids))
+	for _, event := range s.events {
+		if remove[event.ID] {
+			removed = append(removed, event.ID)
+		} else {
+			kept = append(kept, event)
+		}
+	}
+	s.events = kept
+	s.storeDelete(removed)
+	s.queueControl(SSEChannelClear, map[string]interface{}{
+		"cleared": len(removed),
+		"reason":  reason,
+	})
+	for _, event := range kept {
+		s.queueEvent(event)
+	}
+	s.mutex.Unlock()
+
+	log.Printf("Cleared %d events (%s)\n", len(removed), reason)
+	return len(removed)
+}
+
+// isClearMarker reports whether the event is the configured clear marker, either
+// a structured event with that action or a timeline marker with that label
+func (s *AppServer) isClearMarker(event Event) bool {
+	marker := s.config.ClearOnMarker
+	if marker == "" {
+		return false
+	}
+	if event.Schema == MarkerSchema {
+		return markerLabel(event) == marker
+	}
+	for _, item := range event.Data {
+		if item["e"] == "se" && item["se_ac"] == marker {
+			return true
+		}
+	}
+	return false
+}
+
+// StartAutoClear runs the scheduled and idle buffer clearing configured for
+// the server until the context is cancelled
+func (s *AppServer) StartAutoClear(ctx context.Context) {
+	interval := parseDurationSetting("clear_interval", s.config.ClearInterval)
+	idle := parseDurationSetting("clear_after_idle", s.config.ClearAfterIdle)
+
+	if interval > 0 {
+		log.Printf("Clearing events every %s\n", interval)
+		go func() {
+			ticker := s.clock.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C():
+					s.ClearEvents("scheduled", SystemActor)
+				}
+			}
+		}()
+	}
+
+	if idle > 0 {
+		log.Printf("Clearing events after %s of inactivity\n", idle)
+		checkEvery := retentionCheckInterval
+		if idle < checkEvery {
+			checkEvery = idle
+		}
+		go func() {
+			ticker := s.clock.NewTicker(checkEvery)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C():
+					s.mutex.RLock()
+					stale := len(s.events) > 0 && s.Now().Sub(s.lastEventAt) >= idle
+					s.mutex.RUnlock()
+					if stale {
+						s.ClearEvents("idle", SystemActor)
+					}
+				}
+			}
+		}()
+	}
+}
+
+// parseDurationSetting parses a duration config value, returning 0 if unset or invalid
+func parseDurationSetting(name string, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Warning: ignoring invalid %s value %q\n", name, value)
+		return 0
+	}
+	return duration
+}
@@ -0,0 +1,26 @@
+package server
+
+// DefaultRunIDHeader is the ingest request header carrying a test run's ID
+const DefaultRunIDHeader = "X-Goplow-Run-ID"
+
+// maxRunIDLength caps the run IDs recorded from request headers
+const maxRunIDLength = 200
+
+// NormalizeRunID trims a run ID taken from a request header to maxRunIDLength
+func NormalizeRunID(value string) string {
+	if len(value) > maxRunIDLength {
+		return value[:maxRunIDLength]
+	}
+	return value
+}
+
+// FilterEventsByRun returns the events sent with the given run ID
+func FilterEventsByRun(events []Event, runID string) []Event {
+	filtered := make([]Event, 0)
+	for _, event := range events {
+		if event.RunID == runID {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"sync/atomic"
+)
+
+// sampler drops or samples events by tracker event type before they are stored
+// The sampled types are fixed when it is created, so the counters are read
+// without a lock and each is updated atomically
+type sampler struct {
+	keepOneIn  map[string]int
+	seen       map[string]*atomic.Int64
+	suppressed map[string]*atomic.Int64
+}
+
+// newSampler creates a sampler for the configured rules
+func newSampler(rules []SamplingRule) *sampler {
+	keepOneIn := make(map[string]int, len(rules))
+	seen := make(map[string]*atomic.Int64, len(rules))
+	suppressed := make(map[string]*atomic.Int64, len(rules))
+	for _, rule := range rules {
+		keepOneIn[rule.EventType] = rule.KeepOneIn
+		seen[rule.EventType] = new(atomic.Int64)
+		suppressed[rule.EventType] = new(atomic.Int64)
+	}
+	return &sampler{
+		keepOneIn:  keepOneIn,
+		seen:       seen,
+		suppressed: suppressed,
+	}
+}
+
+// suppress reports whether the event should be dropped, counting it if so
+// The first event of a sampled type is always kept, then every KeepOneIn-th after it
+func (s *sampler) suppress(event Event) bool {
+	if len(s.keepOneIn) == 0 || len(event.Data) == 0 {
+		return false
+	}
+	eventType, _ := event.Data[0]["e"].(string)
+	keepOneIn, sampled := s.keepOneIn[eventType]
+	if !sampled {
+		return false
+	}
+
+	seen := s.seen[eventType].Add(1) - 1
+	if keepOneIn > 0 && seen%int64(keepOneIn) == 0 {
+		return false
+	}
+	s.suppressed[eventType].Add(1)
+	return true
+}
+
+// counts returns the total and per-type number of suppressed events
+func (s *sampler) counts() (int, map[string]int) {
+	total := 0
+	byType := make(map[string]int, len(s.suppressed))
+	for eventType, counter := range s.suppressed {
+		if count := int(counter.Load()); count > 0 {
+			byType[eventType] = count
+			total += count
+		}
+	}
+	return total, byType
+}
@@ -1,43 +1,23 @@
 package server
 
 import (
-	"encoding/json"
-	"fmt"
+	"bytes"
+	"context"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/BurntSushi/toml"
+	"goplow/internal/utils"
+	"goplow/pkg/backend"
 )
 
-// Config represents the application configuration
-type Config struct {
-	Default      EnvironmentConfig            `toml:"default"`
-	Environments map[string]EnvironmentConfig `toml:"-"`
-}
-
-// EnvironmentConfig represents environment-specific configuration
-// All fields are flattened (no sub-sections)
-type EnvironmentConfig struct {
-	Port           int    `toml:"port"`
-	Host           string `toml:"host"`
-	MaxMsgs        int    `toml:"max_messages"`
-	EventsEndpoint string `toml:"events_endpoint"`
-	AllowedOrigins string `toml:"allowed_origins"`
-}
-
 // Event represents an analytics event with Snowplow schema structure
-type Event struct {
-	ID         int                      `json:"id"`
-	Schema     string                   `json:"schema"`
-	Data       []map[string]interface{} `json:"data"`
-	Timestamp  time.Time                `json:"timestamp"`
-	ReceivedAt time.Time                `json:"receivedAt"`
-	// UnwrapSingleItem indicates whether to display single-item arrays as a single object
-	UnwrapSingleItem bool `json:"-"`
-}
+type Event = backend.Event
 
 // SSEClient represents an SSE connection
 type SSEClient struct {
@@ -45,168 +25,219 @@ type SSEClient struct {
 	Writer  http.ResponseWriter
 	Flusher http.Flusher
 	Done    chan bool
+	// channels are the named events the client subscribed to; nil selects the
+	// original stream, with events and markers as unnamed messages and no stats
+	channels map[string]bool
+	// jsonl clients are sent each new event as a line of JSON instead of SSE
+	// frames, untransformed
+	jsonl bool
+	// started is when the client connected
+	started time.Time
+	// queue holds encoded frames waiting to be written by ServeSSEClient
+	queue chan []byte
+	// mutex guards the slow-client state below
+	mutex     sync.Mutex
+	dropped   int
+	slowSince time.Time
+	summaries bool
 }
 
 // AppServer handles the web server and analytics event management
 type AppServer struct {
 	config      EnvironmentConfig
+	sources     ConfigSources
 	events      []Event
 	mutex       sync.RWMutex
 	eventID     int
 	sseClients  map[string]*SSEClient
 	sseMutex    sync.RWMutex
 	transformer func(Event) Event
+	handlers    *utils.EventHandlerRegistry
+	enrichers   []Enricher
+	listeners   []func(context.Context, Event)
+	throughput  throughput
+	lastEventAt time.Time
+
+	latestDeviceTime    map[string]time.Time
+	outOfOrderThreshold time.Duration
+	sampler             *sampler
+	validator           Validator
+	schemas             fs.FS
+	labels              labelBundles
+	badEvents           []BadEvent
+	badEventID          int
+	trustedProxies      []*net.IPNet
+	ingestAccess        accessList
+	adminAccess         accessList
+	audit               *auditLog
+	metrics             metrics
+	evictions           evictions
+	sessions            sessions
+	store               EventStore
+	storeWrites         storeWriter
+	ingest              ingestQueue
+	statsCache          statsFrameCache
+	eventTypes          shardedCounts
+	payloads            payloadHistograms
+	anomalies           anomalyDetector
+	sinks               []Sink
+	// preferencesMutex serializes reads and writes of the preferences file
+	preferencesMutex sync.Mutex
+	// funnels are those of the configuration, then those defined through the API
+	funnelsMutex sync.RWMutex
+	funnels      []funnel
+	// broadcasts sends SSE messages in the order the buffer changed
+	broadcasts broadcastQueue
+	// clock is the time source; SystemClock unless replaced with SetClock
+	clock Clock
 }
 
-// LoadConfig loads the configuration from a TOML file
-// It checks multiple locations in order of precedence:
-// 1. Local file (same directory as binary)
-// 2. $HOME/.config/goplow.toml
-// 3. Uses defaults if neither exists
-// If environment is specified, it merges the named environment with defaults
-func LoadConfig(filepath string, environment string) (EnvironmentConfig, error) {
-	// Set up default configuration
-	defaultConfig := EnvironmentConfig{
-		Port:           8081,
-		Host:           "localhost",
-		MaxMsgs:        100,
-		EventsEndpoint: "com.simplybusiness/events",
-		AllowedOrigins: "http://localhost:3000",
+// New creates a new application server
+func New(config EnvironmentConfig) *AppServer {
+	outOfOrderThreshold := parseDurationSetting("out_of_order_threshold", config.OutOfOrderThreshold)
+	if outOfOrderThreshold == 0 {
+		outOfOrderThreshold = defaultOutOfOrderThreshold
 	}
 
-	// Build list of config paths to check (in precedence order)
-	configPaths := []string{filepath}
-
-	// Add $HOME/.config/goplow.toml as fallback
-	if home, err := os.UserHomeDir(); err == nil {
-		configPaths = append(configPaths, fmt.Sprintf("%s/.config/goplow.toml", home))
+	// The configuration has been validated, so network parse errors cannot occur
+	trustedProxies, _ := ParseNetworks(config.TrustedProxies)
+
+	s := &AppServer{
+		config:              config,
+		events:              make([]Event, 0),
+		eventID:             0,
+		sseClients:          make(map[string]*SSEClient),
+		handlers:            utils.NewEventHandlerRegistry(),
+		latestDeviceTime:    make(map[string]time.Time),
+		outOfOrderThreshold: outOfOrderThreshold,
+		sampler:             newSampler(config.Sampling),
+		trustedProxies:      trustedProxies,
+		ingestAccess:        newAccessList(config.IngestAllow, config.IngestDeny),
+		adminAccess:         newAccessList(config.AdminAllow, config.AdminDeny),
+		payloads:            newPayloadHistograms(),
+		funnels:             configuredFunnels(config.Funnels),
+		clock:               SystemClock{},
 	}
+	s.broadcasts.failed = func(recovered interface{}, stack string, record bool) {
+		s.taskFailed("broadcast", recovered, stack, record)
+	}
+	return s
+}
 
-	// Try each path in order
-	var loadedFrom string
-	var rawConfig map[string]interface{}
+// AddEvent adds a new analytics event and broadcasts it to SSE clients
+func (s *AppServer) AddEvent(schema string, data []map[string]interface{}) {
+	s.AddEventWithTime(schema, data, s.Now())
+}
 
-	for _, path := range configPaths {
-		if _, err := os.Stat(path); err == nil {
-			if _, err := toml.DecodeFile(path, &rawConfig); err != nil {
-				return defaultConfig, fmt.Errorf("error parsing config file at %s: %w", path, err)
-			}
-			loadedFrom = path
-			break
-		}
-	}
+// AddEventWithTime adds a new analytics event with a specific timestamp and broadcasts it to SSE clients
+func (s *AppServer) AddEventWithTime(schema string, data []map[string]interface{}, timestamp time.Time) {
+	s.addEvent(context.Background(), Event{
+		Schema:    schema,
+		Data:      data,
+		Timestamp: timestamp,
+	})
+}
 
-	if loadedFrom == "" {
-		log.Printf("Config file not found, using defaults\n")
-		return defaultConfig, nil
-	}
+// AddEventFromSource adds an event that was pushed from another goplow instance,
+// keeping the source label so aggregated events can be told apart
+func (s *AppServer) AddEventFromSource(source string, schema string, data []map[string]interface{}, timestamp time.Time) {
+	s.addEvent(context.Background(), Event{
+		Schema:    schema,
+		Data:      data,
+		Timestamp: timestamp,
+		Source:    source,
+	})
+}
 
-	log.Printf("Loaded config from %s\n", loadedFrom)
+// AddEventRecord stores a pre-populated event (schema, data, timestamp and any
+// optional metadata such as source or namespace) and returns the stored event
+func (s *AppServer) AddEventRecord(event Event) Event {
+	return s.AddEventRecordContext(context.Background(), event)
+}
 
-	// Parse the full config structure
-	var fullConfig Config
-	if _, err := toml.DecodeFile(loadedFrom, &fullConfig); err != nil {
-		return defaultConfig, fmt.Errorf("error parsing config file at %s: %w", loadedFrom, err)
+// AddEventRecordContext is AddEventRecord for an event received in a request,
+// passing ctx on to the event listeners
+func (s *AppServer) AddEventRecordContext(ctx context.Context, event Event) Event {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = s.Now()
 	}
+	return s.addEvent(ctx, event)
+}
 
-	// Start with defaults from file, or use hardcoded defaults if not present
-	finalConfig := defaultConfig
-	if fullConfig.Default.Port != 0 || fullConfig.Default.Host != "" {
-		finalConfig = fullConfig.Default
-		// Fill in any missing defaults
-		if finalConfig.Port == 0 {
-			finalConfig.Port = defaultConfig.Port
-		}
-		if finalConfig.Host == "" {
-			finalConfig.Host = defaultConfig.Host
-		}
-		if finalConfig.MaxMsgs == 0 {
-			finalConfig.MaxMsgs = defaultConfig.MaxMsgs
-		}
-		if finalConfig.EventsEndpoint == "" {
-			finalConfig.EventsEndpoint = defaultConfig.EventsEndpoint
-		}
-		if finalConfig.AllowedOrigins == "" {
-			finalConfig.AllowedOrigins = defaultConfig.AllowedOrigins
-		}
+// addEvent assigns an ID to the event, stores it and notifies SSE clients and listeners
+// It returns the stored event, or the event with a zero ID if sampling suppressed it
+func (s *AppServer) addEvent(ctx context.Context, event Event) Event {
+	if s.sampler.suppress(event) {
+		return event
 	}
 
-	// If an environment is specified, parse and merge it
-	if environment != "" {
-		// Check if environment exists in raw config
-		if _, ok := rawConfig[environment]; ok {
-			// Create a structure to hold all environment configs
-			allEnvs := make(map[string]EnvironmentConfig)
-
-			// Decode the entire file into the map
-			_, err := toml.DecodeFile(loadedFrom, &allEnvs)
-			if err != nil {
-				log.Printf("Warning: error loading environment configs: %v\n", err)
-			} else if envConfig, exists := allEnvs[environment]; exists {
-				// Merge environment config over defaults (only non-zero values)
-				if envConfig.Port != 0 {
-					finalConfig.Port = envConfig.Port
-				}
-				if envConfig.Host != "" {
-					finalConfig.Host = envConfig.Host
-				}
-				if envConfig.MaxMsgs != 0 {
-					finalConfig.MaxMsgs = envConfig.MaxMsgs
-				}
-				if envConfig.EventsEndpoint != "" {
-					finalConfig.EventsEndpoint = envConfig.EventsEndpoint
-				}
-				if envConfig.AllowedOrigins != "" {
-					finalConfig.AllowedOrigins = envConfig.AllowedOrigins
-				}
-				log.Printf("Applied environment configuration: %s\n", environment)
-			}
-		} else {
-			log.Printf("Warning: environment '%s' not found in config file\n", environment)
-		}
+	if event.EventSchema == "" && len(event.Data) > 0 {
+		event.EventSchema = ItemSchema(event.Data[0])
 	}
 
-	return finalConfig, nil
-}
-
-// New creates a new application server
-func New(config EnvironmentConfig) *AppServer {
-	return &AppServer{
-		config:     config,
-		events:     make([]Event, 0),
-		eventID:    0,
-		sseClients: make(map[string]*SSEClient),
+	// Enrich and validate before taking the write lock, as lookups may be slow
+	s.enrich(&event)
+	if event.Violations == nil {
+		event.Violations = s.ValidateEvent(event)
 	}
-}
+	s.payloads.record(event)
+	// Only the histograms need the sizes, so the buffer does not hold them
+	event.ItemBytes = nil
+	s.anomalies.observe(event)
+	// The counters are atomic, so concurrent ingest does not wait on the buffer for them
+	s.throughput.recordAccepted(s.Now(), len(event.Violations) > 0)
+	s.eventTypes.add(eventTypeLabel(event))
 
-// AddEvent adds a new analytics event and broadcasts it to SSE clients
-func (s *AppServer) AddEvent(schema string, data []map[string]interface{}) {
-	s.AddEventWithTime(schema, data, time.Now())
-}
-
-// AddEventWithTime adds a new analytics event with a specific timestamp and broadcasts it to SSE clients
-func (s *AppServer) AddEventWithTime(schema string, data []map[string]interface{}, timestamp time.Time) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	s.eventID++
-	event := Event{
-		ID:         s.eventID,
-		Schema:     schema,
-		Data:       data,
-		Timestamp:  timestamp,
-		ReceivedAt: time.Now(),
+	event.ID = s.eventID
+	event.ReceivedAt = s.Now()
+	s.lastEventAt = event.ReceivedAt
+	s.flagOutOfOrder(&event)
+	// Events pushed from a cluster leaf or mirrored by goplow follow keep the
+	// session they were captured in
+	if event.Session == nil {
+		event.Session = s.currentSession()
+	}
+
+	// A clear marker starts a fresh buffer, keeping the marker as its first event
+	clearedByMarker := -1
+	if s.isClearMarker(event) {
+		clearedByMarker = len(s.events)
+		s.events = make([]Event, 0)
+		log.Printf("Cleared %d events (marker)\n", clearedByMarker)
+		s.storeDeleteBefore(event.ID)
+		go s.Audit(AuditClear, SystemActor, map[string]interface{}{"cleared": clearedByMarker, "reason": "marker"})
 	}
 
 	s.events = append(s.events, event)
+	s.storeAppend(event)
 
 	// Keep only the latest MaxMsgs events
 	if len(s.events) > s.config.MaxMsgs {
+		s.recordEviction(s.events[0], "max_messages")
 		s.events = s.events[1:]
+		s.storeDeleteBefore(s.events[0].ID)
+	}
+
+	// Broadcast new event to all SSE clients, queued under the lock so they
+	// receive events in ID order
+	if clearedByMarker >= 0 {
+		s.queueControl("clear", map[string]interface{}{
+			"cleared": clearedByMarker,
+			"reason":  "marker",
+		})
 	}
+	s.queueEvent(event)
 
-	// Broadcast new event to all SSE clients
-	go s.broadcastNewEvent(event)
+	// Notify listeners (e.g. forwarders) of the new event
+	for _, listener := range s.listeners {
+		listener(ctx, event)
+	}
+
+	return event
 }
 
 // GetEvents returns all analytics events
@@ -225,14 +256,69 @@ func (s *AppServer) GetConfig() EnvironmentConfig {
 	return s.config
 }
 
-// GetAddr returns the server address in format host:port
+// SetConfigSources records where each config value came from, for display
+func (s *AppServer) SetConfigSources(sources ConfigSources) {
+	s.sources = sources
+}
+
+// GetConfigSettings returns the resolved config settings with their sources
+// and with secrets masked
+func (s *AppServer) GetConfigSettings() []ConfigSetting {
+	return s.config.Settings(s.sources)
+}
+
+// GetAddr returns the server listen address in format host:port, or [host]:port
+// for IPv6 literals
 func (s *AppServer) GetAddr() string {
-	return fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
+	return net.JoinHostPort(listenHost(s.config.Host), strconv.Itoa(s.config.Port))
 }
 
 // GetURL returns the full URL for the server
+// A wildcard listen address is reached through localhost
 func (s *AppServer) GetURL() string {
-	return fmt.Sprintf("http://%s:%d", s.config.Host, s.config.Port)
+	host := listenHost(s.config.Host)
+	if isWildcardHost(host) {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(s.config.Port)) + s.GetBasePath() + "/"
+}
+
+// GetLANURLs returns the server URL on each non-loopback interface address when
+// listening on all interfaces, for pointing other devices at goplow
+func (s *AppServer) GetLANURLs() []string {
+	host := listenHost(s.config.Host)
+	if !isWildcardHost(host) {
+		return nil
+	}
+	ipv4Only := host == "0.0.0.0"
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var urls []string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipv4Only && ipNet.IP.To4() == nil {
+			continue
+		}
+		urls = append(urls, "http://"+net.JoinHostPort(ipNet.IP.String(), strconv.Itoa(s.config.Port))+s.GetBasePath())
+	}
+	return urls
+}
+
+// listenHost strips the brackets from an IPv6 literal host such as [::1]
+func listenHost(host string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// isWildcardHost reports whether host listens on all interfaces
+// "::" (and "") are dual-stack, accepting both IPv6 and IPv4 connections
+func isWildcardHost(host string) bool {
+	return host == "" || host == "0.0.0.0" || host == "::"
 }
 
 // GetEventsEndpoint returns the configured events endpoint path
@@ -241,10 +327,27 @@ func (s *AppServer) GetEventsEndpoint() string {
 	if endpoint == "" {
 		endpoint = "com.simplybusiness/events"
 	}
-	// Ensure endpoint starts with /
+	return NormalizeEndpointPath(endpoint)
+}
+
+// GetBasePath returns the path prefix every route is mounted under, such as
+// "/goplow", or "" when goplow is served from the root
+func (s *AppServer) GetBasePath() string {
+	basePath := NormalizeEndpointPath(s.config.BasePath)
+	if basePath == "/" {
+		return ""
+	}
+	return basePath
+}
+
+// NormalizeEndpointPath ensures an endpoint path starts with / and has no trailing /
+func NormalizeEndpointPath(endpoint string) string {
 	if len(endpoint) > 0 && endpoint[0] != '/' {
 		endpoint = "/" + endpoint
 	}
+	if len(endpoint) > 1 && endpoint[len(endpoint)-1] == '/' {
+		endpoint = endpoint[:len(endpoint)-1]
+	}
 	return endpoint
 }
 
@@ -253,19 +356,58 @@ func (s *AppServer) GetCORSAllowedOrigins() string {
 	return s.config.AllowedOrigins
 }
 
+// GetCORSMaxAge returns how long browsers may cache preflight responses
+func (s *AppServer) GetCORSMaxAge() time.Duration {
+	return parseDurationSetting("cors_max_age", s.config.CORSMaxAge)
+}
+
 // SetEventTransformer sets a function to transform events for display
 func (s *AppServer) SetEventTransformer(transformer func(Event) Event) {
 	s.transformer = transformer
 }
 
+// AddEventListener registers a function that is called for every new event
+// Listeners are called while the event store is locked, so they must not block
+// ctx is the context of the request the event arrived in; work a listener
+// queues to run later should not be bound to its cancellation
+func (s *AppServer) AddEventListener(listener func(context.Context, Event)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.listeners = append(s.listeners, listener)
+}
+
+// EventHandlers returns the registry of per-event-type transforms applied to events for display
+// Handlers registered here before RegisterRoutes take precedence over the built-in ones
+func (s *AppServer) EventHandlers() *utils.EventHandlerRegistry {
+	return s.handlers
+}
+
 // AddSSEClient adds a new SSE client
-func (s *AppServer) AddSSEClient(clientID string, w http.ResponseWriter) *SSEClient {
+// channels selects named events (see SSEChannels), or nil for the original stream
+// It fails with ErrSSEUnsupported or, at sse_max_clients, ErrTooManySSEClients
+func (s *AppServer) AddSSEClient(clientID string, w http.ResponseWriter, channels []string) (*SSEClient, error) {
+	return s.addClient(clientID, w, channels, false)
+}
+
+// AddStreamClient adds a client of the JSON Lines stream, which is sent each
+// new event as a line of JSON
+// It fails like AddSSEClient, sharing its sse_max_clients limit
+func (s *AppServer) AddStreamClient(clientID string, w http.ResponseWriter) (*SSEClient, error) {
+	return s.addClient(clientID, w, []string{SSEChannelNew}, true)
+}
+
+// addClient registers an event stream client, in SSE or JSON Lines format
+func (s *AppServer) addClient(clientID string, w http.ResponseWriter, channels []string, jsonl bool) (*SSEClient, error) {
 	s.sseMutex.Lock()
 	defer s.sseMutex.Unlock()
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		return nil
+		return nil, ErrSSEUnsupported
+	}
+	if s.config.SSEMaxClients > 0 && len(s.sseClients) >= s.config.SSEMaxClients {
+		return nil, ErrTooManySSEClients
 	}
 
 	client := &SSEClient{
@@ -273,10 +415,19 @@ func (s *AppServer) AddSSEClient(clientID string, w http.ResponseWriter) *SSECli
 		Writer:  w,
 		Flusher: flusher,
 		Done:    make(chan bool, 1),
+		queue:   make(chan []byte, s.sseQueueSize()),
+		started: time.Now(),
+		jsonl:   jsonl,
+	}
+	if channels != nil {
+		client.channels = make(map[string]bool)
+		for _, channel := range channels {
+			client.channels[channel] = true
+		}
 	}
 
 	s.sseClients[clientID] = client
-	return client
+	return client, nil
 }
 
 // RemoveSSEClient removes an SSE client
@@ -290,90 +441,205 @@ func (s *AppServer) RemoveSSEClient(clientID string) {
 	}
 }
 
+// CloseSSEClients ends every SSE connection, so shutdown does not wait for
+// long-lived streams
+func (s *AppServer) CloseSSEClients() {
+	s.sseMutex.Lock()
+	defer s.sseMutex.Unlock()
+
+	for clientID, client := range s.sseClients {
+		close(client.Done)
+		delete(s.sseClients, clientID)
+	}
+}
+
 // broadcastNewEvent sends a new event to all connected SSE clients
 func (s *AppServer) broadcastNewEvent(event Event) {
 	s.sseMutex.RLock()
 	defer s.sseMutex.RUnlock()
 
+	// Transforming and encoding are the costly part, so skip them when no one is listening
+	if len(s.sseClients) == 0 {
+		return
+	}
+
 	// Apply transformer if available
 	eventToSend := event
 	if s.transformer != nil {
 		eventToSend = s.transformer(event)
+		// Send the original payload too so clients can toggle between raw and pretty views
+		if s.config.SSEIncludeRaw {
+			eventToSend.RawData = event.Data
+		}
 	}
 
-	for clientID, client := range s.sseClients {
+	// The event is encoded once into a pooled buffer; each frame copies it
+	buf := getBuffer()
+	defer putBuffer(buf)
+	eventJSON, err := encodeEvent(buf, eventToSend)
+	if err != nil {
+		log.Printf("Error marshaling event %d: %v\n", event.ID, err)
+		return
+	}
+	channel := eventChannel(event)
+	// Frames are only built for the kinds of client connected
+	var legacyFrame, namedFrame, line, summary []byte
+
+	for _, client := range s.sseClients {
 		select {
 		case <-client.Done:
 			// Client is done, skip
 			continue
 		default:
-			// Send the event to the client
-			if err := s.SendEventToClient(client, eventToSend); err != nil {
-				log.Printf("Error sending event to client %s: %v", clientID, err)
-				// Remove client on error
-				go s.RemoveSSEClient(clientID)
+		}
+		if !client.wants(channel) {
+			continue
+		}
+		if client.jsonl {
+			if line == nil {
+				if line, err = jsonlLine(event); err != nil {
+					log.Printf("Error marshaling event %d: %v\n", event.ID, err)
+					return
+				}
 			}
+			s.sendFrame(client, line)
+			continue
+		}
+		if !client.downgraded() {
+			if client.named() {
+				if namedFrame == nil {
+					namedFrame = sseFrame(channel, eventJSON)
+				}
+				s.sendFrame(client, namedFrame)
+			} else {
+				if legacyFrame == nil {
+					legacyFrame = sseFrame("", eventJSON)
+				}
+				s.sendFrame(client, legacyFrame)
+			}
+			continue
+		}
+		if summary == nil {
+			if summary, err = summaryFrame(event); err != nil {
+				log.Printf("Error marshaling summary of event %d: %v\n", event.ID, err)
+				return
+			}
+		}
+		s.sendFrame(client, summary)
+	}
+}
+
+// broadcastControl sends a named control message (e.g. "clear") to all connected SSE clients
+// Named SSE events are not delivered to plain "message" listeners, so they never
+// appear as analytics events in the UI
+func (s *AppServer) broadcastControl(name string, payload interface{}) {
+	frame, err := encodeFrame(name, payload)
+	if err != nil {
+		log.Printf("Error marshaling %s control message: %v", name, err)
+		return
+	}
+
+	s.sseMutex.RLock()
+	defer s.sseMutex.RUnlock()
+
+	for _, client := range s.sseClients {
+		select {
+		case <-client.Done:
+			continue
+		default:
+		}
+		if client.wants(name) {
+			s.sendFrame(client, frame)
 		}
 	}
 }
 
-// SendEventToClient sends a single event to an SSE client as JSON
+// SendEventToClient queues a single event for an SSE client as JSON
 func (s *AppServer) SendEventToClient(client *SSEClient, event Event) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	eventJSON, err := encodeEvent(buf, event)
+	if err != nil {
+		return err
+	}
+	s.sendFrame(client, client.frame(eventChannel(event), eventJSON))
+	return nil
+}
+
+// encodeEvent encodes an event as it is sent to SSE clients into buf
+func encodeEvent(buf *bytes.Buffer, event Event) ([]byte, error) {
 	// If UnwrapSingleItem is true and there's only one data item, unwrap it
 	var dataToSend interface{} = event.Data
 	if event.UnwrapSingleItem && len(event.Data) == 1 {
 		dataToSend = event.Data[0]
 	}
+	var rawToSend interface{}
+	if event.RawData != nil {
+		rawToSend = event.RawData
+		if event.UnwrapSingleItem && len(event.RawData) == 1 {
+			rawToSend = event.RawData[0]
+		}
+	}
 
 	// Create a custom event structure for JSON marshaling
 	type EventForSSE struct {
-		ID         int         `json:"id"`
-		Schema     string      `json:"schema"`
-		Data       interface{} `json:"data"`
-		Timestamp  time.Time   `json:"timestamp"`
-		ReceivedAt time.Time   `json:"receivedAt"`
+		ID         int                    `json:"id"`
+		Schema     string                 `json:"schema"`
+		ItemSchema string                 `json:"eventSchema,omitempty"`
+		Data       interface{}            `json:"data"`
+		Raw        interface{}            `json:"raw,omitempty"`
+		Timestamp  time.Time              `json:"timestamp"`
+		ReceivedAt time.Time              `json:"receivedAt"`
+		Source     string                 `json:"source,omitempty"`
+		Namespace  string                 `json:"namespace,omitempty"`
+		Enriched   map[string]interface{} `json:"enriched,omitempty"`
+		DeviceTime *time.Time             `json:"deviceTimestamp,omitempty"`
+		OutOfOrder bool                   `json:"outOfOrder,omitempty"`
+		Session    *Session               `json:"session,omitempty"`
+		Trace      *TraceContext          `json:"trace,omitempty"`
+		RunID      string                 `json:"runId,omitempty"`
+		Batch      *BatchPosition         `json:"batch,omitempty"`
+		Summary    string                 `json:"summary,omitempty"`
+		Classes    []string               `json:"classification,omitempty"`
 	}
 
 	eventForSSE := EventForSSE{
 		ID:         event.ID,
 		Schema:     event.Schema,
+		ItemSchema: event.EventSchema,
 		Data:       dataToSend,
+		Raw:        rawToSend,
 		Timestamp:  event.Timestamp,
 		ReceivedAt: event.ReceivedAt,
+		Source:     event.Source,
+		Namespace:  event.Namespace,
+		Enriched:   event.Enriched,
+		DeviceTime: event.DeviceTimestamp,
+		OutOfOrder: event.OutOfOrder,
+		Session:    event.Session,
+		Trace:      event.Trace,
+		RunID:      event.RunID,
+		Batch:      event.Batch,
+		Summary:    event.Summary,
+		Classes:    event.Classification,
 	}
 
-	// Marshal event to JSON
-	eventJSON, err := json.Marshal(eventForSSE)
-	if err != nil {
-		return err
-	}
-
-	// Write SSE format
-	if _, err := fmt.Fprintf(client.Writer, "data: %s\n\n", string(eventJSON)); err != nil {
-		return err
-	}
-
-	client.Flusher.Flush()
-	return nil
+	return encodeJSON(buf, eventForSSE)
 }
 
-// SendTransformedEventToClient sends a transformed event to an SSE client
+// SendTransformedEventToClient queues a transformed event for an SSE client
 // The transformer function is called to transform the event data
 func (s *AppServer) SendTransformedEventToClient(client *SSEClient, event Event, transformer func(Event) Event) error {
 	// Transform the event
 	transformedEvent := transformer(event)
 
-	// Marshal event to JSON
-	eventJSON, err := json.Marshal(transformedEvent)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	eventJSON, err := encodeJSON(buf, transformedEvent)
 	if err != nil {
 		return err
 	}
 
-	// Write SSE format
-	if _, err := fmt.Fprintf(client.Writer, "data: %s\n\n", string(eventJSON)); err != nil {
-		return err
-	}
-
-	client.Flusher.Flush()
+	s.sendFrame(client, client.frame(eventChannel(transformedEvent), eventJSON))
 	return nil
 }
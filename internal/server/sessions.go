@@ -0,0 +1,92 @@
+package server
+
+import (
+	"sync"
+
+	"goplow/pkg/backend"
+)
+
+// Session is a named capture session, recorded with every event received while it is active
+type Session = backend.Session
+
+// sessions tracks the current capture session and those that have ended
+type sessions struct {
+	mutex   sync.Mutex
+	nextID  int
+	current *Session
+	ended   []Session
+}
+
+// StartSession starts a named capture session, ending the current one if any
+func (s *AppServer) StartSession(name string, metadata map[string]interface{}, actor Actor) Session {
+	s.sessions.mutex.Lock()
+	s.endSessionLocked()
+	s.sessions.nextID++
+	session := &Session{ID: s.sessions.nextID, Name: name, StartedAt: s.Now(), Metadata: metadata}
+	s.sessions.current = session
+	s.sessions.mutex.Unlock()
+
+	s.Audit(AuditSessionStart, actor, map[string]interface{}{"id": session.ID, "name": name})
+	return *session
+}
+
+// StopSession ends the current capture session
+// The second return value is false if no session was active
+func (s *AppServer) StopSession(actor Actor) (Session, bool) {
+	s.sessions.mutex.Lock()
+	ended, ok := s.endSessionLocked()
+	s.sessions.mutex.Unlock()
+
+	if ok {
+		s.Audit(AuditSessionStop, actor, map[string]interface{}{"id": ended.ID, "name": ended.Name})
+	}
+	return ended, ok
+}
+
+// endSessionLocked ends the current session; callers must hold sessions.mutex
+// Events keep the session as it was when they arrived, without EndedAt
+func (s *AppServer) endSessionLocked() (Session, bool) {
+	if s.sessions.current == nil {
+		return Session{}, false
+	}
+	ended := *s.sessions.current
+	now := s.Now()
+	ended.EndedAt = &now
+	s.sessions.ended = append(s.sessions.ended, ended)
+	s.sessions.current = nil
+	return ended, true
+}
+
+// GetSessions returns the current capture session, if any, and the ended ones, oldest first
+func (s *AppServer) GetSessions() (*Session, []Session) {
+	s.sessions.mutex.Lock()
+	defer s.sessions.mutex.Unlock()
+
+	var current *Session
+	if s.sessions.current != nil {
+		copied := *s.sessions.current
+		current = &copied
+	}
+	ended := make([]Session, len(s.sessions.ended))
+	copy(ended, s.sessions.ended)
+	return current, ended
+}
+
+// currentSession returns the active session shared by its events, or nil
+func (s *AppServer) currentSession() *Session {
+	s.sessions.mutex.Lock()
+	defer s.sessions.mutex.Unlock()
+	return s.sessions.current
+}
+
+// FilterEventsBySession returns the events received during the capture session
+// with the given ID
+func FilterEventsBySession(events []Event, id int) []Event {
+	filtered := make([]Event, 0)
+	for _, event := range events {
+		if event.Session != nil && event.Session.ID == id {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
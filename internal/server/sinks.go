@@ -0,0 +1,41 @@
+package server
+
+import "goplow/pkg/backend"
+
+// DeadLetter is an event a sink gave up on after using all its delivery attempts
+type DeadLetter = backend.DeadLetter
+
+// SinkStatus is a snapshot of a sink's delivery health
+type SinkStatus = backend.SinkStatus
+
+// Sink is a destination events are delivered to, such as the aggregator forwarder
+type Sink = backend.Sink
+
+// AddSink registers a sink, making it available in the sinks API
+func (s *AppServer) AddSink(sink Sink) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sinks = append(s.sinks, sink)
+}
+
+// GetSink returns the registered sink with the given name
+func (s *AppServer) GetSink(name string) (Sink, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, sink := range s.sinks {
+		if sink.Name() == name {
+			return sink, true
+		}
+	}
+	return nil, false
+}
+
+// Sinks returns the registered sinks in the order they were added
+func (s *AppServer) Sinks() []Sink {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return append([]Sink{}, s.sinks...)
+}
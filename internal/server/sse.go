@@ -0,0 +1,378 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Named SSE events a client can subscribe to on /api/events
+const (
+	SSEChannelNew     = "new"
+	SSEChannelBad     = "bad"
+	SSEChannelClear   = "clear"
+	SSEChannelMarker  = "marker"
+	SSEChannelStats   = "stats"
+	SSEChannelEvicted = "evicted"
+)
+
+// SSEChannels lists every named SSE event
+var SSEChannels = []string{SSEChannelNew, SSEChannelBad, SSEChannelClear, SSEChannelMarker, SSEChannelStats, SSEChannelEvicted}
+
+// Reasons sent in the "close" frame before the server ends an event stream
+const (
+	CloseReasonIdle   = "idle"
+	CloseReasonMaxAge = "max_connection_age"
+)
+
+// Errors returned by AddSSEClient
+var (
+	ErrSSEUnsupported    = errors.New("streaming is not supported by this connection")
+	ErrTooManySSEClients = errors.New("too many event stream clients")
+)
+
+// sseStatsInterval is how often subscribed clients are sent a stats snapshot
+const sseStatsInterval = time.Second
+
+// Policies for SSE clients whose send queue is full
+const (
+	// SlowClientDropOldest discards the oldest queued frame to make room
+	SlowClientDropOldest = "drop_oldest"
+	// SlowClientDisconnect closes the connection, so the client reconnects and reloads
+	SlowClientDisconnect = "disconnect"
+	// SlowClientSummary sends short event summaries until the client catches up
+	SlowClientSummary = "summary"
+)
+
+// defaultSSEQueueSize is the number of frames buffered per SSE client
+const defaultSSEQueueSize = 256
+
+// sseWriteTimeout bounds a single write to an SSE client, so a stalled
+// connection cannot hold its writer forever
+const sseWriteTimeout = 10 * time.Second
+
+// SlowClient reports an SSE client that could not keep up with the stream
+type SlowClient struct {
+	ID string `json:"id"`
+	// Dropped is the number of frames discarded for this client
+	Dropped int `json:"dropped"`
+	// Queued is the number of frames waiting to be written
+	Queued int `json:"queued"`
+	// Summaries is set while the client is downgraded to event summaries
+	Summaries bool `json:"summaries,omitempty"`
+	// SlowSince is when the client's queue last filled up, if it has not caught up since
+	SlowSince *time.Time `json:"slowSince,omitempty"`
+}
+
+// eventSummary is sent instead of the full event to downgraded clients
+type eventSummary struct {
+	ID         int       `json:"id"`
+	Schema     string    `json:"schema"`
+	EventType  string    `json:"eventType,omitempty"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// sseFrame formats data as an SSE frame, named unless name is empty, and
+// stamps it with the frame schema version
+// The frame is built in a single allocation, as one is made per event
+func sseFrame(name string, data []byte) []byte {
+	frame := make([]byte, 0, len(name)+len(data)+len(apiVersionField)+16)
+	if name != "" {
+		frame = append(frame, "event: "...)
+		frame = append(frame, name...)
+		frame = append(frame, '\n')
+	}
+	frame = append(frame, "data: "...)
+	frame = appendAPIVersion(frame, data)
+	return append(frame, "\n\n"...)
+}
+
+// jsonlLine formats an event as a line of the JSON Lines stream: the stored
+// event, as returned by the events list, without display transforms
+func jsonlLine(event Event) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	data, err := encodeJSON(buf, event)
+	if err != nil {
+		return nil, err
+	}
+	line := make([]byte, 0, len(data)+1)
+	return append(append(line, data...), '\n'), nil
+}
+
+// ParseSSEChannels parses a comma-separated list of channel names
+// "all" subscribes to every channel
+func ParseSSEChannels(raw string) ([]string, error) {
+	channels := make([]string, 0)
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+			continue
+		case name == "all":
+			return SSEChannels, nil
+		}
+		known := false
+		for _, channel := range SSEChannels {
+			known = known || channel == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown channel %q, expected one of %s or all", name, strings.Join(SSEChannels, ", "))
+		}
+		channels = append(channels, name)
+	}
+	return channels, nil
+}
+
+// eventChannel returns the named SSE event an event is sent as
+func eventChannel(event Event) string {
+	if event.Schema == MarkerSchema {
+		return SSEChannelMarker
+	}
+	return SSEChannelNew
+}
+
+// named reports whether the client subscribed to named events
+func (c *SSEClient) named() bool {
+	return c.channels != nil
+}
+
+// wants reports whether the client should be sent messages on channel
+func (c *SSEClient) wants(channel string) bool {
+	if !c.named() {
+		return channel != SSEChannelStats
+	}
+	return c.channels[channel]
+}
+
+// frame formats data for the client: named on channel, or as an unnamed
+// message for events and markers on the original stream
+func (c *SSEClient) frame(channel string, data []byte) []byte {
+	if !c.named() && (channel == SSEChannelNew || channel == SSEChannelMarker) {
+		return sseFrame("", data)
+	}
+	return sseFrame(channel, data)
+}
+
+// summaryFrame builds the "summary" frame sent for an event to downgraded clients
+func summaryFrame(event Event) ([]byte, error) {
+	summary := eventSummary{ID: event.ID, Schema: event.Schema, ReceivedAt: event.ReceivedAt}
+	if len(event.Data) > 0 {
+		summary.EventType, _ = event.Data[0]["e"].(string)
+	}
+	return encodeFrame("summary", summary)
+}
+
+// slowClientPolicy returns the configured policy for clients that fall behind
+func (s *AppServer) slowClientPolicy() string {
+	if s.config.SSESlowClientPolicy == "" {
+		return SlowClientDropOldest
+	}
+	return s.config.SSESlowClientPolicy
+}
+
+// sseQueueSize returns the configured number of frames buffered per client
+func (s *AppServer) sseQueueSize() int {
+	if s.config.SSEQueueSize < 1 {
+		return defaultSSEQueueSize
+	}
+	return s.config.SSEQueueSize
+}
+
+// enqueue queues a frame for the client without blocking, applying policy when
+// the queue is full
+// It reports whether the frame or an older one was dropped, and whether the
+// client should be disconnected
+func (c *SSEClient) enqueue(frame []byte, policy string) (dropped bool, disconnect bool) {
+	select {
+	case c.queue <- frame:
+		return false, false
+	default:
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.dropped++
+	if c.slowSince.IsZero() {
+		c.slowSince = time.Now()
+	}
+	if policy == SlowClientDisconnect {
+		return true, true
+	}
+	if policy == SlowClientSummary {
+		c.summaries = true
+	}
+
+	// Make room by discarding the oldest frame; if another broadcast filled the
+	// gap first, this frame is the one dropped
+	select {
+	case <-c.queue:
+	default:
+	}
+	select {
+	case c.queue <- frame:
+	default:
+	}
+	return true, false
+}
+
+// downgraded reports whether the client should be sent event summaries
+func (c *SSEClient) downgraded() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.summaries
+}
+
+// caughtUp clears the slow state once the client's queue has drained
+func (c *SSEClient) caughtUp() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.summaries = false
+	c.slowSince = time.Time{}
+}
+
+// sendFrame queues a frame for a client and disconnects it if the policy says so
+func (s *AppServer) sendFrame(client *SSEClient, frame []byte) {
+	policy := s.slowClientPolicy()
+	// Summaries are SSE frames; JSON Lines clients only ever get whole events
+	if client.jsonl && policy == SlowClientSummary {
+		policy = SlowClientDropOldest
+	}
+	dropped, disconnect := client.enqueue(frame, policy)
+	if !dropped {
+		return
+	}
+	s.CountMetric(MetricSSEDropped, "")
+	if disconnect {
+		log.Printf("Disconnecting slow SSE client %s\n", client.ID)
+		s.CountMetric(MetricSSESlowDisconnects, "")
+		go s.RemoveSSEClient(client.ID)
+	}
+}
+
+// ServeSSEClient writes the client's queued frames until the request ends or
+// the server removes the client
+// Clients subscribed to stats are also sent a snapshot every second, and
+// streams past sse_idle_timeout or sse_max_connection_age are sent a "close"
+// frame and ended
+func (s *AppServer) ServeSSEClient(ctx context.Context, client *SSEClient) {
+	controller := http.NewResponseController(client.Writer)
+	idleTimeout := parseDurationSetting("sse_idle_timeout", s.config.SSEIdleTimeout)
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if idleTimeout > 0 {
+		idleTimer = time.NewTimer(idleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+	lastWrite := time.Now()
+
+	write := func(frame []byte) bool {
+		controller.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+		if _, err := client.Writer.Write(frame); err != nil {
+			log.Printf("Error sending to client %s: %v\n", client.ID, err)
+			s.CountMetric(MetricSSEDropped, "")
+			s.RemoveSSEClient(client.ID)
+			return false
+		}
+		client.Flusher.Flush()
+		lastWrite = time.Now()
+		return true
+	}
+
+	// Say why the stream is ending, so clients can decide whether to reconnect
+	closeStream := func(reason string) {
+		log.Printf("Closing SSE client %s (%s)\n", client.ID, reason)
+		// JSON Lines streams carry events only, so they just end
+		if !client.jsonl {
+			closeFrame, _ := encodeFrame("close", map[string]interface{}{"reason": reason})
+			write(closeFrame)
+		}
+		s.RemoveSSEClient(client.ID)
+	}
+
+	// A nil channel never fires, so clients without stats or limits get no ticks
+	var statsTicks <-chan time.Time
+	if client.wants(SSEChannelStats) {
+		ticker := time.NewTicker(sseStatsInterval)
+		defer ticker.Stop()
+		statsTicks = ticker.C
+	}
+	var maxAge <-chan time.Time
+	if age := parseDurationSetting("sse_max_connection_age", s.config.SSEMaxConnectionAge); age > 0 {
+		timer := time.NewTimer(age - time.Since(client.started))
+		defer timer.Stop()
+		maxAge = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.RemoveSSEClient(client.ID)
+			return
+		case <-client.Done:
+			return
+		case frame := <-client.queue:
+			if !write(frame) {
+				return
+			}
+			if len(client.queue) == 0 {
+				client.caughtUp()
+			}
+		case <-idle:
+			// The timer is not reset on every write; check for activity since it started
+			if remaining := idleTimeout - time.Since(lastWrite); remaining > 0 {
+				idleTimer.Reset(remaining)
+				continue
+			}
+			closeStream(CloseReasonIdle)
+			return
+		case <-maxAge:
+			closeStream(CloseReasonMaxAge)
+			return
+		case <-statsTicks:
+			frame, err := s.statsFrame()
+			if err != nil {
+				log.Printf("Error marshaling stats: %v\n", err)
+				continue
+			}
+			if !write(frame) {
+				return
+			}
+		}
+	}
+}
+
+// slowClients lists the connected SSE clients that have dropped frames
+func (s *AppServer) slowClients() []SlowClient {
+	s.sseMutex.RLock()
+	defer s.sseMutex.RUnlock()
+
+	slow := make([]SlowClient, 0)
+	for _, client := range s.sseClients {
+		client.mutex.Lock()
+		if client.dropped > 0 {
+			report := SlowClient{
+				ID:        client.ID,
+				Dropped:   client.dropped,
+				Queued:    len(client.queue),
+				Summaries: client.summaries,
+			}
+			if !client.slowSince.IsZero() {
+				since := client.slowSince
+				report.SlowSince = &since
+			}
+			slow = append(slow, report)
+		}
+		client.mutex.Unlock()
+	}
+	sort.Slice(slow, func(i, j int) bool { return slow[i].ID < slow[j].ID })
+	return slow
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// maxPooledBuffer keeps buffers grown by unusually large events out of the pool
+const maxPooledBuffer = 64 << 10
+
+// encodeBuffers holds scratch buffers for marshalling SSE frame data, so a busy
+// stream does not allocate a fresh buffer for every event
+var encodeBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// getBuffer takes an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	return encodeBuffers.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns a buffer to the pool; its contents must no longer be used
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	encodeBuffers.Put(buf)
+}
+
+// encodeJSON marshals v into buf and returns the JSON, which is only valid
+// until buf is reused
+// The output matches json.Marshal, without its copy into a fresh slice
+func encodeJSON(buf *bytes.Buffer, v interface{}) ([]byte, error) {
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+// encodeFrame marshals v into a pooled buffer and formats it as an SSE frame,
+// so the frame is the only allocation kept
+func encodeFrame(name string, v interface{}) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	data, err := encodeJSON(buf, v)
+	if err != nil {
+		return nil, err
+	}
+	return sseFrame(name, data), nil
+}
+
+// statsFrameCache holds the last stats frame, shared by every client
+// subscribed to the stats channel
+type statsFrameCache struct {
+	mutex sync.Mutex
+	frame []byte
+	built time.Time
+}
+
+// statsFrame returns the current stats frame
+// Clients tick independently, so a frame built within half a stats interval is
+// reused rather than marshalling the stats again for each one
+func (s *AppServer) statsFrame() ([]byte, error) {
+	s.statsCache.mutex.Lock()
+	defer s.statsCache.mutex.Unlock()
+
+	if s.statsCache.frame != nil && time.Since(s.statsCache.built) < sseStatsInterval/2 {
+		return s.statsCache.frame, nil
+	}
+	frame, err := encodeFrame(SSEChannelStats, s.GetStats())
+	if err != nil {
+		return nil, err
+	}
+	s.statsCache.frame = frame
+	s.statsCache.built = time.Now()
+	return frame, nil
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"bytes"
+	"embed"
+	"strconv"
+)
+
+// SSEAPIVersion is the version of the SSE frame schema, sent as api_version in
+// every frame
+// Bump it, and add schemas/sse_event/<version>.json, when the frame structure changes
+const SSEAPIVersion = "1-0-11"
+
+// SSEEventSchemaPath is where the SSE frame schemas are served, followed by the version
+const SSEEventSchemaPath = "/schemas/goplow/sse_event/jsonschema/"
+
+//go:embed schemas/sse_event
+var sseEventSchemas embed.FS
+
+// GetSSEEventSchema returns the SSE frame schema for version, or false if there is none
+func GetSSEEventSchema(version string) ([]byte, bool) {
+	data, err := sseEventSchemas.ReadFile("schemas/sse_event/" + version + ".json")
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// apiVersionField opens a JSON object with the api_version field
+var apiVersionField = `{"api_version":` + strconv.Quote(SSEAPIVersion)
+
+// stampAPIVersion adds the api_version field to a JSON object
+func stampAPIVersion(data []byte) []byte {
+	return appendAPIVersion(nil, data)
+}
+
+// appendAPIVersion appends data to dst, adding the api_version field if data
+// is a JSON object
+func appendAPIVersion(dst []byte, data []byte) []byte {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) < 2 || trimmed[0] != '{' {
+		return append(dst, data...)
+	}
+	dst = append(dst, apiVersionField...)
+	rest := bytes.TrimSpace(trimmed[1:])
+	if rest[0] != '}' {
+		dst = append(dst, ',')
+	}
+	return append(dst, rest...)
+}
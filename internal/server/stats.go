@@ -0,0 +1,212 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statsWindow is the number of seconds used for rolling rates
+const statsWindow = 10
+
+// Stats is a snapshot of the server's ingest and streaming health
+type Stats struct {
+	// EventsPerSecond is the rolling average of accepted events
+	EventsPerSecond float64 `json:"eventsPerSecond"`
+	// FailureRate is the rolling ratio of events that failed schema validation,
+	// whether stored with violations or rejected in strict mode, to all events
+	// received
+	FailureRate float64 `json:"failureRate"`
+	// SSEClients is the number of connected event stream clients
+	SSEClients int `json:"sseClients"`
+	// BufferedEvents is the number of events currently held in memory
+	BufferedEvents int `json:"bufferedEvents"`
+	// TotalEvents is the number of events accepted since startup
+	TotalEvents int `json:"totalEvents"`
+	// TotalRejected is the number of ingest requests rejected since startup
+	TotalRejected int `json:"totalRejected"`
+	// TotalSuppressed is the number of events dropped by sampling since startup
+	TotalSuppressed int `json:"totalSuppressed"`
+	// SuppressedByType breaks TotalSuppressed down by tracker event type
+	SuppressedByType map[string]int `json:"suppressedByType"`
+	// SlowClients lists connected SSE clients that have dropped frames
+	SlowClients []SlowClient `json:"slowClients"`
+	// SlowClientsDisconnected is the number of SSE clients disconnected for
+	// falling behind since startup
+	SlowClientsDisconnected int `json:"slowClientsDisconnected"`
+	// Classifications counts the buffered events with each classification label
+	Classifications map[string]int `json:"classifications"`
+	// PayloadBytes is the distribution of the JSON size of tracker events
+	// accepted since startup, one per payload item
+	PayloadBytes Histogram `json:"payloadBytes"`
+	// ContextCounts is the distribution of the number of context entities
+	// attached to them
+	ContextCounts Histogram `json:"contextCounts"`
+	// WindowSeconds is the length of the rolling window used for rates
+	WindowSeconds int       `json:"windowSeconds"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// throughput keeps per-second counts of received, accepted and invalid events
+// Counts are atomic so ingest never waits for a stats reader; the mutex is only
+// taken to recycle a bucket when a new second starts
+type throughput struct {
+	mutex         sync.Mutex
+	buckets       [statsWindow]throughputBucket
+	totalAccepted atomic.Int64
+	totalRejected atomic.Int64
+}
+
+// throughputBucket holds the counts for one second of the window
+type throughputBucket struct {
+	second atomic.Int64
+	// received counts accepted events and those rejected in strict mode
+	received atomic.Int64
+	accepted atomic.Int64
+	// invalid counts the received events that failed schema validation
+	invalid atomic.Int64
+}
+
+// bucket returns the bucket for the given second, resetting it if it holds stale counts
+// A count recorded late for a second that has already been recycled is added
+// to the newer second rather than resetting it again
+func (t *throughput) bucket(now int64) *throughputBucket {
+	b := &t.buckets[now%statsWindow]
+	if b.second.Load() >= now {
+		return b
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if b.second.Load() < now {
+		b.received.Store(0)
+		b.accepted.Store(0)
+		b.invalid.Store(0)
+		b.second.Store(now)
+	}
+	return b
+}
+
+// recordAccepted counts an accepted event, and whether it failed validation
+func (t *throughput) recordAccepted(now time.Time, invalid bool) {
+	b := t.bucket(now.Unix())
+	b.received.Add(1)
+	b.accepted.Add(1)
+	if invalid {
+		b.invalid.Add(1)
+	}
+	t.totalAccepted.Add(1)
+}
+
+// recordRejectedEvents counts the events of a request rejected in strict
+// mode, invalid of them having failed validation
+func (t *throughput) recordRejectedEvents(now time.Time, invalid int, total int) {
+	b := t.bucket(now.Unix())
+	b.received.Add(int64(total))
+	b.invalid.Add(int64(invalid))
+}
+
+// recordRejected counts a rejected ingest request
+func (t *throughput) recordRejected() {
+	t.totalRejected.Add(1)
+}
+
+// rates returns the rolling events per second and failure rate
+func (t *throughput) rates(now time.Time) (float64, float64) {
+	current := now.Unix()
+	received, accepted, invalid := int64(0), int64(0), int64(0)
+	for i := range t.buckets {
+		b := &t.buckets[i]
+		if current-b.second.Load() < statsWindow {
+			received += b.received.Load()
+			accepted += b.accepted.Load()
+			invalid += b.invalid.Load()
+		}
+	}
+
+	failureRate := 0.0
+	if received > 0 {
+		failureRate = float64(invalid) / float64(received)
+	}
+	return float64(accepted) / statsWindow, failureRate
+}
+
+// RecordRejected counts an ingest request that was rejected as malformed or,
+// in strict mode, for invalid events
+func (s *AppServer) RecordRejected() {
+	s.throughput.recordRejected()
+}
+
+// RecordRejectedEvents counts the events of a request rejected in strict
+// mode for the failure rate: invalid of them failed validation, out of total
+func (s *AppServer) RecordRejectedEvents(invalid int, total int) {
+	s.throughput.recordRejectedEvents(s.Now(), invalid, total)
+}
+
+// otherEventType labels events without a known tracker event type in EventTypeCounts
+const otherEventType = "other"
+
+// trackerEventTypes are the values of the tracker e parameter that label
+// events; trackers can send anything, and each label is a metrics series
+var trackerEventTypes = map[string]bool{
+	"pv": true,
+	"pp": true,
+	"se": true,
+	"ue": true,
+	"tr": true,
+	"ti": true,
+}
+
+// eventTypeLabel returns the tracker event type of an event, e.g. "pv", or
+// "other" if it has none or an unknown one
+func eventTypeLabel(event Event) string {
+	if len(event.Data) > 0 {
+		if eventType, _ := event.Data[0]["e"].(string); trackerEventTypes[eventType] {
+			return eventType
+		}
+	}
+	return otherEventType
+}
+
+// EventTypeCounts returns the number of events accepted since startup by
+// tracker event type, with "other" for events that have none
+func (s *AppServer) EventTypeCounts() map[string]int {
+	_, counts := s.eventTypes.snapshot()
+	return counts
+}
+
+// GetStats returns a snapshot of the current server statistics
+func (s *AppServer) GetStats() Stats {
+	now := s.Now()
+	eventsPerSecond, failureRate := s.throughput.rates(now)
+
+	s.mutex.RLock()
+	buffered := len(s.events)
+	classifications := classificationCounts(s.events)
+	s.mutex.RUnlock()
+
+	s.sseMutex.RLock()
+	clients := len(s.sseClients)
+	s.sseMutex.RUnlock()
+
+	totalSuppressed, suppressedByType := s.sampler.counts()
+
+	return Stats{
+		EventsPerSecond:         eventsPerSecond,
+		FailureRate:             failureRate,
+		SSEClients:              clients,
+		BufferedEvents:          buffered,
+		TotalEvents:             int(s.throughput.totalAccepted.Load()),
+		TotalRejected:           int(s.throughput.totalRejected.Load()),
+		TotalSuppressed:         totalSuppressed,
+		SuppressedByType:        suppressedByType,
+		SlowClients:             s.slowClients(),
+		SlowClientsDisconnected: s.metricTotal(MetricSSESlowDisconnects),
+		Classifications:         classifications,
+		PayloadBytes:            s.payloads.bytes.snapshot(),
+		ContextCounts:           s.payloads.contexts.snapshot(),
+		WindowSeconds:           statsWindow,
+		Timestamp:               now,
+	}
+}
@@ -0,0 +1,45 @@
+package server
+
+import "testing"
+
+func TestEventTypeCountsBoundLabels(t *testing.T) {
+	s := newTestServer(t)
+	for _, eventType := range []string{"pv", "pv", "se", "made-up", "x1", ""} {
+		s.AddEvent("test", []map[string]interface{}{{"e": eventType}})
+	}
+	s.AddEvent("test", []map[string]interface{}{{"message": "no type"}})
+
+	counts := s.EventTypeCounts()
+	want := map[string]int{"pv": 2, "se": 1, "other": 4}
+	if len(counts) != len(want) {
+		t.Errorf("got labels %v, want %v", counts, want)
+	}
+	for label, count := range want {
+		if counts[label] != count {
+			t.Errorf("%s: got %d, want %d", label, counts[label], count)
+		}
+	}
+}
+
+func TestFailureRateCountsInvalidEvents(t *testing.T) {
+	s := newTestServer(t)
+	s.AddEvent("test", []map[string]interface{}{{"e": "pv"}})
+	s.AddEventRecord(Event{
+		Schema:     "test",
+		Data:       []map[string]interface{}{{"e": "ue"}},
+		Violations: []Violation{{Keyword: "type"}},
+	})
+	// A strict mode batch of 2 events, one of them invalid
+	s.RecordRejected()
+	s.RecordRejectedEvents(1, 2)
+	// Malformed requests have no events to count
+	s.RecordRejected()
+
+	stats := s.GetStats()
+	if stats.FailureRate != 0.5 {
+		t.Errorf("got failure rate %v, want 2 invalid of 4 events", stats.FailureRate)
+	}
+	if stats.TotalEvents != 2 || stats.TotalRejected != 2 {
+		t.Errorf("got %d events and %d rejected requests, want 2 and 2", stats.TotalEvents, stats.TotalRejected)
+	}
+}
@@ -0,0 +1,460 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"goplow/pkg/backend"
+)
+
+// Event store backends, selected with the store setting
+const (
+	// StoreMemory keeps events in the in-memory buffer only
+	StoreMemory = "memory"
+	// StoreFile also persists them to an append-only log in the data directory
+	StoreFile = "file"
+)
+
+// compactMinDead is how many deleted records the file store tolerates before
+// rewriting its log
+const compactMinDead = 1000
+
+// EventStore persists the event buffer, so it survives restarts
+type EventStore = backend.EventStore
+
+// fileRecord locates one event in the file store's log
+type fileRecord struct {
+	id         int
+	receivedAt time.Time
+	offset     int64
+	length     int
+}
+
+// FileStore is a pure-Go EventStore backed by a JSON Lines log with an
+// in-memory index
+// Deletes are appended as {"deleteBefore": id} or {"delete": [ids]} records, and
+// deleted events are dropped from the log when it is compacted
+type FileStore struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+	size  int64
+	index []fileRecord
+	dead  int
+}
+
+// OpenFileStore opens or creates the log at path and indexes its events
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	store := &FileStore{path: path, file: file}
+	if err := store.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// load indexes the log, truncating a partial record left by a crash
+func (f *FileStore) load() error {
+	reader := bufio.NewReader(f.file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.Printf("Discarding partial record at the end of %s\n", f.path)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var header struct {
+			ID           int       `json:"id"`
+			ReceivedAt   time.Time `json:"receivedAt"`
+			DeleteBefore int       `json:"deleteBefore"`
+			Delete       []int     `json:"delete"`
+		}
+		switch {
+		case json.Unmarshal(line, &header) != nil:
+			f.dead++
+		case header.DeleteBefore > 0:
+			f.dead++
+			f.cut(header.DeleteBefore)
+		case len(header.Delete) > 0:
+			f.dead++
+			f.remove(header.Delete)
+		default:
+			f.index = append(f.index, fileRecord{id: header.ID, receivedAt: header.ReceivedAt, offset: offset, length: len(line)})
+		}
+		offset += int64(len(line))
+	}
+	f.size = offset
+	return f.file.Truncate(offset)
+}
+
+// Append writes an event to the end of the log
+func (f *FileStore) Append(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.write(line); err != nil {
+		return err
+	}
+	f.index = append(f.index, fileRecord{id: event.ID, receivedAt: event.ReceivedAt, offset: f.size - int64(len(line)), length: len(line)})
+	return nil
+}
+
+// write appends a line to the log; callers must hold the mutex
+func (f *FileStore) write(line []byte) error {
+	if _, err := f.file.WriteAt(line, f.size); err != nil {
+		return err
+	}
+	f.size += int64(len(line))
+	return nil
+}
+
+// ScanByID returns the stored events with from <= ID <= to
+func (f *FileStore) ScanByID(from int, to int) ([]Event, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	start := sort.Search(len(f.index), func(i int) bool { return f.index[i].id >= from })
+	end := sort.Search(len(f.index), func(i int) bool { return f.index[i].id > to })
+	if start >= end {
+		return []Event{}, nil
+	}
+	return f.read(f.index[start:end])
+}
+
+// ScanByTime returns the stored events received in [from, to)
+func (f *FileStore) ScanByTime(from time.Time, to time.Time) ([]Event, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var records []fileRecord
+	for _, record := range f.index {
+		if !record.receivedAt.Before(from) && record.receivedAt.Before(to) {
+			records = append(records, record)
+		}
+	}
+	return f.read(records)
+}
+
+// read decodes the given records; callers must hold the mutex
+func (f *FileStore) read(records []fileRecord) ([]Event, error) {
+	events := make([]Event, 0, len(records))
+	for _, record := range records {
+		line := make([]byte, record.length)
+		if _, err := f.file.ReadAt(line, record.offset); err != nil {
+			return nil, err
+		}
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// DeleteBefore removes the events with IDs below id, compacting the log once
+// deleted records outnumber live ones
+func (f *FileStore) DeleteBefore(id int) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.index) == 0 || f.index[0].id >= id {
+		return nil
+	}
+	tombstone, err := json.Marshal(map[string]int{"deleteBefore": id})
+	if err != nil {
+		return err
+	}
+	if err := f.write(append(tombstone, '\n')); err != nil {
+		return err
+	}
+	f.dead++
+	f.cut(id)
+	return f.compactIfMostlyDead()
+}
+
+// Delete removes the events with the given IDs, compacting the log once
+// deleted records outnumber live ones
+func (f *FileStore) Delete(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	tombstone, err := json.Marshal(map[string][]int{"delete": ids})
+	if err != nil {
+		return err
+	}
+	if err := f.write(append(tombstone, '\n')); err != nil {
+		return err
+	}
+	f.dead++
+	f.remove(ids)
+	return f.compactIfMostlyDead()
+}
+
+// compactIfMostlyDead compacts the log once deleted records outnumber live
+// ones; callers must hold the mutex
+func (f *FileStore) compactIfMostlyDead() error {
+	if f.dead < compactMinDead || f.dead < len(f.index) {
+		return nil
+	}
+	return f.compact()
+}
+
+// cut drops the indexed records with IDs below id; callers must hold the mutex
+func (f *FileStore) cut(id int) {
+	cut := sort.Search(len(f.index), func(i int) bool { return f.index[i].id >= id })
+	f.index = f.index[cut:]
+	f.dead += cut
+}
+
+// remove drops the indexed records with the given IDs; callers must hold the mutex
+func (f *FileStore) remove(ids []int) {
+	deleted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		deleted[id] = true
+	}
+	kept := f.index[:0]
+	for _, record := range f.index {
+		if !deleted[record.id] {
+			kept = append(kept, record)
+		}
+	}
+	f.dead += len(f.index) - len(kept)
+	f.index = kept
+}
+
+// compact rewrites the log with only the live records, dropping deleted ones
+// and tombstones; callers must hold the mutex
+func (f *FileStore) compact() error {
+	temp, err := os.CreateTemp(filepath.Dir(f.path), ".events-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	var buffer bytes.Buffer
+	index := make([]fileRecord, 0, len(f.index))
+	var offset int64
+	for _, record := range f.index {
+		line := make([]byte, record.length)
+		if _, err := f.file.ReadAt(line, record.offset); err != nil {
+			temp.Close()
+			return err
+		}
+		buffer.Write(line)
+		record.offset = offset
+		index = append(index, record)
+		offset += int64(record.length)
+	}
+	if _, err := temp.Write(buffer.Bytes()); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), f.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.path, os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	f.file.Close()
+	f.file = file
+	f.index = index
+	f.size = offset
+	f.dead = 0
+	return nil
+}
+
+// LastID returns the highest stored ID, or 0 if the store is empty
+func (f *FileStore) LastID() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.index) == 0 {
+		return 0
+	}
+	return f.index[len(f.index)-1].id
+}
+
+// Close closes the log file
+func (f *FileStore) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.file.Close()
+}
+
+// SetEventStore persists the buffer to store, first restoring the latest
+// max_messages events from it
+func (s *AppServer) SetEventStore(store EventStore) error {
+	lastID := store.LastID()
+	// IDs are not contiguous after an archive load, so keep the newest by position
+	restored, err := store.ScanByID(0, lastID)
+	if err != nil {
+		return err
+	}
+	if len(restored) > s.config.MaxMsgs {
+		restored = restored[len(restored)-s.config.MaxMsgs:]
+	}
+	// Drop anything older than the restored buffer
+	if len(restored) > 0 {
+		if err := store.DeleteBefore(restored[0].ID); err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.store = store
+	s.events = append(restored, s.events...)
+	if lastID > s.eventID {
+		s.eventID = lastID
+	}
+	return nil
+}
+
+// storeWriter applies buffer changes to the event store one at a time in the
+// order they were made, so ingest never waits on disk under the buffer's lock
+// Writes are queued while the lock is held, and a single worker applies them
+// without it; the worker exits when the queue is empty and is started again
+// by the next push
+type storeWriter struct {
+	mutex   sync.Mutex
+	pending []func()
+	running bool
+	// idle is signalled when the worker exits
+	idle *sync.Cond
+}
+
+// push queues a write without waiting for it
+func (w *storeWriter) push(write func()) {
+	w.mutex.Lock()
+	w.pending = append(w.pending, write)
+	start := !w.running
+	w.running = true
+	w.mutex.Unlock()
+
+	if start {
+		go w.run()
+	}
+}
+
+// run applies the queued writes until none are left
+func (w *storeWriter) run() {
+	for {
+		w.mutex.Lock()
+		pending := w.pending
+		w.pending = nil
+		if len(pending) == 0 {
+			w.running = false
+			if w.idle != nil {
+				w.idle.Broadcast()
+			}
+			w.mutex.Unlock()
+			return
+		}
+		w.mutex.Unlock()
+
+		for _, write := range pending {
+			write()
+		}
+	}
+}
+
+// wait blocks until every queued write has been applied
+func (w *storeWriter) wait() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.idle == nil {
+		w.idle = sync.NewCond(&w.mutex)
+	}
+	for w.running {
+		w.idle.Wait()
+	}
+}
+
+// CloseEventStore waits for the queued store writes and closes the store, if
+// one is configured; events added afterwards are kept in memory only
+func (s *AppServer) CloseEventStore() error {
+	s.mutex.Lock()
+	store := s.store
+	s.store = nil
+	s.mutex.Unlock()
+
+	s.storeWrites.wait()
+	if store == nil {
+		return nil
+	}
+	return store.Close()
+}
+
+// storeAppend persists an event, if a store is configured; callers must hold mutex
+func (s *AppServer) storeAppend(event Event) {
+	store := s.store
+	if store == nil {
+		return
+	}
+	s.storeWrites.push(func() {
+		if err := store.Append(event); err != nil {
+			log.Printf("Error persisting event %d: %v\n", event.ID, err)
+		}
+	})
+}
+
+// storeDelete removes the events with the given IDs from the store, if any;
+// callers must hold mutex
+func (s *AppServer) storeDelete(ids []int) {
+	store := s.store
+	if store == nil {
+		return
+	}
+	s.storeWrites.push(func() {
+		if err := store.Delete(ids); err != nil {
+			log.Printf("Error deleting persisted events: %v\n", err)
+		}
+	})
+}
+
+// storeDeleteBefore removes events with IDs below id from the store, if any;
+// callers must hold mutex
+func (s *AppServer) storeDeleteBefore(id int) {
+	store := s.store
+	if store == nil {
+		return
+	}
+	s.storeWrites.push(func() {
+		if err := store.DeleteBefore(id); err != nil {
+			log.Printf("Error deleting persisted events: %v\n", err)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// slowStore is a sliceStore whose appends wait for release
+type slowStore struct {
+	sliceStore
+	release chan struct{}
+}
+
+func (s *slowStore) Append(event Event) error {
+	<-s.release
+	return s.sliceStore.Append(event)
+}
+
+func TestStoreWritesDoNotHoldUpIngest(t *testing.T) {
+	s := newTestServer(t)
+	s.config.MaxMsgs = 2
+	store := &slowStore{release: make(chan struct{})}
+	if err := s.SetEventStore(store); err != nil {
+		t.Fatal(err)
+	}
+
+	added := make(chan struct{})
+	go func() {
+		for _, name := range []string{"pv", "pp", "se"} {
+			s.AddEvent("test", []map[string]interface{}{{"e": name}})
+		}
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("adding events waited for the store")
+	}
+
+	close(store.release)
+	s.storeWrites.wait()
+	// The eviction of the first event is applied after its append
+	var ids []int
+	for _, event := range store.events {
+		ids = append(ids, event.ID)
+	}
+	if fmt.Sprint(ids) != "[2 3]" {
+		t.Errorf("stored IDs %v, want [2 3]", ids)
+	}
+}
+
+// closingStore records whether it was closed
+type closingStore struct {
+	sliceStore
+	closed bool
+}
+
+func (s *closingStore) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestCloseEventStoreWritesQueuedEventsFirst(t *testing.T) {
+	s := newTestServer(t)
+	store := &closingStore{}
+	if err := s.SetEventStore(store); err != nil {
+		t.Fatal(err)
+	}
+	s.AddEvent("test", []map[string]interface{}{{"e": "pv"}})
+
+	if err := s.CloseEventStore(); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.events) != 1 || !store.closed {
+		t.Errorf("stored %d events (closed %v), want the event stored before closing", len(store.events), store.closed)
+	}
+	// Later events are not written to the closed store
+	s.AddEvent("test", []map[string]interface{}{{"e": "pp"}})
+	s.storeWrites.wait()
+	if len(store.events) != 1 {
+		t.Errorf("stored %d events after closing, want 1", len(store.events))
+	}
+}
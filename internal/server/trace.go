@@ -0,0 +1,64 @@
+package server
+
+import (
+	"strings"
+
+	"goplow/pkg/backend"
+)
+
+// TraceContext is the W3C trace context (traceparent) an event was produced under
+type TraceContext = backend.TraceContext
+
+// ParseTraceparent parses a W3C traceparent value, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+// Later versions may append fields, which are ignored as the spec requires
+func ParseTraceparent(value string) (*TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return nil, false
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isLowerHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return nil, false
+	}
+	if !isLowerHex(traceID, 32) || traceID == strings.Repeat("0", 32) {
+		return nil, false
+	}
+	if !isLowerHex(parentID, 16) || parentID == strings.Repeat("0", 16) {
+		return nil, false
+	}
+	if !isLowerHex(flags, 2) {
+		return nil, false
+	}
+	return &TraceContext{
+		TraceID:  traceID,
+		ParentID: parentID,
+		// The sampled flag is the lowest bit
+		Sampled: strings.IndexByte("13579bdf", flags[1]) >= 0,
+	}, true
+}
+
+// isLowerHex reports whether value is length lowercase hex digits
+func isLowerHex(value string, length int) bool {
+	if len(value) != length {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if !(value[i] >= '0' && value[i] <= '9' || value[i] >= 'a' && value[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterEventsByTrace returns the events recorded under the given trace ID
+func FilterEventsByTrace(events []Event, traceID string) []Event {
+	traceID = strings.ToLower(traceID)
+	filtered := make([]Event, 0)
+	for _, event := range events {
+		if event.Trace != nil && event.Trace.TraceID == traceID {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
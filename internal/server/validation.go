@@ -0,0 +1,45 @@
+package server
+
+import "goplow/pkg/backend"
+
+// Violation describes one way an event's self-describing data breaks its schema
+type Violation = backend.Violation
+
+// Validator checks the self-describing data of an event against its schemas
+type Validator interface {
+	Validate(event Event) []Violation
+}
+
+// SetValidator sets the validator run on every event before it is stored
+func (s *AppServer) SetValidator(validator Validator) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.validator = validator
+}
+
+// ValidateEvent returns the event's schema violations, or nil if it is valid
+// or no validator is configured
+func (s *AppServer) ValidateEvent(event Event) []Violation {
+	s.mutex.RLock()
+	validator := s.validator
+	s.mutex.RUnlock()
+
+	if validator == nil {
+		return nil
+	}
+	return validator.Validate(event)
+}
+
+// GetEvent returns the buffered event with the given ID
+func (s *AppServer) GetEvent(id int) (Event, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, event := range s.events {
+		if event.ID == id {
+			return event, true
+		}
+	}
+	return Event{}, false
+}
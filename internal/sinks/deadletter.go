@@ -0,0 +1,150 @@
+package sinks
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"goplow/internal/server"
+)
+
+// maxDeadLetters is the number of dead letters a sink keeps; older ones are dropped
+const maxDeadLetters = 1000
+
+// deadLetters holds the events a sink gave up on, in a JSON Lines file if it has a path
+// New letters are appended to the file, which is rewritten when letters are
+// redelivered or it has grown to twice maxDeadLetters lines
+type deadLetters struct {
+	path    string
+	letters []server.DeadLetter
+	nextID  int
+	lines   int
+}
+
+// loadDeadLetters reads the dead letters kept at path by earlier runs
+func loadDeadLetters(path string) (*deadLetters, error) {
+	d := &deadLetters{path: path, nextID: 1}
+	if path == "" {
+		return d, nil
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var letter server.DeadLetter
+		if json.Unmarshal(scanner.Bytes(), &letter) != nil {
+			continue
+		}
+		d.letters = append(d.letters, letter)
+		d.nextID = max(d.nextID, letter.ID+1)
+		d.lines++
+	}
+	if len(d.letters) > maxDeadLetters {
+		d.letters = d.letters[len(d.letters)-maxDeadLetters:]
+	}
+	return d, scanner.Err()
+}
+
+// add records an event that could not be delivered
+func (d *deadLetters) add(event server.Event, cause error, attempts int) error {
+	letter := server.DeadLetter{
+		ID:       d.nextID,
+		Event:    event,
+		Error:    cause.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	}
+	d.nextID++
+	d.letters = append(d.letters, letter)
+	if len(d.letters) > maxDeadLetters {
+		d.letters = d.letters[len(d.letters)-maxDeadLetters:]
+	}
+	if d.path == "" {
+		return nil
+	}
+	if d.lines >= 2*maxDeadLetters {
+		return d.save()
+	}
+
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(d.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	d.lines++
+	return nil
+}
+
+// list returns a copy of the dead letters, oldest first
+func (d *deadLetters) list() []server.DeadLetter {
+	return append([]server.DeadLetter{}, d.letters...)
+}
+
+// remove drops the dead letters for which done returns true
+func (d *deadLetters) remove(done func(server.DeadLetter) bool) (int, error) {
+	kept := d.letters[:0]
+	removed := 0
+	for _, letter := range d.letters {
+		if done(letter) {
+			removed++
+			continue
+		}
+		kept = append(kept, letter)
+	}
+	d.letters = kept
+	if removed == 0 || d.path == "" {
+		return removed, nil
+	}
+	return removed, d.save()
+}
+
+// save rewrites the file with the current dead letters, removing it if there are none
+func (d *deadLetters) save() error {
+	if len(d.letters) == 0 {
+		d.lines = 0
+		if err := os.Remove(d.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	temp := d.path + ".tmp"
+	file, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, letter := range d.letters {
+		if err := encoder.Encode(letter); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	d.lines = len(d.letters)
+	return os.Rename(temp, d.path)
+}
@@ -0,0 +1,464 @@
+// Package sinks delivers events to outside services, retrying with backoff
+// while a target is down and optionally spilling to disk when the queue fills
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"goplow/internal/server"
+)
+
+// Defaults for sinks whose options leave them unset
+const (
+	DefaultQueueSize = 1000
+	DefaultBackoff   = time.Second
+)
+
+// maxBackoff caps the delay between delivery attempts
+const maxBackoff = time.Minute
+
+// DeliverFunc sends one event to a sink's target
+type DeliverFunc func(ctx context.Context, event server.Event) error
+
+// Options configures a sink's queue and retries
+type Options struct {
+	// QueueSize is the number of events held in memory
+	QueueSize int
+	// MaxAttempts is the number of times an event is sent before it is dropped
+	MaxAttempts int
+	// Backoff is the delay before the second attempt, doubled for each one after
+	Backoff time.Duration
+	// SpillPath is the file events are written to while the queue is full; empty
+	// drops them instead
+	SpillPath string
+	// SpillMaxBytes bounds the spill file; 0 for no limit
+	SpillMaxBytes int64
+	// DeadLetterPath is the file events that used all their attempts are kept
+	// in; empty keeps them in memory only
+	DeadLetterPath string
+}
+
+// OptionsFromConfig returns the options for the named sink from a validated
+// configuration, with its dead letters and any spill file in the data directory
+func OptionsFromConfig(config server.EnvironmentConfig, name string) (Options, error) {
+	options := Options{
+		QueueSize:     DefaultQueueSize,
+		MaxAttempts:   config.SinkMaxAttempts,
+		Backoff:       DefaultBackoff,
+		SpillMaxBytes: int64(config.SinkSpillMaxMB) << 20,
+	}
+	if backoff, err := time.ParseDuration(config.SinkRetryBackoff); err == nil {
+		options.Backoff = backoff
+	}
+
+	var err error
+	if options.DeadLetterPath, err = config.DataPath(name + ".dead-letter.jsonl"); err != nil {
+		return options, err
+	}
+	if config.SinkSpill {
+		if options.SpillPath, err = config.DataPath(name + ".spill.jsonl"); err != nil {
+			return options, err
+		}
+	}
+	return options, nil
+}
+
+// Sink queues events for a target and delivers them in order from Run
+// While the target is down, the event at the head of the queue is retried with
+// exponential backoff and later events wait behind it
+type Sink struct {
+	name    string
+	deliver DeliverFunc
+	options Options
+	queue   chan server.Event
+
+	// mutex guards the spill file, dead letters, closed and the delivery health
+	mutex  sync.Mutex
+	spill  *spill
+	dead   *deadLetters
+	closed bool
+	// failing is set while the latest delivery attempt failed
+	failing         bool
+	lastError       string
+	lastErrorAt     time.Time
+	lastDeliveredAt time.Time
+	delivered       int64
+	// undelivered counts failed events; failed is called with and without the mutex
+	undelivered atomic.Int64
+	// wake is signalled when an event is spilled
+	wake chan struct{}
+	// closing is closed by Close; done is closed when Run returns
+	closing chan struct{}
+	done    chan struct{}
+	// cancel aborts Run when Close's deadline passes
+	cancel context.CancelFunc
+
+	// OnFailure, if set, is called for each event that could not be delivered,
+	// with the reason ("queue_full", "spill_error", "send_error" or "shutdown")
+	OnFailure func(reason string)
+}
+
+// New creates a sink that sends events with deliver
+// If options.SpillPath is set, events spilled by the last run are delivered first
+func New(name string, deliver DeliverFunc, options Options) (*Sink, error) {
+	if options.QueueSize < 1 {
+		options.QueueSize = DefaultQueueSize
+	}
+	if options.MaxAttempts < 1 {
+		options.MaxAttempts = 1
+	}
+	sink := &Sink{
+		name:    name,
+		deliver: deliver,
+		options: options,
+		queue:   make(chan server.Event, options.QueueSize),
+		wake:    make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	dead, err := loadDeadLetters(options.DeadLetterPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s dead letters: %w", name, err)
+	}
+	sink.dead = dead
+	if options.SpillPath != "" {
+		spill, err := openSpill(options.SpillPath, options.SpillMaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("opening %s spill file: %w", name, err)
+		}
+		sink.spill = spill
+		if spill.pending() {
+			log.Printf("Sink %s: resuming %d bytes of spilled events from %s\n", name, spill.size, options.SpillPath)
+		}
+	}
+	return sink, nil
+}
+
+// Name returns the sink's name
+func (s *Sink) Name() string {
+	return s.name
+}
+
+// Status reports the sink's delivery health and backlog
+func (s *Sink) Status() server.SinkStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	status := server.SinkStatus{
+		Name:        s.name,
+		Connected:   !s.failing,
+		LastError:   s.lastError,
+		QueueDepth:  len(s.queue),
+		Delivered:   s.delivered,
+		Failed:      s.undelivered.Load(),
+		DeadLetters: len(s.dead.letters),
+	}
+	// Point at copies, as the fields change after the mutex is released
+	if lastErrorAt := s.lastErrorAt; !lastErrorAt.IsZero() {
+		status.LastErrorAt = &lastErrorAt
+	}
+	if lastDeliveredAt := s.lastDeliveredAt; !lastDeliveredAt.IsZero() {
+		status.LastDeliveredAt = &lastDeliveredAt
+	}
+	if s.spill != nil {
+		status.SpilledBytes = s.spill.size - s.spill.offset
+	}
+	return status
+}
+
+// Enqueue queues an event for delivery without blocking
+// When the queue is full the event is spilled to disk, if enabled, or dropped
+func (s *Sink) Enqueue(event server.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if reason := s.enqueue(event); reason != "" {
+		log.Printf("Sink %s dropped event %d (%s)\n", s.name, event.ID, reason)
+		s.failed(reason)
+	}
+}
+
+// Send queues an event for delivery, as Enqueue does, so sinks are
+// server.EventSinks
+func (s *Sink) Send(event server.Event) {
+	s.Enqueue(event)
+}
+
+// enqueue queues or spills an event, returning the reason if it could not
+// The caller holds the mutex
+func (s *Sink) enqueue(event server.Event) string {
+	if s.closed {
+		return "shutdown"
+	}
+	// Once events are spilled, later ones follow them so order is kept
+	if s.spill == nil || !s.spill.pending() {
+		select {
+		case s.queue <- event:
+			return ""
+		default:
+		}
+	}
+	if s.spill == nil {
+		return "queue_full"
+	}
+	if err := s.spill.append(event); err != nil {
+		log.Printf("Sink %s could not spill event %d: %v\n", s.name, event.ID, err)
+		return "spill_error"
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return ""
+}
+
+// DeadLetters returns the events the sink gave up on, oldest first
+func (s *Sink) DeadLetters() []server.DeadLetter {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.dead.list()
+}
+
+// Redeliver queues the dead letters with the given IDs, or all of them if ids
+// is empty, for delivery again and returns how many were queued
+// Dead letters stay listed if the queue has no room for them
+func (s *Sink) Redeliver(ids []int) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	selected := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+	queued, err := s.dead.remove(func(letter server.DeadLetter) bool {
+		if len(ids) > 0 && !selected[letter.ID] {
+			return false
+		}
+		return s.enqueue(letter.Event) == ""
+	})
+	if err != nil {
+		log.Printf("Sink %s: error saving dead letters: %v\n", s.name, err)
+	}
+	return queued
+}
+
+// Run delivers queued events until Close has drained the queue or ctx is
+// cancelled; cancelling ctx also aborts the delivery in flight
+// With a spill file, events still undelivered when Run returns are written to
+// it, so they are delivered on the next run
+func (s *Sink) Run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	s.mutex.Lock()
+	s.cancel = cancel
+	s.mutex.Unlock()
+	defer close(s.done)
+	defer cancel()
+
+	for {
+		event, ok := s.next(ctx)
+		if !ok {
+			s.persist(nil)
+			return
+		}
+		if !s.send(ctx, event) {
+			s.persist(&event)
+			return
+		}
+	}
+}
+
+// Close stops queueing events and waits until those already queued have been
+// delivered by Run, or ctx is done, when the delivery in flight is aborted
+func (s *Sink) Close(ctx context.Context) error {
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.closing)
+	}
+	cancel := s.cancel
+	s.mutex.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+	}
+	if cancel == nil {
+		return fmt.Errorf("sink %s is not running", s.name)
+	}
+	cancel()
+	<-s.done
+	if s.spill != nil {
+		return fmt.Errorf("%w; undelivered events were kept in %s", ctx.Err(), s.options.SpillPath)
+	}
+	return fmt.Errorf("%d events not delivered: %w", len(s.queue), ctx.Err())
+}
+
+// next returns the oldest undelivered event, waiting for one if there are none
+// It returns false when ctx is done, or when the sink is closed and drained
+func (s *Sink) next(ctx context.Context) (server.Event, bool) {
+	for {
+		select {
+		case event := <-s.queue:
+			return event, true
+		default:
+		}
+		if event, ok := s.unspill(); ok {
+			return event, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return server.Event{}, false
+		case event := <-s.queue:
+			return event, true
+		case <-s.wake:
+		case <-s.closing:
+			if s.drained() {
+				return server.Event{}, false
+			}
+		}
+	}
+}
+
+// unspill reads the oldest spilled event
+func (s *Sink) unspill() (server.Event, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.spill == nil || !s.spill.pending() {
+		return server.Event{}, false
+	}
+	event, ok, err := s.spill.next()
+	if err != nil {
+		log.Printf("Sink %s: error reading spill file: %v\n", s.name, err)
+	}
+	return event, ok
+}
+
+// drained reports whether no events are waiting in the queue or spill file
+func (s *Sink) drained() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.queue) == 0 && (s.spill == nil || !s.spill.pending())
+}
+
+// send delivers an event, retrying with backoff up to MaxAttempts
+// It returns false if ctx was cancelled before the event was delivered
+func (s *Sink) send(ctx context.Context, event server.Event) bool {
+	delay := s.options.Backoff
+	for attempt := 1; ; attempt++ {
+		err := s.deliver(ctx, event)
+		if ctx.Err() != nil && err != nil {
+			return false
+		}
+		s.attempted(err)
+		if err == nil {
+			return true
+		}
+		if attempt >= s.options.MaxAttempts {
+			log.Printf("Sink %s: giving up on event %d after %d attempts: %v\n", s.name, event.ID, attempt, err)
+			s.failed("send_error")
+			s.deadLetter(event, err, attempt)
+			return true
+		}
+		log.Printf("Sink %s: error delivering event %d (attempt %d of %d), retrying in %s: %v\n", s.name, event.ID, attempt, s.options.MaxAttempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+		delay = min(delay*2, maxBackoff)
+	}
+}
+
+// attempted records the outcome of a delivery attempt for Status
+func (s *Sink) attempted(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failing = err != nil
+	if err != nil {
+		s.lastError = err.Error()
+		s.lastErrorAt = time.Now()
+		return
+	}
+	s.lastDeliveredAt = time.Now()
+	s.delivered++
+}
+
+// deadLetter keeps an event that used all its attempts, so it can be redelivered
+func (s *Sink) deadLetter(event server.Event, cause error, attempts int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.dead.add(event, cause, attempts); err != nil {
+		log.Printf("Sink %s: error saving dead letter for event %d: %v\n", s.name, event.ID, err)
+	}
+}
+
+// persist writes the undelivered events to the front of the spill file: the
+// one in flight, then the queue, then the events already spilled
+func (s *Sink) persist(inFlight *server.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Nothing is queued once Run has stopped
+	if !s.closed {
+		s.closed = true
+		close(s.closing)
+	}
+	if s.spill == nil {
+		return
+	}
+	var lines []byte
+	add := func(event server.Event) {
+		if line, err := json.Marshal(event); err == nil {
+			lines = append(append(lines, line...), '\n')
+		}
+	}
+	if inFlight != nil {
+		add(*inFlight)
+	}
+	for len(s.queue) > 0 {
+		add(<-s.queue)
+	}
+	if lines == nil {
+		s.closeSpill()
+		return
+	}
+	rest, err := s.spill.unread()
+	if err == nil {
+		err = s.spill.rewrite(append(lines, rest...))
+	}
+	if err != nil {
+		log.Printf("Sink %s: error saving undelivered events to %s: %v\n", s.name, s.options.SpillPath, err)
+	}
+	s.closeSpill()
+}
+
+// closeSpill closes the spill file; it is reopened by the next run
+func (s *Sink) closeSpill() {
+	if err := s.spill.close(); err != nil {
+		log.Printf("Sink %s: error closing spill file: %v\n", s.name, err)
+	}
+}
+
+// failed counts an undelivered event and reports it to OnFailure
+func (s *Sink) failed(reason string) {
+	s.undelivered.Add(1)
+	if s.OnFailure != nil {
+		s.OnFailure(reason)
+	}
+}
@@ -0,0 +1,127 @@
+package sinks
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	"goplow/internal/server"
+)
+
+// errSpillFull is returned when an event would take the spill file past its limit
+var errSpillFull = errors.New("spill file is full")
+
+// spill is a JSON Lines file of events waiting for room in a sink's queue
+// Events are appended at the end and read from the front; the file is
+// truncated whenever it has been read to the end
+type spill struct {
+	path     string
+	file     *os.File
+	reader   *bufio.Reader
+	offset   int64
+	size     int64
+	maxBytes int64
+}
+
+// openSpill opens or creates the spill file at path
+// Events left in it by the last run are read first
+func openSpill(path string, maxBytes int64) (*spill, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &spill{
+		path:     path,
+		file:     file,
+		reader:   bufio.NewReader(io.NewSectionReader(file, 0, 1<<62)),
+		size:     info.Size(),
+		maxBytes: maxBytes,
+	}, nil
+}
+
+// pending reports whether the spill file has events that have not been read
+func (s *spill) pending() bool {
+	return s.offset < s.size
+}
+
+// append writes an event to the end of the file
+func (s *spill) append(event server.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if s.maxBytes > 0 && s.size+int64(len(line)) > s.maxBytes {
+		return errSpillFull
+	}
+	n, err := s.file.WriteAt(line, s.size)
+	s.size += int64(n)
+	return err
+}
+
+// next reads the oldest unread event, truncating the file once it is empty
+// Lines that cannot be decoded, such as one cut short by a crash, are skipped
+func (s *spill) next() (server.Event, bool, error) {
+	for s.pending() {
+		line, err := s.reader.ReadBytes('\n')
+		s.offset += int64(len(line))
+		if err != nil && err != io.EOF {
+			return server.Event{}, false, err
+		}
+		if len(line) == 0 {
+			// The file is shorter than expected
+			break
+		}
+		var event server.Event
+		if json.Unmarshal(line, &event) == nil {
+			if !s.pending() {
+				return event, true, s.reset()
+			}
+			return event, true, nil
+		}
+	}
+	return server.Event{}, false, s.reset()
+}
+
+// unread returns the events that have not been read, without consuming them
+func (s *spill) unread() ([]byte, error) {
+	rest := make([]byte, s.size-s.offset)
+	_, err := s.file.ReadAt(rest, s.offset)
+	return rest, err
+}
+
+// rewrite replaces the file's contents with lines, which are read next
+func (s *spill) rewrite(lines []byte) error {
+	if err := s.reset(); err != nil {
+		return err
+	}
+	n, err := s.file.WriteAt(lines, 0)
+	s.size = int64(n)
+	if err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// reset empties the file
+func (s *spill) reset() error {
+	s.offset, s.size = 0, 0
+	s.reader.Reset(io.NewSectionReader(s.file, 0, 1<<62))
+	return s.file.Truncate(0)
+}
+
+// close closes the file, removing it if it is empty
+func (s *spill) close() error {
+	err := s.file.Close()
+	if !s.pending() {
+		os.Remove(s.path)
+	}
+	return err
+}
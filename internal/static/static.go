@@ -10,6 +10,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"goplow/internal/utils"
 )
 
 //go:embed index.html assets/*
@@ -52,8 +54,28 @@ func GetStaticFS() http.FileSystem {
 	return http.FS(sub)
 }
 
+// GetSchemasFS returns the Iglu schemas, laid out as vendor/name/jsonschema/version
+// In dev mode they are read from disk, as for the /schemas routes
+func GetSchemasFS() fs.FS {
+	if devMode && devAssetsPath != "" {
+		return os.DirFS(filepath.Join(devAssetsPath, "..", "static", "schemas"))
+	}
+	sub, err := fs.Sub(schemasFS, "schemas")
+	if err != nil {
+		log.Fatalf("Error creating schemas filesystem: %v\n", err)
+	}
+	return sub
+}
+
+// Routes is where static file routes are registered, such as an http.ServeMux
+// or one of the server's route groups
+type Routes interface {
+	Handle(pattern string, handler http.Handler)
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
 // RegisterStaticRoutes registers static file routes
-func RegisterStaticRoutes(mux *http.ServeMux) {
+func RegisterStaticRoutes(mux Routes) {
 	// In dev mode, serve assets from the dev folder
 	if devMode && devAssetsPath != "" {
 		log.Printf("DEV MODE: Serving assets from %s\n", devAssetsPath)
@@ -131,7 +153,7 @@ func ServeEmbeddedSchemas(w http.ResponseWriter, r *http.Request) {
 	// Read the file from embedded filesystem
 	data, err := schemasFS.ReadFile(fullPath)
 	if err != nil {
-		http.Error(w, "Schema not found", http.StatusNotFound)
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeSchemaNotFound, "Schema not found")
 		return
 	}
 
@@ -158,7 +180,7 @@ func ListEmbeddedSchemas(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil {
-		http.Error(w, "Failed to list schemas", http.StatusInternalServerError)
+		utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeSchemaListFailed, "Failed to list schemas")
 		return
 	}
 
@@ -177,7 +199,7 @@ func ServeDevSchemas(w http.ResponseWriter, r *http.Request, schemasDir string)
 	// Read the file from disk
 	data, err := os.ReadFile(fullPath)
 	if err != nil {
-		http.Error(w, "Schema not found", http.StatusNotFound)
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeSchemaNotFound, "Schema not found")
 		return
 	}
 
@@ -204,7 +226,7 @@ func ListDevSchemas(w http.ResponseWriter, r *http.Request, schemasDir string) {
 	})
 
 	if err != nil {
-		http.Error(w, "Failed to list schemas", http.StatusInternalServerError)
+		utils.WriteProblem(w, r, http.StatusInternalServerError, utils.CodeSchemaListFailed, "Failed to list schemas")
 		return
 	}
 
@@ -219,7 +241,7 @@ func GetLatestSchemaVersion(w http.ResponseWriter, r *http.Request, schemasDir s
 	name := r.URL.Query().Get("name")
 
 	if vendor == "" || name == "" {
-		http.Error(w, "Missing vendor or name query parameters", http.StatusBadRequest)
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeMissingParameter, "Missing vendor or name query parameters")
 		return
 	}
 
@@ -227,7 +249,7 @@ func GetLatestSchemaVersion(w http.ResponseWriter, r *http.Request, schemasDir s
 	schemaDir := filepath.Join(schemasDir, vendor, name, "jsonschema")
 	entries, err := os.ReadDir(schemaDir)
 	if err != nil {
-		http.Error(w, "Schema not found", http.StatusNotFound)
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeSchemaNotFound, "Schema not found")
 		return
 	}
 
@@ -243,7 +265,7 @@ func GetLatestSchemaVersion(w http.ResponseWriter, r *http.Request, schemasDir s
 	}
 
 	if latestVersion == "" {
-		http.Error(w, "No versions found", http.StatusNotFound)
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeNoSchemaVersions, "No versions found")
 		return
 	}
 
@@ -258,7 +280,7 @@ func GetLatestEmbeddedSchemaVersion(w http.ResponseWriter, r *http.Request) {
 	name := r.URL.Query().Get("name")
 
 	if vendor == "" || name == "" {
-		http.Error(w, "Missing vendor or name query parameters", http.StatusBadRequest)
+		utils.WriteProblem(w, r, http.StatusBadRequest, utils.CodeMissingParameter, "Missing vendor or name query parameters")
 		return
 	}
 
@@ -266,7 +288,7 @@ func GetLatestEmbeddedSchemaVersion(w http.ResponseWriter, r *http.Request) {
 	schemaDir := filepath.Join("schemas", vendor, name, "jsonschema")
 	entries, err := fs.ReadDir(schemasFS, schemaDir)
 	if err != nil {
-		http.Error(w, "Schema not found", http.StatusNotFound)
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeSchemaNotFound, "Schema not found")
 		return
 	}
 
@@ -282,7 +304,7 @@ func GetLatestEmbeddedSchemaVersion(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if latestVersion == "" {
-		http.Error(w, "No versions found", http.StatusNotFound)
+		utils.WriteProblem(w, r, http.StatusNotFound, utils.CodeNoSchemaVersions, "No versions found")
 		return
 	}
 
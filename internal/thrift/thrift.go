@@ -0,0 +1,245 @@
+// Package thrift decodes Snowplow collector payloads serialized with the Thrift
+// binary protocol, as the Scala Stream Collector writes them to its raw stream
+package thrift
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CollectorPayload is a raw request recorded by a Snowplow collector, from the
+// com.snowplowanalytics.snowplow.CollectorPayload 1-0-0 Thrift definition
+type CollectorPayload struct {
+	Schema        string
+	IPAddress     string
+	Timestamp     int64
+	Encoding      string
+	Collector     string
+	UserAgent     string
+	RefererURI    string
+	Path          string
+	Querystring   string
+	Body          string
+	Headers       []string
+	ContentType   string
+	Hostname      string
+	NetworkUserID string
+}
+
+// Thrift binary protocol type codes
+const (
+	typeStop   = 0
+	typeBool   = 2
+	typeByte   = 3
+	typeDouble = 4
+	typeI16    = 6
+	typeI32    = 8
+	typeI64    = 10
+	typeString = 11
+	typeStruct = 12
+	typeMap    = 13
+	typeSet    = 14
+	typeList   = 15
+)
+
+// maxContainerSize bounds strings and lists, so a corrupt length cannot
+// exhaust memory
+const maxContainerSize = 64 << 20
+
+// ReadCollectorPayloads reads collector payloads, either concatenated binary
+// records or one base64-encoded record per line, as Kinesis and Pub/Sub dumps
+// usually hold them
+func ReadCollectorPayloads(r io.Reader) ([]CollectorPayload, error) {
+	reader := bufio.NewReader(r)
+	first, err := reader.Peek(1)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A binary record starts with a field header, not a base64 character
+	if first[0] == typeString || first[0] == typeI64 {
+		var payloads []CollectorPayload
+		for {
+			if _, err := reader.Peek(1); err == io.EOF {
+				return payloads, nil
+			}
+			payload, err := DecodeCollectorPayload(reader)
+			if err != nil {
+				return nil, fmt.Errorf("payload %d: %w", len(payloads)+1, err)
+			}
+			payloads = append(payloads, payload)
+		}
+	}
+
+	var payloads []CollectorPayload
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxContainerSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		raw, err := decodeBase64(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		payload, err := DecodeCollectorPayload(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, scanner.Err()
+}
+
+// decodeBase64 accepts standard and URL-safe base64, with or without padding
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.NewReplacer("-", "+", "_", "/").Replace(s)
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// DecodeCollectorPayload reads one binary-encoded collector payload; unknown
+// fields are skipped
+func DecodeCollectorPayload(r io.Reader) (CollectorPayload, error) {
+	d := decoder{r: r}
+	var payload CollectorPayload
+	stringFields := map[int16]*string{
+		31337: &payload.Schema,
+		100:   &payload.IPAddress,
+		210:   &payload.Encoding,
+		220:   &payload.Collector,
+		300:   &payload.UserAgent,
+		310:   &payload.RefererURI,
+		320:   &payload.Path,
+		330:   &payload.Querystring,
+		340:   &payload.Body,
+		420:   &payload.ContentType,
+		500:   &payload.Hostname,
+		600:   &payload.NetworkUserID,
+	}
+
+	for {
+		fieldType := d.byte()
+		if d.err != nil || fieldType == typeStop {
+			return payload, d.err
+		}
+		id := int16(d.uint16())
+
+		switch {
+		case fieldType == typeString && stringFields[id] != nil:
+			*stringFields[id] = d.string()
+		case fieldType == typeI64 && id == 200:
+			payload.Timestamp = int64(d.uint64())
+		case fieldType == typeList && id == 410:
+			elementType, size := d.byte(), d.size()
+			for i := 0; i < size && d.err == nil; i++ {
+				if elementType != typeString {
+					d.skip(elementType)
+					continue
+				}
+				payload.Headers = append(payload.Headers, d.string())
+			}
+		default:
+			d.skip(fieldType)
+		}
+	}
+}
+
+// decoder reads binary protocol values, keeping the first error
+type decoder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return make([]byte, n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		d.err = err
+	}
+	return buf
+}
+
+func (d *decoder) byte() byte {
+	return d.read(1)[0]
+}
+
+func (d *decoder) uint16() uint16 {
+	return binary.BigEndian.Uint16(d.read(2))
+}
+
+func (d *decoder) uint32() uint32 {
+	return binary.BigEndian.Uint32(d.read(4))
+}
+
+func (d *decoder) uint64() uint64 {
+	return binary.BigEndian.Uint64(d.read(8))
+}
+
+// size reads a string or container length
+func (d *decoder) size() int {
+	size := int32(d.uint32())
+	if d.err == nil && (size < 0 || size > maxContainerSize) {
+		d.err = errors.New("invalid length")
+		return 0
+	}
+	return int(size)
+}
+
+func (d *decoder) string() string {
+	return string(d.read(d.size()))
+}
+
+// skip reads past a value of the given type
+func (d *decoder) skip(valueType byte) {
+	switch valueType {
+	case typeBool, typeByte:
+		d.read(1)
+	case typeI16:
+		d.read(2)
+	case typeI32:
+		d.read(4)
+	case typeDouble, typeI64:
+		d.read(8)
+	case typeString:
+		d.read(d.size())
+	case typeStruct:
+		for d.err == nil {
+			fieldType := d.byte()
+			if fieldType == typeStop {
+				return
+			}
+			d.read(2)
+			d.skip(fieldType)
+		}
+	case typeMap:
+		keyType, valueType, size := d.byte(), d.byte(), d.size()
+		for i := 0; i < size && d.err == nil; i++ {
+			d.skip(keyType)
+			d.skip(valueType)
+		}
+	case typeSet, typeList:
+		elementType, size := d.byte(), d.size()
+		for i := 0; i < size && d.err == nil; i++ {
+			d.skip(elementType)
+		}
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown field type %d", valueType)
+		}
+	}
+}
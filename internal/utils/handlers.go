@@ -1,19 +1,41 @@
 package utils
 
 import (
-	"fmt"
+	"sync"
 )
 
-// EventHandler is a function type that processes event data and returns transformed output
-type EventHandler func(event map[string]interface{}) interface{}
+// EventHandler is a function type that transforms a single event payload item for display
+type EventHandler func(event map[string]interface{}) map[string]interface{}
 
-// EventHandlerRegistry holds all registered event handlers
+// PostProcessor further transforms an event payload item after its per-type handler
+// It receives both the raw item and the transformed item, and returns the item to display
+type PostProcessor func(raw map[string]interface{}, transformed map[string]interface{}) map[string]interface{}
+
+// Names of the built-in transform stages
+const (
+	// StageEventTypes applies the per-event-type handlers (Snowplow friendly names)
+	StageEventTypes = "snowplow"
+	// StageRaw passes events through untransformed
+	StageRaw = "raw"
+)
+
+// namedPostProcessor is a post-processor that can be selected by name in a transform chain
+type namedPostProcessor struct {
+	name      string
+	processor PostProcessor
+}
+
+// EventHandlerRegistry holds all registered event handlers, keyed by the
+// Snowplow event type (the "e" field, e.g. "pv", "se", "ue")
 type EventHandlerRegistry struct {
-	handlers map[string]EventHandler
-	default_ EventHandler
+	mutex          sync.RWMutex
+	handlers       map[string]EventHandler
+	default_       EventHandler
+	postProcessors []namedPostProcessor
 }
 
 // NewEventHandlerRegistry creates a new event handler registry
+// Events without a registered handler are passed through unchanged
 func NewEventHandlerRegistry() *EventHandlerRegistry {
 	return &EventHandlerRegistry{
 		handlers: make(map[string]EventHandler),
@@ -21,36 +43,132 @@ func NewEventHandlerRegistry() *EventHandlerRegistry {
 	}
 }
 
-// Register registers an event handler for a specific event type
+// Register registers an event handler for a specific event type, replacing any existing handler
 func (r *EventHandlerRegistry) Register(eventType string, handler EventHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
 	r.handlers[eventType] = handler
 }
 
+// RegisterDefault registers an event handler only if none is registered for the
+// event type yet, so built-in handlers never override custom ones
+func (r *EventHandlerRegistry) RegisterDefault(eventType string, handler EventHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.handlers[eventType]; !exists {
+		r.handlers[eventType] = handler
+	}
+}
+
+// SetFallback sets the handler used for event types without a registered handler
+func (r *EventHandlerRegistry) SetFallback(handler EventHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.default_ = handler
+}
+
+// AddPostProcessor registers a named processor that runs after the per-type
+// handler, e.g. config-driven field rules ("rules") or a user script ("script").
+// The default chain runs all post-processors in the order they were added.
+func (r *EventHandlerRegistry) AddPostProcessor(name string, processor PostProcessor) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.postProcessors = append(r.postProcessors, namedPostProcessor{name: name, processor: processor})
+}
+
+// HasStage reports whether a transform stage with the given name is available
+func (r *EventHandlerRegistry) HasStage(name string) bool {
+	if name == StageEventTypes || name == StageRaw {
+		return true
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, postProcessor := range r.postProcessors {
+		if postProcessor.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Has reports whether a handler is registered for the event type
+func (r *EventHandlerRegistry) Has(eventType string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	_, exists := r.handlers[eventType]
+	return exists
+}
+
 // Handle processes an event using the appropriate handler
-func (r *EventHandlerRegistry) Handle(eventType string, event map[string]interface{}) interface{} {
+func (r *EventHandlerRegistry) Handle(eventType string, event map[string]interface{}) map[string]interface{} {
+	r.mutex.RLock()
 	handler, exists := r.handlers[eventType]
 	if !exists {
 		handler = r.default_
 	}
+	r.mutex.RUnlock()
+
 	return handler(event)
 }
 
-// defaultEventHandler is the fallback handler for unrecognized event types
-func defaultEventHandler(event map[string]interface{}) interface{} {
-	eventType := "unknown"
-	if e, ok := event["e"].(string); ok {
-		eventType = e
+// Transform runs the default chain: the per-type handler selected by the "e"
+// field, followed by every post-processor. Items without an "e" field skip the
+// per-type handlers.
+func (r *EventHandlerRegistry) Transform(event map[string]interface{}) map[string]interface{} {
+	result := r.handleEventType(event)
+
+	r.mutex.RLock()
+	postProcessors := r.postProcessors
+	r.mutex.RUnlock()
+
+	for _, postProcessor := range postProcessors {
+		result = postProcessor.processor(event, result)
 	}
+	return result
+}
 
-	aid := "N/A"
-	if appID, ok := event["aid"].(string); ok {
-		aid = appID
+// TransformWith runs the named stages in order, e.g. ["snowplow", "rules"]
+// Unknown stage names are skipped; an empty chain or ["raw"] returns the event as-is.
+func (r *EventHandlerRegistry) TransformWith(stages []string, event map[string]interface{}) map[string]interface{} {
+	r.mutex.RLock()
+	postProcessors := r.postProcessors
+	r.mutex.RUnlock()
+
+	result := event
+	for _, stage := range stages {
+		switch stage {
+		case StageRaw:
+			continue
+		case StageEventTypes:
+			result = r.handleEventType(result)
+		default:
+			for _, postProcessor := range postProcessors {
+				if postProcessor.name == stage {
+					result = postProcessor.processor(event, result)
+				}
+			}
+		}
 	}
+	return result
+}
 
-	url := "N/A"
-	if u, ok := event["url"].(string); ok {
-		url = u
+// handleEventType dispatches an item on its "e" field
+func (r *EventHandlerRegistry) handleEventType(event map[string]interface{}) map[string]interface{} {
+	if eventType, ok := event["e"].(string); ok {
+		return r.Handle(eventType, event)
 	}
+	return event
+}
 
-	return fmt.Sprintf("Unrecognised Event: %s. App ID: %s. App URL: %s.", eventType, aid, url)
+// defaultEventHandler is the fallback handler for unrecognized event types
+// It returns the event unchanged
+func defaultEventHandler(event map[string]interface{}) map[string]interface{} {
+	return event
 }
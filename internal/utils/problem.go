@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ProblemContentType is the media type for RFC 9457 problem details
+const ProblemContentType = "application/problem+json"
+
+// Machine-readable error codes returned in problem responses
+const (
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeNotFound          = "not_found"
+	CodeInvalidJSON       = "invalid_json"
+	CodeMissingField      = "missing_field"
+	CodeMissingSchema     = "missing_schema"
+	CodeMissingData       = "missing_data"
+	CodeInvalidDataFormat = "invalid_data_format"
+	CodeEmptyMessage      = "empty_message"
+	CodeInvalidParameter  = "invalid_parameter"
+	CodeMissingParameter  = "missing_parameter"
+	CodeMarkerNotFound    = "marker_not_found"
+	CodeEventNotFound     = "event_not_found"
+	CodeSchemaNotFound    = "schema_not_found"
+	CodeNoSchemaVersions  = "no_schema_versions"
+	CodeStreamUnsupported = "stream_unsupported"
+	CodeSchemaListFailed  = "schema_list_failed"
+	CodeSchemaViolation   = "schema_violation"
+	CodeForbidden         = "forbidden"
+	CodeUnauthorized      = "unauthorized"
+	CodeRateLimited       = "rate_limited"
+	CodeBodyTooLarge      = "body_too_large"
+	CodeAuditUnavailable  = "audit_unavailable"
+	CodeTooManyClients    = "too_many_clients"
+	CodeArchiveFailed     = "archive_failed"
+	CodeArchiveNotFound   = "archive_not_found"
+	CodeManifestNotFound  = "manifest_not_found"
+	CodeNoActiveSession   = "no_active_session"
+	CodeExportFailed      = "export_failed"
+	CodeIngestQueueFull   = "ingest_queue_full"
+	CodeSinkNotFound      = "sink_not_found"
+	CodePreferencesFailed = "preferences_failed"
+	CodeInternalError     = "internal_error"
+	CodeFunnelNotFound    = "funnel_not_found"
+	CodeFunnelConfigured  = "funnel_configured"
+	CodeBatchNotFound     = "batch_not_found"
+)
+
+// Problem is an RFC 9457 problem details body with a machine-readable code
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Code is a stable identifier clients can branch on instead of matching Detail
+	Code     string `json:"code"`
+	Instance string `json:"instance,omitempty"`
+	// Violations lists the schema violations of events rejected by validation
+	Violations interface{} `json:"violations,omitempty"`
+}
+
+// WriteProblem writes a problem+json error response
+func WriteProblem(w http.ResponseWriter, r *http.Request, status int, code string, detail string) {
+	WriteProblemDetails(w, r, Problem{
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	})
+}
+
+// WriteProblemDetails writes a problem+json error response with extension members,
+// filling in the type, title and instance when unset
+func WriteProblemDetails(w http.ResponseWriter, r *http.Request, problem Problem) {
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+	if r != nil && problem.Instance == "" {
+		problem.Instance = r.URL.Path
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// WriteMethodNotAllowed writes a 405 problem response listing the allowed methods
+func WriteMethodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+	}
+	WriteProblem(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+}
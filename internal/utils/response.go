@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// gzipMinSize is the smallest body worth compressing
+const gzipMinSize = 1024
+
+// WriteCachedJSON writes v as JSON with a content-based ETag, answering
+// If-None-Match with 304 Not Modified and gzip-compressing the body when the
+// client accepts it
+// If v cannot be encoded, nothing has been written yet, so it answers with a
+// 500 problem and returns the error
+func WriteCachedJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		WriteProblem(w, r, http.StatusInternalServerError, CodeInternalError, "Response could not be encoded")
+		return err
+	}
+	body = append(body, '\n')
+
+	// Weak ETag, so it matches regardless of the content encoding
+	sum := sha256.Sum256(body)
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if len(body) < gzipMinSize || !AcceptsGzip(r) {
+		_, err := w.Write(body)
+		return err
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(body); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// GzipStream wraps w to gzip a long-lived streamed response, such as SSE, when
+// the client accepts it; every Flush sends the frames compressed so far
+// The returned function finishes the stream and must be called when it ends
+func GzipStream(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	flusher, ok := w.(http.Flusher)
+	if !ok || !AcceptsGzip(r) {
+		return w, func() {}
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	return &gzipStreamWriter{ResponseWriter: w, gz: gz, flusher: flusher}, func() { gz.Close() }
+}
+
+// gzipStreamWriter compresses writes, keeping the compression window across
+// flushes so repeated content in later frames compresses well
+type gzipStreamWriter struct {
+	http.ResponseWriter
+	gz      *gzip.Writer
+	flusher http.Flusher
+}
+
+// Write compresses p into the response
+func (w *gzipStreamWriter) Write(p []byte) (int, error) {
+	return w.gz.Write(p)
+}
+
+// Flush sends the data compressed so far to the client
+func (w *gzipStreamWriter) Flush() {
+	w.gz.Flush()
+	w.flusher.Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *gzipStreamWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AcceptsGzip reports whether the request allows a gzip-encoded response
+func AcceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// etagMatches reports whether an If-None-Match header matches the ETag using weak comparison
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	target := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"goplow/internal/iglu"
+	"goplow/internal/server"
+)
+
+// compiledSchema is a compiled schema with its source document, used to look up
+// the expected value of a failing keyword
+type compiledSchema struct {
+	schema   *jsonschema.Schema
+	document interface{}
+}
+
+// SchemaValidator validates the self-describing events and context entities of
+// tracker payloads against the schemas in a static Iglu registry
+// Schemas that are not in the registry are skipped, as in the web interface
+type SchemaValidator struct {
+	schemas fs.FS
+	mutex   sync.Mutex
+	// compiled caches schemas by path; nil marks a schema that is missing or invalid
+	compiled map[string]*compiledSchema
+}
+
+// New creates a validator reading schemas laid out as vendor/name/jsonschema/version
+func New(schemas fs.FS) *SchemaValidator {
+	return &SchemaValidator{
+		schemas:  schemas,
+		compiled: make(map[string]*compiledSchema),
+	}
+}
+
+// Validate returns the schema violations of every self-describing JSON in the event
+func (v *SchemaValidator) Validate(event server.Event) []server.Violation {
+	var violations []server.Violation
+	for i, item := range event.Data {
+		prefix := ""
+		if len(event.Data) > 1 {
+			prefix = fmt.Sprintf("data[%d].", i)
+		}
+
+		if schema, data, ok := iglu.SelfDescribingEvent(item); ok {
+			location := "ue_px"
+			if _, ok := item["ue_pr"]; ok {
+				location = "ue_pr"
+			}
+			violations = append(violations, v.ValidateEntity(schema, data, prefix+location)...)
+		}
+
+		contextsField := "cx"
+		if _, ok := item["co"]; ok {
+			contextsField = "co"
+		}
+		for j, entity := range iglu.ContextEntities(item) {
+			location := fmt.Sprintf("%s%s[%d]", prefix, contextsField, j)
+			violations = append(violations, v.ValidateEntity(entity.Schema, entity.Data, location)...)
+		}
+	}
+	return violations
+}
+
+// ValidateEntity validates data against the schema with the given Iglu URI
+func (v *SchemaValidator) ValidateEntity(schemaURI string, data interface{}, location string) []server.Violation {
+	compiled := v.schema(schemaURI)
+	if compiled == nil {
+		return nil
+	}
+
+	err := compiled.schema.Validate(data)
+	var validationErr *jsonschema.ValidationError
+	if err == nil || !errors.As(err, &validationErr) {
+		return nil
+	}
+
+	var violations []server.Violation
+	for _, cause := range leafErrors(validationErr) {
+		violation := server.Violation{
+			Schema:   schemaURI,
+			Location: location,
+			Pointer:  cause.InstanceLocation,
+			Keyword:  lastSegment(cause.KeywordLocation),
+			Message:  cause.Message,
+		}
+		if _, fragment, found := strings.Cut(cause.AbsoluteKeywordLocation, "#"); found {
+			if expected, ok := resolvePointer(compiled.document, fragment); ok {
+				violation.Expected = expected
+			}
+		}
+		if value, ok := resolvePointer(data, cause.InstanceLocation); ok {
+			violation.Value = value
+		}
+		violations = append(violations, violation)
+	}
+	return violations
+}
+
+// schema returns the compiled schema for an Iglu URI, compiling it on first use
+func (v *SchemaValidator) schema(schemaURI string) *compiledSchema {
+	path, ok := iglu.SchemaPath(schemaURI)
+	if !ok {
+		return nil
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if compiled, cached := v.compiled[path]; cached {
+		return compiled
+	}
+	compiled, err := v.compile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Error compiling schema %s: %v\n", schemaURI, err)
+	}
+	v.compiled[path] = compiled
+	return compiled
+}
+
+// compile loads and compiles the schema at path
+func (v *SchemaValidator) compile(path string) (*compiledSchema, error) {
+	raw, err := fs.ReadFile(v.schemas, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+	// Iglu schemas reference the self-describing meta-schema, which is not available locally
+	delete(document, "$schema")
+	source, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	url := "iglu:" + path
+	if err := compiler.AddResource(url, bytes.NewReader(source)); err != nil {
+		return nil, err
+	}
+	schema, err := compiler.Compile(url)
+	if err != nil {
+		return nil, err
+	}
+	return &compiledSchema{schema: schema, document: document}, nil
+}
+
+// leafErrors flattens a validation error into its most specific causes
+func leafErrors(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		leaves = append(leaves, leafErrors(cause)...)
+	}
+	return leaves
+}
+
+// lastSegment returns the final segment of a JSON pointer
+func lastSegment(pointer string) string {
+	return pointer[strings.LastIndex(pointer, "/")+1:]
+}
+
+// resolvePointer returns the value at a JSON pointer within decoded JSON
+func resolvePointer(value interface{}, pointer string) (interface{}, bool) {
+	if pointer == "" {
+		return value, true
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[token]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			value = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,89 @@
+// Package backend defines the events goplow captures and the stores and sinks
+// that persist and deliver them, with a registry through which code embedding
+// goplow plugs in its own, such as a SQLite store or a Kafka sink
+package backend
+
+import (
+	"sort"
+	"sync"
+)
+
+// Host is the server a store or sink is opened for; goplow's own factories
+// assert it to its server, to read the rest of the configuration
+type Host interface {
+	// DataPath returns the path of a file in the server's data directory,
+	// creating the directory if it does not exist
+	DataPath(name string) (string, error)
+}
+
+// registry holds the registered store and sink factories
+var registry = struct {
+	mutex  sync.RWMutex
+	stores map[string]StoreFactory
+	sinks  map[string]SinkFactory
+	// sinkOrder is the order sink factories were registered in, which is the
+	// order their sinks are built and listed in
+	sinkOrder []string
+}{
+	stores: make(map[string]StoreFactory),
+	sinks:  make(map[string]SinkFactory),
+}
+
+// RegisterStore makes an event store available to the store setting under
+// name, replacing any registered with the same name
+// Register stores before the configuration is loaded, as it is validated
+// against the registered names
+func RegisterStore(name string, factory StoreFactory) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.stores[name] = factory
+}
+
+// LookupStore returns the store factory registered under name
+func LookupStore(name string) (StoreFactory, bool) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	factory, found := registry.stores[name]
+	return factory, found
+}
+
+// StoreNames returns the names of the registered stores, sorted
+func StoreNames() []string {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	names := make([]string, 0, len(registry.stores))
+	for name := range registry.stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterSinkFactory adds a kind of sink built when the server opens its
+// sinks, replacing any registered under the same kind
+func RegisterSinkFactory(kind string, factory SinkFactory) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if _, exists := registry.sinks[kind]; !exists {
+		registry.sinkOrder = append(registry.sinkOrder, kind)
+	}
+	registry.sinks[kind] = factory
+}
+
+// SinkFactories returns the registered sink kinds and their factories, in the
+// order they were first registered
+func SinkFactories() ([]string, []SinkFactory) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	kinds := append([]string(nil), registry.sinkOrder...)
+	factories := make([]SinkFactory, len(kinds))
+	for i, kind := range kinds {
+		factories[i] = registry.sinks[kind]
+	}
+	return kinds, factories
+}
@@ -0,0 +1,40 @@
+package backend
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRegisterStoreReplacesByName(t *testing.T) {
+	first := errors.New("first")
+	second := errors.New("second")
+	RegisterStore("test", func(Host) (EventStore, error) { return nil, first })
+	RegisterStore("test", func(Host) (EventStore, error) { return nil, second })
+
+	factory, found := LookupStore("test")
+	if !found {
+		t.Fatal("store not registered")
+	}
+	if _, err := factory(nil); err != second {
+		t.Errorf("got %v from the store factory, want the second", err)
+	}
+	if _, found := LookupStore("missing"); found {
+		t.Error("found a store that was never registered")
+	}
+}
+
+func TestSinkFactoriesKeepRegistrationOrder(t *testing.T) {
+	replaced := errors.New("replaced")
+	RegisterSinkFactory("test-b", func(Host) ([]EventSink, error) { return nil, nil })
+	RegisterSinkFactory("test-a", func(Host) ([]EventSink, error) { return nil, nil })
+	RegisterSinkFactory("test-b", func(Host) ([]EventSink, error) { return nil, replaced })
+
+	kinds, factories := SinkFactories()
+	if !reflect.DeepEqual(kinds, []string{"test-b", "test-a"}) {
+		t.Fatalf("got kinds %v, want them in first registration order", kinds)
+	}
+	if _, err := factories[0](nil); err != replaced {
+		t.Errorf("got %v from test-b, want the replacement factory", err)
+	}
+}
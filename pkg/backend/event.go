@@ -0,0 +1,101 @@
+package backend
+
+import "time"
+
+// Event represents an analytics event with Snowplow schema structure
+type Event struct {
+	ID         int                      `json:"id"`
+	Schema     string                   `json:"schema"`
+	Data       []map[string]interface{} `json:"data"`
+	Timestamp  time.Time                `json:"timestamp"`
+	ReceivedAt time.Time                `json:"receivedAt"`
+	// EventSchema is the schema of the event's own item, derived from its ue_pr
+	// or ue_px payload or its e type, where Schema is the payload_data envelope
+	// it arrived in
+	EventSchema string `json:"eventSchema,omitempty"`
+	// Source labels events that were pushed from another goplow instance
+	Source string `json:"source,omitempty"`
+	// Namespace is the ingest endpoint path the event was received on
+	Namespace string `json:"namespace,omitempty"`
+	// Enriched holds fields derived by enrichments, named after the Snowplow
+	// atomic event columns (e.g. user_ipaddress, geo_country)
+	Enriched map[string]interface{} `json:"enriched,omitempty"`
+	// Violations lists where the event's self-describing data breaks its schemas
+	Violations []Violation `json:"violations,omitempty"`
+	// DeviceTimestamp is the derived device-side time of the event (from dtm/stm)
+	DeviceTimestamp *time.Time `json:"deviceTimestamp,omitempty"`
+	// OutOfOrder flags events that arrived well after later device-timestamped events
+	OutOfOrder bool `json:"outOfOrder,omitempty"`
+	// Session is the capture session that was active when the event arrived
+	Session *Session `json:"session,omitempty"`
+	// Trace is the W3C trace context of the request or context entity that
+	// produced the event, linking it to a distributed trace
+	Trace *TraceContext `json:"trace,omitempty"`
+	// RunID is the value of the run_id_header of the request that sent the
+	// event, such as a CI job ID
+	RunID string `json:"runId,omitempty"`
+	// Batch places the event in the tracker batch it was flushed in, for events
+	// split from a data array
+	Batch *BatchPosition `json:"batch,omitempty"`
+	// Summary is the one-line description rendered by the schema's summary template
+	Summary string `json:"summary,omitempty"`
+	// Classification lists the labels of the classification rules the event
+	// matched, such as "checkout"
+	Classification []string `json:"classification,omitempty"`
+	// ItemBytes holds the size of each Data item in the request it arrived in,
+	// where the ingest path knows it; other items are sized by encoding them
+	ItemBytes []int `json:"-"`
+	// RawData holds the untransformed payload when it should be sent alongside the display data
+	RawData []map[string]interface{} `json:"-"`
+	// UnwrapSingleItem indicates whether to display single-item arrays as a single object
+	UnwrapSingleItem bool `json:"-"`
+	// Mirrored is set for events copied from another goplow instance with the
+	// fields it derived from the client's request, which are not derived again
+	Mirrored bool `json:"-"`
+}
+
+// BatchPosition places an event in the tracker batch it was flushed in
+type BatchPosition struct {
+	ID string `json:"id"`
+	// Index is the event's position in the batch's data array, from 0
+	Index int `json:"index"`
+	// Size is the number of items in the batch, including any that were
+	// rejected or suppressed; it is only known once the whole batch has been
+	// read, so events stored and broadcast while it streams in have none
+	Size int `json:"size,omitempty"`
+}
+
+// Session is a named capture session, recorded with every event received while it is active
+type Session struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	// Metadata holds any extra details given when the session started, such as a build number
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// TraceContext is the W3C trace context (traceparent) an event was produced under
+type TraceContext struct {
+	TraceID  string `json:"traceId"`
+	ParentID string `json:"parentId"`
+	Sampled  bool   `json:"sampled"`
+}
+
+// Violation describes one way an event's self-describing data breaks its schema
+type Violation struct {
+	// Schema is the Iglu URI of the schema that was violated
+	Schema string `json:"schema"`
+	// Location identifies the self-describing JSON within the tracker payload,
+	// e.g. "ue_px" or "cx[1]", prefixed with the payload index for batched events
+	Location string `json:"location"`
+	// Pointer is the JSON pointer of the offending value within the schema's data
+	Pointer string `json:"pointer"`
+	// Keyword is the schema keyword that failed, e.g. "type" or "required"
+	Keyword string `json:"keyword"`
+	// Expected is the keyword's value in the schema, e.g. "string" for a type violation
+	Expected interface{} `json:"expected,omitempty"`
+	// Value is the offending value, if present
+	Value   interface{} `json:"value,omitempty"`
+	Message string      `json:"message"`
+}
@@ -0,0 +1,61 @@
+package backend
+
+import (
+	"context"
+	"time"
+)
+
+// DeadLetter is an event a sink gave up on after using all its delivery attempts
+type DeadLetter struct {
+	ID       int       `json:"id"`
+	Event    Event     `json:"event"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// SinkStatus is a snapshot of a sink's delivery health
+type SinkStatus struct {
+	Name string `json:"name"`
+	// Connected is false while the latest delivery attempt failed; LastError
+	// is kept after the sink recovers
+	Connected bool   `json:"connected"`
+	LastError string `json:"lastError,omitempty"`
+	// LastErrorAt and LastDeliveredAt are nil until the first failure and delivery
+	LastErrorAt     *time.Time `json:"lastErrorAt,omitempty"`
+	LastDeliveredAt *time.Time `json:"lastDeliveredAt,omitempty"`
+	QueueDepth      int        `json:"queueDepth"`
+	SpilledBytes    int64      `json:"spilledBytes"`
+	Delivered       int64      `json:"delivered"`
+	Failed          int64      `json:"failed"`
+	DeadLetters     int        `json:"deadLetters"`
+}
+
+// Sink is a destination events are delivered to, such as the aggregator forwarder
+type Sink interface {
+	Name() string
+	// Status reports whether the sink's target is reachable and its backlog
+	Status() SinkStatus
+	// DeadLetters returns the events the sink gave up on, oldest first
+	DeadLetters() []DeadLetter
+	// Redeliver queues the dead letters with the given IDs, or all of them if
+	// ids is empty, for delivery again and returns how many were queued
+	Redeliver(ids []int) int
+}
+
+// EventSink is a Sink that is sent every new event and delivers it from Run,
+// such as the aggregator forwarder or a notification
+type EventSink interface {
+	Sink
+	// Send queues an event for delivery; it is called while the buffer is
+	// locked, so it must not block
+	Send(event Event)
+	// Run delivers queued events until the context is cancelled
+	Run(ctx context.Context)
+	// Close delivers the events still queued until the context is done
+	Close(ctx context.Context) error
+}
+
+// SinkFactory builds the sinks of one kind for a server, returning none when
+// that kind is not configured
+type SinkFactory func(host Host) ([]EventSink, error)
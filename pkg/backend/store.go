@@ -0,0 +1,23 @@
+package backend
+
+import "time"
+
+// EventStore persists the event buffer, so it survives restarts
+type EventStore interface {
+	// Append stores an event; IDs must be increasing
+	Append(event Event) error
+	// ScanByID returns the stored events with from <= ID <= to, in ID order
+	ScanByID(from int, to int) ([]Event, error)
+	// ScanByTime returns the stored events received in [from, to), in ID order
+	ScanByTime(from time.Time, to time.Time) ([]Event, error)
+	// DeleteBefore removes the events with IDs below id
+	DeleteBefore(id int) error
+	// Delete removes the events with the given IDs
+	Delete(ids []int) error
+	// LastID returns the highest stored ID, or 0 if the store is empty
+	LastID() int
+	Close() error
+}
+
+// StoreFactory opens an event store for a server
+type StoreFactory func(host Host) (EventStore, error)
@@ -0,0 +1,65 @@
+package collector
+
+import "goplow/pkg/events"
+
+// Schema keys of the consent events and context entities
+const (
+	gdprContextSchema      = "com.snowplowanalytics.snowplow/gdpr"
+	consentDocumentSchema  = "com.snowplowanalytics.snowplow/consent_document"
+	consentPreferences     = "com.snowplowanalytics.snowplow/consent_preferences"
+	consentGrantedSchema   = "com.snowplowanalytics.snowplow/consent_granted"
+	consentWithdrawnSchema = "com.snowplowanalytics.snowplow/consent_withdrawn"
+)
+
+// ConsentSummary returns the consent state of a tracker payload, from its gdpr
+// and consent_document entities (contexts, as from events.DecodeContexts) and
+// any consent event, or nil if there is none
+func ConsentSummary(item map[string]interface{}, contexts []events.Entity) map[string]interface{} {
+	summary := map[string]interface{}{}
+
+	for _, context := range contexts {
+		switch events.SchemaKey(context.Schema) {
+		case gdprContextSchema:
+			copyField(summary, "basis", context.Data, "basisForProcessing")
+			copyField(summary, "document_id", context.Data, "documentId")
+			copyField(summary, "document_version", context.Data, "documentVersion")
+			copyField(summary, "document_description", context.Data, "documentDescription")
+		case consentDocumentSchema:
+			document := map[string]interface{}{}
+			copyField(document, "id", context.Data, "id")
+			copyField(document, "version", context.Data, "version")
+			copyField(document, "name", context.Data, "name")
+			documents, _ := summary["documents"].([]map[string]interface{})
+			summary["documents"] = append(documents, document)
+		}
+	}
+
+	if schema, data, ok := events.SelfDescribingEvent(item); ok {
+		switch events.SchemaKey(schema) {
+		case consentPreferences:
+			copyField(summary, "preference", data, "eventType")
+			copyField(summary, "scopes", data, "consentScopes")
+			copyField(summary, "gdpr_applies", data, "gdprApplies")
+			if _, ok := summary["basis"]; !ok {
+				copyField(summary, "basis", data, "basisForProcessing")
+			}
+		case consentGrantedSchema:
+			summary["preference"] = "granted"
+			copyField(summary, "expiry", data, "expiry")
+		case consentWithdrawnSchema:
+			summary["preference"] = "withdrawn"
+			copyField(summary, "withdraw_all", data, "all")
+		}
+	}
+
+	if len(summary) == 0 {
+		return nil
+	}
+	return summary
+}
+
+// transformConsentEvent transforms the consent_preferences, consent_granted and
+// consent_withdrawn events
+func transformConsentEvent(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Consent"
+}
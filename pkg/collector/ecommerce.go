@@ -0,0 +1,74 @@
+package collector
+
+import "goplow/pkg/events"
+
+// ecommerceVendor is the Iglu vendor of the Snowplow ecommerce action and entity schemas
+const ecommerceVendor = "com.snowplowanalytics.snowplow.ecommerce"
+
+// transformEcommerceAction transforms a Snowplow ecommerce action into a summary
+// of the action, its products, cart, checkout step and transaction
+func transformEcommerceAction(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Ecommerce Action"
+	copyField(result, "action", data, "type")
+	copyField(result, "list_name", data, "name")
+
+	var products []map[string]interface{}
+	for _, context := range events.DecodeContexts(item) {
+		switch events.SchemaKey(context.Schema) {
+		case ecommerceVendor + "/product":
+			products = append(products, summarizeProduct(context.Data))
+		case ecommerceVendor + "/cart":
+			cart := map[string]interface{}{}
+			copyField(cart, "id", context.Data, "cart_id")
+			copyField(cart, "total", context.Data, "total_value")
+			copyField(cart, "currency", context.Data, "currency")
+			result["cart"] = cart
+		case ecommerceVendor + "/checkout_step":
+			step := map[string]interface{}{}
+			copyField(step, "step", context.Data, "step")
+			copyField(step, "delivery_method", context.Data, "delivery_method")
+			copyField(step, "payment_method", context.Data, "payment_method")
+			copyField(step, "shipping_postcode", context.Data, "shipping_postcode")
+			result["checkout_step"] = step
+		case ecommerceVendor + "/transaction":
+			transaction := map[string]interface{}{}
+			copyField(transaction, "id", context.Data, "transaction_id")
+			copyField(transaction, "revenue", context.Data, "revenue")
+			copyField(transaction, "currency", context.Data, "currency")
+			copyField(transaction, "payment_method", context.Data, "payment_method")
+			copyField(transaction, "total_quantity", context.Data, "total_quantity")
+			copyField(transaction, "tax", context.Data, "tax")
+			copyField(transaction, "shipping", context.Data, "shipping")
+			result["transaction"] = transaction
+		case ecommerceVendor + "/refund":
+			refund := map[string]interface{}{}
+			copyField(refund, "transaction_id", context.Data, "transaction_id")
+			copyField(refund, "amount", context.Data, "refund_amount")
+			copyField(refund, "currency", context.Data, "currency")
+			copyField(refund, "reason", context.Data, "refund_reason")
+			result["refund"] = refund
+		case ecommerceVendor + "/promotion":
+			promotion := map[string]interface{}{}
+			copyField(promotion, "id", context.Data, "id")
+			copyField(promotion, "name", context.Data, "name")
+			copyField(promotion, "slot", context.Data, "slot")
+			result["promotion"] = promotion
+		}
+	}
+	if len(products) > 0 {
+		result["products"] = products
+	}
+}
+
+// summarizeProduct returns the fields of a product entity shown in the summary
+func summarizeProduct(data map[string]interface{}) map[string]interface{} {
+	product := map[string]interface{}{}
+	copyField(product, "id", data, "id")
+	copyField(product, "name", data, "name")
+	copyField(product, "category", data, "category")
+	copyField(product, "price", data, "price")
+	copyField(product, "currency", data, "currency")
+	copyField(product, "quantity", data, "quantity")
+	copyField(product, "variant", data, "variant")
+	return product
+}
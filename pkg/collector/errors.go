@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ApplicationErrorSchema is used by the JavaScript error tracking plugin and mobile exception tracking
+const ApplicationErrorSchema = "com.snowplowanalytics.snowplow/application_error"
+
+// transformApplicationError transforms an application_error event, splitting the
+// stack trace into lines so it renders readably
+func transformApplicationError(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Application Error"
+	copyField(result, "message", data, "message")
+	copyField(result, "exception", data, "exceptionName")
+	copyField(result, "fatal", data, "isFatal")
+	copyField(result, "language", data, "programmingLanguage")
+	copyField(result, "class_name", data, "className")
+	copyField(result, "thread", data, "threadName")
+	if location := errorLocation(data); location != "" {
+		result["location"] = location
+	}
+	if stack, ok := data["stackTrace"].(string); ok && stack != "" {
+		result["stack_trace"] = strings.Split(strings.TrimRight(stack, "\n"), "\n")
+	}
+	if cause, ok := data["causeStackTrace"].(string); ok && cause != "" {
+		result["cause_stack_trace"] = strings.Split(strings.TrimRight(cause, "\n"), "\n")
+	}
+}
+
+// errorLocation formats the file, line and column of an application error
+func errorLocation(data map[string]interface{}) string {
+	file, _ := data["fileName"].(string)
+	if file == "" {
+		return ""
+	}
+	location := file
+	if line, ok := data["lineNumber"]; ok {
+		location += fmt.Sprintf(":%v", line)
+		if column, ok := data["lineColumn"]; ok {
+			location += fmt.Sprintf(":%v", column)
+		}
+	}
+	return location
+}
@@ -0,0 +1,76 @@
+package collector
+
+// Schemas of the link click, form tracking and button click plugin events
+const (
+	linkClickSchema   = "com.snowplowanalytics.snowplow/link_click"
+	submitFormSchema  = "com.snowplowanalytics.snowplow/submit_form"
+	changeFormSchema  = "com.snowplowanalytics.snowplow/change_form"
+	focusFormSchema   = "com.snowplowanalytics.snowplow/focus_form"
+	buttonClickSchema = "com.snowplowanalytics.snowplow/button_click"
+)
+
+// transformLinkClick transforms a link_click event
+func transformLinkClick(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Link Click"
+	copyField(result, "target_url", data, "targetUrl")
+	copyField(result, "element_id", data, "elementId")
+	copyField(result, "element_classes", data, "elementClasses")
+	copyField(result, "element_target", data, "elementTarget")
+	copyField(result, "element_content", data, "elementContent")
+}
+
+// transformSubmitForm transforms a submit_form event, listing each form element's value
+func transformSubmitForm(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Form Submit"
+	copyField(result, "form_id", data, "formId")
+	copyField(result, "form_classes", data, "formClasses")
+
+	elements, _ := data["elements"].([]interface{})
+	fields := make([]map[string]interface{}, 0, len(elements))
+	for _, raw := range elements {
+		element, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		field := map[string]interface{}{}
+		copyField(field, "name", element, "name")
+		copyField(field, "value", element, "value")
+		copyField(field, "node_name", element, "nodeName")
+		copyField(field, "type", element, "type")
+		fields = append(fields, field)
+	}
+	if len(fields) > 0 {
+		result["elements"] = fields
+	}
+}
+
+// transformChangeForm transforms a change_form event
+func transformChangeForm(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Form Change"
+	addFormElementFields(data, result)
+}
+
+// transformFocusForm transforms a focus_form event
+func transformFocusForm(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Form Focus"
+	addFormElementFields(data, result)
+}
+
+// addFormElementFields copies the element fields shared by change_form and focus_form
+func addFormElementFields(data map[string]interface{}, result map[string]interface{}) {
+	copyField(result, "form_id", data, "formId")
+	copyField(result, "element_id", data, "elementId")
+	copyField(result, "node_name", data, "nodeName")
+	copyField(result, "type", data, "type")
+	copyField(result, "element_classes", data, "elementClasses")
+	copyField(result, "value", data, "value")
+}
+
+// transformButtonClick transforms a button_click event
+func transformButtonClick(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Button Click"
+	copyField(result, "label", data, "label")
+	copyField(result, "element_id", data, "id")
+	copyField(result, "element_classes", data, "classes")
+	copyField(result, "name", data, "name")
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"strings"
+
+	"goplow/pkg/events"
+)
+
+// Schemas of the media tracking events and context entities
+const (
+	// mediaVendor holds the v2 media events, one schema per event type (play_event, pause_event...)
+	mediaVendor = "com.snowplowanalytics.snowplow.media"
+	// mediaPlayerEventSchema is the v1 media event, with the event type in its data
+	mediaPlayerEventSchema = "com.snowplowanalytics.snowplow/media_player_event"
+	mediaPlayerSchema      = "com.snowplowanalytics.snowplow/media_player"
+	mediaSessionSchema     = mediaVendor + "/session"
+)
+
+// MediaEvent describes a tracker payload that is a media event
+type MediaEvent struct {
+	// Type is the media event type, such as "play" or "pause"
+	Type      string
+	SessionID string
+	Label     string
+	// Player is the media_player entity
+	Player map[string]interface{}
+}
+
+// ParseMediaEvent returns the media event details of a tracker payload, from
+// its v1 media_player_event or v2 media event and media entities
+func ParseMediaEvent(item map[string]interface{}) (MediaEvent, bool) {
+	schema, data, ok := events.SelfDescribingEvent(item)
+	if !ok {
+		return MediaEvent{}, false
+	}
+
+	var media MediaEvent
+	key := events.SchemaKey(schema)
+	switch {
+	case key == mediaPlayerEventSchema:
+		media.Type, _ = data["type"].(string)
+		media.Label, _ = data["label"].(string)
+	case strings.HasPrefix(key, mediaVendor+"/"):
+		media.Type = strings.TrimSuffix(strings.TrimPrefix(key, mediaVendor+"/"), "_event")
+	default:
+		return MediaEvent{}, false
+	}
+
+	for _, context := range events.DecodeContexts(item) {
+		switch events.SchemaKey(context.Schema) {
+		case mediaPlayerSchema:
+			media.Player = context.Data
+			if label, ok := context.Data["label"].(string); ok && media.Label == "" {
+				media.Label = label
+			}
+		case mediaSessionSchema:
+			media.SessionID, _ = context.Data["mediaSessionId"].(string)
+		}
+	}
+
+	// v1 events have no session entity, so group them by player label
+	if media.SessionID == "" {
+		media.SessionID = media.Label
+	}
+	if media.SessionID == "" {
+		media.SessionID = "unknown"
+	}
+	return media, true
+}
+
+// transformMediaEvent transforms a media player event
+func transformMediaEvent(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Media Event"
+	media, ok := ParseMediaEvent(item)
+	if !ok {
+		return
+	}
+	result["media_event"] = media.Type
+	result["media_session"] = media.SessionID
+	if media.Label != "" {
+		result["media_label"] = media.Label
+	}
+	copyField(result, "current_time", media.Player, "currentTime")
+	copyField(result, "duration", media.Player, "duration")
+	copyField(result, "percent_progress", media.Player, "percentProgress")
+	copyField(result, "paused", media.Player, "paused")
+	copyField(result, "playback_rate", media.Player, "playbackRate")
+}
@@ -0,0 +1,45 @@
+package collector
+
+import (
+	"fmt"
+
+	"goplow/pkg/events"
+)
+
+// Schemas of the device, session and screen context entities sent by mobile trackers
+const (
+	mobileContextSchema      = "com.snowplowanalytics.snowplow/mobile_context"
+	clientSessionSchema      = "com.snowplowanalytics.snowplow/client_session"
+	screenContextSchema      = "com.snowplowanalytics.mobile/screen"
+	applicationContextSchema = "com.snowplowanalytics.mobile/application"
+)
+
+// addMobileContextFields copies the commonly checked fields of mobile context
+// entities to top-level fields of result
+func addMobileContextFields(contexts []events.Entity, result map[string]interface{}) {
+	for _, context := range contexts {
+		switch events.SchemaKey(context.Schema) {
+		case mobileContextSchema:
+			copyField(result, "os", context.Data, "osType")
+			copyField(result, "os_version", context.Data, "osVersion")
+			if manufacturer, ok := context.Data["deviceManufacturer"]; ok {
+				result["device_model"] = fmt.Sprintf("%v %v", manufacturer, context.Data["deviceModel"])
+			} else {
+				copyField(result, "device_model", context.Data, "deviceModel")
+			}
+			copyField(result, "carrier", context.Data, "carrier")
+			copyField(result, "network_type", context.Data, "networkType")
+		case clientSessionSchema:
+			copyField(result, "session_id", context.Data, "sessionId")
+			copyField(result, "session_index", context.Data, "sessionIndex")
+			copyField(result, "event_index", context.Data, "eventIndex")
+			copyField(result, "user_id", context.Data, "userId")
+		case screenContextSchema:
+			copyField(result, "current_screen", context.Data, "name")
+			copyField(result, "current_screen_id", context.Data, "id")
+		case applicationContextSchema:
+			copyField(result, "app_version", context.Data, "version")
+			copyField(result, "app_build", context.Data, "build")
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Package collector parses Snowplow tracker requests and renders their events
+// for display, as the goplow collector does, for Go tools that handle tracker
+// payloads without running a server
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotObject is returned when a tracker request body is not a JSON object
+var ErrNotObject = errors.New("payload must be a JSON object")
+
+// Payload is a decoded Snowplow payload_data request body
+type Payload struct {
+	// Schema is the payload_data envelope schema
+	Schema string
+	// HasSchema is set if the payload has a string schema field
+	HasSchema bool
+	// HasData is set if the payload has a data field
+	HasData bool
+	// Single is set when data is one object rather than an array
+	Single bool
+	// InvalidData is set when data is neither an object nor an array
+	InvalidData bool
+	// Items are the objects in data; array elements that are not objects are
+	// skipped. ParsePayloadFunc leaves it empty, handing each on instead
+	Items []map[string]interface{}
+}
+
+// PayloadItem is an object of a payload's data, handed on as it is decoded
+type PayloadItem struct {
+	// Schema is the payload_data envelope schema
+	Schema string
+	// Index is the item's position among the objects of data, from 0
+	Index int
+	// Single is set when data is one object rather than an array
+	Single bool
+	Data   map[string]interface{}
+	// Bytes is the size of the item's JSON in the request body, counting the
+	// separator and whitespace before it
+	Bytes int
+}
+
+// ParsePayload reads a tracker request body, decoding the data array one item
+// at a time as it streams in, so large mobile batches are never held as a
+// generic document alongside their events
+// Payloads missing their schema or data are returned without error, with
+// HasSchema or HasData unset, so callers can report what is wrong
+func ParsePayload(r io.Reader) (Payload, error) {
+	var items []map[string]interface{}
+	parser, err := parsePayload(r, func(item PayloadItem) error {
+		items = append(items, item.Data)
+		return nil
+	})
+	// Without a schema the items are still held
+	for _, item := range parser.held {
+		items = append(items, item.Data)
+	}
+	parser.payload.Items = items
+	return parser.payload, err
+}
+
+// ParsePayloadFunc is ParsePayload calling emit with each object of data as
+// soon as it is decoded instead of collecting them in Items, so a batch can be
+// processed while the rest of it is still being read
+// Objects decoded before the schema field are held until it is read, and
+// never emitted if the payload has no string schema; an error from emit stops
+// the parse and is returned
+func ParsePayloadFunc(r io.Reader, emit func(PayloadItem) error) (Payload, error) {
+	parser, err := parsePayload(r, emit)
+	return parser.payload, err
+}
+
+// parsePayload decodes a payload, emitting its items, and returns the parser
+// with the payload's fields and any items still held
+func parsePayload(r io.Reader, emit func(PayloadItem) error) (*payloadParser, error) {
+	parser := &payloadParser{decoder: json.NewDecoder(r), emit: emit}
+	payload := &parser.payload
+
+	if err := expectDelim(parser.decoder, '{'); err != nil {
+		return parser, err
+	}
+	for parser.decoder.More() {
+		token, err := parser.decoder.Token()
+		if err != nil {
+			return parser, err
+		}
+		key, _ := token.(string)
+
+		switch key {
+		case "schema":
+			var schema interface{}
+			if err := parser.decoder.Decode(&schema); err != nil {
+				return parser, err
+			}
+			payload.Schema, payload.HasSchema = schema.(string)
+			if err := parser.flush(); err != nil {
+				return parser, err
+			}
+		case "data":
+			payload.HasData = true
+			if err := parser.decodeData(); err != nil {
+				return parser, err
+			}
+		default:
+			var skipped json.RawMessage
+			if err := parser.decoder.Decode(&skipped); err != nil {
+				return parser, err
+			}
+		}
+	}
+	return parser, expectDelim(parser.decoder, '}')
+}
+
+// payloadParser decodes a payload, emitting its items
+type payloadParser struct {
+	decoder *json.Decoder
+	emit    func(PayloadItem) error
+	payload Payload
+	// held are the items decoded before the schema
+	held  []PayloadItem
+	count int
+}
+
+// item emits a decoded item read from the body since offset start, or holds
+// it until the schema has been read
+func (p *payloadParser) item(data map[string]interface{}, start int64) error {
+	item := PayloadItem{Index: p.count, Single: p.payload.Single, Data: data, Bytes: int(p.decoder.InputOffset() - start)}
+	p.count++
+	if !p.payload.HasSchema {
+		p.held = append(p.held, item)
+		return nil
+	}
+	item.Schema = p.payload.Schema
+	return p.emit(item)
+}
+
+// flush emits the items held until the schema was read
+func (p *payloadParser) flush() error {
+	if !p.payload.HasSchema {
+		return nil
+	}
+	held := p.held
+	p.held = nil
+	for _, item := range held {
+		item.Schema = p.payload.Schema
+		if err := p.emit(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeData reads the data field: an array of items, decoded one at a time,
+// or a single item
+func (p *payloadParser) decodeData() error {
+	p.payload.Single, p.payload.InvalidData = false, false
+
+	start := p.decoder.InputOffset()
+	token, err := p.decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch token {
+	case json.Delim('['):
+		for p.decoder.More() {
+			start := p.decoder.InputOffset()
+			var element interface{}
+			if err := p.decoder.Decode(&element); err != nil {
+				return err
+			}
+			if item, ok := element.(map[string]interface{}); ok {
+				if err := p.item(item, start); err != nil {
+					return err
+				}
+			}
+		}
+		return expectDelim(p.decoder, ']')
+	case json.Delim('{'):
+		item, err := decodeObjectBody(p.decoder)
+		if err != nil {
+			return err
+		}
+		p.payload.Single = true
+		return p.item(item, start)
+	default:
+		// A scalar or null, which Token has already consumed
+		p.payload.InvalidData = true
+		return nil
+	}
+}
+
+// decodeObjectBody reads the members of an object whose opening brace has been read
+func decodeObjectBody(decoder *json.Decoder) (map[string]interface{}, error) {
+	object := make(map[string]interface{})
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := token.(string)
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		object[key] = value
+	}
+	return object, expectDelim(decoder, '}')
+}
+
+// expectDelim reads the next token, which must be the given delimiter
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		if delim == '{' {
+			return ErrNotObject
+		}
+		return fmt.Errorf("expected %q, got %v", delim, token)
+	}
+	return nil
+}
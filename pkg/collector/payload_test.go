@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParsePayloadFuncEmitsItemsAsDecoded(t *testing.T) {
+	body := `{"schema":"s","data":[{"e":"pv"},1,{"e":"pp"},{"e":"se"}]}`
+	reader := &countingReader{r: strings.NewReader(body)}
+
+	var items []PayloadItem
+	var readAtEmit []int
+	payload, err := ParsePayloadFunc(reader, func(item PayloadItem) error {
+		items = append(items, item)
+		readAtEmit = append(readAtEmit, reader.read)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !payload.HasSchema || !payload.HasData || payload.Single || len(payload.Items) != 0 {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+	if len(items) != 3 {
+		t.Fatalf("emitted %d items, want 3", len(items))
+	}
+	for i, item := range items {
+		if item.Index != i || item.Schema != "s" || item.Single {
+			t.Errorf("item %d: unexpected %+v", i, item)
+		}
+	}
+	// The reader is read a byte at a time, so earlier items are emitted
+	// before the body has been read to the end
+	if readAtEmit[0] >= len(body) {
+		t.Errorf("first item emitted after reading %d of %d bytes", readAtEmit[0], len(body))
+	}
+}
+
+func TestParsePayloadFuncHoldsItemsUntilSchema(t *testing.T) {
+	var schemas []string
+	_, err := ParsePayloadFunc(strings.NewReader(`{"data":[{"e":"pv"},{"e":"pp"}],"schema":"s"}`), func(item PayloadItem) error {
+		schemas = append(schemas, item.Schema)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) != 2 || schemas[0] != "s" || schemas[1] != "s" {
+		t.Errorf("unexpected schemas %v", schemas)
+	}
+
+	emitted := 0
+	payload, err := ParsePayloadFunc(strings.NewReader(`{"data":[{"e":"pv"}]}`), func(PayloadItem) error {
+		emitted++
+		return nil
+	})
+	if err != nil || payload.HasSchema || emitted != 0 {
+		t.Errorf("payload without schema: emitted %d, %+v, %v", emitted, payload, err)
+	}
+}
+
+func TestParsePayloadFuncStopsOnEmitError(t *testing.T) {
+	stop := errors.New("stop")
+	emitted := 0
+	_, err := ParsePayloadFunc(strings.NewReader(`{"schema":"s","data":[{"e":"pv"},{"e":"pp"}]}`), func(PayloadItem) error {
+		emitted++
+		return stop
+	})
+	if !errors.Is(err, stop) || emitted != 1 {
+		t.Errorf("got %v after %d items", err, emitted)
+	}
+}
+
+func TestParsePayloadCollectsItems(t *testing.T) {
+	payload, err := ParsePayload(strings.NewReader(`{"data":{"e":"pv"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.HasSchema || !payload.Single || len(payload.Items) != 1 {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+
+	if _, err := ParsePayload(strings.NewReader(`[]`)); !errors.Is(err, ErrNotObject) {
+		t.Errorf("got %v for an array, want ErrNotObject", err)
+	}
+}
+
+// countingReader reads a byte at a time, counting the bytes read
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestParsePayloadFuncSizesItems(t *testing.T) {
+	first, second := `{"e":"pv","url":"https://shop.acme.com/"}`, `{"e":"pp"}`
+	var sizes []int
+	_, err := ParsePayloadFunc(strings.NewReader(`{"schema":"s","data":[`+first+`, `+second+`]}`), func(item PayloadItem) error {
+		sizes = append(sizes, item.Bytes)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second item counts the comma and space before it
+	if len(sizes) != 2 || sizes[0] != len(first) || sizes[1] != len(second)+2 {
+		t.Errorf("got sizes %v, want [%d %d]", sizes, len(first), len(second)+2)
+	}
+
+	var single int
+	ParsePayloadFunc(strings.NewReader(`{"schema":"s","data":`+first+`}`), func(item PayloadItem) error {
+		single = item.Bytes
+		return nil
+	})
+	if single < len(first) || single > len(first)+1 {
+		t.Errorf("got size %d for a single item of %d bytes", single, len(first))
+	}
+}
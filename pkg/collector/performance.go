@@ -0,0 +1,63 @@
+package collector
+
+import "goplow/pkg/events"
+
+// Schemas of the web vitals event and performance timing entities
+const (
+	webVitalsSchema             = "com.snowplowanalytics.snowplow/web_vitals"
+	performanceTimingSchema     = "org.w3/PerformanceTiming"
+	performanceNavigationSchema = "org.w3/PerformanceNavigationTiming"
+)
+
+// transformWebVitals transforms a web_vitals event, putting the Core Web Vitals first
+func transformWebVitals(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Web Vitals"
+	copyField(result, "lcp", data, "lcp")
+	copyField(result, "cls", data, "cls")
+	copyField(result, "inp", data, "inp")
+	copyField(result, "fcp", data, "fcp")
+	copyField(result, "fid", data, "fid")
+	copyField(result, "ttfb", data, "ttfb")
+	copyField(result, "navigation_type", data, "navigation_type")
+}
+
+// performanceSummary returns page timings in milliseconds from a tracker payload's
+// PerformanceTiming or PerformanceNavigationTiming entity, or nil if there is none
+func performanceSummary(contexts []events.Entity) map[string]interface{} {
+	for _, context := range contexts {
+		switch events.SchemaKey(context.Schema) {
+		case performanceNavigationSchema:
+			// Navigation timing values are already relative to the start of navigation
+			summary := map[string]interface{}{}
+			copyField(summary, "ttfb_ms", context.Data, "responseStart")
+			copyField(summary, "dom_content_loaded_ms", context.Data, "domContentLoadedEventEnd")
+			copyField(summary, "load_ms", context.Data, "loadEventEnd")
+			copyField(summary, "transfer_size", context.Data, "transferSize")
+			return summary
+		case performanceTimingSchema:
+			// Legacy timing values are epoch milliseconds, so subtract navigationStart
+			start, ok := numberField(context.Data, "navigationStart")
+			if !ok {
+				return nil
+			}
+			summary := map[string]interface{}{}
+			for field, name := range map[string]string{
+				"ttfb_ms":               "responseStart",
+				"dom_content_loaded_ms": "domContentLoadedEventEnd",
+				"load_ms":               "loadEventEnd",
+			} {
+				if value, ok := numberField(context.Data, name); ok && value >= start {
+					summary[field] = value - start
+				}
+			}
+			return summary
+		}
+	}
+	return nil
+}
+
+// numberField returns a numeric field from decoded JSON
+func numberField(data map[string]interface{}, field string) (float64, bool) {
+	value, ok := data[field].(float64)
+	return value, ok
+}
@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"strings"
+
+	"goplow/pkg/events"
+)
+
+// schemaTransform adds friendly fields for a self-describing event's data to result
+// item is the full tracker payload, for transforms that summarise its context entities
+type schemaTransform func(data map[string]interface{}, item map[string]interface{}, result map[string]interface{})
+
+// schemaTransforms maps "vendor/name" schema keys to their friendly transforms
+var schemaTransforms = map[string]schemaTransform{
+	"com.snowplowanalytics.mobile/screen_view":                           transformScreenView,
+	"com.snowplowanalytics.snowplow/screen_view":                         transformScreenView,
+	"com.snowplowanalytics.mobile/application_install":                   transformApplicationInstall,
+	"com.snowplowanalytics.snowplow/application_install":                 transformApplicationInstall,
+	"com.snowplowanalytics.snowplow/application_foreground":              transformApplicationForeground,
+	"com.snowplowanalytics.snowplow/application_background":              transformApplicationBackground,
+	"com.snowplowanalytics.mobile/deep_link_received":                    transformDeepLinkReceived,
+	"com.snowplowanalytics.snowplow/deep_link_received":                  transformDeepLinkReceived,
+	"com.snowplowanalytics.snowplow.ecommerce/snowplow_ecommerce_action": transformEcommerceAction,
+	consentPreferences:     transformConsentEvent,
+	consentGrantedSchema:   transformConsentEvent,
+	consentWithdrawnSchema: transformConsentEvent,
+	mediaPlayerEventSchema: transformMediaEvent,
+	webVitalsSchema:        transformWebVitals,
+	ApplicationErrorSchema: transformApplicationError,
+	linkClickSchema:        transformLinkClick,
+	submitFormSchema:       transformSubmitForm,
+	changeFormSchema:       transformChangeForm,
+	focusFormSchema:        transformFocusForm,
+	buttonClickSchema:      transformButtonClick,
+}
+
+// vendorTransforms maps Iglu vendors to the transform used for all of their
+// event schemas not listed in schemaTransforms
+var vendorTransforms = map[string]schemaTransform{
+	mediaVendor: transformMediaEvent,
+}
+
+// lookupSchemaTransform returns the friendly transform for a schema URI
+func lookupSchemaTransform(schema string) (schemaTransform, bool) {
+	key := events.SchemaKey(schema)
+	if transform, found := schemaTransforms[key]; found {
+		return transform, true
+	}
+	transform, found := vendorTransforms[strings.SplitN(key, "/", 2)[0]]
+	return transform, found
+}
+
+// copyField copies data[from] to result[to] when present
+func copyField(result map[string]interface{}, to string, data map[string]interface{}, from string) {
+	if v, ok := data[from]; ok {
+		result[to] = v
+	}
+}
+
+// transformScreenView transforms a mobile Screen View event
+func transformScreenView(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Screen View"
+	copyField(result, "screen_name", data, "name")
+	copyField(result, "screen_id", data, "id")
+	copyField(result, "screen_type", data, "type")
+	copyField(result, "previous_screen_name", data, "previousName")
+	copyField(result, "previous_screen_id", data, "previousId")
+	copyField(result, "transition_type", data, "transitionType")
+}
+
+// transformApplicationInstall transforms a mobile Application Install event
+func transformApplicationInstall(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Application Install"
+	result["lifecycle_state"] = "installed"
+}
+
+// transformApplicationForeground transforms a mobile Application Foreground event
+func transformApplicationForeground(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Application Foreground"
+	result["lifecycle_state"] = "foreground"
+	copyField(result, "foreground_index", data, "foregroundIndex")
+}
+
+// transformApplicationBackground transforms a mobile Application Background event
+func transformApplicationBackground(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Application Background"
+	result["lifecycle_state"] = "background"
+	copyField(result, "background_index", data, "backgroundIndex")
+}
+
+// transformDeepLinkReceived transforms a mobile Deep Link Received event
+func transformDeepLinkReceived(data map[string]interface{}, item map[string]interface{}, result map[string]interface{}) {
+	result["kind"] = "Deep Link Received"
+	copyField(result, "deep_link_url", data, "url")
+	copyField(result, "deep_link_referrer", data, "referrer")
+}
+
+// addContextSummaries adds friendly summaries of recognised context entities to result
+// The contexts are decoded once and shared by each summary, as this runs for every event
+func addContextSummaries(data map[string]interface{}, result map[string]interface{}) {
+	contexts := events.DecodeContexts(data)
+	if consent := ConsentSummary(data, contexts); consent != nil {
+		result["consent"] = consent
+	}
+	if performance := performanceSummary(contexts); performance != nil {
+		result["performance"] = performance
+	}
+	addMobileContextFields(contexts, result)
+}
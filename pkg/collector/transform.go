@@ -0,0 +1,169 @@
+package collector
+
+import "goplow/pkg/events"
+
+// Transform renders one tracker payload item for display, with friendly field
+// names in place of the tracker's parameters
+type Transform func(item map[string]interface{}) map[string]interface{}
+
+// BuiltinTransforms returns the display transforms for the standard Snowplow
+// event types, by the item's e parameter
+func BuiltinTransforms() map[string]Transform {
+	return map[string]Transform{
+		"pv": TransformPageView,
+		"pp": TransformPagePing,
+		"se": TransformStructuredEvent,
+		"ue": TransformSelfDescribingEvent,
+	}
+}
+
+// TransformEvent renders a tracker payload item for display with the built-in
+// transform for its event type; items of other types are returned unchanged
+func TransformEvent(item map[string]interface{}) map[string]interface{} {
+	eventType, _ := item["e"].(string)
+	if transform, found := BuiltinTransforms()[eventType]; found {
+		return transform(item)
+	}
+	return item
+}
+
+// TransformPageView transforms a Page View event
+func TransformPageView(data map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{
+		"kind": "Page View",
+	}
+
+	if v, ok := data["url"]; ok {
+		result["url"] = v
+	}
+	if v, ok := data["page"]; ok {
+		result["page"] = v
+	}
+	if v, ok := data["refr"]; ok {
+		result["referrer"] = v
+	}
+	if v, ok := data["tna"]; ok {
+		result["tracker"] = v
+	}
+	if v, ok := data["aid"]; ok {
+		result["app_id"] = v
+	}
+	if v, ok := data["duid"]; ok {
+		result["device_id"] = v
+	}
+	if v, ok := data["cx"]; ok {
+		result["context"] = v
+	}
+
+	addContextSummaries(data, result)
+
+	return result
+}
+
+// TransformStructuredEvent transforms a Structured Event
+func TransformStructuredEvent(data map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{
+		"kind": "Structured Event",
+	}
+
+	if v, ok := data["se_ca"]; ok {
+		result["category"] = v
+	}
+	if v, ok := data["se_ac"]; ok {
+		result["action"] = v
+	}
+	if v, ok := data["se_la"]; ok {
+		result["label"] = v
+	}
+	if v, ok := data["se_pr"]; ok {
+		if v != nil {
+			result["property"] = v
+		} else {
+			result["property"] = "N/A"
+		}
+	} else {
+		result["property"] = "N/A"
+	}
+	if v, ok := data["se_va"]; ok {
+		if v != nil {
+			result["value"] = v
+		} else {
+			result["value"] = "N/A"
+		}
+	} else {
+		result["value"] = "N/A"
+	}
+	if v, ok := data["url"]; ok {
+		result["url"] = v
+	}
+	if v, ok := data["aid"]; ok {
+		result["app_id"] = v
+	}
+	if v, ok := data["duid"]; ok {
+		result["device_id"] = v
+	}
+	if v, ok := data["cx"]; ok {
+		result["context"] = v
+	}
+
+	addContextSummaries(data, result)
+
+	return result
+}
+
+// TransformSelfDescribingEvent transforms an Unstructured (Self-Describing) Event
+func TransformSelfDescribingEvent(data map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{
+		"kind": "Self-Describing Event",
+	}
+
+	if v, ok := data["url"]; ok {
+		result["url"] = v
+	}
+	if v, ok := data["ue_px"]; ok {
+		result["payload"] = v
+	}
+	if v, ok := data["aid"]; ok {
+		result["app_id"] = v
+	}
+	if v, ok := data["duid"]; ok {
+		result["device_id"] = v
+	}
+	if v, ok := data["cx"]; ok {
+		result["context"] = v
+	}
+
+	// Recognised schemas are shown with friendly fields instead of the encoded payload
+	if schema, payload, ok := events.SelfDescribingEvent(data); ok {
+		if transform, found := lookupSchemaTransform(schema); found {
+			result["schema"] = schema
+			transform(payload, data, result)
+			delete(result, "payload")
+		}
+	}
+
+	addContextSummaries(data, result)
+
+	return result
+}
+
+// TransformPagePing transforms a Page Ping event
+func TransformPagePing(data map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{
+		"kind": "Page Ping",
+	}
+
+	copyField(result, "url", data, "url")
+	copyField(result, "page", data, "page")
+	copyField(result, "min_x_offset", data, "pp_mix")
+	copyField(result, "max_x_offset", data, "pp_max")
+	copyField(result, "min_y_offset", data, "pp_miy")
+	copyField(result, "max_y_offset", data, "pp_may")
+	copyField(result, "app_id", data, "aid")
+	copyField(result, "device_id", data, "duid")
+	copyField(result, "context", data, "cx")
+
+	addContextSummaries(data, result)
+
+	return result
+}
@@ -0,0 +1,109 @@
+// Package events decodes the self-describing JSON that Snowplow trackers embed
+// in payload items: the ue_pr/ue_px event and the co/cx context entities
+package events
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// Entity is a self-describing JSON: a schema URI and the data it describes
+type Entity struct {
+	Schema string
+	Data   map[string]interface{}
+}
+
+// SelfDescribingEvent decodes a ue event's ue_pr or ue_px payload and returns
+// the inner event's schema and data
+func SelfDescribingEvent(item map[string]interface{}) (string, map[string]interface{}, bool) {
+	encoded, _ := item["ue_pr"].(string)
+	if encoded == "" {
+		encoded, _ = item["ue_px"].(string)
+	}
+	decoded, ok := DecodeEmbeddedJSON(encoded)
+	if !ok {
+		return "", nil, false
+	}
+
+	// The payload wraps the event in an unstruct_event envelope
+	envelope, _ := decoded.(map[string]interface{})
+	inner, _ := envelope["data"].(map[string]interface{})
+	schema, _ := inner["schema"].(string)
+	data, _ := inner["data"].(map[string]interface{})
+	if schema == "" || data == nil {
+		return "", nil, false
+	}
+	return schema, data, true
+}
+
+// DecodeContexts decodes a tracker payload item's co or cx context entities,
+// skipping any without a schema or data
+func DecodeContexts(item map[string]interface{}) []Entity {
+	encoded, _ := item["co"].(string)
+	if encoded == "" {
+		encoded, _ = item["cx"].(string)
+	}
+	decoded, ok := DecodeEmbeddedJSON(encoded)
+	if !ok {
+		return nil
+	}
+
+	envelope, _ := decoded.(map[string]interface{})
+	items, _ := envelope["data"].([]interface{})
+	entities := make([]Entity, 0, len(items))
+	for _, raw := range items {
+		context, _ := raw.(map[string]interface{})
+		schema, _ := context["schema"].(string)
+		data, _ := context["data"].(map[string]interface{})
+		if schema != "" && data != nil {
+			entities = append(entities, Entity{Schema: schema, Data: data})
+		}
+	}
+	return entities
+}
+
+// SchemaKey returns the "vendor/name" part of an Iglu schema URI
+func SchemaKey(schema string) string {
+	parts := strings.Split(strings.TrimPrefix(schema, "iglu:"), "/")
+	if len(parts) < 2 {
+		return schema
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+// DecodeEmbeddedJSON decodes a string holding a JSON object or array, either
+// directly or base64/base64url-encoded as Snowplow trackers send ue_px and cx
+func DecodeEmbeddedJSON(s string) (interface{}, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, false
+	}
+
+	raw := []byte(s)
+	if s[0] != '{' && s[0] != '[' {
+		decoded, err := decodeBase64(s)
+		if err != nil {
+			return nil, false
+		}
+		raw = decoded
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, false
+	}
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return value, true
+	default:
+		return nil, false
+	}
+}
+
+// decodeBase64 accepts standard and URL-safe base64, with or without padding
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.NewReplacer("-", "+", "_", "/").Replace(s)
+	s = strings.TrimRight(s, "=")
+	return base64.RawStdEncoding.DecodeString(s)
+}